@@ -14,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elbv2"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/hashicorp/go-cleanhttp"
@@ -34,6 +35,7 @@ type AWS struct {
 	autoscalingConn *autoscaling.AutoScaling
 	ec2Conn         *ec2.EC2
 	elbConn         *elb.ELB
+	elbv2Conn       *elbv2.ELBV2
 	s3Conn          *s3.S3
 	stsConn         *sts.STS
 }
@@ -60,6 +62,7 @@ func NewAWS(profileName string, region string) *AWS {
 		autoscalingConn: autoscaling.New(sess),
 		ec2Conn:         ec2.New(sess),
 		elbConn:         elb.New(sess),
+		elbv2Conn:       elbv2.New(sess),
 		stsConn:         sts.New(sess),
 		s3Conn:          s3.New(sess),
 	}
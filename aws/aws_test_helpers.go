@@ -14,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elbv2"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/sts"
 )
@@ -23,6 +24,7 @@ type MockedAWSInput struct {
 	AutoscalingSess *session.Session
 	Ec2Sess         *session.Session
 	ElbSess         *session.Session
+	Elbv2Sess       *session.Session
 	StsSess         *session.Session
 	S3Sess          *session.Session
 }
@@ -40,6 +42,9 @@ func MockedAWS(input *MockedAWSInput) *AWS {
 	if input.ElbSess != nil {
 		a.elbConn = elb.New(input.ElbSess)
 	}
+	if input.Elbv2Sess != nil {
+		a.elbv2Conn = elbv2.New(input.Elbv2Sess)
+	}
 	if input.StsSess != nil {
 		a.stsConn = sts.New(input.StsSess)
 	}
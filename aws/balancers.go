@@ -0,0 +1,109 @@
+package aws
+
+import (
+	"fmt"
+)
+
+// Functions below treat classic ELBs and ALB/NLB target groups the same way,
+// so that traffic commands don't need to care which ones an app uses.
+
+// GetAllBalancersForApp discovers both ELBs and target groups by the "App" tag
+func (a *AWS) GetAllBalancersForApp(appName string) ([]*Balancer, error) {
+	names, err := a.GetBalancersForApp(appName)
+	if err != nil {
+		return nil, err
+	}
+	var balancers []*Balancer
+	for _, name := range names {
+		balancers = append(balancers, &Balancer{Name: name, Type: BalancerTypeELB})
+	}
+
+	targetGroups, err := a.GetTargetGroupsForApp(appName)
+	if err != nil {
+		return nil, err
+	}
+	return append(balancers, targetGroups...), nil
+}
+
+// GetAllBalancersFromScalingGroup returns both ELBs and target groups attached to a given ASG
+func (a *AWS) GetAllBalancersFromScalingGroup(scalingGroup string) ([]*Balancer, error) {
+	balancers, err := a.GetBalancersFromScalingGroup(scalingGroup)
+	if err != nil {
+		return nil, err
+	}
+	targetGroups, err := a.GetTargetGroupsFromScalingGroup(scalingGroup)
+	if err != nil {
+		return nil, err
+	}
+	return append(balancers, targetGroups...), nil
+}
+
+func (a *AWS) AttachAllBalancersToScalingGroup(balancers []*Balancer, groupName string) error {
+	balancerNames, targetGroupARNs := splitBalancers(balancers)
+	if len(balancerNames) > 0 {
+		err := a.AttachBalancersToScalingGroup(balancerNames, groupName)
+		if err != nil {
+			return err
+		}
+	}
+	if len(targetGroupARNs) > 0 {
+		err := a.AttachTargetGroupsToScalingGroup(targetGroupARNs, groupName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *AWS) DetachAllBalancersFromScalingGroup(balancers []*Balancer, groupName string) error {
+	balancerNames, targetGroupARNs := splitBalancers(balancers)
+	if len(balancerNames) > 0 {
+		err := a.DetachBalancersFromScalingGroup(balancerNames, groupName)
+		if err != nil {
+			return err
+		}
+	}
+	if len(targetGroupARNs) > 0 {
+		err := a.DetachTargetGroupsFromScalingGroup(targetGroupARNs, groupName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DescribeBalancerHealth returns health of instances behind an ELB or a target group
+func (a *AWS) DescribeBalancerHealth(b *Balancer) ([]*InstanceHealth, error) {
+	switch b.Type {
+	case BalancerTypeELB:
+		return a.DescribeBalancedInstanceHealth(b.Name)
+	case BalancerTypeTargetGroup:
+		return a.DescribeTargetHealth(b.ARN)
+	}
+	return nil, fmt.Errorf("Unknown type of balancer %q: %q", b.Name, b.Type)
+}
+
+// String returns e.g. "ELB my-elb" or "TG my-targets"
+func (b *Balancer) String() string {
+	return fmt.Sprintf("%s %s", b.Type, b.Name)
+}
+
+// ID identifies the balancer among both ELBs and target groups
+func (b *Balancer) ID() string {
+	if b.Type == BalancerTypeTargetGroup {
+		return b.ARN
+	}
+	return b.Name
+}
+
+func splitBalancers(balancers []*Balancer) (balancerNames, targetGroupARNs []string) {
+	for _, b := range balancers {
+		switch b.Type {
+		case BalancerTypeTargetGroup:
+			targetGroupARNs = append(targetGroupARNs, b.ARN)
+		default:
+			balancerNames = append(balancerNames, b.Name)
+		}
+	}
+	return balancerNames, targetGroupARNs
+}
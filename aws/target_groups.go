@@ -0,0 +1,152 @@
+package aws
+
+import (
+	"log"
+	"strings"
+
+	awsSDK "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// GetTargetGroupsForApp discovers ALB/NLB target groups by the "App" tag
+func (a *AWS) GetTargetGroupsForApp(appName string) ([]*Balancer, error) {
+	log.Printf("[DEBUG] Discovering target groups for %q", appName)
+	svc := a.elbv2Conn
+
+	var allTargetGroups []*elbv2.TargetGroup
+	input := &elbv2.DescribeTargetGroupsInput{}
+	for {
+		resp, err := svc.DescribeTargetGroups(input)
+		if err != nil {
+			return nil, err
+		}
+		allTargetGroups = append(allTargetGroups, resp.TargetGroups...)
+		if resp.NextMarker == nil || *resp.NextMarker == "" {
+			break
+		}
+		input.Marker = resp.NextMarker
+	}
+
+	namesByARN := make(map[string]string, len(allTargetGroups))
+	var allARNs []*string
+	for _, tg := range allTargetGroups {
+		namesByARN[*tg.TargetGroupArn] = *tg.TargetGroupName
+		allARNs = append(allARNs, tg.TargetGroupArn)
+	}
+
+	var targetGroups []*Balancer
+	for len(allARNs) > 0 {
+		log.Printf("[DEBUG] checking tags for some target groups: %v", allARNs)
+		var batchOfARNs []*string
+		if len(allARNs) > 20 {
+			batchOfARNs = allARNs[:20]
+		} else {
+			batchOfARNs = allARNs
+		}
+		tagsResponse, err := svc.DescribeTags(&elbv2.DescribeTagsInput{
+			ResourceArns: batchOfARNs,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, desc := range tagsResponse.TagDescriptions {
+			for _, tag := range desc.Tags {
+				if *tag.Key == "App" && *tag.Value == appName {
+					targetGroups = append(targetGroups, &Balancer{
+						Name: namesByARN[*desc.ResourceArn],
+						Type: BalancerTypeTargetGroup,
+						ARN:  *desc.ResourceArn,
+					})
+				}
+			}
+		}
+		allARNs = allARNs[len(batchOfARNs):]
+	}
+
+	log.Printf("[DEBUG] found %d target groups for %q", len(targetGroups), appName)
+	return targetGroups, nil
+}
+
+// GetTargetGroupsFromScalingGroup returns target groups attached to a given ASG
+func (a *AWS) GetTargetGroupsFromScalingGroup(scalingGroup string) ([]*Balancer, error) {
+	log.Printf("[DEBUG] Discovering target groups for ASG %q", scalingGroup)
+	svc := a.autoscalingConn
+	resp, err := svc.DescribeLoadBalancerTargetGroups(&autoscaling.DescribeLoadBalancerTargetGroupsInput{
+		AutoScalingGroupName: awsSDK.String(scalingGroup),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var targetGroups []*Balancer
+	for _, tg := range resp.LoadBalancerTargetGroups {
+		targetGroups = append(targetGroups, &Balancer{
+			Name:  targetGroupNameFromARN(*tg.LoadBalancerTargetGroupARN),
+			State: *tg.State,
+			Type:  BalancerTypeTargetGroup,
+			ARN:   *tg.LoadBalancerTargetGroupARN,
+		})
+	}
+
+	return targetGroups, nil
+}
+
+// DescribeTargetHealth returns health of targets registered in a target group.
+// States are translated to those of classic ELBs (InService/OutOfService),
+// so that instances behind both can be treated the same way.
+func (a *AWS) DescribeTargetHealth(targetGroupARN string) ([]*InstanceHealth, error) {
+	svc := a.elbv2Conn
+	var instances []*InstanceHealth
+	resp, err := svc.DescribeTargetHealth(&elbv2.DescribeTargetHealthInput{
+		TargetGroupArn: awsSDK.String(targetGroupARN),
+	})
+	if err != nil {
+		return instances, err
+	}
+	for _, health := range resp.TargetHealthDescriptions {
+		state := "OutOfService"
+		if *health.TargetHealth.State == elbv2.TargetHealthStateEnumHealthy {
+			state = "InService"
+		}
+		instances = append(instances, &InstanceHealth{
+			*health.Target.Id,
+			state,
+		})
+	}
+	return instances, nil
+}
+
+func (a *AWS) DetachTargetGroupsFromScalingGroup(targetGroupARNs []string, groupName string) error {
+	svc := a.autoscalingConn
+	_, err := svc.DetachLoadBalancerTargetGroups(&autoscaling.DetachLoadBalancerTargetGroupsInput{
+		AutoScalingGroupName: awsSDK.String(groupName),
+		TargetGroupARNs:      awsSDK.StringSlice(targetGroupARNs),
+	})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (a *AWS) AttachTargetGroupsToScalingGroup(targetGroupARNs []string, groupName string) error {
+	svc := a.autoscalingConn
+	_, err := svc.AttachLoadBalancerTargetGroups(&autoscaling.AttachLoadBalancerTargetGroupsInput{
+		AutoScalingGroupName: awsSDK.String(groupName),
+		TargetGroupARNs:      awsSDK.StringSlice(targetGroupARNs),
+	})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// targetGroupNameFromARN parses name out of an ARN like
+// arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/my-targets/73e2d6bc24d8a067
+func targetGroupNameFromARN(arn string) string {
+	parts := strings.Split(arn, "/")
+	if len(parts) < 3 {
+		return arn
+	}
+	return parts[len(parts)-2]
+}
@@ -0,0 +1,334 @@
+package aws
+
+import (
+	"reflect"
+	"testing"
+
+	awsSDK "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+func TestGetTargetGroupsForApp(t *testing.T) {
+	routes := []*MockRoute{
+		&MockRoute{
+			ExpectedURI:         "/",
+			ExpectedRequestBody: "Action=DescribeTargetGroups&Version=2015-12-01",
+			Response: MockResponse{
+				Code: 200,
+				Body: test_elbv2_describeTargetGroups_apiBody,
+			},
+		},
+		&MockRoute{
+			ExpectedURI:         "/",
+			ExpectedRequestBody: "Action=DescribeTargetGroups&Marker=page-2&Version=2015-12-01",
+			Response: MockResponse{
+				Code: 200,
+				Body: test_elbv2_describeTargetGroups_page2_apiBody,
+			},
+		},
+		&MockRoute{
+			ExpectedURI: "/",
+			ExpectedRequestBody: "Action=DescribeTags&" +
+				"ResourceArns.member.1=arn%3Aaws%3Aelasticloadbalancing%3Aus-east-1%3A123456789012%3Atargetgroup%2Fcookie-tg%2F73e2d6bc24d8a067&" +
+				"ResourceArns.member.2=arn%3Aaws%3Aelasticloadbalancing%3Aus-east-1%3A123456789012%3Atargetgroup%2Fother-tg%2F83e2d6bc24d8a067&" +
+				"Version=2015-12-01",
+			Response: MockResponse{
+				Code: 200,
+				Body: test_elbv2_describeTags_apiBody,
+			},
+		},
+	}
+	mockedSession, closeFunc := GetMockedAwsSession(routes, "us-east-1")
+	defer closeFunc()
+
+	a := &AWS{
+		Region:    awsSDK.String("us-east-1"),
+		elbv2Conn: elbv2.New(mockedSession),
+	}
+
+	targetGroups, err := a.GetTargetGroupsForApp("tasty_cookie_generator")
+	if err != nil {
+		t.Fatalf("Failed getting target groups for app: %s", err)
+	}
+
+	expectedTargetGroups := []*Balancer{
+		&Balancer{
+			Name: "cookie-tg",
+			Type: "TG",
+			ARN:  "arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/cookie-tg/73e2d6bc24d8a067",
+		},
+	}
+	if !reflect.DeepEqual(targetGroups, expectedTargetGroups) {
+		t.Fatalf("Wrong target groups received.\nGiven: %v\nExpected: %v\n",
+			targetGroups, expectedTargetGroups)
+	}
+}
+
+func TestGetTargetGroupsFromScalingGroup(t *testing.T) {
+	routes := []*MockRoute{
+		&MockRoute{
+			ExpectedURI:         "/",
+			ExpectedRequestBody: "Action=DescribeLoadBalancerTargetGroups&AutoScalingGroupName=asg-xyz&Version=2011-01-01",
+			Response: MockResponse{
+				Code: 200,
+				Body: test_autoscaling_describeTargetGroups_apiBody,
+			},
+		},
+	}
+	mockedSession, closeFunc := GetMockedAwsSession(routes, "us-east-1")
+	defer closeFunc()
+
+	a := &AWS{
+		Region:          awsSDK.String("us-east-1"),
+		autoscalingConn: autoscaling.New(mockedSession),
+	}
+
+	targetGroups, err := a.GetTargetGroupsFromScalingGroup("asg-xyz")
+	if err != nil {
+		t.Fatalf("Failed getting target groups: %s", err)
+	}
+	expectedTargetGroups := []*Balancer{
+		&Balancer{
+			Name:  "cookie-tg",
+			State: "InService",
+			Type:  "TG",
+			ARN:   "arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/cookie-tg/73e2d6bc24d8a067",
+		},
+	}
+	if !reflect.DeepEqual(targetGroups, expectedTargetGroups) {
+		t.Fatalf("Target groups don't match:\nGiven: %v\nExpected: %v", targetGroups, expectedTargetGroups)
+	}
+}
+
+func TestDescribeTargetHealth(t *testing.T) {
+	routes := []*MockRoute{
+		&MockRoute{
+			ExpectedURI: "/",
+			ExpectedRequestBody: "Action=DescribeTargetHealth&" +
+				"TargetGroupArn=arn%3Aaws%3Aelasticloadbalancing%3Aus-east-1%3A123456789012%3Atargetgroup%2Fcookie-tg%2F73e2d6bc24d8a067&" +
+				"Version=2015-12-01",
+			Response: MockResponse{
+				Code: 200,
+				Body: test_elbv2_describeTargetHealth_apiBody,
+			},
+		},
+	}
+	mockedSession, closeFunc := GetMockedAwsSession(routes, "us-east-1")
+	defer closeFunc()
+
+	a := &AWS{
+		Region:    awsSDK.String("us-east-1"),
+		elbv2Conn: elbv2.New(mockedSession),
+	}
+
+	healths, err := a.DescribeTargetHealth("arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/cookie-tg/73e2d6bc24d8a067")
+	if err != nil {
+		t.Fatalf("Failed getting target health: %s", err)
+	}
+
+	expectedHealths := []*InstanceHealth{
+		&InstanceHealth{"i-90d8c2a5", "InService"},
+		&InstanceHealth{"i-00000000", "OutOfService"},
+	}
+	if !reflect.DeepEqual(healths, expectedHealths) {
+		t.Fatalf("Wrong healths received.\nGiven: %v\nExpected: %v\n",
+			healths, expectedHealths)
+	}
+}
+
+func TestAttachAllBalancersToScalingGroup(t *testing.T) {
+	routes := []*MockRoute{
+		&MockRoute{
+			ExpectedURI: "/",
+			ExpectedRequestBody: "Action=AttachLoadBalancers&" +
+				"AutoScalingGroupName=asg-xyz&" +
+				"LoadBalancerNames.member.1=lb-1&" +
+				"Version=2011-01-01",
+			Response: MockResponse{
+				Code: 200,
+				Body: "",
+			},
+		},
+		&MockRoute{
+			ExpectedURI: "/",
+			ExpectedRequestBody: "Action=AttachLoadBalancerTargetGroups&" +
+				"AutoScalingGroupName=asg-xyz&" +
+				"TargetGroupARNs.member.1=arn%3Atg-1&" +
+				"TargetGroupARNs.member.2=arn%3Atg-2&" +
+				"Version=2011-01-01",
+			Response: MockResponse{
+				Code: 200,
+				Body: "",
+			},
+		},
+	}
+	mockedSession, closeFunc := GetMockedAwsSession(routes, "us-east-1")
+	defer closeFunc()
+
+	a := &AWS{
+		Region:          awsSDK.String("us-east-1"),
+		autoscalingConn: autoscaling.New(mockedSession),
+	}
+
+	err := a.AttachAllBalancersToScalingGroup([]*Balancer{
+		&Balancer{Name: "lb-1", Type: "ELB"},
+		&Balancer{Name: "tg-1", Type: "TG", ARN: "arn:tg-1"},
+		&Balancer{Name: "tg-2", Type: "TG", ARN: "arn:tg-2"},
+	}, "asg-xyz")
+	if err != nil {
+		t.Fatalf("Failed attaching balancers: %s", err)
+	}
+}
+
+func TestDetachAllBalancersFromScalingGroup(t *testing.T) {
+	routes := []*MockRoute{
+		&MockRoute{
+			ExpectedURI: "/",
+			ExpectedRequestBody: "Action=DetachLoadBalancerTargetGroups&" +
+				"AutoScalingGroupName=asg-xyz&" +
+				"TargetGroupARNs.member.1=arn%3Atg-1&" +
+				"Version=2011-01-01",
+			Response: MockResponse{
+				Code: 200,
+				Body: "",
+			},
+		},
+	}
+	mockedSession, closeFunc := GetMockedAwsSession(routes, "us-east-1")
+	defer closeFunc()
+
+	a := &AWS{
+		Region:          awsSDK.String("us-east-1"),
+		autoscalingConn: autoscaling.New(mockedSession),
+	}
+
+	// No ELBs, so no request for detaching these is expected
+	err := a.DetachAllBalancersFromScalingGroup([]*Balancer{
+		&Balancer{Name: "tg-1", Type: "TG", ARN: "arn:tg-1"},
+	}, "asg-xyz")
+	if err != nil {
+		t.Fatalf("Failed detaching balancers: %s", err)
+	}
+}
+
+func TestTargetGroupNameFromARN(t *testing.T) {
+	name := targetGroupNameFromARN("arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/my-targets/73e2d6bc24d8a067")
+	if name != "my-targets" {
+		t.Fatalf("Unexpected name: %q", name)
+	}
+	name = targetGroupNameFromARN("invalid")
+	if name != "invalid" {
+		t.Fatalf("Unexpected name: %q", name)
+	}
+}
+
+var test_elbv2_describeTargetGroups_apiBody = `<DescribeTargetGroupsResponse xmlns="http://elasticloadbalancing.amazonaws.com/doc/2015-12-01/">
+  <DescribeTargetGroupsResult>
+    <TargetGroups>
+      <member>
+        <TargetGroupArn>arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/cookie-tg/73e2d6bc24d8a067</TargetGroupArn>
+        <TargetGroupName>cookie-tg</TargetGroupName>
+        <Protocol>HTTP</Protocol>
+        <Port>80</Port>
+        <VpcId>vpc-3ac0fb5f</VpcId>
+        <TargetType>instance</TargetType>
+      </member>
+    </TargetGroups>
+    <NextMarker>page-2</NextMarker>
+  </DescribeTargetGroupsResult>
+  <ResponseMetadata>
+    <RequestId>70092c0e-f3a9-11e5-ae48-cff02092876b</RequestId>
+  </ResponseMetadata>
+</DescribeTargetGroupsResponse>`
+
+var test_elbv2_describeTargetGroups_page2_apiBody = `<DescribeTargetGroupsResponse xmlns="http://elasticloadbalancing.amazonaws.com/doc/2015-12-01/">
+  <DescribeTargetGroupsResult>
+    <TargetGroups>
+      <member>
+        <TargetGroupArn>arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/other-tg/83e2d6bc24d8a067</TargetGroupArn>
+        <TargetGroupName>other-tg</TargetGroupName>
+        <Protocol>TCP</Protocol>
+        <Port>80</Port>
+        <VpcId>vpc-3ac0fb5f</VpcId>
+        <TargetType>instance</TargetType>
+      </member>
+    </TargetGroups>
+  </DescribeTargetGroupsResult>
+  <ResponseMetadata>
+    <RequestId>70092c0e-f3a9-11e5-ae48-cff02092876c</RequestId>
+  </ResponseMetadata>
+</DescribeTargetGroupsResponse>`
+
+var test_elbv2_describeTags_apiBody = `<DescribeTagsResponse xmlns="http://elasticloadbalancing.amazonaws.com/doc/2015-12-01/">
+  <DescribeTagsResult>
+    <TagDescriptions>
+      <member>
+        <ResourceArn>arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/cookie-tg/73e2d6bc24d8a067</ResourceArn>
+        <Tags>
+          <member>
+            <Key>App</Key>
+            <Value>tasty_cookie_generator</Value>
+          </member>
+        </Tags>
+      </member>
+      <member>
+        <ResourceArn>arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/other-tg/83e2d6bc24d8a067</ResourceArn>
+        <Tags>
+          <member>
+            <Key>App</Key>
+            <Value>other_app</Value>
+          </member>
+        </Tags>
+      </member>
+    </TagDescriptions>
+  </DescribeTagsResult>
+  <ResponseMetadata>
+    <RequestId>34f144db-f2d9-11e5-a53c-67205c0d10fd</RequestId>
+  </ResponseMetadata>
+</DescribeTagsResponse>`
+
+var test_elbv2_describeTargetHealth_apiBody = `<DescribeTargetHealthResponse xmlns="http://elasticloadbalancing.amazonaws.com/doc/2015-12-01/">
+  <DescribeTargetHealthResult>
+    <TargetHealthDescriptions>
+      <member>
+        <HealthCheckPort>80</HealthCheckPort>
+        <TargetHealth>
+          <State>healthy</State>
+        </TargetHealth>
+        <Target>
+          <Port>80</Port>
+          <Id>i-90d8c2a5</Id>
+        </Target>
+      </member>
+      <member>
+        <HealthCheckPort>80</HealthCheckPort>
+        <TargetHealth>
+          <State>initial</State>
+          <Reason>Elb.RegistrationInProgress</Reason>
+        </TargetHealth>
+        <Target>
+          <Port>80</Port>
+          <Id>i-00000000</Id>
+        </Target>
+      </member>
+    </TargetHealthDescriptions>
+  </DescribeTargetHealthResult>
+  <ResponseMetadata>
+    <RequestId>c534f810-f389-11e5-9192-3fff33344cfa</RequestId>
+  </ResponseMetadata>
+</DescribeTargetHealthResponse>`
+
+var test_autoscaling_describeTargetGroups_apiBody = `<DescribeLoadBalancerTargetGroupsResponse xmlns="http://autoscaling.amazonaws.com/doc/2011-01-01/">
+  <DescribeLoadBalancerTargetGroupsResult>
+    <LoadBalancerTargetGroups>
+      <member>
+        <LoadBalancerTargetGroupARN>arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/cookie-tg/73e2d6bc24d8a067</LoadBalancerTargetGroupARN>
+        <State>InService</State>
+      </member>
+    </LoadBalancerTargetGroups>
+  </DescribeLoadBalancerTargetGroupsResult>
+  <ResponseMetadata>
+    <RequestId>7c6e177f-f082-11e1-ac58-3714bEXAMPLF</RequestId>
+  </ResponseMetadata>
+</DescribeLoadBalancerTargetGroupsResponse>`
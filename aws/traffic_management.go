@@ -11,9 +11,17 @@ import (
 	"github.com/aws/aws-sdk-go/service/elb"
 )
 
+const (
+	BalancerTypeELB         = "ELB"
+	BalancerTypeTargetGroup = "TG"
+)
+
+// Balancer is either a classic ELB or an ALB/NLB target group
 type Balancer struct {
 	Name  string
 	State string
+	Type  string
+	ARN   string // target groups only
 }
 
 type InstanceHealth struct {
@@ -34,8 +42,9 @@ func (a *AWS) GetBalancersFromScalingGroup(scalingGroup string) ([]*Balancer, er
 	var balancers []*Balancer
 	for _, b := range resp.LoadBalancers {
 		balancers = append(balancers, &Balancer{
-			*b.LoadBalancerName,
-			*b.State,
+			Name:  *b.LoadBalancerName,
+			State: *b.State,
+			Type:  BalancerTypeELB,
 		})
 	}
 
@@ -33,8 +33,8 @@ func TestGetBalancersFromScalingGroup(t *testing.T) {
 		t.Fatalf("Failed getting balancers: %s", err)
 	}
 	expectedBalancers := []*Balancer{
-		&Balancer{Name: "internal-loadbalancer", State: "Added"},
-		&Balancer{Name: "external-loadbalancer", State: "Added"},
+		&Balancer{Name: "internal-loadbalancer", State: "Added", Type: "ELB"},
+		&Balancer{Name: "external-loadbalancer", State: "Added", Type: "ELB"},
 	}
 	if !reflect.DeepEqual(balancers, expectedBalancers) {
 		t.Fatalf("Load balancers don't match:\nGiven: %v\nExpected: %v", balancers, expectedBalancers)
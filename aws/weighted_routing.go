@@ -0,0 +1,244 @@
+package aws
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	awsSDK "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// TargetGroup describes a target group of an ALB/NLB
+type TargetGroup struct {
+	ARN              string
+	Name             string
+	Protocol         string
+	Port             int64
+	LoadBalancerARNs []string
+}
+
+// TrafficRoute is an ALB listener or listener rule forwarding traffic
+// to (potentially weighted) target groups
+type TrafficRoute struct {
+	ListenerARN string
+	RuleARN     string // empty for default actions of the listener
+
+	// Weights of target groups by ARN as found when the route was discovered
+	Weights map[string]int64
+
+	actions []*elbv2.Action
+}
+
+func (r *TrafficRoute) String() string {
+	if r.RuleARN != "" {
+		return "rule " + r.RuleARN
+	}
+	return "listener " + r.ListenerARN
+}
+
+func (a *AWS) DescribeTargetGroups(targetGroupARNs []string) ([]*TargetGroup, error) {
+	svc := a.elbv2Conn
+	resp, err := svc.DescribeTargetGroups(&elbv2.DescribeTargetGroupsInput{
+		TargetGroupArns: awsSDK.StringSlice(targetGroupARNs),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var targetGroups []*TargetGroup
+	for _, tg := range resp.TargetGroups {
+		targetGroups = append(targetGroups, &TargetGroup{
+			ARN:              *tg.TargetGroupArn,
+			Name:             *tg.TargetGroupName,
+			Protocol:         awsSDK.StringValue(tg.Protocol),
+			Port:             awsSDK.Int64Value(tg.Port),
+			LoadBalancerARNs: awsSDK.StringValueSlice(tg.LoadBalancerArns),
+		})
+	}
+	return targetGroups, nil
+}
+
+// GetTrafficRoutesForTargetGroups discovers listeners & rules of load balancers
+// which forward traffic to any of given target groups
+func (a *AWS) GetTrafficRoutesForTargetGroups(targetGroups []*TargetGroup) ([]*TrafficRoute, error) {
+	isWanted := make(map[string]bool, len(targetGroups))
+	var balancerARNs []string
+	seenBalancers := make(map[string]bool, 0)
+	for _, tg := range targetGroups {
+		isWanted[tg.ARN] = true
+		for _, arn := range tg.LoadBalancerARNs {
+			if !seenBalancers[arn] {
+				seenBalancers[arn] = true
+				balancerARNs = append(balancerARNs, arn)
+			}
+		}
+	}
+
+	svc := a.elbv2Conn
+	var routes []*TrafficRoute
+	for _, balancerARN := range balancerARNs {
+		log.Printf("[DEBUG] Discovering listeners of %q", balancerARN)
+		var listeners []*elbv2.Listener
+		input := &elbv2.DescribeListenersInput{
+			LoadBalancerArn: awsSDK.String(balancerARN),
+		}
+		for {
+			resp, err := svc.DescribeListeners(input)
+			if err != nil {
+				return nil, err
+			}
+			listeners = append(listeners, resp.Listeners...)
+			if resp.NextMarker == nil || *resp.NextMarker == "" {
+				break
+			}
+			input.Marker = resp.NextMarker
+		}
+
+		for _, l := range listeners {
+			if r := newTrafficRoute(*l.ListenerArn, "", l.DefaultActions, isWanted); r != nil {
+				routes = append(routes, r)
+			}
+
+			rules, err := a.listRules(*l.ListenerArn)
+			if err != nil {
+				return nil, err
+			}
+			for _, rule := range rules {
+				// Default rule mirrors default actions of the listener
+				if awsSDK.BoolValue(rule.IsDefault) {
+					continue
+				}
+				if r := newTrafficRoute(*l.ListenerArn, *rule.RuleArn, rule.Actions, isWanted); r != nil {
+					routes = append(routes, r)
+				}
+			}
+		}
+	}
+
+	return routes, nil
+}
+
+func (a *AWS) listRules(listenerARN string) ([]*elbv2.Rule, error) {
+	svc := a.elbv2Conn
+	var rules []*elbv2.Rule
+	input := &elbv2.DescribeRulesInput{
+		ListenerArn: awsSDK.String(listenerARN),
+	}
+	for {
+		resp, err := svc.DescribeRules(input)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, resp.Rules...)
+		if resp.NextMarker == nil || *resp.NextMarker == "" {
+			break
+		}
+		input.Marker = resp.NextMarker
+	}
+	return rules, nil
+}
+
+// newTrafficRoute returns route if its forward action
+// includes any of the wanted target groups, nil otherwise
+func newTrafficRoute(listenerARN, ruleARN string, actions []*elbv2.Action, isWanted map[string]bool) *TrafficRoute {
+	for _, action := range actions {
+		weights := forwardWeights(action)
+		for arn := range weights {
+			if isWanted[arn] {
+				return &TrafficRoute{
+					ListenerARN: listenerARN,
+					RuleARN:     ruleARN,
+					Weights:     weights,
+					actions:     actions,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// forwardWeights returns weights of target groups the action forwards to,
+// plain forward to a single target group is treated as weight 1
+func forwardWeights(action *elbv2.Action) map[string]int64 {
+	weights := make(map[string]int64, 0)
+	if awsSDK.StringValue(action.Type) != elbv2.ActionTypeEnumForward {
+		return weights
+	}
+	if action.ForwardConfig != nil && len(action.ForwardConfig.TargetGroups) > 0 {
+		for _, tg := range action.ForwardConfig.TargetGroups {
+			weight := int64(1)
+			if tg.Weight != nil {
+				weight = *tg.Weight
+			}
+			weights[*tg.TargetGroupArn] = weight
+		}
+		return weights
+	}
+	if action.TargetGroupArn != nil {
+		weights[*action.TargetGroupArn] = 1
+	}
+	return weights
+}
+
+// SetTrafficRouteWeights makes the route forward traffic to target groups
+// by given weights (ALB only), other actions of the route are kept
+func (a *AWS) SetTrafficRouteWeights(r *TrafficRoute, weights map[string]int64) error {
+	arns := make([]string, 0, len(weights))
+	for arn := range weights {
+		arns = append(arns, arn)
+	}
+	sort.Strings(arns)
+
+	actions := make([]*elbv2.Action, 0, len(r.actions))
+	replaced := false
+	for _, action := range r.actions {
+		if replaced || awsSDK.StringValue(action.Type) != elbv2.ActionTypeEnumForward {
+			actions = append(actions, action)
+			continue
+		}
+
+		forwardConfig := &elbv2.ForwardActionConfig{}
+		if action.ForwardConfig != nil {
+			forwardConfig.TargetGroupStickinessConfig = action.ForwardConfig.TargetGroupStickinessConfig
+		}
+		for _, arn := range arns {
+			forwardConfig.TargetGroups = append(forwardConfig.TargetGroups, &elbv2.TargetGroupTuple{
+				TargetGroupArn: awsSDK.String(arn),
+				Weight:         awsSDK.Int64(weights[arn]),
+			})
+		}
+		actions = append(actions, &elbv2.Action{
+			Type:          action.Type,
+			Order:         action.Order,
+			ForwardConfig: forwardConfig,
+		})
+		replaced = true
+	}
+	if !replaced {
+		return fmt.Errorf("No forward action found in %s", r)
+	}
+
+	return a.modifyTrafficRoute(r, actions)
+}
+
+// RevertTrafficRoute restores actions of the route as they were discovered
+func (a *AWS) RevertTrafficRoute(r *TrafficRoute) error {
+	return a.modifyTrafficRoute(r, r.actions)
+}
+
+func (a *AWS) modifyTrafficRoute(r *TrafficRoute, actions []*elbv2.Action) error {
+	svc := a.elbv2Conn
+	if r.RuleARN != "" {
+		_, err := svc.ModifyRule(&elbv2.ModifyRuleInput{
+			RuleArn: awsSDK.String(r.RuleARN),
+			Actions: actions,
+		})
+		return err
+	}
+	_, err := svc.ModifyListener(&elbv2.ModifyListenerInput{
+		ListenerArn:    awsSDK.String(r.ListenerARN),
+		DefaultActions: actions,
+	})
+	return err
+}
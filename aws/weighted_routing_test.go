@@ -0,0 +1,232 @@
+package aws
+
+import (
+	"reflect"
+	"testing"
+
+	awsSDK "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+func TestGetTrafficRoutesForTargetGroups(t *testing.T) {
+	routes := []*MockRoute{
+		&MockRoute{
+			ExpectedURI: "/",
+			ExpectedRequestBody: "Action=DescribeListeners&" +
+				"LoadBalancerArn=arn%3Aaws%3Aelasticloadbalancing%3Aus-east-1%3A123456789012%3Aloadbalancer%2Fapp%2Fcookie-alb%2F50dc6c495c0c9188&" +
+				"Version=2015-12-01",
+			Response: MockResponse{
+				Code: 200,
+				Body: test_elbv2_describeListeners_apiBody,
+			},
+		},
+		&MockRoute{
+			ExpectedURI: "/",
+			ExpectedRequestBody: "Action=DescribeRules&" +
+				"ListenerArn=arn%3Aaws%3Aelasticloadbalancing%3Aus-east-1%3A123456789012%3Alistener%2Fapp%2Fcookie-alb%2F50dc6c495c0c9188%2Ff2f7dc8efc522ab2&" +
+				"Version=2015-12-01",
+			Response: MockResponse{
+				Code: 200,
+				Body: test_elbv2_describeRules_apiBody,
+			},
+		},
+	}
+	mockedSession, closeFunc := GetMockedAwsSession(routes, "us-east-1")
+	defer closeFunc()
+
+	a := &AWS{
+		Region:    awsSDK.String("us-east-1"),
+		elbv2Conn: elbv2.New(mockedSession),
+	}
+
+	trafficRoutes, err := a.GetTrafficRoutesForTargetGroups([]*TargetGroup{
+		{
+			ARN:              "arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/blue/73e2d6bc24d8a067",
+			LoadBalancerARNs: []string{"arn:aws:elasticloadbalancing:us-east-1:123456789012:loadbalancer/app/cookie-alb/50dc6c495c0c9188"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed getting traffic routes: %s", err)
+	}
+
+	if len(trafficRoutes) != 2 {
+		t.Fatalf("Expected 2 routes (listener & rule), given: %d", len(trafficRoutes))
+	}
+	listenerARN := "arn:aws:elasticloadbalancing:us-east-1:123456789012:listener/app/cookie-alb/50dc6c495c0c9188/f2f7dc8efc522ab2"
+	if trafficRoutes[0].ListenerARN != listenerARN || trafficRoutes[0].RuleARN != "" {
+		t.Fatalf("Expected default actions of the listener first, given: %s", trafficRoutes[0])
+	}
+	expectedWeights := map[string]int64{
+		"arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/blue/73e2d6bc24d8a067": 1,
+	}
+	if !reflect.DeepEqual(trafficRoutes[0].Weights, expectedWeights) {
+		t.Fatalf("Expected weights: %v, given: %v", expectedWeights, trafficRoutes[0].Weights)
+	}
+
+	ruleARN := "arn:aws:elasticloadbalancing:us-east-1:123456789012:listener-rule/app/cookie-alb/50dc6c495c0c9188/f2f7dc8efc522ab2/9683b2d02a6cabee"
+	if trafficRoutes[1].RuleARN != ruleARN {
+		t.Fatalf("Expected rule %q, given: %s", ruleARN, trafficRoutes[1])
+	}
+	expectedWeights = map[string]int64{
+		"arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/blue/73e2d6bc24d8a067":  80,
+		"arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/green/83e2d6bc24d8a067": 20,
+	}
+	if !reflect.DeepEqual(trafficRoutes[1].Weights, expectedWeights) {
+		t.Fatalf("Expected weights: %v, given: %v", expectedWeights, trafficRoutes[1].Weights)
+	}
+}
+
+func TestSetTrafficRouteWeights(t *testing.T) {
+	routes := []*MockRoute{
+		&MockRoute{
+			ExpectedURI: "/",
+			ExpectedRequestBody: "Action=ModifyListener&" +
+				"DefaultActions.member.1.ForwardConfig.TargetGroups.member.1.TargetGroupArn=arn%3Ablue&" +
+				"DefaultActions.member.1.ForwardConfig.TargetGroups.member.1.Weight=90&" +
+				"DefaultActions.member.1.ForwardConfig.TargetGroups.member.2.TargetGroupArn=arn%3Agreen&" +
+				"DefaultActions.member.1.ForwardConfig.TargetGroups.member.2.Weight=10&" +
+				"DefaultActions.member.1.Order=1&" +
+				"DefaultActions.member.1.Type=forward&" +
+				"ListenerArn=arn%3Alistener&" +
+				"Version=2015-12-01",
+			Response: MockResponse{
+				Code: 200,
+				Body: "",
+			},
+		},
+		&MockRoute{
+			ExpectedURI: "/",
+			ExpectedRequestBody: "Action=ModifyListener&" +
+				"DefaultActions.member.1.Order=1&" +
+				"DefaultActions.member.1.TargetGroupArn=arn%3Ablue&" +
+				"DefaultActions.member.1.Type=forward&" +
+				"ListenerArn=arn%3Alistener&" +
+				"Version=2015-12-01",
+			Response: MockResponse{
+				Code: 200,
+				Body: "",
+			},
+		},
+	}
+	mockedSession, closeFunc := GetMockedAwsSession(routes, "us-east-1")
+	defer closeFunc()
+
+	a := &AWS{
+		Region:    awsSDK.String("us-east-1"),
+		elbv2Conn: elbv2.New(mockedSession),
+	}
+
+	r := newTrafficRoute("arn:listener", "", []*elbv2.Action{
+		{
+			Type:           awsSDK.String("forward"),
+			Order:          awsSDK.Int64(1),
+			TargetGroupArn: awsSDK.String("arn:blue"),
+		},
+	}, map[string]bool{"arn:blue": true})
+	if r == nil {
+		t.Fatal("Expected route forwarding to the target group")
+	}
+
+	err := a.SetTrafficRouteWeights(r, map[string]int64{"arn:blue": 90, "arn:green": 10})
+	if err != nil {
+		t.Fatalf("Failed setting weights: %s", err)
+	}
+	err = a.RevertTrafficRoute(r)
+	if err != nil {
+		t.Fatalf("Failed reverting route: %s", err)
+	}
+}
+
+var test_elbv2_describeListeners_apiBody = `<DescribeListenersResponse xmlns="http://elasticloadbalancing.amazonaws.com/doc/2015-12-01/">
+  <DescribeListenersResult>
+    <Listeners>
+      <member>
+        <LoadBalancerArn>arn:aws:elasticloadbalancing:us-east-1:123456789012:loadbalancer/app/cookie-alb/50dc6c495c0c9188</LoadBalancerArn>
+        <Protocol>HTTP</Protocol>
+        <Port>80</Port>
+        <ListenerArn>arn:aws:elasticloadbalancing:us-east-1:123456789012:listener/app/cookie-alb/50dc6c495c0c9188/f2f7dc8efc522ab2</ListenerArn>
+        <DefaultActions>
+          <member>
+            <Type>forward</Type>
+            <TargetGroupArn>arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/blue/73e2d6bc24d8a067</TargetGroupArn>
+          </member>
+        </DefaultActions>
+      </member>
+    </Listeners>
+  </DescribeListenersResult>
+  <ResponseMetadata>
+    <RequestId>18e470d3-f39c-11e5-a53c-67205c0d10fd</RequestId>
+  </ResponseMetadata>
+</DescribeListenersResponse>`
+
+var test_elbv2_describeRules_apiBody = `<DescribeRulesResponse xmlns="http://elasticloadbalancing.amazonaws.com/doc/2015-12-01/">
+  <DescribeRulesResult>
+    <Rules>
+      <member>
+        <IsDefault>false</IsDefault>
+        <Conditions>
+          <member>
+            <Field>path-pattern</Field>
+            <Values>
+              <member>/img/*</member>
+            </Values>
+          </member>
+        </Conditions>
+        <Priority>10</Priority>
+        <Actions>
+          <member>
+            <Type>forward</Type>
+            <ForwardConfig>
+              <TargetGroups>
+                <member>
+                  <TargetGroupArn>arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/blue/73e2d6bc24d8a067</TargetGroupArn>
+                  <Weight>80</Weight>
+                </member>
+                <member>
+                  <TargetGroupArn>arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/green/83e2d6bc24d8a067</TargetGroupArn>
+                  <Weight>20</Weight>
+                </member>
+              </TargetGroups>
+            </ForwardConfig>
+          </member>
+        </Actions>
+        <RuleArn>arn:aws:elasticloadbalancing:us-east-1:123456789012:listener-rule/app/cookie-alb/50dc6c495c0c9188/f2f7dc8efc522ab2/9683b2d02a6cabee</RuleArn>
+      </member>
+      <member>
+        <IsDefault>false</IsDefault>
+        <Conditions>
+          <member>
+            <Field>path-pattern</Field>
+            <Values>
+              <member>/health</member>
+            </Values>
+          </member>
+        </Conditions>
+        <Priority>20</Priority>
+        <Actions>
+          <member>
+            <Type>fixed-response</Type>
+            <FixedResponseConfig>
+              <StatusCode>200</StatusCode>
+            </FixedResponseConfig>
+          </member>
+        </Actions>
+        <RuleArn>arn:aws:elasticloadbalancing:us-east-1:123456789012:listener-rule/app/cookie-alb/50dc6c495c0c9188/f2f7dc8efc522ab2/a683b2d02a6cabee</RuleArn>
+      </member>
+      <member>
+        <IsDefault>true</IsDefault>
+        <Priority>default</Priority>
+        <Actions>
+          <member>
+            <Type>forward</Type>
+            <TargetGroupArn>arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/blue/73e2d6bc24d8a067</TargetGroupArn>
+          </member>
+        </Actions>
+        <RuleArn>arn:aws:elasticloadbalancing:us-east-1:123456789012:listener-rule/app/cookie-alb/50dc6c495c0c9188/f2f7dc8efc522ab2/b683b2d02a6cabee</RuleArn>
+      </member>
+    </Rules>
+  </DescribeRulesResult>
+  <ResponseMetadata>
+    <RequestId>74926cf3-f3a3-11e5-b543-9f2066fd2e98</RequestId>
+  </ResponseMetadata>
+</DescribeRulesResponse>`
@@ -1,6 +1,7 @@
 package command
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -13,6 +14,7 @@ import (
 	"github.com/MeredithCorpOSS/ape-dev-rt/clippy"
 	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
 	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
 	"github.com/MeredithCorpOSS/ape-dev-rt/hcl"
 	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
 )
@@ -48,6 +50,25 @@ func ApplyInfra(c *commons.Context) error {
 		return deprecatedGitError()
 	}
 
+	err = checkTerraformVersionOfInfra(c, appData)
+	if err != nil {
+		return err
+	}
+
+	var savedPlan *schema.PlanData
+	if planId := c.String("plan-id"); planId != "" {
+		if len(c.StringSlice("var")) > 0 || c.String("target") != "" {
+			return errors.New("Variables & target are part of the saved plan and can't be changed.")
+		}
+		savedPlan, err = ds.GetPlan(c.String("app"), planId)
+		if err != nil {
+			return err
+		}
+		if savedPlan.SlotId != "" {
+			return fmt.Errorf("Plan %q is a plan of slot %q, use deploy instead.", planId, savedPlan.SlotId)
+		}
+	}
+
 	namespace := user.AccountID
 	if c.String("namespace") != "default" {
 		namespace = c.String("namespace")
@@ -83,23 +104,35 @@ func ApplyInfra(c *commons.Context) error {
 
 	tfVariables["app_name"] = c.String("app")
 	tfVariables["environment"] = c.String("env")
+	if savedPlan != nil {
+		tfVariables = savedPlan.Variables
+	}
 	planStartTime := time.Now().UTC()
 	planFilePath := path.Join(rootDir, "planfile")
 	filesToCleanup = append(filesToCleanup, path.Join(rootDir, ".terraform"))
 	filesToCleanup = append(filesToCleanup, path.Join(rootDir, "terraform.tfstate.backup"))
 	filesToCleanup = append(filesToCleanup, planFilePath)
-	planOut, err := terraform.FreshPlan(&terraform.FreshPlanInput{
-		RemoteState:  remoteState,
-		RootPath:     rootDir,
-		PlanFilePath: planFilePath,
-		Variables:    tfVariables,
-		Refresh:      true,
-		Target:       c.String("target"),
-		Destroy:      false,
-		XLegacy:      c.Bool("x"),
-	})
+	var planOut *terraform.PlanOutput
+	if savedPlan != nil {
+		planOut, err = prepareSavedPlan(savedPlan, remoteState, rootDir, planFilePath, "", appData.LastInfraChangeTime)
+		planStartTime = savedPlan.PlanStartTime
+	} else {
+		planOut, err = terraform.FreshPlan(&terraform.FreshPlanInput{
+			RemoteState:  remoteState,
+			RootPath:     rootDir,
+			PlanFilePath: planFilePath,
+			Variables:    tfVariables,
+			Refresh:      true,
+			Target:       c.String("target"),
+			Destroy:      false,
+			XLegacy:      c.Bool("x"),
+		})
+	}
 	filesToCleanup = append(filesToCleanup, terraform.GetBackendConfigFilename(rootDir))
 	planFinishTime := time.Now().UTC()
+	if savedPlan != nil {
+		planFinishTime = savedPlan.PlanFinishTime
+	}
 	if err != nil {
 		return err
 	}
@@ -149,6 +182,11 @@ func ApplyInfra(c *commons.Context) error {
 	log.Printf("[DEBUG] Marking app as active? %t", isActive)
 
 	appData.LastInfraChangeTime = time.Now().UTC()
+	appData.InfraVariables = tfVariables
+	appData.LastTerraformVersion, err = terraform.Version()
+	if err != nil {
+		return err
+	}
 	err = FinishApplicationOperation(c.String("app"), appData, isActive, ao.Outputs, ds)
 	if err != nil {
 		return err
@@ -156,6 +194,14 @@ func ApplyInfra(c *commons.Context) error {
 
 	fmt.Printf("Apply TimeStamp: %v\n\n", appData.LastInfraChangeTime)
 
+	if savedPlan != nil && ao.ExitCode == 0 {
+		// Applied plan is stale, so there's no point keeping it
+		err = ds.DeletePlan(c.String("app"), savedPlan.PlanId)
+		if err != nil {
+			log.Printf("[WARN] Failed to delete applied plan %s: %s", savedPlan.PlanId, err)
+		}
+	}
+
 	if ao.ExitCode != 0 {
 		return fmt.Errorf("Apply operation failed (exit code %d). Stderr:\n%s",
 			ao.ExitCode, ao.Stderr)
@@ -0,0 +1,192 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
+	"github.com/MeredithCorpOSS/ape-dev-rt/clippy"
+	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+)
+
+// CheckState compares apps, slots & deployments across all configured
+// deployment state backends and reports any differences
+func CheckState(c *commons.Context) error {
+	ds, ok := c.CliContext.App.Metadata["ds"].(*deploymentstate.DeploymentState)
+	if !ok {
+		return fmt.Errorf("Unable to find Deployment State in metadata")
+	}
+
+	authoritative, err := authoritativeBackend(c, ds)
+	if err != nil {
+		return err
+	}
+
+	appNames, err := ds.ListAllApplicationNames()
+	if err != nil {
+		return err
+	}
+
+	inconsistent := 0
+	for _, appName := range appNames {
+		diffs, err := ds.CheckApplication(appName, authoritative)
+		if err != nil {
+			return err
+		}
+		if len(diffs) == 0 {
+			fmt.Printf("%s %s\n", colour.boldWhite(appName+":"), colour.green("consistent"))
+			continue
+		}
+		inconsistent++
+		fmt.Printf("%s %s\n", colour.boldWhite(appName+":"), colour.red(fmt.Sprintf("%d difference(s)", len(diffs))))
+		printRecordDiffs(diffs)
+	}
+	fmt.Println("")
+
+	if inconsistent > 0 {
+		return fmt.Errorf("%d of %d app(s) differ from backend %s. Use repair-state to fix them.",
+			inconsistent, len(appNames), authoritative)
+	}
+	fmt.Printf("All %d app(s) are consistent across %d backend(s).\n", len(appNames), len(ds.BackendNames()))
+
+	return nil
+}
+
+// RepairState copies records of inconsistent apps from the authoritative
+// deployment state backend to all the others
+func RepairState(c *commons.Context) error {
+	user, ok := c.CliContext.App.Metadata["user"].(*aws.User)
+	if !ok {
+		return fmt.Errorf("Unable to find AWS User in metadata")
+	}
+	ds, ok := c.CliContext.App.Metadata["ds"].(*deploymentstate.DeploymentState)
+	if !ok {
+		return fmt.Errorf("Unable to find Deployment State in metadata")
+	}
+	currentIp, ok := c.CliContext.App.Metadata["current_ip"].(string)
+	if !ok {
+		fmt.Print(colour.boldYellow("Note: We were unable to detect your IP address\n"))
+	}
+
+	authoritative, err := authoritativeBackend(c, ds)
+	if err != nil {
+		return err
+	}
+
+	appNames, err := ds.ListAllApplicationNames()
+	if err != nil {
+		return err
+	}
+
+	inconsistentApps := make([]string, 0)
+	for _, appName := range appNames {
+		diffs, err := ds.CheckApplication(appName, authoritative)
+		if err != nil {
+			return err
+		}
+		if len(diffs) == 0 {
+			continue
+		}
+		inconsistentApps = append(inconsistentApps, appName)
+		fmt.Printf("%s\n", colour.boldWhite(appName+":"))
+		printRecordDiffs(diffs)
+	}
+	if len(inconsistentApps) == 0 {
+		fmt.Printf("All %d app(s) are consistent, nothing to repair.\n", len(appNames))
+		return nil
+	}
+	fmt.Println("")
+
+	pilot := &schema.DeployPilot{
+		AWSApiCaller: user.Arn,
+		IPAddress:    currentIp,
+	}
+	note := fmt.Sprintf("It looks like you want to overwrite deployment state of %d app(s) in %s "+
+		"with records from backend %s. Extra records will be left untouched.",
+		len(inconsistentApps), c.String("env"), authoritative)
+	_, confirmed, err := clippy.BoolPrompt(note, c.Bool("y"), isEnvironmentSensitive(c.String("env")), func() (interface{}, error) {
+		for _, appName := range inconsistentApps {
+			err := repairApplication(ds, appName, authoritative, pilot)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if confirmed {
+		fmt.Printf("Deployment state of %d app(s) %s.\n", len(inconsistentApps), colour.green("repaired"))
+	}
+
+	return nil
+}
+
+func repairApplication(ds *deploymentstate.DeploymentState, appName, authoritative string,
+	pilot *schema.DeployPilot) error {
+	lock, err := ds.AcquireLock(appName, pilot, "repair-state", "", deploymentstate.DefaultLockTTL)
+	if err != nil {
+		return err
+	}
+	if lock != nil {
+		defer func() {
+			err := ds.ReleaseLock(appName, lock)
+			if err != nil {
+				log.Printf("[ERROR] Failed to release lock of %q: %s", appName, err)
+			}
+		}()
+	}
+
+	repairs, err := ds.RepairApplication(appName, authoritative)
+	for backendName, m := range repairs {
+		fmt.Printf("%s %s: %d copied, %d overwritten\n", colour.boldWhite(appName+":"), backendName,
+			m.Count(deploymentstate.RecordCopied), m.Count(deploymentstate.RecordOverwritten))
+	}
+	return err
+}
+
+func authoritativeBackend(c *commons.Context, ds *deploymentstate.DeploymentState) (string, error) {
+	names := ds.BackendNames()
+	if len(names) < 2 {
+		return "", fmt.Errorf("Only one deployment state backend configured (%s), nothing to compare.",
+			strings.Join(names, ", "))
+	}
+
+	authoritative := c.String("authoritative")
+	if authoritative == "" {
+		authoritative = names[0]
+	}
+	found := false
+	for _, name := range names {
+		if name == authoritative {
+			found = true
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("Backend %q is not configured, available: %s",
+			authoritative, strings.Join(names, ", "))
+	}
+	fmt.Printf("%s Comparing backends %s against %s.\n\n", colour.boldWhite("Note:"),
+		strings.Join(names, ", "), colour.boldWhite(authoritative))
+
+	return authoritative, nil
+}
+
+func printRecordDiffs(diffs []*deploymentstate.RecordDiff) {
+	for _, d := range diffs {
+		problem := d.Problem
+		switch d.Problem {
+		case deploymentstate.RecordMissing:
+			problem = colour.red("missing in " + d.Backend)
+		case deploymentstate.RecordDifferent:
+			problem = colour.boldYellow("different in " + d.Backend)
+		case deploymentstate.RecordExtra:
+			problem = colour.boldYellow("only in " + d.Backend)
+		}
+		fmt.Printf(" - %s %s: %s\n", d.Kind, d.Id, problem)
+	}
+}
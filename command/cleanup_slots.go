@@ -6,6 +6,7 @@ import (
 
 	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
 	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
 	"github.com/ninibe/bigduration"
 )
 
@@ -36,9 +37,10 @@ func CleanupSlots(c *commons.Context) error {
 	borderline := time.Now().Add(-1 * d.Duration())
 
 	for _, s := range slots {
-		if s.LastTerraformRun == nil {
+		if s.GetLastDeploymentStatus() == schema.DeploymentInProgress {
 			if isVerbose {
-				fmt.Printf("Skipping %q as it is %s.\n", s.SlotId, colour.boldYellow("being deployed"))
+				fmt.Printf("Skipping %q as it is %s (see stale-deployments if it's stuck).\n",
+					s.SlotId, colour.boldYellow("being deployed"))
 			}
 			continue
 		}
@@ -19,7 +19,27 @@ import (
 	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
 )
 
+// deployOptions alter where deploy takes variables from
+type deployOptions struct {
+	// ReuseVars makes variables of the slot's last deployment
+	// the base, which can be overridden via -var
+	ReuseVars bool
+
+	// RollbackTo is a previous deployment of the slot whose variables
+	// (and configs) are deployed again
+	RollbackTo *schema.DeploymentData
+}
+
 func Deploy(c *commons.Context) error {
+	return deploy(c, &deployOptions{ReuseVars: c.Bool("reuse-vars")})
+}
+
+// Redeploy deploys a slot again with variables of its last deployment
+func Redeploy(c *commons.Context) error {
+	return deploy(c, &deployOptions{ReuseVars: true})
+}
+
+func deploy(c *commons.Context, opts *deployOptions) error {
 	user, ok := c.CliContext.App.Metadata["user"].(*aws.User)
 	if !ok {
 		return fmt.Errorf("Unable to find AWS User in metadata")
@@ -57,7 +77,30 @@ func Deploy(c *commons.Context) error {
 		return deprecatedGitError()
 	}
 
+	var savedPlan *schema.PlanData
+	if planId := c.String("plan-id"); planId != "" {
+		if c.String("slot-prefix") != "" {
+			return errors.New("You can specify either 'plan-id' or 'slot-prefix', not both.")
+		}
+		if len(c.StringSlice("var")) > 0 || c.String("target") != "" || opts.ReuseVars {
+			return errors.New("Variables & target are part of the saved plan and can't be changed.")
+		}
+		savedPlan, err = ds.GetPlan(c.String("app"), planId)
+		if err != nil {
+			return err
+		}
+		if savedPlan.SlotId == "" {
+			return fmt.Errorf("Plan %q is a plan of infrastructure, use apply-infra instead.", planId)
+		}
+		if c.String("slot-id") != "" && c.String("slot-id") != savedPlan.SlotId {
+			return fmt.Errorf("Plan %q was created for slot %q, not %q.", planId, savedPlan.SlotId, c.String("slot-id"))
+		}
+	}
+
 	slotId := c.String("slot-id")
+	if savedPlan != nil {
+		slotId = savedPlan.SlotId
+	}
 	slotPrefix := c.String("slot-prefix")
 	if slotId == "" && slotPrefix == "" {
 		return fmt.Errorf("'slot-id' or 'slot-prefix' is required parameter for %q (migrated app)", c.String("app"))
@@ -65,6 +108,9 @@ func Deploy(c *commons.Context) error {
 	if slotId != "" && slotPrefix != "" {
 		return errors.New("You can specify either 'slot-id' or 'slot-prefix', not both.")
 	}
+	if slotPrefix != "" && opts.ReuseVars {
+		return errors.New("Variables can only be reused for a given 'slot-id', 'slot-prefix' always deploys a new slot.")
+	}
 
 	if c.CliContext.NArg() < 1 {
 		return fmt.Errorf("You need to supply a path to Terraform configs of %q.", slotId)
@@ -88,6 +134,23 @@ func Deploy(c *commons.Context) error {
 		fmt.Printf("Last slot ID is %s, preparing deploy into %s\n", oldSlotId, colour.boldWhite(slotId))
 	}
 
+	err = checkTerraformVersionOfSlot(c, ds, slotId)
+	if err != nil {
+		return err
+	}
+
+	var lastVariables, baseVariables map[string]string
+	if opts.ReuseVars || opts.RollbackTo != nil {
+		lastVariables, err = lastVariablesOfSlot(ds, c.String("app"), slotId)
+		if err != nil {
+			return err
+		}
+		baseVariables = lastVariables
+	}
+	if opts.RollbackTo != nil {
+		baseVariables = opts.RollbackTo.Terraform.Variables
+	}
+
 	rootDir := path.Join(cfgPath, c.CliContext.Args().First())
 	if rootDir == cfgPath {
 		return fmt.Errorf("Terraform configs for a slot have to be in a separate dir, not in %q!", cfgPath)
@@ -124,6 +187,14 @@ func Deploy(c *commons.Context) error {
 	tfVariables["app_name"] = c.String("app")
 	tfVariables["app_version"] = slotId
 	tfVariables["environment"] = c.String("env")
+	if baseVariables != nil {
+		tfVariables = mergeVariables(baseVariables, tfVariables)
+		printVariablesDiff(fmt.Sprintf("Variables compared to the last deployment of %s", slotId),
+			lastVariables, tfVariables)
+	}
+	if savedPlan != nil {
+		tfVariables = savedPlan.Variables
+	}
 
 	remoteState, err := terraform.GetRemoteStateForSlotId(&terraform.RemoteState{
 		Backend: rs.Backend,
@@ -135,21 +206,46 @@ func Deploy(c *commons.Context) error {
 
 	planStartTime := time.Now().UTC()
 	planFilePath := path.Join(rootDir, slotId+"-planfile")
+	checksum, err := configChecksum(rootDir, planFilePath)
+	if err != nil {
+		return err
+	}
+	if opts.RollbackTo != nil {
+		err = checkRollbackConfigs(opts.RollbackTo, checksum)
+		if err != nil {
+			return err
+		}
+	}
 	filesToCleanup = append(filesToCleanup, path.Join(rootDir, ".terraform"))
 	filesToCleanup = append(filesToCleanup, path.Join(rootDir, "terraform.tfstate.backup"))
 	filesToCleanup = append(filesToCleanup, planFilePath)
-	out, err := terraform.FreshPlan(&terraform.FreshPlanInput{
-		RemoteState:  remoteState,
-		RootPath:     rootDir,
-		PlanFilePath: planFilePath,
-		Variables:    tfVariables,
-		Refresh:      true,
-		Target:       c.String("target"),
-		Destroy:      false,
-		XLegacy:      c.Bool("x"),
-	})
+	var out *terraform.PlanOutput
+	if savedPlan != nil {
+		var lastDeploymentId string
+		lastDeploymentId, err = lastDeploymentIdOfSlot(ds, c.String("app"), slotId)
+		if err != nil {
+			return err
+		}
+		out, err = prepareSavedPlan(savedPlan, remoteState, rootDir, planFilePath, lastDeploymentId, time.Time{})
+		planStartTime = savedPlan.PlanStartTime
+	} else {
+		out, err = terraform.FreshPlan(&terraform.FreshPlanInput{
+			RemoteState:  remoteState,
+			RootPath:     rootDir,
+			PlanFilePath: planFilePath,
+			Variables:    tfVariables,
+			Refresh:      true,
+			Target:       c.String("target"),
+			Destroy:      false,
+			XLegacy:      c.Bool("x"),
+			WithValues:   c.Bool("store-values"),
+		})
+	}
 	filesToCleanup = append(filesToCleanup, terraform.GetBackendConfigFilename(rootDir))
 	planFinishTime := time.Now().UTC()
+	if savedPlan != nil {
+		planFinishTime = savedPlan.PlanFinishTime
+	}
 	if err != nil {
 		return err
 	}
@@ -175,18 +271,31 @@ func Deploy(c *commons.Context) error {
 	isSensitive := isEnvironmentSensitive(c.String("env"))
 	var applyStartTime time.Time
 	var data *schema.DeploymentData
+	var trap *interruptTrap
 	applyOut, confirmed, err := clippy.BoolPrompt(note, yesOverride, isSensitive, func() (interface{}, error) {
 		var err error
 		pilot := &schema.DeployPilot{
 			AWSApiCaller: user.Arn,
 			IPAddress:    currentIp,
 		}
+		tfVersion, err := terraform.Version()
+		if err != nil {
+			return nil, err
+		}
+		rollbackOf := ""
+		if opts.RollbackTo != nil {
+			rollbackOf = opts.RollbackTo.DeploymentId
+		}
 		startTime := time.Now().UTC()
-		data, err = ds.BeginDeployment(c.String("app"), slotId, false, pilot, startTime, tfVariables)
+		data, err = ds.BeginDeployment(c.String("app"), slotId, false, pilot, tfVersion, startTime, tfVariables,
+			checksum, rollbackOf)
 		if err != nil {
 			return nil, err
 		}
 
+		trap = trapInterrupts("Waiting for Terraform to stop, so the deployment can be recorded...")
+		defer trap.Stop()
+
 		applyStartTime = time.Now().UTC()
 		input := terraform.ApplyInput{
 			RootPath:     rootDir,
@@ -203,6 +312,18 @@ func Deploy(c *commons.Context) error {
 		return cleanupFilePaths(filesToCleanup)
 	}
 	if err != nil {
+		if data != nil {
+			finishFailedDeployment(ds, c.String("app"), slotId, rootDir, data, &schema.FinishedTerraformRun{
+				PlanStartTime:   planStartTime,
+				PlanFinishTime:  planFinishTime,
+				ResourceChanges: out.Diff.Changes,
+				StartTime:       applyStartTime,
+				FinishTime:      time.Now().UTC(),
+				ExitCode:        1,
+				Stderr:          err.Error(),
+				Interrupted:     trap.Interrupted(),
+			})
+		}
 		return fmt.Errorf("Apply operation failed: %s", err)
 	}
 
@@ -216,15 +337,17 @@ func Deploy(c *commons.Context) error {
 	isActive = !isStateEmpty
 
 	err = ds.FinishDeployment(c.String("app"), slotId, data.DeploymentId, isActive, data, &schema.FinishedTerraformRun{
-		PlanStartTime:  planStartTime,
-		PlanFinishTime: planFinishTime,
-		StartTime:      applyStartTime,
-		FinishTime:     time.Now().UTC(),
-		ResourceDiff:   ao.Diff,
-		Outputs:        ao.Outputs,
-		ExitCode:       ao.ExitCode,
-		Warnings:       ao.Warnings,
-		Stderr:         ao.Stderr,
+		PlanStartTime:   planStartTime,
+		PlanFinishTime:  planFinishTime,
+		ResourceChanges: out.Diff.Changes,
+		StartTime:       applyStartTime,
+		FinishTime:      time.Now().UTC(),
+		ResourceDiff:    ao.Diff,
+		Outputs:         ao.Outputs,
+		ExitCode:        ao.ExitCode,
+		Warnings:        ao.Warnings,
+		Stderr:          ao.Stderr,
+		Interrupted:     trap.Interrupted(),
 	})
 	if err != nil {
 		return fmt.Errorf("Finishing deployment failed: %s", err)
@@ -238,6 +361,18 @@ func Deploy(c *commons.Context) error {
 
 	fmt.Printf("Apply TimeStamp: %v\n\n", appData.LastDeploymentTime)
 
+	if savedPlan != nil && ao.ExitCode == 0 {
+		// Applied plan is stale, so there's no point keeping it
+		err = ds.DeletePlan(c.String("app"), savedPlan.PlanId)
+		if err != nil {
+			log.Printf("[WARN] Failed to delete applied plan %s: %s", savedPlan.PlanId, err)
+		}
+	}
+
+	if trap.Interrupted() {
+		return fmt.Errorf("Apply operation was interrupted (exit code %d). Stderr:\n%s",
+			ao.ExitCode, ao.Stderr)
+	}
 	if ao.ExitCode != 0 {
 		return fmt.Errorf("Apply operation failed (exit code %d). Stderr:\n%s",
 			ao.ExitCode, ao.Stderr)
@@ -87,6 +87,11 @@ func DeployDestroy(c *commons.Context) error {
 		return fmt.Errorf("You need to supply a path to Terraform configs of %q.", slotId)
 	}
 
+	err = checkTerraformVersionOfSlot(c, ds, slotId)
+	if err != nil {
+		return err
+	}
+
 	rootDir := path.Join(cfgPath, c.CliContext.Args().First())
 	if rootDir == cfgPath {
 		return fmt.Errorf("Terraform configs for a slot have to be in a separate dir, not in %q!", cfgPath)
@@ -146,6 +151,7 @@ func DeployDestroy(c *commons.Context) error {
 		Target:      c.String("target"),
 		Destroy:     true,
 		XLegacy:     c.Bool("x"),
+		WithValues:  c.Bool("store-values"),
 	})
 	filesToCleanup = append(filesToCleanup, terraform.GetBackendConfigFilename(rootDir))
 	planFinishTime := time.Now().UTC()
@@ -173,19 +179,26 @@ func DeployDestroy(c *commons.Context) error {
 	isSensitive := isEnvironmentSensitive(c.String("env"))
 	var destroyStartTime time.Time
 	var data *schema.DeploymentData
+	var trap *interruptTrap
 	destroyOut, confirmed, err := clippy.BoolPrompt(note, yesOverride, isSensitive, func() (interface{}, error) {
 		destroyStartTime = time.Now().UTC()
 		pilot := &schema.DeployPilot{
 			AWSApiCaller: user.Arn,
 			IPAddress:    currentIp,
 		}
-		var err error
+		tfVersion, err := terraform.Version()
+		if err != nil {
+			return nil, err
+		}
 		startTime := time.Now().UTC()
-		data, err = ds.BeginDeployment(c.String("app"), slotId, true, pilot, startTime, tfVariables)
+		data, err = ds.BeginDeployment(c.String("app"), slotId, true, pilot, tfVersion, startTime, tfVariables, "", "")
 		if err != nil {
 			return nil, err
 		}
 
+		trap = trapInterrupts("Waiting for Terraform to stop, so the deployment can be recorded...")
+		defer trap.Stop()
+
 		input := terraform.DestroyInput{
 			RootPath:     rootDir,
 			Target:       "",
@@ -201,6 +214,18 @@ func DeployDestroy(c *commons.Context) error {
 		return cleanupFilePaths(filesToCleanup)
 	}
 	if err != nil {
+		if data != nil {
+			finishFailedDeployment(ds, c.String("app"), slotId, rootDir, data, &schema.FinishedTerraformRun{
+				PlanStartTime:   planStartTime,
+				PlanFinishTime:  planFinishTime,
+				ResourceChanges: out.Diff.Changes,
+				StartTime:       destroyStartTime,
+				FinishTime:      time.Now().UTC(),
+				ExitCode:        1,
+				Stderr:          err.Error(),
+				Interrupted:     trap.Interrupted(),
+			})
+		}
 		return fmt.Errorf("Destroy operation failed: %s", err)
 	}
 
@@ -214,14 +239,16 @@ func DeployDestroy(c *commons.Context) error {
 	isActive = !isStateEmpty
 
 	err = ds.FinishDeployment(c.String("app"), slotId, data.DeploymentId, isActive, data, &schema.FinishedTerraformRun{
-		PlanStartTime:  planStartTime,
-		PlanFinishTime: planFinishTime,
-		StartTime:      destroyStartTime,
-		FinishTime:     time.Now().UTC(),
-		ResourceDiff:   do.Diff,
-		ExitCode:       do.ExitCode,
-		Warnings:       do.Warnings,
-		Stderr:         do.Stderr,
+		PlanStartTime:   planStartTime,
+		PlanFinishTime:  planFinishTime,
+		ResourceChanges: out.Diff.Changes,
+		StartTime:       destroyStartTime,
+		FinishTime:      time.Now().UTC(),
+		ResourceDiff:    do.Diff,
+		ExitCode:        do.ExitCode,
+		Warnings:        do.Warnings,
+		Stderr:          do.Stderr,
+		Interrupted:     trap.Interrupted(),
 	})
 	if err != nil {
 		return fmt.Errorf("Finishing deployment failed: %s", err)
@@ -243,6 +270,9 @@ func DeployDestroy(c *commons.Context) error {
 		}
 	}
 
+	if trap.Interrupted() {
+		return fmt.Errorf("Destroy operation was interrupted. Errors:\n%s", do.Stderr)
+	}
 	if do.ExitCode != 0 {
 		return fmt.Errorf("Errors:\n%s", do.Stderr)
 	}
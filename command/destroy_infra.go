@@ -48,6 +48,11 @@ func DestroyInfra(c *commons.Context) error {
 		return deprecatedGitError()
 	}
 
+	err = checkTerraformVersionOfInfra(c, appData)
+	if err != nil {
+		return err
+	}
+
 	slotData, err := ds.ListSlots(c.String("app"))
 	if err != nil {
 		return err
@@ -165,6 +170,10 @@ func DestroyInfra(c *commons.Context) error {
 	isActive = !isStateEmpty
 
 	appData.LastInfraChangeTime = time.Now().UTC()
+	appData.LastTerraformVersion, err = terraform.Version()
+	if err != nil {
+		return err
+	}
 	err = FinishApplicationOperation(c.String("app"), appData, isActive, nil, ds)
 	if err != nil {
 		return err
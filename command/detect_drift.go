@@ -0,0 +1,347 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
+	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+	"github.com/MeredithCorpOSS/ape-dev-rt/hcl"
+	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
+	"github.com/urfave/cli"
+)
+
+const (
+	DriftNone    = "no-changes"
+	DriftPending = "drifted"
+	DriftFailed  = "failed"
+	DriftSkipped = "skipped"
+
+	// Exit code of detect-drift when any changes are pending
+	// (same as `terraform plan -detailed-exitcode`)
+	driftExitCode = 2
+)
+
+// DriftReport is what detect-drift prints with -json
+type DriftReport struct {
+	App         string         `json:"app"`
+	Environment string         `json:"environment"`
+	Drifted     bool           `json:"drifted"`
+	Failed      bool           `json:"failed"`
+	Targets     []*DriftTarget `json:"targets"`
+}
+
+// DriftTarget is the result of planning either the app's infra or a slot
+type DriftTarget struct {
+	SlotId   string         `json:"slot_id,omitempty"` // empty for infra
+	Status   string         `json:"status"`
+	ToCreate int            `json:"to_create"`
+	ToChange int            `json:"to_change"`
+	ToRemove int            `json:"to_remove"`
+	Changes  []*DriftChange `json:"changes,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// DriftChange is a pending change of a resource, values are left out
+// as these may be sensitive
+type DriftChange struct {
+	Address string `json:"address"`
+	Action  string `json:"action"`
+}
+
+func (t *DriftTarget) Name() string {
+	if t.SlotId == "" {
+		return "infra"
+	}
+	return "slot " + t.SlotId
+}
+
+func (r *DriftReport) add(t *DriftTarget) {
+	r.Targets = append(r.Targets, t)
+	switch t.Status {
+	case DriftPending:
+		r.Drifted = true
+	case DriftFailed:
+		r.Failed = true
+	}
+}
+
+// DetectDrift plans the app's infra and all active slots with variables
+// they were last applied with and reports which ones have pending changes.
+// It exits with 1 if any plan failed, 2 if any changes are pending, 0 otherwise.
+func DetectDrift(c *commons.Context) error {
+	user, ok := c.CliContext.App.Metadata["user"].(*aws.User)
+	if !ok {
+		return fmt.Errorf("Unable to find AWS User in metadata")
+	}
+
+	rs, ok := c.CliContext.App.Metadata["remote_state"].(*hcl.RemoteState)
+	if !ok {
+		return fmt.Errorf("Unable to find Remote State in metadata")
+	}
+
+	ds, ok := c.CliContext.App.Metadata["ds"].(*deploymentstate.DeploymentState)
+	if !ok {
+		return fmt.Errorf("Unable to find Deployment State in metadata")
+	}
+
+	cfgPath, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	// Existing apps only, detect-drift is meant to run unattended
+	appData, err := ds.GetApplication(c.String("app"))
+	if err != nil {
+		return err
+	}
+	if appData.UseCentralGitRepo {
+		return deprecatedGitError()
+	}
+
+	slots, err := ds.ListSlots(c.String("app"))
+	if err != nil {
+		return err
+	}
+	activeSlots := make([]*schema.SlotData, 0)
+	for _, s := range slots {
+		if s.IsActive {
+			activeSlots = append(activeSlots, s)
+		}
+	}
+
+	slotsDir := ""
+	if len(activeSlots) > 0 {
+		if c.CliContext.NArg() < 1 {
+			return fmt.Errorf("You need to supply a path to Terraform configs of slots (%d active).", len(activeSlots))
+		}
+		slotsDir = path.Join(cfgPath, c.CliContext.Args().First())
+		if slotsDir == cfgPath {
+			return fmt.Errorf("Terraform configs for a slot have to be in a separate dir, not in %q!", cfgPath)
+		}
+		_, err = os.Stat(slotsDir)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%q does not exist", slotsDir)
+		}
+	}
+
+	isJSON := c.Bool("json")
+	// Terraform output would break JSON, so it's discarded
+	var stdoutW, stderrW io.Writer
+	if isJSON {
+		stdoutW, stderrW = ioutil.Discard, ioutil.Discard
+	}
+
+	namespace := user.AccountID
+	if c.String("namespace") != "default" {
+		namespace = c.String("namespace")
+	}
+
+	report := &DriftReport{
+		App:         c.String("app"),
+		Environment: c.String("env"),
+		Targets:     make([]*DriftTarget, 0),
+	}
+
+	infra := &DriftTarget{Status: DriftSkipped}
+	if appData.IsActive {
+		infra = detectInfraDrift(c, appData, rs, namespace, cfgPath, stdoutW, stderrW)
+	}
+	report.add(infra)
+	if !isJSON {
+		printDriftTarget(infra)
+	}
+
+	if len(activeSlots) > 0 {
+		templateVars := VersionTemplateVars{
+			AwsAccountId: namespace,
+			Environment:  c.String("env"),
+			AppName:      c.String("app"),
+		}
+		filesToCleanup, err := commons.ProcessTemplates(slotsDir, "tpl", templateVars)
+		if err != nil {
+			return err
+		}
+		filesToCleanup = append(filesToCleanup,
+			path.Join(slotsDir, ".terraform"),
+			path.Join(slotsDir, "terraform.tfstate.backup"),
+			terraform.GetBackendConfigFilename(slotsDir))
+
+		// Slots share the directory with configs, so these can't be planned concurrently
+		for _, s := range activeSlots {
+			t := detectSlotDrift(c, s, rs, user.AccountID, slotsDir, stdoutW, stderrW)
+			filesToCleanup = append(filesToCleanup, path.Join(slotsDir, s.SlotId+"-driftplan"))
+			report.add(t)
+			if !isJSON {
+				printDriftTarget(t)
+			}
+		}
+
+		err = cleanupFilePaths(filesToCleanup)
+		if err != nil {
+			return err
+		}
+	}
+
+	if isJSON {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	}
+
+	if report.Failed {
+		return fmt.Errorf("Drift detection failed for some targets of %q, see the report.", c.String("app"))
+	}
+	if report.Drifted {
+		// Empty message, so that nothing but the report is printed
+		return cli.NewExitError("", driftExitCode)
+	}
+	if !isJSON {
+		fmt.Println(colour.boldGreen("No drift detected."))
+	}
+	return nil
+}
+
+func detectInfraDrift(c *commons.Context, appData *schema.ApplicationData, rs *hcl.RemoteState,
+	namespace, rootDir string, stdoutW, stderrW io.Writer) *DriftTarget {
+	t := &DriftTarget{}
+
+	if appData.InfraVariables == nil {
+		t.Status = DriftSkipped
+		t.Error = "No variables recorded for the infra (recorded by apply-infra)"
+		return t
+	}
+	tfVariables := make(map[string]string, len(appData.InfraVariables))
+	for k, v := range appData.InfraVariables {
+		tfVariables[k] = v
+	}
+
+	templateVars := ApplicationTemplateVars{
+		AwsAccountId: namespace,
+		AppName:      c.String("app"),
+		Environment:  c.String("env"),
+	}
+	filesToCleanup, err := commons.ProcessTemplates(rootDir, "tpl", templateVars)
+	if err != nil {
+		return failedDriftTarget(t, err)
+	}
+	planFilePath := path.Join(rootDir, "driftplan")
+	filesToCleanup = append(filesToCleanup,
+		path.Join(rootDir, ".terraform"),
+		planFilePath,
+		terraform.GetBackendConfigFilename(rootDir))
+	defer cleanupFilePaths(filesToCleanup)
+
+	remoteState, err := terraform.GetRemoteStateForApp(&terraform.RemoteState{
+		Backend: rs.Backend,
+		Config:  rs.Config,
+	}, namespace, c.String("app"))
+	if err != nil {
+		return failedDriftTarget(t, err)
+	}
+
+	return planDriftTarget(t, &terraform.FreshPlanInput{
+		RemoteState:  remoteState,
+		RootPath:     rootDir,
+		PlanFilePath: planFilePath,
+		Variables:    tfVariables,
+		Refresh:      true,
+		StdoutWriter: stdoutW,
+		StderrWriter: stderrW,
+	})
+}
+
+func detectSlotDrift(c *commons.Context, slot *schema.SlotData, rs *hcl.RemoteState,
+	accountId, rootDir string, stdoutW, stderrW io.Writer) *DriftTarget {
+	t := &DriftTarget{SlotId: slot.SlotId}
+
+	if slot.LastTerraformRun == nil || slot.LastTerraformRun.Variables == nil {
+		t.Status = DriftSkipped
+		t.Error = "No variables recorded for the slot"
+		return t
+	}
+	tfVariables := make(map[string]string, len(slot.LastTerraformRun.Variables))
+	for k, v := range slot.LastTerraformRun.Variables {
+		tfVariables[k] = v
+	}
+
+	remoteState, err := terraform.GetRemoteStateForSlotId(&terraform.RemoteState{
+		Backend: rs.Backend,
+		Config:  rs.Config,
+	}, accountId, c.String("app"), slot.SlotId)
+	if err != nil {
+		return failedDriftTarget(t, err)
+	}
+
+	return planDriftTarget(t, &terraform.FreshPlanInput{
+		RemoteState:  remoteState,
+		RootPath:     rootDir,
+		PlanFilePath: path.Join(rootDir, slot.SlotId+"-driftplan"),
+		Variables:    tfVariables,
+		Refresh:      true,
+		StdoutWriter: stdoutW,
+		StderrWriter: stderrW,
+	})
+}
+
+func planDriftTarget(t *DriftTarget, input *terraform.FreshPlanInput) *DriftTarget {
+	out, err := terraform.FreshPlan(input)
+	if err != nil {
+		return failedDriftTarget(t, err)
+	}
+	if out.ExitCode != 0 {
+		return failedDriftTarget(t, fmt.Errorf("Planning failed (exit code %d). Stderr:\n%s",
+			out.ExitCode, out.Stderr))
+	}
+
+	t.ToCreate, t.ToChange, t.ToRemove = out.Diff.ToCreate, out.Diff.ToChange, out.Diff.ToRemove
+	for _, rc := range out.Diff.Changes {
+		t.Changes = append(t.Changes, &DriftChange{Address: rc.Address, Action: rc.Action})
+	}
+	t.Status = DriftNone
+	if t.ToCreate+t.ToChange+t.ToRemove > 0 {
+		t.Status = DriftPending
+	}
+	return t
+}
+
+func failedDriftTarget(t *DriftTarget, err error) *DriftTarget {
+	t.Status = DriftFailed
+	t.Error = err.Error()
+	return t
+}
+
+func printDriftTarget(t *DriftTarget) {
+	switch t.Status {
+	case DriftNone:
+		fmt.Printf("%s: %s\n", colour.boldWhite(t.Name()), colour.green("no changes"))
+	case DriftPending:
+		fmt.Printf("%s: %s (%d to add, %d to change, %d to destroy)\n", colour.boldWhite(t.Name()),
+			colour.boldYellow("drifted"), t.ToCreate, t.ToChange, t.ToRemove)
+		for _, rc := range t.Changes {
+			fmt.Printf(" %s %s\n", colourResourceAction(rc.Action), rc.Address)
+		}
+	case DriftFailed:
+		fmt.Printf("%s: %s\n%s\n", colour.boldWhite(t.Name()), colour.boldRed("failed"),
+			indentLines(t.Error, "  "))
+	case DriftSkipped:
+		reason := "inactive"
+		if t.Error != "" {
+			reason = t.Error
+		}
+		fmt.Printf("%s: skipped (%s)\n", colour.boldWhite(t.Name()), reason)
+	}
+}
+
+func indentLines(s, indent string) string {
+	return indent + strings.Replace(strings.TrimRight(s, "\n"), "\n", "\n"+indent, -1)
+}
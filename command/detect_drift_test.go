@@ -0,0 +1,60 @@
+package command
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+)
+
+func TestDriftReport(t *testing.T) {
+	r := &DriftReport{App: "test-app", Environment: "test", Targets: make([]*DriftTarget, 0)}
+	r.add(&DriftTarget{Status: DriftNone})
+	r.add(&DriftTarget{SlotId: "blue", Status: DriftSkipped})
+	if r.Drifted || r.Failed {
+		t.Fatalf("Expected no drift & no failure, given: %#v", r)
+	}
+
+	r.add(&DriftTarget{SlotId: "green", Status: DriftPending, ToChange: 1,
+		Changes: []*DriftChange{{Address: "aws_instance.web", Action: "update"}}})
+	if !r.Drifted || r.Failed {
+		t.Fatalf("Expected drift & no failure, given: %#v", r)
+	}
+	r.add(&DriftTarget{SlotId: "red", Status: DriftFailed, Error: "boom"})
+	if !r.Failed {
+		t.Fatalf("Expected failure, given: %#v", r)
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"app":"test-app","environment":"test","drifted":true,"failed":true,"targets":[` +
+		`{"status":"no-changes","to_create":0,"to_change":0,"to_remove":0},` +
+		`{"slot_id":"blue","status":"skipped","to_create":0,"to_change":0,"to_remove":0},` +
+		`{"slot_id":"green","status":"drifted","to_create":0,"to_change":1,"to_remove":0,` +
+		`"changes":[{"address":"aws_instance.web","action":"update"}]},` +
+		`{"slot_id":"red","status":"failed","to_create":0,"to_change":0,"to_remove":0,"error":"boom"}]}`
+	if string(b) != expected {
+		t.Fatalf("Unexpected JSON.\nGiven:    %s\nExpected: %s", b, expected)
+	}
+}
+
+func TestDetectInfraDrift_noVariables(t *testing.T) {
+	appData := &schema.ApplicationData{IsActive: true}
+	target := detectInfraDrift(nil, appData, nil, "", "", nil, nil)
+	if target.Status != DriftSkipped {
+		t.Fatalf("Expected infra without recorded variables to be %q, given: %q", DriftSkipped, target.Status)
+	}
+}
+
+func TestIndentLines(t *testing.T) {
+	given := indentLines("first\nsecond\n", "  ")
+	if given != "  first\n  second" {
+		t.Fatalf("Unexpected output: %q", given)
+	}
+	if strings.Count(indentLines("single", "  "), "\n") != 0 {
+		t.Fatal("Expected single line to stay single")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
 	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
 	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
 	"github.com/MeredithCorpOSS/ape-dev-rt/hcl"
 	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
 )
@@ -32,6 +33,8 @@ func DiffDeploy(c *commons.Context) error {
 		return fmt.Errorf("Unable to find Remote State in metadata")
 	}
 
+	currentIp, _ := c.CliContext.App.Metadata["current_ip"].(string)
+
 	cfgPath, err := os.Getwd()
 	if err != nil {
 		return err
@@ -53,6 +56,11 @@ func DiffDeploy(c *commons.Context) error {
 	if slotId != "" && slotPrefix != "" {
 		return errors.New("You can specify either 'slot-id' or 'slot-prefix', not both.")
 	}
+	if slotPrefix != "" && c.Bool("save-plan") {
+		// Slot counters aren't incremented by diff-deploy,
+		// so the slot of a saved plan could be taken by another deployment
+		return errors.New("Plans can only be saved for a given 'slot-id'.")
+	}
 
 	if c.CliContext.NArg() < 1 {
 		return fmt.Errorf("You need to supply a path to Terraform configs of %q.", slotId)
@@ -121,8 +129,20 @@ func DiffDeploy(c *commons.Context) error {
 		return err
 	}
 
-	planStartTime := time.Now().UTC()
 	planFilePath := path.Join(rootDir, slotId+"-planfile")
+	var checksum, lastDeploymentId string
+	if c.Bool("save-plan") {
+		checksum, err = configChecksum(rootDir, planFilePath)
+		if err != nil {
+			return err
+		}
+		lastDeploymentId, err = lastDeploymentIdOfSlot(ds, c.String("app"), slotId)
+		if err != nil {
+			return err
+		}
+	}
+
+	planStartTime := time.Now().UTC()
 	filesToCleanup = append(filesToCleanup, path.Join(rootDir, ".terraform"))
 	filesToCleanup = append(filesToCleanup, path.Join(rootDir, "terraform.tfstate.backup"))
 	filesToCleanup = append(filesToCleanup, planFilePath)
@@ -135,6 +155,7 @@ func DiffDeploy(c *commons.Context) error {
 		Target:       c.String("target"),
 		Destroy:      false,
 		XLegacy:      c.Bool("x"),
+		WithValues:   c.Bool("store-values"),
 	})
 	filesToCleanup = append(filesToCleanup, terraform.GetBackendConfigFilename(rootDir))
 	planFinishTime := time.Now().UTC()
@@ -150,5 +171,32 @@ func DiffDeploy(c *commons.Context) error {
 			out.ExitCode, out.Stderr)
 	}
 
+	if c.Bool("save-plan") {
+		diff := out.Diff
+		if diff.ToChange+diff.ToCreate+diff.ToRemove == 0 && !c.Bool("f") {
+			fmt.Println("No changes planned, plan was not saved.")
+			return cleanupFilePaths(filesToCleanup)
+		}
+
+		planId, err := savePlan(ds, c.String("app"), planFilePath, &schema.PlanData{
+			SlotId: slotId,
+			CreatedBy: &schema.DeployPilot{
+				AWSApiCaller: user.Arn,
+				IPAddress:    currentIp,
+			},
+			PlanStartTime:    planStartTime,
+			PlanFinishTime:   planFinishTime,
+			Variables:        tfVariables,
+			ConfigChecksum:   checksum,
+			LastDeploymentId: lastDeploymentId,
+			Diff:             out.Diff,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Plan saved as %s, apply it via:\n  ape-dev-rt deploy -env=%s -app=%s -plan-id=%s %s\n",
+			colour.boldWhite(planId), c.String("env"), c.String("app"), planId, c.CliContext.Args().First())
+	}
+
 	return cleanupFilePaths(filesToCleanup)
 }
@@ -10,6 +10,9 @@ import (
 
 	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
 	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/backends"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
 	"github.com/MeredithCorpOSS/ape-dev-rt/hcl"
 	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
 )
@@ -25,6 +28,13 @@ func DiffInfra(c *commons.Context) error {
 		return fmt.Errorf("Unable to find Remote State in metadata")
 	}
 
+	ds, ok := c.CliContext.App.Metadata["ds"].(*deploymentstate.DeploymentState)
+	if !ok {
+		return fmt.Errorf("Unable to find Deployment State in metadata")
+	}
+
+	currentIp, _ := c.CliContext.App.Metadata["current_ip"].(string)
+
 	cfgPath, err := os.Getwd()
 	if err != nil {
 		return err
@@ -65,8 +75,25 @@ func DiffInfra(c *commons.Context) error {
 
 	tfVariables["app_name"] = c.String("app")
 	tfVariables["environment"] = c.String("env")
-	planStartTime := time.Now().UTC()
 	planFilePath := path.Join(rootDir, "planfile")
+	var checksum string
+	var lastInfraChangeTime time.Time
+	if c.Bool("save-plan") {
+		checksum, err = configChecksum(rootDir, planFilePath)
+		if err != nil {
+			return err
+		}
+		appData, err := ds.GetApplication(c.String("app"))
+		if err != nil {
+			if _, ok := err.(*backends.AppNotFound); !ok {
+				return err
+			}
+		} else {
+			lastInfraChangeTime = appData.LastInfraChangeTime
+		}
+	}
+
+	planStartTime := time.Now().UTC()
 	filesToCleanup = append(filesToCleanup, path.Join(rootDir, ".terraform"))
 	filesToCleanup = append(filesToCleanup, planFilePath)
 	planOut, err := terraform.FreshPlan(&terraform.FreshPlanInput{
@@ -91,5 +118,31 @@ func DiffInfra(c *commons.Context) error {
 		return fmt.Errorf("Plan failed (exit code %d). Stderr:\n%v", planOut.ExitCode, planOut.Stderr)
 	}
 
+	if c.Bool("save-plan") {
+		diff := planOut.Diff
+		if diff.ToChange+diff.ToCreate+diff.ToRemove == 0 && !c.Bool("f") {
+			fmt.Println("No changes planned, plan was not saved.")
+			return cleanupFilePaths(filesToCleanup)
+		}
+
+		planId, err := savePlan(ds, c.String("app"), planFilePath, &schema.PlanData{
+			CreatedBy: &schema.DeployPilot{
+				AWSApiCaller: user.Arn,
+				IPAddress:    currentIp,
+			},
+			PlanStartTime:       planStartTime,
+			PlanFinishTime:      planFinishTime,
+			Variables:           tfVariables,
+			ConfigChecksum:      checksum,
+			LastInfraChangeTime: lastInfraChangeTime,
+			Diff:                planOut.Diff,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Plan saved as %s, apply it via:\n  ape-dev-rt apply-infra -env=%s -app=%s -plan-id=%s\n",
+			colour.boldWhite(planId), c.String("env"), c.String("app"), planId)
+	}
+
 	return cleanupFilePaths(filesToCleanup)
 }
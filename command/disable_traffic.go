@@ -9,6 +9,7 @@ import (
 	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
 	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
 	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
 	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 )
@@ -26,6 +27,11 @@ func DisableTraffic(c *commons.Context) error {
 		return err
 	}
 	log.Printf("[DEBUG] Received AWS Account: %#v", user)
+	currentIp, _ := c.CliContext.App.Metadata["current_ip"].(string)
+	pilot := &schema.DeployPilot{
+		AWSApiCaller: user.Arn,
+		IPAddress:    currentIp,
+	}
 
 	appData, exists, err := BeginApplicationOperation(c.String("env"), c.String("app"), ds)
 	if err != nil {
@@ -77,9 +83,9 @@ func DisableTraffic(c *commons.Context) error {
 	}
 	outputs := app.InfraOutputs
 
-	internalAppName, ok := outputs[terraform.AppName]
+	internalAppName, ok := outputs.GetString(terraform.AppName)
 	if !ok {
-		return fmt.Errorf("Output %q not found", terraform.AppName)
+		return fmt.Errorf("String output %q not found", terraform.AppName)
 	}
 
 	var scalingGroup string
@@ -103,7 +109,7 @@ func DisableTraffic(c *commons.Context) error {
 			if err != nil {
 				return err
 			}
-			balancers, err := regionalAWS.GetBalancersFromScalingGroup(scalingGroup)
+			balancers, err := regionalAWS.GetAllBalancersFromScalingGroup(scalingGroup)
 			if err != nil {
 				return err
 			}
@@ -117,8 +123,8 @@ func DisableTraffic(c *commons.Context) error {
 			"Do you intend to deprovision this slot/app? Use deploy-destroy instead.")
 	}
 
-	var balancers []string
-	balancers, err = regionalAWS.GetBalancersForApp(internalAppName)
+	var balancers []*aws.Balancer
+	balancers, err = regionalAWS.GetAllBalancersForApp(internalAppName)
 	if err != nil {
 		return fmt.Errorf("Failed getting load balancers for %s", internalAppName)
 	}
@@ -127,7 +133,7 @@ func DisableTraffic(c *commons.Context) error {
 		return fmt.Errorf("No Load Balancer found for %s\n", internalAppName)
 	}
 
-	err = regionalAWS.DetachBalancersFromScalingGroup(balancers, scalingGroup)
+	err = regionalAWS.DetachAllBalancersFromScalingGroup(balancers, scalingGroup)
 	if err != nil {
 		errCode := err.(awserr.Error).Code()
 		switch errCode {
@@ -135,11 +141,15 @@ func DisableTraffic(c *commons.Context) error {
 			if strings.Contains(err.Error(), "Trying to remove Load Balancers that are not part of the group") {
 				return fmt.Errorf("ELBs are not attached to scaling group %s\n", scalingGroup)
 			}
+			if strings.Contains(err.Error(), "Trying to remove Target Groups that are not part of the group") {
+				return fmt.Errorf("Target groups are not attached to scaling group %s\n", scalingGroup)
+			}
 		}
 		return fmt.Errorf("Failed detaching load balancers %s from scaling group %s\n", balancers, scalingGroup)
 	}
 
 	detachedNotice := fmt.Sprintf("Load Balancers have begun detaching from scaling group %s\n", scalingGroup)
 	fmt.Printf("%s", colour.boldGreen(detachedNotice))
+	recordTrafficEvent(c, ds, slotId, schema.TrafficDisabled, balancers, pilot)
 	return nil
 }
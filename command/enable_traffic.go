@@ -4,11 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
 	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
 	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
 	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
+	"github.com/ninibe/bigduration"
 )
 
 func EnableTraffic(c *commons.Context) error {
@@ -24,6 +27,11 @@ func EnableTraffic(c *commons.Context) error {
 		return err
 	}
 	log.Printf("[DEBUG] Received AWS Account: %#v", user)
+	currentIp, _ := c.CliContext.App.Metadata["current_ip"].(string)
+	pilot := &schema.DeployPilot{
+		AWSApiCaller: user.Arn,
+		IPAddress:    currentIp,
+	}
 
 	appData, exists, err := BeginApplicationOperation(c.String("env"), c.String("app"), ds)
 	if err != nil {
@@ -37,6 +45,19 @@ func EnableTraffic(c *commons.Context) error {
 		return deprecatedGitError()
 	}
 
+	timeout, err := bigduration.ParseBigDuration(c.String("timeout"))
+	if err != nil {
+		return err
+	}
+	criteria := &healthCriteria{
+		MinHealthy:      c.Int("min-healthy"),
+		MinHealthyRatio: c.Float64("min-healthy-ratio"),
+	}
+	err = criteria.Validate()
+	if err != nil {
+		return err
+	}
+
 	slotId := c.String("slot-id")
 	slotPrefix := c.String("slot-prefix")
 	if slotId == "" && slotPrefix == "" {
@@ -68,9 +89,9 @@ func EnableTraffic(c *commons.Context) error {
 	}
 	outputs := app.InfraOutputs
 
-	internalAppName, ok := outputs[terraform.AppName]
+	internalAppName, ok := outputs.GetString(terraform.AppName)
 	if !ok {
-		return fmt.Errorf("Output %q not found", terraform.AppName)
+		return fmt.Errorf("String output %q not found", terraform.AppName)
 	}
 
 	var scalingGroup string
@@ -82,8 +103,8 @@ func EnableTraffic(c *commons.Context) error {
 		return fmt.Errorf("Slot %s has no scaling group\n", slotId)
 	}
 
-	var balancers []string
-	balancers, err = regionalAWS.GetBalancersForApp(internalAppName)
+	var balancers []*aws.Balancer
+	balancers, err = regionalAWS.GetAllBalancersForApp(internalAppName)
 	if err != nil {
 		return fmt.Errorf("Failed getting load balancers for %s", internalAppName)
 	}
@@ -93,20 +114,30 @@ func EnableTraffic(c *commons.Context) error {
 	}
 
 	for _, b := range balancers {
-		instances, err := regionalAWS.DescribeBalancedInstanceHealth(b)
+		instances, err := regionalAWS.DescribeBalancerHealth(b)
 		if err != nil {
 			return fmt.Errorf("Failed asessing health of instances attached to %s", b)
 		}
 		if len(instances) > 0 {
-			fmt.Printf("(ELB %s already has %d instances attached)\n", b, len(instances))
+			fmt.Printf("(%s already has %d instances attached)\n", b, len(instances))
 		}
 	}
 
-	err = regionalAWS.AttachBalancersToScalingGroup(balancers, scalingGroup)
+	err = regionalAWS.AttachAllBalancersToScalingGroup(balancers, scalingGroup)
 	if err != nil {
 		return fmt.Errorf("Failed attaching balancers %s, to scaling group %s", balancers, scalingGroup)
 	}
 	attachedNotice := fmt.Sprintf("Load Balancers attached to scaling group %s\n", scalingGroup)
 	fmt.Printf("%s", colour.boldGreen(attachedNotice))
+	recordTrafficEvent(c, ds, slotId, schema.TrafficEnabled, balancers, pilot)
+
+	if !c.Bool("wait") {
+		return nil
+	}
+	err = waitForSlotHealth(regionalAWS, scalingGroup, balancers, criteria, timeout.Duration(), nil, os.Stdout)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s", colour.boldGreen(fmt.Sprintf("Slot %s is healthy\n", slotId)))
 	return nil
 }
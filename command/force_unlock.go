@@ -0,0 +1,83 @@
+package command
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
+	"github.com/MeredithCorpOSS/ape-dev-rt/clippy"
+	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+)
+
+func ForceUnlock(c *commons.Context) error {
+	user, ok := c.CliContext.App.Metadata["user"].(*aws.User)
+	if !ok {
+		return fmt.Errorf("Unable to find AWS User in metadata")
+	}
+	ds, ok := c.CliContext.App.Metadata["ds"].(*deploymentstate.DeploymentState)
+	if !ok {
+		return fmt.Errorf("Unable to find Deployment State in metadata")
+	}
+	currentIp, ok := c.CliContext.App.Metadata["current_ip"].(string)
+	if !ok {
+		fmt.Print(colour.boldYellow("Note: We were unable to detect your IP address\n"))
+	}
+
+	_, exists, err := BeginApplicationOperation(c.String("env"), c.String("app"), ds)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	lock, err := ds.GetLock(c.String("app"))
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		fmt.Printf("%s is %s, nothing to unlock.\n", colour.boldWhite(c.String("app")), colour.green("not locked"))
+		return nil
+	}
+	printLock(lock, time.Now().UTC())
+	fmt.Println("")
+
+	yesOverride := c.Bool("y")
+	if lock.Holder != nil && lock.Holder.AWSApiCaller == user.Arn {
+		// Holders can release their own lock without leaving an audit record
+		note := fmt.Sprintf("It looks like you want to release your own lock of '%s' in %s.",
+			c.String("app"), c.String("env"))
+		_, confirmed, err := clippy.BoolPrompt(note, yesOverride, false, func() (interface{}, error) {
+			return nil, ds.ReleaseLock(c.String("app"), lock)
+		}, nil)
+		if err != nil {
+			return err
+		}
+		if confirmed {
+			fmt.Printf("Lock of %s released.\n", colour.boldWhite(c.String("app")))
+		}
+		return nil
+	}
+
+	note := fmt.Sprintf("It looks like you want to break somebody else's lock of '%s' in %s. "+
+		"Make sure the operation holding it is no longer running. This will be recorded.",
+		c.String("app"), c.String("env"))
+	isSensitive := isEnvironmentSensitive(c.String("env")) || !lock.IsExpired(time.Now().UTC())
+	_, confirmed, err := clippy.BoolPrompt(note, yesOverride, isSensitive, func() (interface{}, error) {
+		pilot := &schema.DeployPilot{
+			AWSApiCaller: user.Arn,
+			IPAddress:    currentIp,
+		}
+		return ds.ForceReleaseLock(c.String("app"), pilot)
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if confirmed {
+		fmt.Printf("Lock of %s %s.\n", colour.boldWhite(c.String("app")), colour.red("broken"))
+	}
+
+	return nil
+}
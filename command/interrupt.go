@@ -0,0 +1,93 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
+)
+
+// errInterrupted is returned by waits which were cut short by interruptTrap
+var errInterrupted = fmt.Errorf("Interrupted")
+
+// interruptTrap keeps RT running when it receives SIGINT/SIGTERM
+// while Terraform is running, so that the deployment can be finalized
+// (recorded as interrupted) rather than left in progress forever.
+// Terraform receives SIGINT from the terminal too (same process group)
+// and stops gracefully on its own. SIGTERM is usually sent to RT alone
+// (e.g. by a CI runner), so it's forwarded to Terraform as SIGINT.
+// Long-running operations without Terraform (e.g. shifting traffic) use it
+// to stop early (see Interrupts) and clean up after themselves.
+type interruptTrap struct {
+	signals     chan os.Signal
+	done        chan struct{}
+	interrupted chan struct{}
+
+	mu       sync.Mutex
+	received os.Signal
+}
+
+// trapInterrupts starts trapping signals, note is printed
+// when one is received (e.g. what RT is waiting for)
+func trapInterrupts(note string) *interruptTrap {
+	t := &interruptTrap{
+		signals:     make(chan os.Signal, 1),
+		done:        make(chan struct{}),
+		interrupted: make(chan struct{}),
+	}
+	signal.Notify(t.signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for {
+			select {
+			case sig := <-t.signals:
+				log.Printf("[WARN] Received %s", sig)
+				fmt.Printf("\n%s %s\n", colour.boldYellow("Interrupted."), note)
+				t.mu.Lock()
+				if t.received == nil {
+					close(t.interrupted)
+				}
+				t.received = sig
+				t.mu.Unlock()
+				if sig == syscall.SIGTERM {
+					terraform.InterruptRunning()
+				}
+			case <-t.done:
+				return
+			}
+		}
+	}()
+
+	return t
+}
+
+// Interrupted tells whether any signal was received since the trap was set
+func (t *interruptTrap) Interrupted() bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.received != nil
+}
+
+// Interrupts returns a channel which is closed once a signal is received
+func (t *interruptTrap) Interrupts() <-chan struct{} {
+	if t == nil {
+		return nil
+	}
+	return t.interrupted
+}
+
+// Stop restores default signal handling
+func (t *interruptTrap) Stop() {
+	if t == nil {
+		return
+	}
+	signal.Stop(t.signals)
+	close(t.done)
+}
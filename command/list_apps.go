@@ -5,6 +5,7 @@ import (
 
 	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
 	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
 )
 
 var whitelistedOutputs = map[string]bool{
@@ -40,7 +41,7 @@ func ListApps(c *commons.Context) error {
 			if a.InfraOutputs != nil && len(a.InfraOutputs) > 0 {
 				for k, v := range a.InfraOutputs {
 					if whitelistedOutputs[k] {
-						fmt.Printf(" - %s: %s\n", k, v)
+						fmt.Printf(" - %s: %s\n", k, terraform.FormatOutputValue(v, ""))
 					}
 				}
 			}
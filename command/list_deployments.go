@@ -2,9 +2,12 @@ package command
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
 	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
 )
 
 func ListDeployments(c *commons.Context) error {
@@ -69,9 +72,13 @@ func ListDeployments(c *commons.Context) error {
 						tfAction,
 						suffix)
 
+					fmt.Printf("   - status: %s\n", colourDeploymentStatus(d.GetStatus()))
+					if d.RollbackOf != "" {
+						fmt.Printf("   - rollback to: %s\n", d.RollbackOf)
+					}
 					fmt.Printf("   - finished: %s\n", d.Terraform.FinishTime)
 					fmt.Printf("   - variables: %q\n", d.Terraform.Variables)
-					fmt.Printf("   - outputs: %q\n", d.Terraform.Outputs)
+					fmt.Printf("   - outputs: %s\n", terraform.FormatOutputValue(d.Terraform.Outputs, ""))
 					exitCode := fmt.Sprintf("%d", d.Terraform.ExitCode)
 					if exitCode != "0" {
 						exitCode = colour.boldRed(fmt.Sprintf("%s (!)", exitCode))
@@ -79,6 +86,13 @@ func ListDeployments(c *commons.Context) error {
 					}
 				}
 			}
+
+			if len(s.TrafficEvents) > 0 {
+				if len(deployments) == 0 {
+					fmt.Println("")
+				}
+				printTrafficEvents(s.TrafficEvents, 10, " - %s\n", os.Stdout, colour)
+			}
 		} else {
 			pilotSuffix := ""
 			if s.LastDeployPilot != nil {
@@ -90,6 +104,10 @@ func ListDeployments(c *commons.Context) error {
 				colour.red("destroyed"),
 				s.LastTerraformRun.FinishTime,
 				pilotSuffix)
+			if len(s.TrafficEvents) > 0 {
+				fmt.Println("")
+				printTrafficEvents(s.TrafficEvents, 10, " - %s\n", os.Stdout, colour)
+			}
 		}
 		fmt.Println("")
 	}
@@ -97,3 +115,15 @@ func ListDeployments(c *commons.Context) error {
 
 	return nil
 }
+
+func colourDeploymentStatus(status string) string {
+	switch status {
+	case schema.DeploymentSucceeded:
+		return colour.green(status)
+	case schema.DeploymentFailed:
+		return colour.boldRed(status)
+	case schema.DeploymentInProgress, schema.DeploymentInterrupted, schema.DeploymentAbandoned:
+		return colour.boldYellow(status)
+	}
+	return status
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
 	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
 )
 
 func ListSlots(c *commons.Context) error {
@@ -57,7 +58,7 @@ func ListSlots(c *commons.Context) error {
 			fmt.Printf(" - last variables: %q\n", s.LastTerraformRun.Variables)
 		}
 		if s.LastTerraformRun != nil && len(s.LastTerraformRun.Outputs) > 0 {
-			fmt.Printf(" - last outputs: %q\n", s.LastTerraformRun.Outputs)
+			fmt.Printf(" - last outputs: %s\n", terraform.FormatOutputValue(s.LastTerraformRun.Outputs, ""))
 		}
 		fmt.Println("")
 	}
@@ -0,0 +1,70 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
+	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/backends"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+	"github.com/ninibe/bigduration"
+)
+
+// Lock takes the lock of an app by hand (e.g. for a maintenance window).
+// The lock outlives the command and has to be released via force-unlock
+// or left to expire.
+func Lock(c *commons.Context) error {
+	user, ok := c.CliContext.App.Metadata["user"].(*aws.User)
+	if !ok {
+		return fmt.Errorf("Unable to find AWS User in metadata")
+	}
+	ds, ok := c.CliContext.App.Metadata["ds"].(*deploymentstate.DeploymentState)
+	if !ok {
+		return fmt.Errorf("Unable to find Deployment State in metadata")
+	}
+	currentIp, ok := c.CliContext.App.Metadata["current_ip"].(string)
+	if !ok {
+		fmt.Print(colour.boldYellow("Note: We were unable to detect your IP address\n"))
+	}
+
+	_, exists, err := BeginApplicationOperation(c.String("env"), c.String("app"), ds)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	supportsLock, err := ds.SupportsWriteLock()
+	if err != nil {
+		return err
+	}
+	if !supportsLock {
+		return fmt.Errorf("Deployment state backend doesn't support locking.")
+	}
+
+	d, err := bigduration.ParseBigDuration(c.String("ttl"))
+	if err != nil {
+		return err
+	}
+
+	pilot := &schema.DeployPilot{
+		AWSApiCaller: user.Arn,
+		IPAddress:    currentIp,
+	}
+	lock, err := ds.AcquireLock(c.String("app"), pilot, schema.ManualLockCommand, c.String("reason"), d.Duration())
+	if err != nil {
+		if _, ok := err.(*backends.LockHeld); ok {
+			return fmt.Errorf("%s Use force-unlock if the lock is stale.", err)
+		}
+		return err
+	}
+
+	fmt.Printf("%s is now %s until %s.\n", colour.boldWhite(c.String("app")),
+		colour.boldYellow("locked"), lock.ExpiresAt.String())
+	fmt.Println("You can keep running commands against it, others will have to wait.")
+	fmt.Println("Use force-unlock to release the lock when you're done.")
+
+	return nil
+}
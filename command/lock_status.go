@@ -0,0 +1,91 @@
+package command
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+	"github.com/ninibe/bigduration"
+)
+
+func LockStatus(c *commons.Context) error {
+	ds, ok := c.CliContext.App.Metadata["ds"].(*deploymentstate.DeploymentState)
+	if !ok {
+		return fmt.Errorf("Unable to find Deployment State in metadata")
+	}
+
+	appData, exists, err := BeginApplicationOperation(c.String("env"), c.String("app"), ds)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	supportsLock, err := ds.SupportsWriteLock()
+	if err != nil {
+		return err
+	}
+	if !supportsLock {
+		fmt.Printf("Deployment state backend doesn't support locking.\n")
+		return nil
+	}
+
+	lock, err := ds.GetLock(c.String("app"))
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		fmt.Printf("%s is %s.\n", colour.boldWhite(c.String("app")), colour.green("not locked"))
+	} else {
+		printLock(lock, time.Now().UTC())
+	}
+
+	if c.Bool("verbose") && len(appData.ForcedUnlocks) > 0 {
+		fmt.Println("\nForced unlocks:")
+		for _, fu := range appData.ForcedUnlocks {
+			brokenBy := "unknown"
+			if fu.BrokenBy != nil {
+				brokenBy = fmt.Sprintf("%s via %s", fu.BrokenBy.AWSApiCaller, fu.BrokenBy.IPAddress)
+			}
+			fmt.Printf(" - %s by %s (lock %s)\n", fu.BrokenAt.String(), brokenBy, describeLock(fu.Lock))
+		}
+	}
+
+	return nil
+}
+
+func printLock(lock *schema.LockData, now time.Time) {
+	state := colour.boldYellow("locked")
+	if lock.IsExpired(now) {
+		state = colour.red("locked (expired)")
+	}
+	fmt.Printf("%s is %s\n", colour.boldWhite(lock.AppName), state)
+
+	if lock.Holder != nil {
+		fmt.Printf(" - held by %s via %s\n", lock.Holder.AWSApiCaller, lock.Holder.IPAddress)
+	}
+	heldFor, _ := bigduration.ParseBigDuration(now.Sub(lock.AcquiredAt).Truncate(time.Second).String())
+	fmt.Printf(" - acquired %s (%s ago)\n", lock.AcquiredAt.String(), heldFor.Compact())
+	fmt.Printf(" - expires %s\n", lock.ExpiresAt.String())
+	fmt.Printf(" - command: %s\n", lock.Command)
+	if lock.Reason != "" {
+		fmt.Printf(" - reason: %s\n", lock.Reason)
+	}
+	fmt.Printf(" - RT version: %s\n", lock.RTVersion)
+	fmt.Printf(" - lock ID: %s\n", lock.LockId)
+}
+
+func describeLock(lock *schema.LockData) string {
+	if lock == nil {
+		return "unknown"
+	}
+	holder := "unknown"
+	if lock.Holder != nil {
+		holder = lock.Holder.AWSApiCaller
+	}
+	return fmt.Sprintf("%q held by %s running %q since %s",
+		lock.LockId, holder, lock.Command, lock.AcquiredAt.String())
+}
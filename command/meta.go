@@ -3,6 +3,7 @@ package command
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"regexp"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/backends"
 	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
 	"github.com/MeredithCorpOSS/ape-dev-rt/rt"
+	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/go-version"
 	"github.com/ttacon/chalk"
@@ -67,13 +69,18 @@ func BeginApplicationOperation(env, appName string, ds *deploymentstate.Deployme
 	if err != nil {
 		_, ok := err.(*backends.AppNotFound)
 		if ok {
+			tfVersion, err := terraform.Version()
+			if err != nil {
+				return nil, false, err
+			}
+
 			note := fmt.Sprintf("Application %q doesn't exist in %q, do you want to create it?", appName, env)
 			isSensitive := isEnvironmentSensitive(env)
 			out, confirmed, _ := clippy.BoolPrompt(note, yes, isSensitive, func() (interface{}, error) {
 				return &schema.ApplicationData{
 					UseCentralGitRepo:    false,
 					LastRtVersion:        rt.Version,
-					LastTerraformVersion: rt.TerraformVersion,
+					LastTerraformVersion: tfVersion,
 					IsActive:             true,
 				}, nil
 			}, nil)
@@ -102,11 +109,10 @@ func BeginApplicationOperation(env, appName string, ds *deploymentstate.Deployme
 	return app, true, nil
 }
 
-func FinishApplicationOperation(appName string, appData *schema.ApplicationData, isActive bool, outputs map[string]string,
+func FinishApplicationOperation(appName string, appData *schema.ApplicationData, isActive bool, outputs terraform.Outputs,
 	ds *deploymentstate.DeploymentState) error {
 	appData.IsActive = isActive
 	appData.LastRtVersion = rt.Version
-	appData.LastTerraformVersion = rt.TerraformVersion
 	if outputs != nil && len(outputs) > 0 {
 		appData.InfraOutputs = outputs
 	}
@@ -115,6 +121,23 @@ func FinishApplicationOperation(appName string, appData *schema.ApplicationData,
 	return err
 }
 
+// finishFailedDeployment records a deployment which failed before Terraform
+// produced any output, so that it isn't left in progress
+func finishFailedDeployment(ds *deploymentstate.DeploymentState, appName, slotId, rootDir string,
+	data *schema.DeploymentData, tfRun *schema.FinishedTerraformRun) {
+	isActive := true
+	isStateEmpty, err := terraform.IsStateEmpty(rootDir)
+	if err == nil {
+		isActive = !isStateEmpty
+	}
+
+	err = ds.FinishDeployment(appName, slotId, data.DeploymentId, isActive, data, tfRun)
+	if err != nil {
+		log.Printf("[ERROR] Failed to record failed deployment %s of %q/%q: %s",
+			data.DeploymentId, appName, slotId, err)
+	}
+}
+
 func isEnvironmentSensitive(environment string) bool {
 	re := regexp.MustCompile("(prod|production|live)")
 	return re.Match([]byte(environment))
@@ -130,7 +153,7 @@ func cleanupFilePaths(paths []string) error {
 	return errors
 }
 
-func generateOutputMessage(app, env, slotId, name string, outputs map[string]string) (string, error) {
+func generateOutputMessage(app, env, slotId, name string, outputs terraform.Outputs) (string, error) {
 	slotIdMessage := ""
 	if slotId != "" {
 		slotIdMessage = fmt.Sprintf(" with slot-id %s", slotId)
@@ -144,13 +167,14 @@ func generateOutputMessage(app, env, slotId, name string, outputs map[string]str
 		return fmt.Sprintf("The app %s%s in env %s contains the outputs:\n%s\n", app, slotIdMessage, env, b), nil
 	}
 
-	value, ok := outputs[name]
-
-	if ok {
-		return fmt.Sprintf("The app %s%s in env %s contains the output:\n%s: %s\n", app, slotIdMessage, env, name, value), nil
+	value, err := outputs.Lookup(name)
+	if err == nil {
+		return fmt.Sprintf("The app %s%s in env %s contains the output:\n%s: %s\n", app, slotIdMessage, env,
+			name, terraform.FormatOutputValue(value, "	")), nil
 	}
 
-	return "", fmt.Errorf("The app %s%s in env %s does not contain the output:\n%s\n", app, slotIdMessage, env, name)
+	return "", fmt.Errorf("The app %s%s in env %s does not contain the output:\n%s (%s)\n", app, slotIdMessage, env,
+		name, err)
 }
 
 func deprecatedGitError() error {
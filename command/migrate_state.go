@@ -0,0 +1,135 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
+	"github.com/MeredithCorpOSS/ape-dev-rt/clippy"
+	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+)
+
+// MigrateState copies all applications, slots & deployments
+// from the deployment state configured in one HCL config to another.
+// Records already present in the target are skipped, so it can be re-run
+// to resume an interrupted migration.
+func MigrateState(c *commons.Context) error {
+	user, ok := c.CliContext.App.Metadata["user"].(*aws.User)
+	if !ok {
+		return fmt.Errorf("Unable to find AWS User in metadata")
+	}
+	source, ok := c.CliContext.App.Metadata["source_ds"].(*deploymentstate.DeploymentState)
+	if !ok {
+		return fmt.Errorf("Unable to find source Deployment State in metadata")
+	}
+	target, ok := c.CliContext.App.Metadata["target_ds"].(*deploymentstate.DeploymentState)
+	if !ok {
+		return fmt.Errorf("Unable to find target Deployment State in metadata")
+	}
+	currentIp, ok := c.CliContext.App.Metadata["current_ip"].(string)
+	if !ok {
+		fmt.Print(colour.boldYellow("Note: We were unable to detect your IP address\n"))
+	}
+
+	apps, err := source.ListApplications()
+	if err != nil {
+		return err
+	}
+	if len(apps) == 0 {
+		fmt.Println(colour.boldWhite("No applications found in source, nothing to migrate."))
+		return nil
+	}
+
+	pilot := &schema.DeployPilot{
+		AWSApiCaller: user.Arn,
+		IPAddress:    currentIp,
+	}
+	dryRun := c.Bool("dry-run")
+	migrate := func() (interface{}, error) {
+		failed := make([]string, 0)
+		for _, app := range apps {
+			err := migrateApplication(source, target, app.Name, pilot, dryRun, c.Bool("verbose"))
+			if err != nil {
+				fmt.Printf("%s %s\n\n", colour.boldRed(app.Name+":"), err)
+				failed = append(failed, app.Name)
+			}
+		}
+		if len(failed) > 0 {
+			return nil, fmt.Errorf("Migration of %d app(s) failed: %s. Run migrate-state again to resume.",
+				len(failed), strings.Join(failed, ", "))
+		}
+		return nil, nil
+	}
+
+	if dryRun {
+		fmt.Printf("%s Dry run, nothing will be written to the target.\n\n", colour.boldWhite("Note:"))
+		_, err := migrate()
+		return err
+	}
+
+	note := fmt.Sprintf("It looks like you want to copy deployment state of %d app(s) in %s from %s to %s. "+
+		"Records which differ in the target will be overwritten.",
+		len(apps), c.String("env"), c.String("from"), c.String("to"))
+	_, confirmed, err := clippy.BoolPrompt(note, c.Bool("y"), isEnvironmentSensitive(c.String("env")), migrate, nil)
+	if err != nil {
+		return err
+	}
+	if confirmed {
+		fmt.Printf("Deployment state of %d app(s) %s.\n", len(apps), colour.green("migrated"))
+	}
+
+	return nil
+}
+
+func migrateApplication(source, target *deploymentstate.DeploymentState, appName string,
+	pilot *schema.DeployPilot, dryRun, verbose bool) error {
+	if !dryRun {
+		// Stop anyone from deploying the app while it's being copied
+		lock, err := source.AcquireLock(appName, pilot, "migrate-state", "", deploymentstate.DefaultLockTTL)
+		if err != nil {
+			return err
+		}
+		if lock != nil {
+			defer func() {
+				err := source.ReleaseLock(appName, lock)
+				if err != nil {
+					log.Printf("[ERROR] Failed to release lock of %q: %s", appName, err)
+				}
+			}()
+		}
+	}
+
+	m, err := source.MigrateApplication(appName, target, dryRun)
+	if m != nil && (verbose || dryRun) {
+		for _, r := range m.Records {
+			if r.Action == deploymentstate.RecordSkipped && !verbose {
+				continue
+			}
+			fmt.Printf(" - %s %s: %s\n", r.Kind, r.Id, r.Action)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s %d copied, %d overwritten, %d skipped (already in target)\n",
+		colour.boldWhite(appName+":"),
+		m.Count(deploymentstate.RecordCopied),
+		m.Count(deploymentstate.RecordOverwritten),
+		m.Count(deploymentstate.RecordSkipped))
+	if dryRun {
+		fmt.Println("")
+		return nil
+	}
+
+	summary, err := source.VerifyMigration(appName, target)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s %s\n\n", colour.green("Verified:"), summary)
+
+	return nil
+}
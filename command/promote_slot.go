@@ -0,0 +1,240 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
+	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
+	"github.com/ninibe/bigduration"
+)
+
+// PromoteSlot switches traffic to a slot (blue/green).
+// It attaches the app's balancers to the slot's ASG, waits until its instances
+// are healthy and only then detaches balancers from all other active slots.
+// Balancers attached by the command are detached again if health doesn't converge.
+func PromoteSlot(c *commons.Context) error {
+	ds, ok := c.CliContext.App.Metadata["ds"].(*deploymentstate.DeploymentState)
+	if !ok {
+		return fmt.Errorf("Unable to find Deployment State in metadata")
+	}
+
+	regionalAWS := aws.NewAWS(c.GlobalString("aws-profile"), c.String("aws-region"))
+	fmt.Printf("Operating on resources in AWS region %s\n\n", colour.boldWhite(*regionalAWS.Region))
+	user, err := regionalAWS.User()
+	if err != nil {
+		return err
+	}
+	log.Printf("[DEBUG] Received AWS Account: %#v", user)
+	currentIp, _ := c.CliContext.App.Metadata["current_ip"].(string)
+	pilot := &schema.DeployPilot{
+		AWSApiCaller: user.Arn,
+		IPAddress:    currentIp,
+	}
+
+	appData, exists, err := BeginApplicationOperation(c.String("env"), c.String("app"), ds)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	if appData.UseCentralGitRepo {
+		return deprecatedGitError()
+	}
+
+	timeout, err := bigduration.ParseBigDuration(c.String("timeout"))
+	if err != nil {
+		return err
+	}
+
+	slotId := c.String("slot-id")
+	slotPrefix := c.String("slot-prefix")
+	if slotId == "" && slotPrefix == "" {
+		return fmt.Errorf("'slot-id' or 'slot-prefix' is required parameter for %q (migrated app)", c.String("app"))
+	}
+	if slotId != "" && slotPrefix != "" {
+		return errors.New("You can specify either 'slot-id' or 'slot-prefix', not both.")
+	}
+
+	if slotPrefix != "" {
+		counter, prefixExists, err := ds.GetSlotCounter(slotPrefix, appData)
+		if err != nil {
+			return err
+		}
+		if !prefixExists {
+			return fmt.Errorf("Slot prefix %s does not exist", slotPrefix)
+		}
+
+		slotId = fmt.Sprintf("%s%d", slotPrefix, counter)
+		fmt.Printf("Promoting last slot (%s)\n", colour.boldWhite(slotId))
+	}
+
+	slots, err := ds.ListSlots(c.String("app"))
+	if err != nil {
+		return err
+	}
+	isActive := false
+	for _, s := range slots {
+		if s.SlotId == slotId {
+			isActive = s.IsActive
+		}
+	}
+	if !isActive {
+		return fmt.Errorf("Slot %s of %q is not active, deploy it first", slotId, c.String("app"))
+	}
+
+	if appData.InfraOutputs == nil {
+		return fmt.Errorf("No infra outputs found for %q", c.String("app"))
+	}
+	internalAppName, ok := appData.InfraOutputs.GetString(terraform.AppName)
+	if !ok {
+		return fmt.Errorf("String output %q not found", terraform.AppName)
+	}
+
+	scalingGroup, err := regionalAWS.GetScalingGroupForSlotId(c.String("env"), internalAppName, slotId)
+	if err != nil {
+		return fmt.Errorf("Failed getting scaling group for %s slot %s", internalAppName, slotId)
+	}
+	if len(scalingGroup) == 0 {
+		return fmt.Errorf("Slot %s has no scaling group\n", slotId)
+	}
+
+	balancers, err := regionalAWS.GetAllBalancersForApp(internalAppName)
+	if err != nil {
+		return fmt.Errorf("Failed getting load balancers for %s", internalAppName)
+	}
+	if len(balancers) == 0 {
+		return fmt.Errorf("No Load Balancer found for %s\n", internalAppName)
+	}
+
+	// Only balancers which aren't attached yet are attached (and rolled back)
+	attached, err := regionalAWS.GetAllBalancersFromScalingGroup(scalingGroup)
+	if err != nil {
+		return err
+	}
+	toAttach := balancersMissingFrom(balancers, attached)
+
+	// Interrupting the wait detaches balancers again, rather than leaving
+	// an unhealthy slot serving traffic alongside others
+	trap := trapInterrupts("Stopping, Load Balancers attached by promote-slot will be detached...")
+
+	if len(toAttach) > 0 {
+		err = regionalAWS.AttachAllBalancersToScalingGroup(toAttach, scalingGroup)
+		if err != nil {
+			trap.Stop()
+			return fmt.Errorf("Failed attaching balancers %s, to scaling group %s", toAttach, scalingGroup)
+		}
+		fmt.Printf("Load Balancers %s attached to scaling group %s\n", toAttach, scalingGroup)
+		recordTrafficEvent(c, ds, slotId, schema.TrafficEnabled, toAttach, pilot)
+	} else {
+		fmt.Printf("Load Balancers already attached to scaling group %s\n", scalingGroup)
+	}
+
+	detached, err := waitForPromotedSlot(regionalAWS, scalingGroup, balancers, toAttach,
+		timeout.Duration(), trap.Interrupts(), os.Stdout)
+	trap.Stop()
+	if detached {
+		recordTrafficEvent(c, ds, slotId, schema.TrafficDisabled, toAttach, pilot)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s", colour.boldGreen(fmt.Sprintf("Slot %s is healthy\n", slotId)))
+
+	for _, s := range slots {
+		if !s.IsActive || s.SlotId == slotId {
+			continue
+		}
+		otherGroup, err := regionalAWS.GetScalingGroupForSlotId(c.String("env"), internalAppName, s.SlotId)
+		if err != nil {
+			return err
+		}
+		if len(otherGroup) == 0 {
+			continue
+		}
+		otherBalancers, err := regionalAWS.GetAllBalancersFromScalingGroup(otherGroup)
+		if err != nil {
+			return err
+		}
+		// Balancers which aren't the app's are left alone
+		toDetach := balancersAmong(otherBalancers, balancers)
+		if len(toDetach) == 0 {
+			continue
+		}
+		err = regionalAWS.DetachAllBalancersFromScalingGroup(toDetach, otherGroup)
+		if err != nil {
+			return fmt.Errorf("Failed detaching load balancers %s from scaling group %s of slot %s: %s",
+				toDetach, otherGroup, s.SlotId, err)
+		}
+		recordTrafficEvent(c, ds, s.SlotId, schema.TrafficDisabled, toDetach, pilot)
+		fmt.Printf("Load Balancers have begun detaching from scaling group %s (slot %s)\n",
+			otherGroup, colour.boldRed(s.SlotId))
+	}
+
+	fmt.Printf("%s", colour.boldGreen(fmt.Sprintf("Slot %s promoted\n", slotId)))
+	return nil
+}
+
+// waitForPromotedSlot waits until the slot is healthy behind all balancers
+// and detaches the ones promote-slot attached if it doesn't become
+// healthy in time or interrupted is closed. It tells whether they were detached.
+func waitForPromotedSlot(a *aws.AWS, scalingGroup string, balancers, attached []*aws.Balancer,
+	timeout time.Duration, interrupted <-chan struct{}, w io.Writer) (bool, error) {
+	err := waitForSlotHealth(a, scalingGroup, balancers, &healthCriteria{}, timeout, interrupted, w)
+	if err == nil {
+		return false, nil
+	}
+	if len(attached) == 0 {
+		return false, fmt.Errorf("%s. Other slots were left serving traffic.", err)
+	}
+	fmt.Fprintf(w, "%s Rolling back...\n", colour.boldRed(err.Error()))
+	rollbackErr := a.DetachAllBalancersFromScalingGroup(attached, scalingGroup)
+	if rollbackErr != nil {
+		return false, fmt.Errorf("%s. Failed detaching balancers %s from scaling group %s: %s",
+			err, attached, scalingGroup, rollbackErr)
+	}
+	return true, fmt.Errorf("%s. Load Balancers have begun detaching from scaling group %s, "+
+		"other slots were left serving traffic.", err, scalingGroup)
+}
+
+// balancersMissingFrom returns balancers which are not attached
+// (or are being detached), i.e. not among attached ones
+func balancersMissingFrom(balancers, attached []*aws.Balancer) []*aws.Balancer {
+	isAttached := make(map[string]bool, len(attached))
+	for _, b := range attached {
+		if b.State != "Removing" && b.State != "Removed" {
+			isAttached[b.ID()] = true
+		}
+	}
+	missing := make([]*aws.Balancer, 0)
+	for _, b := range balancers {
+		if !isAttached[b.ID()] {
+			missing = append(missing, b)
+		}
+	}
+	return missing
+}
+
+// balancersAmong returns balancers which are among given others
+func balancersAmong(balancers, others []*aws.Balancer) []*aws.Balancer {
+	isOther := make(map[string]bool, len(others))
+	for _, b := range others {
+		isOther[b.ID()] = true
+	}
+	among := make([]*aws.Balancer, 0)
+	for _, b := range balancers {
+		if isOther[b.ID()] {
+			among = append(among, b)
+		}
+	}
+	return among
+}
@@ -0,0 +1,80 @@
+package command
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
+)
+
+func TestBalancersMissingFrom(t *testing.T) {
+	elb := &aws.Balancer{Name: "elb-1", Type: aws.BalancerTypeELB}
+	tg := &aws.Balancer{Name: "tg-1", Type: aws.BalancerTypeTargetGroup, ARN: "arn:tg-1"}
+	attached := []*aws.Balancer{
+		{Name: "elb-1", State: "InService", Type: aws.BalancerTypeELB},
+		{Name: "tg-1", State: "Removing", Type: aws.BalancerTypeTargetGroup, ARN: "arn:tg-1"},
+	}
+
+	missing := balancersMissingFrom([]*aws.Balancer{elb, tg}, attached)
+	if len(missing) != 1 || missing[0] != tg {
+		t.Fatalf("Expected only target group being detached to be missing, given: %v", missing)
+	}
+
+	among := balancersAmong(attached, []*aws.Balancer{tg})
+	if len(among) != 1 || among[0].ID() != "arn:tg-1" {
+		t.Fatalf("Expected only target group to be among app's balancers, given: %v", among)
+	}
+}
+
+func TestWaitForPromotedSlot_interrupted(t *testing.T) {
+	detachRoute := &aws.MockRoute{
+		ExpectedURI: "/",
+		ExpectedRequestBody: "Action=DetachLoadBalancers&" +
+			"AutoScalingGroupName=test-decanter-wine-api-vstable13-vasg&" +
+			"LoadBalancerNames.member.1=tf-lb-decanter-wine-api&" +
+			"Version=2011-01-01",
+		Response: aws.MockResponse{
+			Code: 200,
+			Body: "",
+		},
+	}
+	a, closeFunc := mockedSlotHealthAWS(test_elb_DescribeInstanceHealth_outOfService_body, detachRoute)
+	defer closeFunc()
+
+	interrupted := make(chan struct{})
+	close(interrupted)
+
+	balancers := []*aws.Balancer{{Name: "tf-lb-decanter-wine-api", Type: aws.BalancerTypeELB}}
+	detached, err := waitForPromotedSlot(a, "test-decanter-wine-api-vstable13-vasg", balancers, balancers,
+		time.Minute, interrupted, ioutil.Discard)
+	if err == nil {
+		t.Fatal("Expected interrupted promotion to fail")
+	}
+	if !detached {
+		t.Fatalf("Expected attached balancers to be detached, given error: %s", err)
+	}
+	if !strings.Contains(err.Error(), errInterrupted.Error()) {
+		t.Fatalf("Expected error to mention interruption, given: %s", err)
+	}
+}
+
+func TestWaitForPromotedSlot_interruptedWithoutAttaching(t *testing.T) {
+	// No detach route is mocked, so detaching would fail
+	a, closeFunc := mockedSlotHealthAWS(test_elb_DescribeInstanceHealth_outOfService_body)
+	defer closeFunc()
+
+	interrupted := make(chan struct{})
+	close(interrupted)
+
+	balancers := []*aws.Balancer{{Name: "tf-lb-decanter-wine-api", Type: aws.BalancerTypeELB}}
+	detached, err := waitForPromotedSlot(a, "test-decanter-wine-api-vstable13-vasg", balancers, []*aws.Balancer{},
+		time.Minute, interrupted, ioutil.Discard)
+	if err == nil {
+		t.Fatal("Expected interrupted promotion to fail")
+	}
+	if detached {
+		t.Fatal("Expected balancers which were attached before to be left alone")
+	}
+}
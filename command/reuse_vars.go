@@ -0,0 +1,84 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+)
+
+// lastVariablesOfSlot returns variables the slot was last deployed with
+func lastVariablesOfSlot(ds *deploymentstate.DeploymentState, appName, slotId string) (map[string]string, error) {
+	slotData, err := ds.GetSlot(appName, slotId)
+	if err != nil {
+		return nil, err
+	}
+	if slotData.LastTerraformRun == nil || len(slotData.LastTerraformRun.Variables) == 0 {
+		return nil, fmt.Errorf("No variables recorded for slot %q of %q", slotId, appName)
+	}
+	return slotData.LastTerraformRun.Variables, nil
+}
+
+// mergeVariables returns base variables overridden by given ones
+func mergeVariables(base, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(overrides))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
+
+// variablesDiff describes variables which differ, one line per variable
+// sorted by name, in the same notation as Terraform plans use
+func variablesDiff(old, new map[string]string) []string {
+	names := make(map[string]bool, 0)
+	for k := range old {
+		names[k] = true
+	}
+	for k := range new {
+		names[k] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for k := range names {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	lines := make([]string, 0)
+	for _, k := range sorted {
+		oldValue, inOld := old[k]
+		newValue, inNew := new[k]
+		switch {
+		case !inOld:
+			lines = append(lines, fmt.Sprintf("+ %s: %q", k, newValue))
+		case !inNew:
+			lines = append(lines, fmt.Sprintf("- %s: %q", k, oldValue))
+		case oldValue != newValue:
+			lines = append(lines, fmt.Sprintf("~ %s: %q => %q", k, oldValue, newValue))
+		}
+	}
+	return lines
+}
+
+func printVariablesDiff(title string, old, new map[string]string) {
+	lines := variablesDiff(old, new)
+	if len(lines) == 0 {
+		fmt.Printf("%s: %s\n", title, colour.green("no changes"))
+		return
+	}
+	fmt.Printf("%s:\n", title)
+	for _, l := range lines {
+		switch l[0] {
+		case '+':
+			l = colour.boldGreen(l)
+		case '-':
+			l = colour.boldRed(l)
+		case '~':
+			l = colour.boldYellow(l)
+		}
+		fmt.Printf("  %s\n", l)
+	}
+}
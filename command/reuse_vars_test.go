@@ -0,0 +1,39 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeVariables(t *testing.T) {
+	base := map[string]string{"ami": "ami-1", "count": "2", "app_version": "blue"}
+	overrides := map[string]string{"ami": "ami-2", "app_version": "blue", "new": "x"}
+
+	merged := mergeVariables(base, overrides)
+	expected := map[string]string{"ami": "ami-2", "count": "2", "app_version": "blue", "new": "x"}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Fatalf("Unexpected variables.\nGiven:    %#v\nExpected: %#v", merged, expected)
+	}
+	if base["ami"] != "ami-1" {
+		t.Fatal("Expected base variables not to be modified")
+	}
+}
+
+func TestVariablesDiff(t *testing.T) {
+	old := map[string]string{"ami": "ami-1", "count": "2", "gone": "y"}
+	new := map[string]string{"ami": "ami-2", "count": "2", "new": "x"}
+
+	lines := variablesDiff(old, new)
+	expected := []string{
+		`~ ami: "ami-1" => "ami-2"`,
+		`- gone: "y"`,
+		`+ new: "x"`,
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("Unexpected diff.\nGiven:    %#v\nExpected: %#v", lines, expected)
+	}
+
+	if len(variablesDiff(old, old)) != 0 {
+		t.Fatal("Expected no diff for the same variables")
+	}
+}
@@ -0,0 +1,95 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+)
+
+// Rollback deploys a slot again with variables & configs
+// of a previous deployment (the last successful one by default)
+func Rollback(c *commons.Context) error {
+	ds, ok := c.CliContext.App.Metadata["ds"].(*deploymentstate.DeploymentState)
+	if !ok {
+		return fmt.Errorf("Unable to find Deployment State in metadata")
+	}
+
+	slotId := c.String("slot-id")
+	if slotId == "" {
+		return fmt.Errorf("'slot-id' is required parameter for %q", c.String("app"))
+	}
+
+	var target *schema.DeploymentData
+	var err error
+	if deploymentId := c.String("to"); deploymentId != "" {
+		target, err = ds.GetDeployment(c.String("app"), slotId, deploymentId)
+		if err != nil {
+			return err
+		}
+	} else {
+		deployments, err := ds.ListLastDeployments(c.String("app"), slotId, 0)
+		if err != nil {
+			return err
+		}
+		target, err = findRollbackTarget(deployments)
+		if err != nil {
+			return fmt.Errorf("Unable to roll back slot %q of %q: %s", slotId, c.String("app"), err)
+		}
+	}
+
+	err = checkRollbackTarget(target)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rolling back slot %s to deployment %s (started %s)\n",
+		colour.boldWhite(slotId), colour.boldWhite(target.DeploymentId), target.StartTime)
+
+	return deploy(c, &deployOptions{RollbackTo: target})
+}
+
+// findRollbackTarget returns the last successful deployment
+// before the last one, from deployments sorted newest first
+func findRollbackTarget(deployments []*schema.DeploymentData) (*schema.DeploymentData, error) {
+	if len(deployments) == 0 {
+		return nil, fmt.Errorf("No deployments found")
+	}
+	for _, d := range deployments[1:] {
+		if checkRollbackTarget(d) == nil {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("No successful deployment found before %s", deployments[0].DeploymentId)
+}
+
+// checkRollbackTarget verifies a slot can be rolled back to a given deployment
+func checkRollbackTarget(d *schema.DeploymentData) error {
+	if d.GetStatus() != schema.DeploymentSucceeded {
+		return fmt.Errorf("Deployment %s is %s, only successful deployments can be rolled back to",
+			d.DeploymentId, d.GetStatus())
+	}
+	if d.Terraform == nil || len(d.Terraform.Variables) == 0 {
+		return fmt.Errorf("No variables recorded for deployment %s", d.DeploymentId)
+	}
+	if d.Terraform.IsDestroy {
+		return fmt.Errorf("Deployment %s destroyed the slot, use deploy-destroy instead", d.DeploymentId)
+	}
+	return nil
+}
+
+// checkRollbackConfigs refuses to roll back with different configs than
+// the deployment used, as variables alone would not restore the slot
+func checkRollbackConfigs(d *schema.DeploymentData, configChecksum string) error {
+	if d.ConfigChecksum == "" {
+		fmt.Printf("%s Configs of deployment %s weren't recorded, please make sure they match.\n",
+			colour.boldYellow("Warning:"), d.DeploymentId)
+		return nil
+	}
+	if d.ConfigChecksum != configChecksum {
+		return fmt.Errorf("Terraform configs differ from those deployed by %s. "+
+			"Please check out the revision which was deployed.", d.DeploymentId)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package command
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+)
+
+func TestFindRollbackTarget(t *testing.T) {
+	finished := time.Date(2016, time.March, 30, 14, 4, 5, 0, time.UTC)
+	vars := map[string]string{"app_version": "blue"}
+	deployment := func(id, status string, isDestroy bool) *schema.DeploymentData {
+		return &schema.DeploymentData{
+			DeploymentId: id,
+			Status:       status,
+			Terraform: &schema.TerraformRun{
+				FinishTime: finished,
+				IsDestroy:  isDestroy,
+				Variables:  vars,
+			},
+		}
+	}
+
+	// Sorted newest first
+	deployments := []*schema.DeploymentData{
+		deployment("5", schema.DeploymentSucceeded, false),
+		deployment("4", schema.DeploymentFailed, false),
+		deployment("3", schema.DeploymentSucceeded, true),
+		deployment("2", schema.DeploymentSucceeded, false),
+		deployment("1", schema.DeploymentSucceeded, false),
+	}
+	target, err := findRollbackTarget(deployments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.DeploymentId != "2" {
+		t.Fatalf("Expected deployment %q, given: %q", "2", target.DeploymentId)
+	}
+
+	_, err = findRollbackTarget(deployments[:3])
+	if err == nil {
+		t.Fatal("Expected error when there's no successful deployment to roll back to")
+	}
+	_, err = findRollbackTarget([]*schema.DeploymentData{})
+	if err == nil {
+		t.Fatal("Expected error for slot without deployments")
+	}
+}
+
+func TestCheckRollbackConfigs(t *testing.T) {
+	d := &schema.DeploymentData{DeploymentId: "1", ConfigChecksum: "abc"}
+	if err := checkRollbackConfigs(d, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRollbackConfigs(d, "def"); err == nil {
+		t.Fatal("Expected error for different configs")
+	}
+
+	// Recorded before checksums were
+	d.ConfigChecksum = ""
+	if err := checkRollbackConfigs(d, "def"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,129 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+	"github.com/MeredithCorpOSS/ape-dev-rt/rt"
+	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
+)
+
+// configChecksum returns checksum of Terraform configs in rootDir,
+// ignoring files generated by RT & Terraform
+func configChecksum(rootDir, planFilePath string) (string, error) {
+	return commons.ChecksumDir(rootDir, []string{
+		planFilePath,
+		terraform.GetBackendConfigFilename(rootDir),
+		path.Join(rootDir, "terraform.tfstate"),
+		path.Join(rootDir, "terraform.tfstate.backup"),
+	})
+}
+
+// lastDeploymentIdOfSlot returns ID of the last deployment
+// or empty string if the slot was never deployed
+func lastDeploymentIdOfSlot(ds *deploymentstate.DeploymentState, appName, slotId string) (string, error) {
+	deployments, err := ds.ListLastDeployments(appName, slotId, 1)
+	if err != nil {
+		return "", err
+	}
+	if len(deployments) == 0 {
+		return "", nil
+	}
+	return deployments[0].DeploymentId, nil
+}
+
+// savePlan uploads the planfile along with its metadata,
+// so that it can be applied later via -plan-id
+func savePlan(ds *deploymentstate.DeploymentState, appName, planFilePath string, plan *schema.PlanData) (string, error) {
+	planfile, err := ioutil.ReadFile(planFilePath)
+	if err != nil {
+		return "", fmt.Errorf("Unable to read planfile: %s", err)
+	}
+	plan.Planfile = planfile
+
+	tfVersion, err := terraform.Version()
+	if err != nil {
+		return "", err
+	}
+	return ds.SavePlan(appName, tfVersion, plan)
+}
+
+// writePlanfile writes the planfile of a saved plan
+// to where Terraform can apply it from
+func writePlanfile(plan *schema.PlanData, planFilePath string) error {
+	return ioutil.WriteFile(planFilePath, plan.Planfile, 0600)
+}
+
+// checkSavedPlan refuses to apply a saved plan if it was created by different
+// versions of RT/Terraform or if configs or state changed since
+func checkSavedPlan(plan *schema.PlanData, configChecksum, lastDeploymentId string,
+	lastInfraChangeTime time.Time) error {
+	tfVersion, err := terraform.Version()
+	if err != nil {
+		return err
+	}
+
+	if plan.RTVersion != rt.Version {
+		return fmt.Errorf("Plan %q was created by RT %s, you have %s. Please create a new plan.",
+			plan.PlanId, plan.RTVersion, rt.Version)
+	}
+	if plan.TerraformVersion != tfVersion {
+		return fmt.Errorf("Plan %q was created by Terraform %s, you have %s. Please create a new plan.",
+			plan.PlanId, plan.TerraformVersion, tfVersion)
+	}
+	if plan.ConfigChecksum != configChecksum {
+		return fmt.Errorf("Terraform configs changed since plan %q was created. Please create a new plan.",
+			plan.PlanId)
+	}
+	if plan.LastDeploymentId != lastDeploymentId {
+		return fmt.Errorf("Slot %q was deployed since plan %q was created (last deployment: %s). Please create a new plan.",
+			plan.SlotId, plan.PlanId, lastDeploymentId)
+	}
+	if !plan.LastInfraChangeTime.Equal(lastInfraChangeTime) {
+		return fmt.Errorf("Infrastructure was changed since plan %q was created (last change: %s). Please create a new plan.",
+			plan.PlanId, lastInfraChangeTime)
+	}
+	return nil
+}
+
+// prepareSavedPlan verifies the saved plan can still be applied,
+// writes its planfile and initializes Terraform the same way FreshPlan does
+func prepareSavedPlan(plan *schema.PlanData, remoteState *terraform.RemoteState, rootDir, planFilePath,
+	lastDeploymentId string, lastInfraChangeTime time.Time) (*terraform.PlanOutput, error) {
+	checksum, err := configChecksum(rootDir, planFilePath)
+	if err != nil {
+		return nil, err
+	}
+	err = checkSavedPlan(plan, checksum, lastDeploymentId, lastInfraChangeTime)
+	if err != nil {
+		return nil, err
+	}
+
+	createdBy := "unknown"
+	if plan.CreatedBy != nil {
+		createdBy = plan.CreatedBy.AWSApiCaller
+	}
+	fmt.Printf("Applying saved plan %s (created by %s at %s)\n",
+		colour.boldWhite(plan.PlanId), createdBy, plan.PlanFinishTime)
+
+	err = writePlanfile(plan, planFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = terraform.ReenableRemoteState(remoteState, rootDir)
+	if err != nil {
+		return nil, err
+	}
+	err = terraform.Get(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &terraform.PlanOutput{Diff: plan.Diff}, nil
+}
@@ -0,0 +1,61 @@
+package command
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+	"github.com/MeredithCorpOSS/ape-dev-rt/rt"
+)
+
+func TestCheckSavedPlan(t *testing.T) {
+	infraChange := time.Date(2016, time.March, 30, 14, 4, 5, 0, time.UTC)
+	plan := &schema.PlanData{
+		PlanId:              "3f9a1c2b5e6d7a8b",
+		SlotId:              "blue",
+		RTVersion:           rt.Version,
+		TerraformVersion:    rt.TerraformVersion,
+		ConfigChecksum:      "abc",
+		LastDeploymentId:    "07459713834261430807.3f9a1c2b",
+		LastInfraChangeTime: infraChange,
+	}
+
+	cases := []struct {
+		Name                string
+		Modify              func(p schema.PlanData) *schema.PlanData
+		Checksum            string
+		LastDeploymentId    string
+		LastInfraChangeTime time.Time
+		ExpectedErr         string
+	}{
+		{"unchanged", nil, "abc", plan.LastDeploymentId, infraChange, ""},
+		{"configs", nil, "def", plan.LastDeploymentId, infraChange, "configs changed"},
+		{"deployed", nil, "abc", "07459713834261430806.1a2b3c4d", infraChange, "was deployed"},
+		{"infra", nil, "abc", plan.LastDeploymentId, infraChange.Add(time.Hour), "Infrastructure was changed"},
+		{"rt", func(p schema.PlanData) *schema.PlanData {
+			p.RTVersion = "0.0.1"
+			return &p
+		}, "abc", plan.LastDeploymentId, infraChange, "created by RT 0.0.1"},
+		{"terraform", func(p schema.PlanData) *schema.PlanData {
+			p.TerraformVersion = "0.11.0"
+			return &p
+		}, "abc", plan.LastDeploymentId, infraChange, "created by Terraform 0.11.0"},
+	}
+	for _, c := range cases {
+		p := plan
+		if c.Modify != nil {
+			p = c.Modify(*plan)
+		}
+		err := checkSavedPlan(p, c.Checksum, c.LastDeploymentId, c.LastInfraChangeTime)
+		if c.ExpectedErr == "" {
+			if err != nil {
+				t.Fatalf("%s: Expected no error, given: %s", c.Name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.ExpectedErr) {
+			t.Fatalf("%s: Expected error containing %q, given: %v", c.Name, c.ExpectedErr, err)
+		}
+	}
+}
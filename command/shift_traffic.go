@@ -0,0 +1,403 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
+	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
+	"github.com/hashicorp/go-multierror"
+	"github.com/ninibe/bigduration"
+)
+
+// ShiftTraffic gradually shifts traffic from other active slots to a given slot
+// by changing weights of target groups in ALB listeners & rules.
+// Health of the slot is checked between steps, all weights are reverted
+// to what they were before if the slot becomes unhealthy.
+func ShiftTraffic(c *commons.Context) error {
+	ds, ok := c.CliContext.App.Metadata["ds"].(*deploymentstate.DeploymentState)
+	if !ok {
+		return fmt.Errorf("Unable to find Deployment State in metadata")
+	}
+
+	regionalAWS := aws.NewAWS(c.GlobalString("aws-profile"), c.String("aws-region"))
+	fmt.Printf("Operating on resources in AWS region %s\n\n", colour.boldWhite(*regionalAWS.Region))
+	user, err := regionalAWS.User()
+	if err != nil {
+		return err
+	}
+	log.Printf("[DEBUG] Received AWS Account: %#v", user)
+
+	currentIp, ok := c.CliContext.App.Metadata["current_ip"].(string)
+	if !ok {
+		fmt.Print(colour.boldYellow("Note: We were unable to detect your IP address\n"))
+	}
+
+	appData, exists, err := BeginApplicationOperation(c.String("env"), c.String("app"), ds)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	if appData.UseCentralGitRepo {
+		return deprecatedGitError()
+	}
+
+	steps, err := parseTrafficSteps(c.String("steps"))
+	if err != nil {
+		return err
+	}
+	interval, err := bigduration.ParseBigDuration(c.String("interval"))
+	if err != nil {
+		return err
+	}
+	timeout, err := bigduration.ParseBigDuration(c.String("timeout"))
+	if err != nil {
+		return err
+	}
+	criteria := &healthCriteria{
+		MinHealthy:      c.Int("min-healthy"),
+		MinHealthyRatio: c.Float64("min-healthy-ratio"),
+	}
+	err = criteria.Validate()
+	if err != nil {
+		return err
+	}
+
+	slotId := c.String("to")
+	if slotId == "" {
+		return fmt.Errorf("'to' is required parameter for %q", c.String("app"))
+	}
+
+	slots, err := ds.ListSlots(c.String("app"))
+	if err != nil {
+		return err
+	}
+	var slotData *schema.SlotData
+	for _, s := range slots {
+		if s.SlotId == slotId && s.IsActive {
+			slotData = s
+		}
+	}
+	if slotData == nil {
+		return fmt.Errorf("Slot %s of %q is not active, deploy it first", slotId, c.String("app"))
+	}
+
+	if appData.InfraOutputs == nil {
+		return fmt.Errorf("No infra outputs found for %q", c.String("app"))
+	}
+	internalAppName, ok := appData.InfraOutputs.GetString(terraform.AppName)
+	if !ok {
+		return fmt.Errorf("String output %q not found", terraform.AppName)
+	}
+
+	scalingGroup, err := regionalAWS.GetScalingGroupForSlotId(c.String("env"), internalAppName, slotId)
+	if err != nil {
+		return fmt.Errorf("Failed getting scaling group for %s slot %s", internalAppName, slotId)
+	}
+	if len(scalingGroup) == 0 {
+		return fmt.Errorf("Slot %s has no scaling group\n", slotId)
+	}
+
+	// Weights are set per target group, so each slot needs its own
+	toBalancers, err := attachedTargetGroups(regionalAWS, scalingGroup)
+	if err != nil {
+		return err
+	}
+	if len(toBalancers) == 0 {
+		return fmt.Errorf("Slot %s has no target groups attached. "+
+			"Shifting traffic requires target groups of the slot attached to its ASG.", slotId)
+	}
+	isToTargetGroup := make(map[string]bool, len(toBalancers))
+	for _, b := range toBalancers {
+		isToTargetGroup[b.ARN] = true
+	}
+
+	fromARNs := make([]string, 0)
+	fromBalancers := make(map[string][]*aws.Balancer, 0)
+	for _, s := range slots {
+		if !s.IsActive || s.SlotId == slotId {
+			continue
+		}
+		otherGroup, err := regionalAWS.GetScalingGroupForSlotId(c.String("env"), internalAppName, s.SlotId)
+		if err != nil {
+			return err
+		}
+		if len(otherGroup) == 0 {
+			continue
+		}
+		otherBalancers, err := attachedTargetGroups(regionalAWS, otherGroup)
+		if err != nil {
+			return err
+		}
+		for _, b := range otherBalancers {
+			if !isToTargetGroup[b.ARN] {
+				fromARNs = append(fromARNs, b.ARN)
+				fromBalancers[s.SlotId] = append(fromBalancers[s.SlotId], b)
+			}
+		}
+	}
+	if len(fromARNs) == 0 {
+		return fmt.Errorf("No other slot of %q is attached to target groups, use enable-traffic instead.",
+			c.String("app"))
+	}
+
+	toARNs := make([]string, 0, len(toBalancers))
+	for _, b := range toBalancers {
+		toARNs = append(toARNs, b.ARN)
+	}
+	toTargetGroups, err := regionalAWS.DescribeTargetGroups(toARNs)
+	if err != nil {
+		return err
+	}
+	fromTargetGroups, err := regionalAWS.DescribeTargetGroups(fromARNs)
+	if err != nil {
+		return err
+	}
+	pairs, err := pairTargetGroups(fromTargetGroups, toTargetGroups)
+	if err != nil {
+		return err
+	}
+
+	routes, err := regionalAWS.GetTrafficRoutesForTargetGroups(fromTargetGroups)
+	if err != nil {
+		return err
+	}
+	if len(routes) == 0 {
+		return fmt.Errorf("No ALB listeners or rules forward traffic to target groups of other slots")
+	}
+
+	pilot := &schema.DeployPilot{
+		AWSApiCaller: user.Arn,
+		IPAddress:    currentIp,
+	}
+	recordStep := func(percent int, status string, stepErr error) {
+		if slotData.LastDeploymentId == "" {
+			return
+		}
+		event := &schema.TrafficShiftEvent{
+			By:      pilot,
+			At:      time.Now().UTC(),
+			Percent: percent,
+			Status:  status,
+		}
+		if stepErr != nil {
+			event.Error = stepErr.Error()
+		}
+		err := ds.RecordTrafficShift(c.String("app"), slotId, slotData.LastDeploymentId, event)
+		if err != nil {
+			log.Printf("[ERROR] Unable to record traffic shift in deployment %s: %s",
+				slotData.LastDeploymentId, err)
+		}
+	}
+	if slotData.LastDeploymentId == "" {
+		fmt.Print(colour.boldYellow("Note: Last deployment of the slot is unknown, steps won't be recorded\n"))
+	}
+	// recordTrafficEvents records where traffic ended up in the slot & the other slots
+	// (only steps are recorded in the deployment)
+	recordTrafficEvents := func(direction, otherDirection string) {
+		recordTrafficEvent(c, ds, slotId, direction, toBalancers, pilot)
+		if otherDirection == "" {
+			return
+		}
+		for _, s := range slots {
+			if balancers, ok := fromBalancers[s.SlotId]; ok {
+				recordTrafficEvent(c, ds, s.SlotId, otherDirection, balancers, pilot)
+			}
+		}
+	}
+
+	// abort reverts all routes (even if some fail) to leave as little traffic split as possible
+	abort := func(percent int, stepErr error) error {
+		fmt.Printf("%s Reverting traffic...\n", colour.boldRed(stepErr.Error()))
+		var revertErrs error
+		for _, r := range routes {
+			err := regionalAWS.RevertTrafficRoute(r)
+			if err != nil {
+				revertErrs = multierror.Append(revertErrs, fmt.Errorf("Failed reverting %s: %s", r, err))
+			}
+		}
+		if revertErrs != nil {
+			recordStep(percent, schema.TrafficShiftAborted, stepErr)
+			recordTrafficEvents(schema.TrafficSplit, schema.TrafficSplit)
+			return fmt.Errorf("Shifting traffic to slot %s aborted at %d%%: %s. %s",
+				slotId, percent, stepErr, revertErrs)
+		}
+		recordStep(percent, schema.TrafficShiftReverted, stepErr)
+		recordTrafficEvents(schema.TrafficDisabled, "")
+		return fmt.Errorf("Shifting traffic to slot %s aborted at %d%%: %s. Traffic was reverted.",
+			slotId, percent, stepErr)
+	}
+
+	setWeights := func(percent int) error {
+		for _, r := range routes {
+			weights, err := shiftedWeights(r.Weights, pairs, percent)
+			if err == nil {
+				err = regionalAWS.SetTrafficRouteWeights(r, weights)
+			}
+			if err != nil {
+				return fmt.Errorf("Failed changing weights of %s: %s", r, err)
+			}
+		}
+		return nil
+	}
+
+	// Traffic must not be left split, so signals make the shift revert instead of killing RT
+	trap := trapInterrupts("Stopping the traffic shift...")
+	defer trap.Stop()
+
+	// ALB health-checks targets as soon as a listener or rule forwards to their
+	// target group, even with weight 0, so the slot is added without any traffic
+	// and receives the first step only once its instances are healthy
+	fmt.Printf("Adding target groups of slot %s to ALB listeners & rules with no traffic\n",
+		colour.boldWhite(slotId))
+	err = setWeights(0)
+	if err != nil {
+		return abort(0, err)
+	}
+	err = waitForSlotHealth(regionalAWS, scalingGroup, toBalancers, criteria, timeout.Duration(),
+		trap.Interrupts(), os.Stdout)
+	if err != nil {
+		return abort(0, err)
+	}
+
+	for i, percent := range steps {
+		fmt.Printf("Shifting %s of traffic to slot %s\n",
+			colour.boldWhite(fmt.Sprintf("%d%%", percent)), colour.boldWhite(slotId))
+		err = setWeights(percent)
+		if err != nil {
+			return abort(percent, err)
+		}
+		recordStep(percent, schema.TrafficShifted, nil)
+
+		checkFor := interval.Duration()
+		if i == len(steps)-1 {
+			checkFor = 0
+		} else {
+			fmt.Printf("Checking health of slot %s for %s\n", slotId, interval.Compact())
+		}
+		err = monitorSlotHealth(regionalAWS, scalingGroup, toBalancers, criteria, checkFor,
+			trap.Interrupts(), os.Stdout)
+		if err == nil && trap.Interrupted() {
+			err = errInterrupted
+		}
+		if err != nil {
+			return abort(percent, err)
+		}
+	}
+
+	if steps[len(steps)-1] == 100 {
+		recordTrafficEvents(schema.TrafficEnabled, schema.TrafficDisabled)
+	} else {
+		recordTrafficEvents(schema.TrafficSplit, schema.TrafficSplit)
+	}
+
+	shiftedNotice := fmt.Sprintf("%d%% of traffic shifted to slot %s\n", steps[len(steps)-1], slotId)
+	fmt.Printf("%s", colour.boldGreen(shiftedNotice))
+	return nil
+}
+
+// parseTrafficSteps parses increasing percentages of traffic, e.g. "10,25,50,100"
+func parseTrafficSteps(s string) ([]int, error) {
+	steps := make([]int, 0)
+	for _, part := range strings.Split(s, ",") {
+		percent, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid step %q, expected percentage: %s", part, err)
+		}
+		if percent < 1 || percent > 100 {
+			return nil, fmt.Errorf("Invalid step %d, expected percentage between 1 and 100", percent)
+		}
+		if len(steps) > 0 && percent <= steps[len(steps)-1] {
+			return nil, fmt.Errorf("Steps have to be increasing, %d follows %d", percent, steps[len(steps)-1])
+		}
+		steps = append(steps, percent)
+	}
+	return steps, nil
+}
+
+// attachedTargetGroups returns target groups attached to the ASG (and not being detached)
+func attachedTargetGroups(a *aws.AWS, scalingGroup string) ([]*aws.Balancer, error) {
+	targetGroups, err := a.GetTargetGroupsFromScalingGroup(scalingGroup)
+	if err != nil {
+		return nil, err
+	}
+	attached := make([]*aws.Balancer, 0)
+	for _, tg := range targetGroups {
+		if tg.State != "Removing" && tg.State != "Removed" {
+			attached = append(attached, tg)
+		}
+	}
+	return attached, nil
+}
+
+// pairTargetGroups maps target groups of other slots to the target group
+// of the slot which replaces them, i.e. the one with same protocol & port
+func pairTargetGroups(from, to []*aws.TargetGroup) (map[string]string, error) {
+	pairs := make(map[string]string, len(from))
+	for _, f := range from {
+		if len(to) == 1 {
+			pairs[f.ARN] = to[0].ARN
+			continue
+		}
+		matches := make([]string, 0)
+		for _, t := range to {
+			if t.Protocol == f.Protocol && t.Port == f.Port {
+				matches = append(matches, t.ARN)
+			}
+		}
+		if len(matches) != 1 {
+			return nil, fmt.Errorf("Unable to pair target group %s (%s:%d) with exactly one target group "+
+				"of the slot, %d found with the same protocol & port", f.Name, f.Protocol, f.Port, len(matches))
+		}
+		pairs[f.ARN] = matches[0]
+	}
+	return pairs, nil
+}
+
+// shiftedWeights returns weights which send a given percentage of traffic
+// to the paired target group and the rest to target groups being replaced
+// in proportion to their original weights. Other target groups are left as they are.
+func shiftedWeights(original map[string]int64, pairs map[string]string, percent int) (map[string]int64, error) {
+	weights := make(map[string]int64, len(original)+1)
+	var sources []string
+	var sourcesTotal int64
+	target := ""
+	for arn, w := range original {
+		weights[arn] = w
+		to, ok := pairs[arn]
+		if !ok {
+			continue
+		}
+		if target != "" && target != to {
+			return nil, fmt.Errorf("Target groups in the same route are replaced by different target groups (%s, %s)",
+				target, to)
+		}
+		target = to
+		sources = append(sources, arn)
+		sourcesTotal += w
+	}
+	if target == "" {
+		return nil, fmt.Errorf("No target group to be replaced found")
+	}
+
+	remaining := int64(100 - percent)
+	for _, arn := range sources {
+		if sourcesTotal == 0 {
+			weights[arn] = remaining / int64(len(sources))
+			continue
+		}
+		weights[arn] = (original[arn]*remaining + sourcesTotal/2) / sourcesTotal
+	}
+	weights[target] = int64(percent)
+	return weights, nil
+}
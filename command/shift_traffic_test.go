@@ -0,0 +1,119 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
+)
+
+func TestParseTrafficSteps(t *testing.T) {
+	steps, err := parseTrafficSteps("10, 25,50,100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedSteps := []int{10, 25, 50, 100}
+	if !reflect.DeepEqual(steps, expectedSteps) {
+		t.Fatalf("Expected steps: %v, given: %v", expectedSteps, steps)
+	}
+
+	invalid := []string{"", "10,x", "0,50", "50,101", "50,25", "50,50"}
+	for _, s := range invalid {
+		_, err := parseTrafficSteps(s)
+		if err == nil {
+			t.Fatalf("Expected error for steps %q", s)
+		}
+	}
+}
+
+func TestPairTargetGroups(t *testing.T) {
+	from := []*aws.TargetGroup{
+		{ARN: "arn:blue-http", Name: "blue-http", Protocol: "HTTP", Port: 80},
+		{ARN: "arn:blue-https", Name: "blue-https", Protocol: "HTTPS", Port: 443},
+	}
+	to := []*aws.TargetGroup{
+		{ARN: "arn:green-https", Name: "green-https", Protocol: "HTTPS", Port: 443},
+		{ARN: "arn:green-http", Name: "green-http", Protocol: "HTTP", Port: 80},
+	}
+	pairs, err := pairTargetGroups(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedPairs := map[string]string{
+		"arn:blue-http":  "arn:green-http",
+		"arn:blue-https": "arn:green-https",
+	}
+	if !reflect.DeepEqual(pairs, expectedPairs) {
+		t.Fatalf("Expected pairs: %q, given: %q", expectedPairs, pairs)
+	}
+
+	// Single target group of the slot replaces all
+	pairs, err = pairTargetGroups(from, to[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pairs["arn:blue-http"] != "arn:green-https" || pairs["arn:blue-https"] != "arn:green-https" {
+		t.Fatalf("Expected all target groups paired with the only one, given: %q", pairs)
+	}
+
+	_, err = pairTargetGroups(from, []*aws.TargetGroup{to[0], to[0]})
+	if err == nil {
+		t.Fatal("Expected error when target groups can't be paired")
+	}
+}
+
+func TestShiftedWeights(t *testing.T) {
+	pairs := map[string]string{
+		"arn:blue":   "arn:green",
+		"arn:purple": "arn:green",
+	}
+	testCases := []struct {
+		original map[string]int64
+		percent  int
+		expected map[string]int64
+	}{
+		{
+			// Slot added to the route before its health is checked
+			map[string]int64{"arn:blue": 1},
+			0,
+			map[string]int64{"arn:blue": 100, "arn:green": 0},
+		},
+		{
+			map[string]int64{"arn:blue": 1},
+			10,
+			map[string]int64{"arn:blue": 90, "arn:green": 10},
+		},
+		{
+			// Resumed shift
+			map[string]int64{"arn:blue": 75, "arn:green": 25},
+			50,
+			map[string]int64{"arn:blue": 50, "arn:green": 50},
+		},
+		{
+			// Multiple slots serving traffic keep their ratio
+			map[string]int64{"arn:blue": 3, "arn:purple": 1, "arn:other": 5},
+			20,
+			map[string]int64{"arn:blue": 60, "arn:purple": 20, "arn:green": 20, "arn:other": 5},
+		},
+		{
+			map[string]int64{"arn:blue": 0, "arn:purple": 0},
+			100,
+			map[string]int64{"arn:blue": 0, "arn:purple": 0, "arn:green": 100},
+		},
+	}
+
+	for i, tc := range testCases {
+		weights, err := shiftedWeights(tc.original, pairs, tc.percent)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if !reflect.DeepEqual(weights, tc.expected) {
+			t.Fatalf("%d: Expected weights: %v, given: %v", i, tc.expected, weights)
+		}
+	}
+
+	_, err := shiftedWeights(map[string]int64{"arn:other": 1}, pairs, 10)
+	if err == nil {
+		t.Fatal("Expected error when no target group is replaced")
+	}
+}
@@ -0,0 +1,192 @@
+package command
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/backends"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
+)
+
+// ShowDeployment shows details of a single deployment
+// including resources changed by it
+func ShowDeployment(c *commons.Context) error {
+	ds, ok := c.CliContext.App.Metadata["ds"].(*deploymentstate.DeploymentState)
+	if !ok {
+		return fmt.Errorf("Unable to find Deployment State in metadata")
+	}
+
+	if c.CliContext.NArg() < 1 {
+		return fmt.Errorf("You need to supply a deployment ID (see list-deployments).")
+	}
+	deploymentId := c.CliContext.Args().First()
+
+	appData, exists, err := BeginApplicationOperation(c.String("env"), c.String("app"), ds)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	if appData.UseCentralGitRepo {
+		return deprecatedGitError()
+	}
+
+	slotId, d, err := findDeployment(ds, c.String("app"), c.String("slot-id"), deploymentId)
+	if err != nil {
+		return err
+	}
+
+	tfAction := colour.boldGreen("apply")
+	if d.Terraform != nil && d.Terraform.IsDestroy {
+		tfAction = colour.boldRed("destroy")
+	}
+	fmt.Printf("%s (%s of slot %s)\n", colour.boldWhite(d.DeploymentId), tfAction, colour.boldWhite(slotId))
+	fmt.Printf(" - status: %s\n", colourDeploymentStatus(d.GetStatus()))
+	if d.RollbackOf != "" {
+		fmt.Printf(" - rollback to: %s\n", d.RollbackOf)
+	}
+	fmt.Printf(" - started: %s\n", d.StartTime)
+	if d.DeployPilot != nil {
+		fmt.Printf(" - by: %s via %s\n", d.DeployPilot.AWSApiCaller, d.DeployPilot.IPAddress)
+	}
+	if d.Abandoned != nil && d.Abandoned.By != nil {
+		fmt.Printf(" - abandoned: %s by %s\n", d.Abandoned.At, d.Abandoned.By.AWSApiCaller)
+	}
+	fmt.Printf(" - RT version: %s\n", d.RTVersion)
+	for _, e := range d.TrafficShifts {
+		fmt.Printf(" - traffic %s: %d%% at %s by %s\n", colourTrafficShiftStatus(e.Status), e.Percent, e.At,
+			e.By.AWSApiCaller)
+		if e.Error != "" {
+			fmt.Printf("   %s\n", e.Error)
+		}
+	}
+	if d.Terraform != nil {
+		fmt.Printf(" - finished: %s\n", d.Terraform.FinishTime)
+		fmt.Printf(" - variables: %q\n", d.Terraform.Variables)
+		fmt.Printf(" - outputs: %s\n", terraform.FormatOutputValue(d.Terraform.Outputs, ""))
+		if d.Terraform.ExitCode != 0 {
+			fmt.Printf(" - exit code: %s\n", colour.boldRed(fmt.Sprintf("%d (!)", d.Terraform.ExitCode)))
+		}
+	}
+	fmt.Println("")
+
+	changes, err := ds.GetDeploymentChanges(c.String("app"), slotId, d.DeploymentId)
+	if err != nil {
+		if _, ok := err.(*backends.DeploymentChangesNotFound); ok {
+			fmt.Println("No resource changes were recorded for this deployment.")
+			return nil
+		}
+		return err
+	}
+
+	if len(changes.ResourceChanges) == 0 {
+		fmt.Println("No resources were changed by this deployment.")
+		return nil
+	}
+
+	fmt.Printf("%s\n", colour.boldWhite(fmt.Sprintf("Planned resource changes (%d):", len(changes.ResourceChanges))))
+	for _, rc := range changes.ResourceChanges {
+		fmt.Printf(" %s %s (%s)\n", colourResourceAction(rc.Action), rc.Address, rc.Action)
+		if c.Bool("verbose") {
+			printAttributeChanges(rc)
+		}
+	}
+	fmt.Println("")
+
+	return nil
+}
+
+// findDeployment looks up the deployment in a given slot
+// or in all slots of the app if no slot is given
+func findDeployment(ds *deploymentstate.DeploymentState, appName, slotId, deploymentId string) (
+	string, *schema.DeploymentData, error) {
+	if slotId != "" {
+		d, err := ds.GetDeployment(appName, slotId, deploymentId)
+		return slotId, d, err
+	}
+
+	slots, err := ds.ListSlots(appName)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, s := range slots {
+		deployments, err := ds.ListLastDeployments(appName, s.SlotId, 0)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, d := range deployments {
+			if d.DeploymentId == deploymentId {
+				return s.SlotId, d, nil
+			}
+		}
+	}
+
+	return "", nil, fmt.Errorf("Deployment %q of %q not found", deploymentId, appName)
+}
+
+func colourTrafficShiftStatus(status string) string {
+	switch status {
+	case schema.TrafficShifted:
+		return colour.boldGreen(status)
+	case schema.TrafficShiftReverted:
+		return colour.boldYellow(status)
+	case schema.TrafficShiftAborted:
+		return colour.boldRed(status)
+	}
+	return status
+}
+
+func colourResourceAction(action string) string {
+	switch action {
+	case terraform.ActionCreate:
+		return colour.boldGreen("+")
+	case terraform.ActionUpdate:
+		return colour.boldYellow("~")
+	case terraform.ActionDelete:
+		return colour.boldRed("-")
+	case terraform.ActionReplace:
+		return colour.boldRed("-/+")
+	}
+	return "?"
+}
+
+// printAttributeChanges prints top-level attributes
+// which differ between before & after
+func printAttributeChanges(rc *terraform.ResourceChange) {
+	before, _ := rc.Before.(map[string]interface{})
+	after, _ := rc.After.(map[string]interface{})
+
+	keys := make(map[string]bool, 0)
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		if !reflect.DeepEqual(before[k], after[k]) {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Printf("     %s: %s => %s\n", name,
+			formatAttributeValue(before, name), formatAttributeValue(after, name))
+	}
+}
+
+func formatAttributeValue(values map[string]interface{}, name string) string {
+	v, ok := values[name]
+	if !ok || v == nil {
+		return "(none)"
+	}
+	return terraform.FormatOutputValue(v, "")
+}
@@ -6,11 +6,13 @@ import (
 	"log"
 	"os"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
 	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
 	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
 	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
 )
 
@@ -49,9 +51,9 @@ func ShowTraffic(c *commons.Context) error {
 		return fmt.Errorf("No infra outputs found for %q", c.String("app"))
 	}
 
-	internalAppName, ok := app.InfraOutputs[terraform.AppName]
+	internalAppName, ok := app.InfraOutputs.GetString(terraform.AppName)
 	if !ok {
-		return fmt.Errorf("Output %q not found", terraform.AppName)
+		return fmt.Errorf("String output %q not found", terraform.AppName)
 	}
 
 	_slots, err := ds.ListSlots(c.String("app"))
@@ -70,6 +72,8 @@ func ShowTraffic(c *commons.Context) error {
 			SlotId:     s.SlotId,
 			Variables:  sortedVars(s.LastTerraformRun.Variables),
 			FinishTime: s.LastTerraformRun.FinishTime,
+
+			TrafficEvents: s.TrafficEvents,
 		}
 
 		slots = append(slots, gc)
@@ -120,17 +124,12 @@ func decorateAndPrintSortedVersions(internalAppName, env string, slots []*slotDa
 
 		if len(scalingGroup) > 0 {
 			var balancers []*aws.Balancer
-			balancers, err = a.GetBalancersFromScalingGroup(scalingGroup)
+			balancers, err = a.GetAllBalancersFromScalingGroup(scalingGroup)
 			if err != nil {
 				return err
 			}
 
-			resourceCount := ""
-			if len(balancers) > 1 {
-				resourceCount = fmt.Sprintf("%v ELBs", len(balancers))
-			} else {
-				resourceCount = fmt.Sprintf("%v ELB", len(balancers))
-			}
+			resourceCount := countBalancers(balancers)
 			if len(balancers) == 0 {
 				resourceCount = colour.boldWhite(resourceCount)
 			} else {
@@ -152,7 +151,7 @@ func decorateAndPrintSortedVersions(internalAppName, env string, slots []*slotDa
 
 			for _, b := range balancers {
 				decorateAndPrintBalancer(b, scalingGroup, w, colour)
-				instances, err := a.DescribeBalancedInstanceHealth(b.Name)
+				instances, err := a.DescribeBalancerHealth(b)
 				if err != nil {
 					return err
 				}
@@ -164,6 +163,7 @@ func decorateAndPrintSortedVersions(internalAppName, env string, slots []*slotDa
 		} else {
 			fmt.Fprintf(w, "%s - %s", versionSlug, colour.boldRed(fmt.Sprintf("no ASG")))
 		}
+		printTrafficEvents(version.TrafficEvents, 3, "\n  %s", w, colour)
 		fmt.Fprint(w, "\n")
 	}
 	return nil
@@ -182,10 +182,38 @@ func decorateAndPrintBalancer(b *aws.Balancer, scalingGroup string, w io.Writer,
 	case "Removing":
 		balancerState = fmt.Sprintf("%s from", colour.boldRed(b.State))
 	}
-	fmt.Fprintf(w, "\n  ELB %s %s ASG %s", b.Name, balancerState, scalingGroup)
+	fmt.Fprintf(w, "\n  %s %s ASG %s", b, balancerState, scalingGroup)
 	return
 }
 
+// countBalancers returns e.g. "2 ELBs" or "1 ELB, 1 TG"
+func countBalancers(balancers []*aws.Balancer) string {
+	elbs, tgs := 0, 0
+	for _, b := range balancers {
+		if b.Type == aws.BalancerTypeTargetGroup {
+			tgs++
+		} else {
+			elbs++
+		}
+	}
+
+	counts := make([]string, 0)
+	if elbs > 0 || tgs == 0 {
+		counts = append(counts, pluralize(elbs, "ELB"))
+	}
+	if tgs > 0 {
+		counts = append(counts, pluralize(tgs, "TG"))
+	}
+	return strings.Join(counts, ", ")
+}
+
+func pluralize(count int, noun string) string {
+	if count > 1 {
+		return fmt.Sprintf("%v %ss", count, noun)
+	}
+	return fmt.Sprintf("%v %s", count, noun)
+}
+
 func decorateAndPrintInstanceHealth(i *aws.InstanceHealth, instanceIds []*string, idToIp map[string]string, w io.Writer, colour *colours) {
 	state := "Unknown"
 
@@ -211,4 +239,7 @@ type slotData struct {
 	SlotId     string
 	Variables  string
 	FinishTime time.Time
+
+	// Most recent traffic changes are shown along with balancers
+	TrafficEvents []*schema.TrafficEvent
 }
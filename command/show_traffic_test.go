@@ -44,6 +44,14 @@ func TestDecorateAndPrintSortedVersions(t *testing.T) {
 				Body: test_asg_DescribeLoadBalancers_body,
 			},
 		},
+		{
+			ExpectedURI:         "/",
+			ExpectedRequestBody: "Action=DescribeLoadBalancerTargetGroups&AutoScalingGroupName=test-decanter-wine-api-vstable13-vasg&Version=2011-01-01",
+			Response: aws.MockResponse{
+				Code: 200,
+				Body: test_asg_DescribeLoadBalancerTargetGroups_empty_body,
+			},
+		},
 		{
 			ExpectedURI:         "/",
 			ExpectedRequestBody: "Action=DescribeAutoScalingGroups&AutoScalingGroupNames.member.1=test-decanter-wine-api-vstable13-vasg&Version=2011-01-01",
@@ -162,6 +170,15 @@ var test_asg_DescribeLoadBalancers_body = `<DescribeLoadBalancersResponse xmlns=
   </ResponseMetadata>
 </DescribeLoadBalancersResponse>`
 
+var test_asg_DescribeLoadBalancerTargetGroups_empty_body = `<DescribeLoadBalancerTargetGroupsResponse xmlns="http://autoscaling.amazonaws.com/doc/2011-01-01/">
+  <DescribeLoadBalancerTargetGroupsResult>
+    <LoadBalancerTargetGroups/>
+  </DescribeLoadBalancerTargetGroupsResult>
+  <ResponseMetadata>
+    <RequestId>e3775f7e-b632-11e6-924a-e73cbafc637f</RequestId>
+  </ResponseMetadata>
+</DescribeLoadBalancerTargetGroupsResponse>`
+
 var test_asg_DescribeAutoScalingGroups_body = `<DescribeAutoScalingGroupsResponse xmlns="http://autoscaling.amazonaws.com/doc/2011-01-01/">
   <DescribeAutoScalingGroupsResult>
     <AutoScalingGroups>
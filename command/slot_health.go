@@ -0,0 +1,173 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
+)
+
+// How often is health of instances checked while waiting
+var healthCheckInterval = 10 * time.Second
+
+// balancerHealth is health of a slot's instances behind a balancer
+type balancerHealth struct {
+	Balancer *aws.Balancer
+	Healthy  int // instances of the slot InService
+	Total    int // all instances of the slot
+}
+
+// healthCriteria decides when a slot is healthy behind a balancer,
+// all instances have to be InService if no minimum is given
+type healthCriteria struct {
+	MinHealthy      int     // minimum number of instances InService
+	MinHealthyRatio float64 // minimum ratio of instances InService (0-1)
+}
+
+// Validate rejects minimums which make no sense, so that these fail
+// before any traffic is changed rather than while waiting
+func (hc *healthCriteria) Validate() error {
+	if hc.MinHealthy < 0 {
+		return fmt.Errorf("'min-healthy' can't be negative")
+	}
+	if hc.MinHealthyRatio < 0 || hc.MinHealthyRatio > 1 {
+		return fmt.Errorf("'min-healthy-ratio' has to be between 0 and 1, given: %g", hc.MinHealthyRatio)
+	}
+	return nil
+}
+
+func (hc *healthCriteria) IsMet(h *balancerHealth) bool {
+	if h.Total == 0 {
+		return false
+	}
+	if hc.MinHealthy == 0 && hc.MinHealthyRatio == 0 {
+		return h.Healthy == h.Total
+	}
+	if h.Healthy < hc.MinHealthy {
+		return false
+	}
+	return float64(h.Healthy)/float64(h.Total) >= hc.MinHealthyRatio
+}
+
+func (hc *healthCriteria) String() string {
+	criteria := make([]string, 0)
+	if hc.MinHealthy > 0 {
+		criteria = append(criteria, fmt.Sprintf("at least %d", hc.MinHealthy))
+	}
+	if hc.MinHealthyRatio > 0 {
+		criteria = append(criteria, fmt.Sprintf("at least %.0f%%", hc.MinHealthyRatio*100))
+	}
+	if len(criteria) == 0 {
+		return "all"
+	}
+	return strings.Join(criteria, " and ")
+}
+
+// describeSlotHealth returns health of the ASG's instances behind each balancer,
+// instances not registered with a balancer (yet) count as unhealthy
+func describeSlotHealth(a *aws.AWS, scalingGroup string, balancers []*aws.Balancer) ([]*balancerHealth, error) {
+	instanceIds, err := a.GetInstanceIdsFromScalingGroup(scalingGroup)
+	if err != nil {
+		return nil, err
+	}
+	isSlotInstance := make(map[string]bool, len(instanceIds))
+	for _, id := range instanceIds {
+		isSlotInstance[*id] = true
+	}
+
+	healths := make([]*balancerHealth, 0)
+	for _, b := range balancers {
+		instances, err := a.DescribeBalancerHealth(b)
+		if err != nil {
+			return nil, fmt.Errorf("Failed asessing health of instances attached to %s: %s", b, err)
+		}
+		h := &balancerHealth{Balancer: b, Total: len(instanceIds)}
+		for _, i := range instances {
+			if isSlotInstance[i.InstanceID] && i.State == "InService" {
+				h.Healthy++
+			}
+		}
+		healths = append(healths, h)
+	}
+	return healths, nil
+}
+
+// waitForSlotHealth polls health of the ASG's instances behind given balancers
+// until criteria are met behind all of them or the timeout expires.
+// Waiting stops early once interrupted is closed (nil never does).
+func waitForSlotHealth(a *aws.AWS, scalingGroup string, balancers []*aws.Balancer,
+	criteria *healthCriteria, timeout time.Duration, interrupted <-chan struct{}, w io.Writer) error {
+	fmt.Fprintf(w, "Waiting up to %s for %s instances of ASG %s to become healthy\n",
+		timeout, criteria, scalingGroup)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		healths, err := describeSlotHealth(a, scalingGroup, balancers)
+		if err != nil {
+			return err
+		}
+
+		allHealthy := true
+		for _, h := range healths {
+			fmt.Fprintf(w, "  %s: %d/%d InService\n", h.Balancer, h.Healthy, h.Total)
+			if !criteria.IsMet(h) {
+				allHealthy = false
+			}
+		}
+		if allHealthy {
+			return nil
+		}
+
+		if time.Now().Add(healthCheckInterval).After(deadline) {
+			return fmt.Errorf("Instances of ASG %s didn't become healthy within %s", scalingGroup, timeout)
+		}
+		err = sleepUnlessInterrupted(healthCheckInterval, interrupted)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// monitorSlotHealth keeps checking health of the ASG's instances behind given
+// balancers for the duration and fails as soon as criteria aren't met
+// or interrupted is closed (nil never is)
+func monitorSlotHealth(a *aws.AWS, scalingGroup string, balancers []*aws.Balancer,
+	criteria *healthCriteria, duration time.Duration, interrupted <-chan struct{}, w io.Writer) error {
+	deadline := time.Now().Add(duration)
+	for {
+		healths, err := describeSlotHealth(a, scalingGroup, balancers)
+		if err != nil {
+			return err
+		}
+		for _, h := range healths {
+			fmt.Fprintf(w, "  %s: %d/%d InService\n", h.Balancer, h.Healthy, h.Total)
+			if !criteria.IsMet(h) {
+				return fmt.Errorf("Only %d/%d instances of ASG %s are InService behind %s (%s required)",
+					h.Healthy, h.Total, scalingGroup, h.Balancer, criteria)
+			}
+		}
+
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			return nil
+		}
+		if remaining > healthCheckInterval {
+			remaining = healthCheckInterval
+		}
+		err = sleepUnlessInterrupted(remaining, interrupted)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func sleepUnlessInterrupted(d time.Duration, interrupted <-chan struct{}) error {
+	select {
+	case <-interrupted:
+		return errInterrupted
+	case <-time.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,175 @@
+package command
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
+)
+
+func mockedSlotHealthAWS(instanceHealthBody string, extraAutoscalingRoutes ...*aws.MockRoute) (*aws.AWS, func()) {
+	autoscalingRoutes := []*aws.MockRoute{
+		{
+			ExpectedURI:         "/",
+			ExpectedRequestBody: "Action=DescribeAutoScalingGroups&AutoScalingGroupNames.member.1=test-decanter-wine-api-vstable13-vasg&Version=2011-01-01",
+			Response: aws.MockResponse{
+				Code: 200,
+				Body: test_asg_DescribeAutoScalingGroups_body,
+			},
+		},
+	}
+	autoscalingRoutes = append(autoscalingRoutes, extraAutoscalingRoutes...)
+	autoscalingSession, closeAutoscaling := aws.GetMockedAwsSession(autoscalingRoutes, "us-east-1")
+
+	elbRoutes := []*aws.MockRoute{
+		{
+			ExpectedURI:         "/",
+			ExpectedRequestBody: "Action=DescribeInstanceHealth&LoadBalancerName=tf-lb-decanter-wine-api&Version=2012-06-01",
+			Response: aws.MockResponse{
+				Code: 200,
+				Body: instanceHealthBody,
+			},
+		},
+	}
+	elbSession, closeElb := aws.GetMockedAwsSession(elbRoutes, "us-east-1")
+
+	a := aws.MockedAWS(&aws.MockedAWSInput{
+		Region:          "us-east-1",
+		AutoscalingSess: autoscalingSession,
+		ElbSess:         elbSession,
+	})
+	return a, func() {
+		closeAutoscaling()
+		closeElb()
+	}
+}
+
+func TestWaitForSlotHealth_healthy(t *testing.T) {
+	a, closeFunc := mockedSlotHealthAWS(test_elb_DescribeInstanceHealth_body)
+	defer closeFunc()
+
+	balancers := []*aws.Balancer{{Name: "tf-lb-decanter-wine-api", Type: aws.BalancerTypeELB}}
+	w := bytes.NewBufferString("")
+	err := waitForSlotHealth(a, "test-decanter-wine-api-vstable13-vasg", balancers, &healthCriteria{}, time.Minute, nil, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedOutput := `Waiting up to 1m0s for all instances of ASG test-decanter-wine-api-vstable13-vasg to become healthy
+  ELB tf-lb-decanter-wine-api: 1/1 InService
+`
+	if w.String() != expectedOutput {
+		t.Fatalf("Unexpected output!\nExpected: %q\nGiven: %q\n", expectedOutput, w.String())
+	}
+}
+
+func TestWaitForSlotHealth_timeout(t *testing.T) {
+	a, closeFunc := mockedSlotHealthAWS(test_elb_DescribeInstanceHealth_outOfService_body)
+	defer closeFunc()
+
+	origInterval := healthCheckInterval
+	healthCheckInterval = 10 * time.Millisecond
+	defer func() {
+		healthCheckInterval = origInterval
+	}()
+
+	balancers := []*aws.Balancer{{Name: "tf-lb-decanter-wine-api", Type: aws.BalancerTypeELB}}
+	w := bytes.NewBufferString("")
+	err := waitForSlotHealth(a, "test-decanter-wine-api-vstable13-vasg", balancers, &healthCriteria{}, 50*time.Millisecond, nil, w)
+	if err == nil {
+		t.Fatal("Expected error when instances never become healthy")
+	}
+	expectedErr := "didn't become healthy within 50ms"
+	if !strings.Contains(err.Error(), expectedErr) {
+		t.Fatalf("Expected error to contain %q, given: %s", expectedErr, err)
+	}
+	if strings.Count(w.String(), "0/1 InService") < 2 {
+		t.Fatalf("Expected health to be polled repeatedly, given output: %q", w.String())
+	}
+}
+
+func TestWaitForSlotHealth_interrupted(t *testing.T) {
+	a, closeFunc := mockedSlotHealthAWS(test_elb_DescribeInstanceHealth_outOfService_body)
+	defer closeFunc()
+
+	interrupted := make(chan struct{})
+	close(interrupted)
+
+	balancers := []*aws.Balancer{{Name: "tf-lb-decanter-wine-api", Type: aws.BalancerTypeELB}}
+	start := time.Now()
+	err := waitForSlotHealth(a, "test-decanter-wine-api-vstable13-vasg", balancers, &healthCriteria{},
+		time.Minute, interrupted, ioutil.Discard)
+	if err != errInterrupted {
+		t.Fatalf("Expected %q, given: %v", errInterrupted, err)
+	}
+	if time.Since(start) >= healthCheckInterval {
+		t.Fatalf("Expected waiting to stop without sleeping, took %s", time.Since(start))
+	}
+}
+
+func TestHealthCriteria_Validate(t *testing.T) {
+	invalid := []*healthCriteria{
+		{MinHealthy: -1},
+		{MinHealthyRatio: -0.1},
+		{MinHealthyRatio: 1.5},
+	}
+	for _, hc := range invalid {
+		if hc.Validate() == nil {
+			t.Fatalf("Expected %#v to be invalid", hc)
+		}
+	}
+	valid := []*healthCriteria{{}, {MinHealthy: 2}, {MinHealthyRatio: 1}, {MinHealthy: 1, MinHealthyRatio: 0.5}}
+	for _, hc := range valid {
+		err := hc.Validate()
+		if err != nil {
+			t.Fatalf("Expected %#v to be valid, given: %s", hc, err)
+		}
+	}
+}
+
+func TestHealthCriteria(t *testing.T) {
+	testCases := []struct {
+		criteria         *healthCriteria
+		healthy, total   int
+		expectedMet      bool
+		expectedCriteria string
+	}{
+		{&healthCriteria{}, 2, 2, true, "all"},
+		{&healthCriteria{}, 1, 2, false, "all"},
+		{&healthCriteria{}, 0, 0, false, "all"},
+		{&healthCriteria{MinHealthy: 2}, 2, 4, true, "at least 2"},
+		{&healthCriteria{MinHealthy: 2}, 1, 4, false, "at least 2"},
+		{&healthCriteria{MinHealthyRatio: 0.5}, 2, 4, true, "at least 50%"},
+		{&healthCriteria{MinHealthyRatio: 0.5}, 1, 4, false, "at least 50%"},
+		{&healthCriteria{MinHealthy: 1, MinHealthyRatio: 0.75}, 2, 4, false, "at least 1 and at least 75%"},
+	}
+
+	for i, tc := range testCases {
+		h := &balancerHealth{Healthy: tc.healthy, Total: tc.total}
+		if met := tc.criteria.IsMet(h); met != tc.expectedMet {
+			t.Fatalf("%d: Expected %t for %d/%d, given %t", i, tc.expectedMet, tc.healthy, tc.total, met)
+		}
+		if s := tc.criteria.String(); s != tc.expectedCriteria {
+			t.Fatalf("%d: Expected criteria %q, given %q", i, tc.expectedCriteria, s)
+		}
+	}
+}
+
+var test_elb_DescribeInstanceHealth_outOfService_body = `<DescribeInstanceHealthResponse xmlns="http://elasticloadbalancing.amazonaws.com/doc/2012-06-01/">
+  <DescribeInstanceHealthResult>
+    <InstanceStates>
+      <member>
+        <Description>Instance has failed at least the UnhealthyThreshold number of health checks consecutively.</Description>
+        <InstanceId>i-ee546206</InstanceId>
+        <ReasonCode>Instance</ReasonCode>
+        <State>OutOfService</State>
+      </member>
+    </InstanceStates>
+  </DescribeInstanceHealthResult>
+  <ResponseMetadata>
+    <RequestId>e412dcbb-b632-11e6-9dd0-e1f5c9454d05</RequestId>
+  </ResponseMetadata>
+</DescribeInstanceHealthResponse>`
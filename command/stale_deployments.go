@@ -0,0 +1,104 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
+	"github.com/MeredithCorpOSS/ape-dev-rt/clippy"
+	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+	"github.com/ninibe/bigduration"
+)
+
+// StaleDeployments lists deployments which are still in progress
+// long after they started (e.g. RT crashed or was killed)
+// and optionally marks them as abandoned
+func StaleDeployments(c *commons.Context) error {
+	user, ok := c.CliContext.App.Metadata["user"].(*aws.User)
+	if !ok {
+		return fmt.Errorf("Unable to find AWS User in metadata")
+	}
+	ds, ok := c.CliContext.App.Metadata["ds"].(*deploymentstate.DeploymentState)
+	if !ok {
+		return fmt.Errorf("Unable to find Deployment State in metadata")
+	}
+	currentIp, ok := c.CliContext.App.Metadata["current_ip"].(string)
+	if !ok {
+		fmt.Print(colour.boldYellow("Note: We were unable to detect your IP address\n"))
+	}
+
+	_, exists, err := BeginApplicationOperation(c.String("env"), c.String("app"), ds)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	d, err := bigduration.ParseBigDuration(c.String("stale-after"))
+	if err != nil {
+		return err
+	}
+	borderline := time.Now().Add(-1 * d.Duration())
+
+	stale, err := ds.ListStaleDeployments(c.String("app"), borderline)
+	if err != nil {
+		return err
+	}
+	if len(stale) == 0 {
+		fmt.Printf("No deployments of %s in progress for longer than %s.\n",
+			colour.boldWhite(c.String("app")), c.String("stale-after"))
+		return nil
+	}
+
+	slotIds := make([]string, 0, len(stale))
+	for slotId := range stale {
+		slotIds = append(slotIds, slotId)
+	}
+	sort.Strings(slotIds)
+
+	for _, slotId := range slotIds {
+		deployment := stale[slotId]
+		suffix := ""
+		if deployment.DeployPilot != nil {
+			suffix = fmt.Sprintf(" by %s via %s",
+				deployment.DeployPilot.AWSApiCaller, deployment.DeployPilot.IPAddress)
+		}
+		fmt.Printf("%s: %s (%s, started %s%s)\n", colour.boldWhite(slotId), deployment.DeploymentId,
+			colourDeploymentStatus(deployment.GetStatus()), deployment.StartTime, suffix)
+	}
+	fmt.Println("")
+
+	if !c.Bool("abandon") {
+		fmt.Println("Use -abandon to mark these deployments as abandoned.")
+		return nil
+	}
+
+	note := fmt.Sprintf("It looks like you want to mark %d deployment(s) of '%s' in %s as abandoned. "+
+		"Make sure they're no longer running, Terraform state of these slots may need checking.",
+		len(stale), c.String("app"), c.String("env"))
+	_, confirmed, err := clippy.BoolPrompt(note, c.Bool("y"), isEnvironmentSensitive(c.String("env")), func() (interface{}, error) {
+		pilot := &schema.DeployPilot{
+			AWSApiCaller: user.Arn,
+			IPAddress:    currentIp,
+		}
+		for _, slotId := range slotIds {
+			err := ds.AbandonDeployment(c.String("app"), slotId, stale[slotId].DeploymentId, pilot)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if confirmed {
+		fmt.Printf("%d deployment(s) marked as %s.\n", len(stale), colour.boldYellow(schema.DeploymentAbandoned))
+	}
+
+	return nil
+}
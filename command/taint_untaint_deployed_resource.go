@@ -54,6 +54,11 @@ func TaintUntaintDeployedResource(c *commons.Context) error {
 		return fmt.Errorf("You need to supply a path to Terraform configs of %q.", slotId)
 	}
 
+	err = checkTerraformVersionOfSlot(c, ds, slotId)
+	if err != nil {
+		return err
+	}
+
 	rootDir := path.Join(cfgPath, c.CliContext.Args().First())
 	if rootDir == cfgPath {
 		return fmt.Errorf("Terraform configs for a slot have to be in a separate dir, not in %q!", cfgPath)
@@ -117,6 +122,10 @@ func TaintUntaintDeployedResource(c *commons.Context) error {
 		return fmt.Errorf("Failed to %s a resource (exit code %d). Stderr:\n%s",
 			action, out.ExitCode, out.Stderr)
 	}
+	err = recordTerraformVersionOfSlot(ds, c.String("app"), slotId)
+	if err != nil {
+		return err
+	}
 	filesToCleanup = append(filesToCleanup, terraform.GetBackendConfigFilename(rootDir))
 
 	fmt.Printf("%s\n", out.Stdout)
@@ -66,6 +66,11 @@ func TaintUntaintInfraResource(c *commons.Context) error {
 		return deprecatedGitError()
 	}
 
+	err = checkTerraformVersionOfInfra(c, appData)
+	if err != nil {
+		return err
+	}
+
 	rootDir := cfgPath
 
 	templateVars := ApplicationTemplateVars{
@@ -127,6 +132,10 @@ func TaintUntaintInfraResource(c *commons.Context) error {
 		return fmt.Errorf("Failed to %s a resource (exit code %d). Stderr:\n%s",
 			action, out.ExitCode, out.Stderr)
 	}
+	err = recordTerraformVersionOfApp(ds, c.String("app"), appData)
+	if err != nil {
+		return err
+	}
 	filesToCleanup = append(filesToCleanup, terraform.GetBackendConfigFilename(rootDir))
 
 	fmt.Printf("%s\n", out.Stdout)
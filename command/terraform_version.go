@@ -0,0 +1,122 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/clippy"
+	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
+	"github.com/hashicorp/go-version"
+)
+
+// compareTerraformVersions returns -1, 0 or 1 if the current version
+// is older, same or newer than the last version (0 if none was recorded)
+func compareTerraformVersions(lastVersion, currentVersion string) (int, error) {
+	if lastVersion == "" {
+		return 0, nil
+	}
+	last, err := version.NewVersion(lastVersion)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to parse last Terraform version: %s", err)
+	}
+	current, err := version.NewVersion(currentVersion)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to parse current Terraform version: %s", err)
+	}
+	return current.Compare(last), nil
+}
+
+// checkTerraformVersion refuses to apply a state with older Terraform than
+// the one it was last applied with, as it can't read state written by newer versions.
+// It also asks for confirmation before upgrading, because the state can't be read
+// by the previous version afterwards.
+func checkTerraformVersion(c *commons.Context, subject, lastVersion string) error {
+	currentVersion, err := terraform.Version()
+	if err != nil {
+		return err
+	}
+	cmp, err := compareTerraformVersions(lastVersion, currentVersion)
+	if err != nil {
+		return err
+	}
+	if cmp < 0 {
+		return fmt.Errorf("%s was last applied with Terraform %s, you have %s. "+
+			"Downgrades are not supported, please upgrade.", subject, lastVersion, currentVersion)
+	}
+	if cmp == 0 {
+		return nil
+	}
+
+	note := fmt.Sprintf("%s was last applied with Terraform %s, this will upgrade it to %s.\n"+
+		"The state won't be readable by Terraform %s anymore.",
+		subject, colour.boldWhite(lastVersion), colour.boldYellow(currentVersion), lastVersion)
+	isSensitive := isEnvironmentSensitive(c.String("env"))
+	_, confirmed, err := clippy.BoolPrompt(note, c.Bool("upgrade-terraform"), isSensitive, func() (interface{}, error) {
+		return nil, nil
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		return fmt.Errorf("Upgrade of %s to Terraform %s wasn't confirmed.", subject, currentVersion)
+	}
+	return nil
+}
+
+func checkTerraformVersionOfInfra(c *commons.Context, appData *schema.ApplicationData) error {
+	subject := fmt.Sprintf("Infrastructure of %q", c.String("app"))
+	return checkTerraformVersion(c, subject, appData.LastTerraformVersion)
+}
+
+// lastTerraformVersionOfSlot returns Terraform version the slot was last
+// applied with or empty string if the slot was never deployed
+func lastTerraformVersionOfSlot(ds *deploymentstate.DeploymentState, appName, slotId string) (string, error) {
+	slots, err := ds.ListSlots(appName)
+	if err != nil {
+		return "", err
+	}
+	for _, s := range slots {
+		if s.SlotId == slotId {
+			return s.GetLastTerraformVersion(), nil
+		}
+	}
+	return "", nil
+}
+
+func checkTerraformVersionOfSlot(c *commons.Context, ds *deploymentstate.DeploymentState, slotId string) error {
+	lastVersion, err := lastTerraformVersionOfSlot(ds, c.String("app"), slotId)
+	if err != nil {
+		return err
+	}
+	subject := fmt.Sprintf("Slot %q of %q", slotId, c.String("app"))
+	return checkTerraformVersion(c, subject, lastVersion)
+}
+
+// recordTerraformVersionOfApp saves Terraform version after the app's
+// infra state was changed outside of apply-infra/destroy-infra (e.g. tainted)
+func recordTerraformVersionOfApp(ds *deploymentstate.DeploymentState, appName string,
+	appData *schema.ApplicationData) error {
+	tfVersion, err := terraform.Version()
+	if err != nil {
+		return err
+	}
+	appData.LastTerraformVersion = tfVersion
+	return ds.SaveApplication(appName, appData)
+}
+
+// recordTerraformVersionOfSlot saves Terraform version after the slot's
+// state was changed outside of a deployment (e.g. tainted)
+func recordTerraformVersionOfSlot(ds *deploymentstate.DeploymentState, appName, slotId string) error {
+	tfVersion, err := terraform.Version()
+	if err != nil {
+		return err
+	}
+	slotData, err := ds.GetSlot(appName, slotId)
+	if err != nil {
+		return err
+	}
+	slotData.LastTerraformVersion = tfVersion
+	return ds.SaveSlot(appName, slotId, slotData)
+}
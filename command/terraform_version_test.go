@@ -0,0 +1,32 @@
+package command
+
+import (
+	"testing"
+)
+
+func TestCompareTerraformVersions(t *testing.T) {
+	cases := []struct {
+		Last, Current string
+		Expected      int
+	}{
+		0: {"", "0.12.29", 0},
+		1: {"0.12.29", "0.12.29", 0},
+		2: {"0.12.29", "0.13.5", 1},
+		3: {"0.13.5", "0.12.29", -1},
+		4: {"0.12.9", "0.12.29", 1},
+	}
+	for i, c := range cases {
+		cmp, err := compareTerraformVersions(c.Last, c.Current)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if cmp != c.Expected {
+			t.Fatalf("%d: Expected %d for %q => %q, given: %d", i, c.Expected, c.Last, c.Current, cmp)
+		}
+	}
+
+	_, err := compareTerraformVersions("not-a-version", "0.12.29")
+	if err == nil {
+		t.Fatal("Expected error for invalid version")
+	}
+}
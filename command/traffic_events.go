@@ -0,0 +1,68 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
+	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+)
+
+// recordTrafficEvent records balancers being attached to/detached from a slot
+// (or traffic being split between slots).
+// Traffic has already changed by then, so failures are reported, not returned.
+func recordTrafficEvent(c *commons.Context, ds *deploymentstate.DeploymentState, slotId, direction string,
+	balancers []*aws.Balancer, pilot *schema.DeployPilot) {
+	names := make([]string, 0, len(balancers))
+	for _, b := range balancers {
+		names = append(names, b.String())
+	}
+	event := &schema.TrafficEvent{
+		By:        pilot,
+		At:        time.Now().UTC(),
+		Direction: direction,
+		Command:   c.CliContext.Command.Name,
+		Balancers: names,
+	}
+	err := ds.RecordTrafficEvent(c.String("app"), slotId, event)
+	if err != nil {
+		log.Printf("[ERROR] Unable to record traffic %s for slot %s: %s", direction, slotId, err)
+		fmt.Print(colour.boldYellow(fmt.Sprintf("Note: Traffic was %s, but it wasn't recorded in slot %s\n",
+			direction, slotId)))
+	}
+}
+
+// printTrafficEvents prints up to limit most recent traffic events, newest first,
+// each formatted by layout (e.g. " - %s\n")
+func printTrafficEvents(events []*schema.TrafficEvent, limit int, layout string, w io.Writer, colour *colours) {
+	for i := len(events) - 1; i >= 0 && i >= len(events)-limit; i-- {
+		fmt.Fprintf(w, layout, formatTrafficEvent(events[i], colour))
+	}
+}
+
+func formatTrafficEvent(e *schema.TrafficEvent, colour *colours) string {
+	direction := e.Direction
+	switch e.Direction {
+	case schema.TrafficEnabled:
+		direction = colour.green(e.Direction)
+	case schema.TrafficDisabled:
+		direction = colour.red(e.Direction)
+	case schema.TrafficSplit:
+		direction = colour.boldYellow(e.Direction)
+	}
+
+	suffix := ""
+	if e.By != nil {
+		suffix += fmt.Sprintf(" by %s", e.By.AWSApiCaller)
+		if e.By.IPAddress != "" {
+			suffix += fmt.Sprintf(" via %s", e.By.IPAddress)
+		}
+	}
+	return fmt.Sprintf("traffic %s at %s%s (%s): %s", direction, e.At, suffix, e.Command,
+		strings.Join(e.Balancers, ", "))
+}
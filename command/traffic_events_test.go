@@ -0,0 +1,51 @@
+package command
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+)
+
+func TestPrintTrafficEvents(t *testing.T) {
+	at, err := time.Parse(time.RFC3339, "2016-11-23T11:53:50Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pilot := &schema.DeployPilot{
+		AWSApiCaller: "arn:aws:iam::123456789012:user/Bob",
+		IPAddress:    "10.0.0.1",
+	}
+	events := []*schema.TrafficEvent{
+		{By: pilot, At: at, Direction: schema.TrafficEnabled, Command: "enable-traffic",
+			Balancers: []string{"ELB oldest"}},
+		{By: pilot, At: at.Add(time.Hour), Direction: schema.TrafficEnabled, Command: "promote-slot",
+			Balancers: []string{"ELB app", "TG app-http"}},
+		{By: &schema.DeployPilot{AWSApiCaller: "arn:aws:iam::123456789012:user/Alice"}, At: at.Add(2 * time.Hour),
+			Direction: schema.TrafficDisabled, Command: "disable-traffic", Balancers: []string{"ELB app"}},
+		{By: pilot, At: at.Add(3 * time.Hour), Direction: schema.TrafficSplit, Command: "shift-traffic",
+			Balancers: []string{"TG app-http"}},
+	}
+
+	noColour := func(s string) string {
+		return s
+	}
+	c := &colours{
+		red:        noColour,
+		green:      noColour,
+		boldYellow: noColour,
+	}
+
+	b := bytes.NewBufferString("")
+	printTrafficEvents(events, 3, " - %s\n", b, c)
+
+	expectedOutput := ` - traffic split at 2016-11-23 14:53:50 +0000 UTC by arn:aws:iam::123456789012:user/Bob via 10.0.0.1 (shift-traffic): TG app-http
+ - traffic disabled at 2016-11-23 13:53:50 +0000 UTC by arn:aws:iam::123456789012:user/Alice (disable-traffic): ELB app
+ - traffic enabled at 2016-11-23 12:53:50 +0000 UTC by arn:aws:iam::123456789012:user/Bob via 10.0.0.1 (promote-slot): ELB app, TG app-http
+`
+	output := b.String()
+	if output != expectedOutput {
+		t.Fatalf("Unexpected output!\nExpected: %q\nGiven: %q\n", expectedOutput, output)
+	}
+}
@@ -58,7 +58,7 @@ func ValidateInfra(c *commons.Context) error {
 		return err
 	}
 
-	vo, err := terraform.Validate(cfgPath)
+	vo, err := terraform.Validate(cfgPath, os.Stdout, os.Stderr)
 	if err != nil {
 		return err
 	}
@@ -1,16 +1,19 @@
 package command
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"strings"
+	"sync"
 
 	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
 	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
 	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
 	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
+	"github.com/hashicorp/go-multierror"
 )
 
 func ValidateSlots(c *commons.Context) error {
@@ -75,20 +78,49 @@ func ValidateSlots(c *commons.Context) error {
 
 	for _, directory := range directories {
 		rootDir := path.Join(cfgPath, directory)
-		filesToCleanup, err = commons.ProcessTemplates(rootDir, "tpl", templateVars)
+		files, err := commons.ProcessTemplates(rootDir, "tpl", templateVars)
 		if err != nil {
+			cleanupFilePaths(filesToCleanup)
 			return err
 		}
+		filesToCleanup = append(filesToCleanup, files...)
+	}
 
-		vo, err := terraform.Validate(rootDir)
-		if err != nil {
-			return err
+	// Slots are validated in parallel, Terraform runs in each slot's directory.
+	// Output of each slot is buffered and printed in order afterwards,
+	// so that output of different slots doesn't interleave.
+	validationErrs := make([]error, len(directories))
+	stdouts := make([]bytes.Buffer, len(directories))
+	stderrs := make([]bytes.Buffer, len(directories))
+	var wg sync.WaitGroup
+	for i, directory := range directories {
+		wg.Add(1)
+		go func(i int, rootDir string) {
+			defer wg.Done()
+			_, validationErrs[i] = terraform.Validate(rootDir, &stdouts[i], &stderrs[i])
+		}(i, path.Join(cfgPath, directory))
+	}
+	wg.Wait()
+
+	for i, directory := range directories {
+		if stdouts[i].Len()+stderrs[i].Len() == 0 {
+			continue
 		}
-		if vo.ExitCode != 0 {
-			return fmt.Errorf("validate operation failed (exit code %d). Stderr:\n%s",
-				vo.ExitCode, vo.Stderr)
+		fmt.Printf("%s:\n", colour.boldWhite(directory))
+		os.Stdout.Write(stdouts[i].Bytes())
+		os.Stderr.Write(stderrs[i].Bytes())
+	}
+
+	var _errors error
+	for i, err := range validationErrs {
+		if err != nil {
+			_errors = multierror.Append(_errors, fmt.Errorf("%s: %s", directories[i], err))
 		}
 	}
+	if _errors != nil {
+		cleanupFilePaths(filesToCleanup)
+		return _errors
+	}
 
 	fmt.Printf("\\(◕ヮ◕)/\nTerraform code for app '%s' in environment '%s' is valid.\n\n", c.String("app"), c.String("env"))
 
@@ -5,13 +5,17 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/MeredithCorpOSS/ape-dev-rt/aws"
 	"github.com/MeredithCorpOSS/ape-dev-rt/command"
 	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
 	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/backends"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
 	"github.com/MeredithCorpOSS/ape-dev-rt/hcl"
 	"github.com/MeredithCorpOSS/ape-dev-rt/rt"
+	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
 	"github.com/RevH/ipinfo"
 	"github.com/mitchellh/go-homedir"
 	"github.com/ttacon/chalk"
@@ -20,6 +24,7 @@ import (
 
 var boldBlue = chalk.Blue.NewStyle().WithTextStyle(chalk.Bold).Style
 var boldYellow = chalk.Yellow.NewStyle().WithTextStyle(chalk.Bold).Style
+var boldRed = chalk.Red.NewStyle().WithTextStyle(chalk.Bold).Style
 
 var Commands = []cli.Command{
 	{
@@ -46,8 +51,11 @@ var Commands = []cli.Command{
 			flags.Target,
 			flags.Namespace,
 			flags.Force,
+			flags.PlanID,
+			flags.UpgradeTerraform,
 		},
-		Before: beforeAuthedCommand,
+		Before: beforeLockedCommand,
+		After:  afterLockedCommand,
 	},
 	{
 		Name:   "destroy-infra",
@@ -62,8 +70,10 @@ var Commands = []cli.Command{
 			flags.Variable,
 			flags.Namespace,
 			flags.Force,
+			flags.UpgradeTerraform,
 		},
-		Before: beforeAuthedCommand,
+		Before: beforeLockedCommand,
+		After:  afterLockedCommand,
 	},
 	{
 		Name:   "diff-infra",
@@ -78,6 +88,7 @@ var Commands = []cli.Command{
 			flags.Variable,
 			flags.Namespace,
 			flags.Force,
+			flags.SavePlan,
 		},
 		Before: beforeAuthedCommand,
 	},
@@ -96,9 +107,55 @@ var Commands = []cli.Command{
 			flags.Target,
 			flags.Namespace,
 			flags.Force,
+			flags.StoreValues,
+			flags.PlanID,
+			flags.UpgradeTerraform,
+			flags.ReuseVars,
 		},
 		ArgsUsage: "<path-to-tf-cfgs>",
-		Before:    beforeAuthedCommand,
+		Before:    beforeLockedCommand,
+		After:     afterLockedCommand,
+	},
+	{
+		Name:   "redeploy",
+		Usage:  "Deploy a slot again with variables of its last deployment (-var overrides them)",
+		Action: wrapCommand(command.Redeploy),
+		Flags: []cli.Flag{
+			flags.AwsProfile,
+			flags.Environment,
+			flags.AppName,
+			flags.SlotID,
+			flags.YesOverride,
+			flags.Variable,
+			flags.Target,
+			flags.Namespace,
+			flags.Force,
+			flags.StoreValues,
+			flags.UpgradeTerraform,
+		},
+		ArgsUsage: "<path-to-tf-cfgs>",
+		Before:    beforeLockedCommand,
+		After:     afterLockedCommand,
+	},
+	{
+		Name:   "rollback",
+		Usage:  "Deploy a slot again with variables & configs of a previous deployment",
+		Action: wrapCommand(command.Rollback),
+		Flags: []cli.Flag{
+			flags.AwsProfile,
+			flags.Environment,
+			flags.AppName,
+			flags.SlotID,
+			flags.RollbackTo,
+			flags.YesOverride,
+			flags.Namespace,
+			flags.Force,
+			flags.StoreValues,
+			flags.UpgradeTerraform,
+		},
+		ArgsUsage: "<path-to-tf-cfgs>",
+		Before:    beforeLockedCommand,
+		After:     afterLockedCommand,
 	},
 	{
 		Name:   "deploy-destroy",
@@ -116,9 +173,12 @@ var Commands = []cli.Command{
 			flags.Variable,
 			flags.Namespace,
 			flags.Force,
+			flags.StoreValues,
+			flags.UpgradeTerraform,
 		},
 		ArgsUsage: "<path-to-tf-cfgs>",
-		Before:    beforeAuthedCommand,
+		Before:    beforeLockedCommand,
+		After:     afterLockedCommand,
 	},
 	{
 		Name:   "diff-deploy",
@@ -135,10 +195,26 @@ var Commands = []cli.Command{
 			flags.Target,
 			flags.Namespace,
 			flags.Force,
+			flags.SavePlan,
+			flags.StoreValues,
 		},
 		ArgsUsage: "<path-to-tf-cfgs>",
 		Before:    beforeAuthedCommand,
 	},
+	{
+		Name:   "detect-drift",
+		Usage:  "Show which of infra & active slots have pending changes (exits with 2 if any)",
+		Action: wrapCommand(command.DetectDrift),
+		Flags: []cli.Flag{
+			flags.AwsProfile,
+			flags.Environment,
+			flags.AppName,
+			flags.Namespace,
+			flags.JSON,
+		},
+		ArgsUsage: "[path-to-slot-tf-cfgs]",
+		Before:    beforeAuthedCommand,
+	},
 	{
 		Name:   "disable-traffic",
 		Usage:  "Detach load-balancers from the version scaling-group",
@@ -152,7 +228,8 @@ var Commands = []cli.Command{
 			flags.SlotPrefix,
 			flags.PreviousSlot,
 		},
-		Before: beforeAuthedCommand,
+		Before: beforeLockedCommand,
+		After:  afterLockedCommand,
 	},
 	{
 		Name:   "enable-traffic",
@@ -165,8 +242,48 @@ var Commands = []cli.Command{
 			flags.Environment,
 			flags.SlotID,
 			flags.SlotPrefix,
+			flags.Wait,
+			flags.HealthTimeout,
+			flags.MinHealthy,
+			flags.MinHealthyRatio,
 		},
-		Before: beforeAuthedCommand,
+		Before: beforeLockedCommand,
+		After:  afterLockedCommand,
+	},
+	{
+		Name:   "promote-slot",
+		Usage:  "Attach load-balancers to a healthy slot & detach them from all other slots",
+		Action: wrapCommand(command.PromoteSlot),
+		Flags: []cli.Flag{
+			flags.AwsProfile,
+			flags.AwsRegion,
+			flags.AppName,
+			flags.Environment,
+			flags.SlotID,
+			flags.SlotPrefix,
+			flags.HealthTimeout,
+		},
+		Before: beforeLockedCommand,
+		After:  afterLockedCommand,
+	},
+	{
+		Name:   "shift-traffic",
+		Usage:  "Gradually shift traffic to a slot via weighted ALB target groups",
+		Action: wrapCommand(command.ShiftTraffic),
+		Flags: []cli.Flag{
+			flags.AwsProfile,
+			flags.AwsRegion,
+			flags.AppName,
+			flags.Environment,
+			flags.ShiftTo,
+			flags.TrafficSteps,
+			flags.TrafficInterval,
+			flags.HealthTimeout,
+			flags.MinHealthy,
+			flags.MinHealthyRatio,
+		},
+		Before: beforeLockedCommand,
+		After:  afterLockedCommand,
 	},
 	{
 		Name:   "show-traffic",
@@ -226,8 +343,102 @@ var Commands = []cli.Command{
 			flags.OlderThan,
 			flags.Verbose,
 		},
+		Before: beforeLockedCommand,
+		After:  afterLockedCommand,
+	},
+	{
+		Name:   "stale-deployments",
+		Usage:  "List deployments of a given app which never finished and optionally mark them as abandoned",
+		Action: wrapCommand(command.StaleDeployments),
+		Flags: []cli.Flag{
+			flags.AwsProfile,
+			flags.Environment,
+			flags.AppName,
+			flags.StaleAfter,
+			flags.Abandon,
+			flags.YesOverride,
+		},
+		Before: beforeLockedCommand,
+		After:  afterLockedCommand,
+	},
+	{
+		Name:   "lock-status",
+		Usage:  "Show who holds the deployment state lock of a given app in a given environment",
+		Action: wrapCommand(command.LockStatus),
+		Flags: []cli.Flag{
+			flags.AwsProfile,
+			flags.Environment,
+			flags.AppName,
+			flags.Verbose,
+		},
 		Before: beforeAuthedCommand,
 	},
+	{
+		Name:   "lock",
+		Usage:  "Lock a given app in a given environment by hand (e.g. for a maintenance window)",
+		Action: wrapCommand(command.Lock),
+		Flags: []cli.Flag{
+			flags.AwsProfile,
+			flags.Environment,
+			flags.AppName,
+			flags.LockTTL,
+			flags.LockReason,
+		},
+		Before: beforeAuthedCommand,
+	},
+	{
+		Name:   "force-unlock",
+		Usage:  "Release the deployment state lock of a given app in a given environment",
+		Action: wrapCommand(command.ForceUnlock),
+		Flags: []cli.Flag{
+			flags.AwsProfile,
+			flags.Environment,
+			flags.AppName,
+			flags.YesOverride,
+		},
+		Before: beforeAuthedCommand,
+	},
+	{
+		Name:   "migrate-state",
+		Usage:  "Copy deployment state of all apps in a given environment from one deployment_state config to another",
+		Action: wrapCommand(command.MigrateState),
+		Flags: []cli.Flag{
+			flags.AwsProfile,
+			flags.Environment,
+			flags.MigrateFrom,
+			flags.MigrateTo,
+			flags.DryRun,
+			flags.YesOverride,
+			flags.Verbose,
+		},
+		Before:   beforeMigrateStateCommand,
+		Category: "app-not-required",
+	},
+	{
+		Name:   "check-state",
+		Usage:  "Compare deployment state of all apps across all configured backends in a given environment",
+		Action: wrapCommand(command.CheckState),
+		Flags: []cli.Flag{
+			flags.AwsProfile,
+			flags.Environment,
+			flags.Authoritative,
+		},
+		Before:   beforeAuthedCommand,
+		Category: "app-not-required",
+	},
+	{
+		Name:   "repair-state",
+		Usage:  "Copy deployment state of inconsistent apps from the authoritative backend to all the others",
+		Action: wrapCommand(command.RepairState),
+		Flags: []cli.Flag{
+			flags.AwsProfile,
+			flags.Environment,
+			flags.Authoritative,
+			flags.YesOverride,
+		},
+		Before:   beforeAuthedCommand,
+		Category: "app-not-required",
+	},
 	{
 		Name:   "add-slot-prefix",
 		Usage:  "Add a new slot prefix for a given app in a given environment",
@@ -238,7 +449,8 @@ var Commands = []cli.Command{
 			flags.AppName,
 		},
 		ArgsUsage: "slot-id",
-		Before:    beforeAuthedCommand,
+		Before:    beforeLockedCommand,
+		After:     afterLockedCommand,
 	},
 	{
 		Name:   "delete-slot-prefix",
@@ -250,7 +462,8 @@ var Commands = []cli.Command{
 			flags.AppName,
 		},
 		ArgsUsage: "slot-id",
-		Before:    beforeAuthedCommand,
+		Before:    beforeLockedCommand,
+		After:     afterLockedCommand,
 	},
 	{
 		Name:   "taint-infra-resource",
@@ -262,9 +475,11 @@ var Commands = []cli.Command{
 			flags.Environment,
 			flags.Module,
 			flags.Namespace,
+			flags.UpgradeTerraform,
 		},
 		ArgsUsage: "resource-to-taint",
-		Before:    beforeAuthedCommand,
+		Before:    beforeLockedCommand,
+		After:     afterLockedCommand,
 	},
 	{
 		Name:   "untaint-infra-resource",
@@ -276,9 +491,11 @@ var Commands = []cli.Command{
 			flags.Environment,
 			flags.Module,
 			flags.Namespace,
+			flags.UpgradeTerraform,
 		},
 		ArgsUsage: "resource-to-untaint",
-		Before:    beforeAuthedCommand,
+		Before:    beforeLockedCommand,
+		After:     afterLockedCommand,
 	},
 	{
 		Name:   "taint-deployed-resource",
@@ -291,9 +508,11 @@ var Commands = []cli.Command{
 			flags.SlotID,
 			flags.Module,
 			flags.Namespace,
+			flags.UpgradeTerraform,
 		},
 		ArgsUsage: "<path-to-tf-cfgs> <resource-to-untaint>",
-		Before:    beforeAuthedCommand,
+		Before:    beforeLockedCommand,
+		After:     afterLockedCommand,
 	},
 	{
 		Name:   "untaint-deployed-resource",
@@ -306,9 +525,11 @@ var Commands = []cli.Command{
 			flags.SlotID,
 			flags.Module,
 			flags.Namespace,
+			flags.UpgradeTerraform,
 		},
 		ArgsUsage: "<path-to-tf-cfgs> <resource-to-untaint>",
-		Before:    beforeAuthedCommand,
+		Before:    beforeLockedCommand,
+		After:     afterLockedCommand,
 	},
 	{
 		Name:   "version",
@@ -359,6 +580,20 @@ var Commands = []cli.Command{
 		},
 		Before: beforeAuthedCommand,
 	},
+	{
+		Name:   "show-deployment",
+		Usage:  "Show details of a given deployment including resources it changed",
+		Action: wrapCommand(command.ShowDeployment),
+		Flags: []cli.Flag{
+			flags.AwsProfile,
+			flags.Environment,
+			flags.AppName,
+			flags.SlotID,
+			flags.Verbose,
+		},
+		Before:    beforeAuthedCommand,
+		ArgsUsage: "<deployment-id>",
+	},
 	{
 		Name:   "validate-infra",
 		Usage:  "Validates the current working directory for valid Terraform code",
@@ -406,6 +641,11 @@ func beforeAuthedCommand(c *cli.Context) error {
 	}
 	c.App.Metadata["remote_state"] = cfg.RemoteState
 
+	err = loadTerraformExecutor(cfg.Terraform)
+	if err != nil {
+		return err
+	}
+
 	if c.String("env") == "" {
 		return errors.New("No environment defined. Please use -env flag")
 	}
@@ -419,6 +659,157 @@ func beforeAuthedCommand(c *cli.Context) error {
 	return nil
 }
 
+// beforeLockedCommand is used by commands which change deployment state
+// (or Terraform state), so that two people cannot operate on the same app at once
+func beforeLockedCommand(c *cli.Context) error {
+	err := beforeAuthedCommand(c)
+	if err != nil {
+		return err
+	}
+
+	return acquireDeploymentStateLock(c)
+}
+
+func afterLockedCommand(c *cli.Context) error {
+	lock, ok := c.App.Metadata["lock"].(*schema.LockData)
+	if !ok {
+		return nil
+	}
+	ds, ok := c.App.Metadata["ds"].(*deploymentstate.DeploymentState)
+	if !ok {
+		return fmt.Errorf("Unable to find Deployment State in metadata")
+	}
+	if stopRefreshing, ok := c.App.Metadata["stop_lock_refresh"].(func()); ok {
+		stopRefreshing()
+		delete(c.App.Metadata, "stop_lock_refresh")
+	}
+
+	log.Printf("[DEBUG] Releasing lock %q of %q", lock.LockId, lock.AppName)
+	err := ds.ReleaseLock(lock.AppName, lock)
+	if err != nil {
+		return fmt.Errorf("Failed to release lock of %q: %s", lock.AppName, err)
+	}
+	delete(c.App.Metadata, "lock")
+
+	return nil
+}
+
+func acquireDeploymentStateLock(c *cli.Context) error {
+	appName := c.String("app")
+	if appName == "" {
+		// Missing app name is reported by wrapCommand
+		return nil
+	}
+	ds, ok := c.App.Metadata["ds"].(*deploymentstate.DeploymentState)
+	if !ok {
+		return fmt.Errorf("Unable to find Deployment State in metadata")
+	}
+	user, ok := c.App.Metadata["user"].(*aws.User)
+	if !ok {
+		return fmt.Errorf("Unable to find AWS User in metadata")
+	}
+	currentIp, _ := c.App.Metadata["current_ip"].(string)
+
+	pilot := &schema.DeployPilot{
+		AWSApiCaller: user.Arn,
+		IPAddress:    currentIp,
+	}
+	lock, err := ds.AcquireLock(appName, pilot, c.Command.Name, "", deploymentstate.DefaultLockTTL)
+	if err != nil {
+		if lh, ok := err.(*backends.LockHeld); ok {
+			if lh.Lock.IsManual() && lh.Lock.Holder != nil && lh.Lock.Holder.AWSApiCaller == user.Arn {
+				fmt.Printf("%s Proceeding under your own lock of %s (%s).\n\n",
+					boldYellow("Note:"), appName, lh.Lock.Reason)
+				return nil
+			}
+			return fmt.Errorf("%s Please wait until the operation finishes or check with your team.", err)
+		}
+		return err
+	}
+	if lock == nil {
+		return nil
+	}
+	log.Printf("[DEBUG] Acquired lock %q of %q (expires %s)", lock.LockId, appName, lock.ExpiresAt)
+	c.App.Metadata["lock"] = lock
+	c.App.Metadata["stop_lock_refresh"] = refreshLockPeriodically(ds, lock)
+
+	return nil
+}
+
+// refreshLockPeriodically keeps extending the lock while the command runs
+// (e.g. long applies or traffic shifts), so that it only expires if RT stops.
+// The returned function stops refreshing.
+func refreshLockPeriodically(ds *deploymentstate.DeploymentState, lock *schema.LockData) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(deploymentstate.LockRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				err := ds.RefreshLock(lock.AppName, lock, deploymentstate.DefaultLockTTL)
+				if err != nil {
+					log.Printf("[ERROR] Failed to refresh lock %q of %q: %s", lock.LockId, lock.AppName, err)
+					fmt.Fprintf(os.Stderr, "\n%s Failed to refresh lock of %q (expires %s), "+
+						"others may start changing it once it expires: %s\n",
+						boldRed("Warning:"), lock.AppName, lock.ExpiresAt, err)
+					continue
+				}
+				log.Printf("[DEBUG] Refreshed lock %q of %q (expires %s)", lock.LockId, lock.AppName, lock.ExpiresAt)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// beforeMigrateStateCommand loads deployment state from two separate configs
+// (-from & -to) instead of the one in current directory
+func beforeMigrateStateCommand(c *cli.Context) error {
+	user, err := authenticateWithAWS(c)
+	if err != nil {
+		return err
+	}
+	err = getCurrentIpAddress(c)
+	if err != nil {
+		log.Printf("[WARN] Unable to get IP address: %s", err)
+	}
+
+	if c.String("env") == "" {
+		return errors.New("No environment defined. Please use -env flag")
+	}
+	if c.String("from") == "" || c.String("to") == "" {
+		return errors.New("Both source and target config need to be defined. Please use -from and -to flags")
+	}
+
+	for _, side := range []string{"from", "to"} {
+		cfg, cfgPath, err := hcl.LoadConfigFromPath(c.String("env"), user.AccountID, c.String(side))
+		if err != nil {
+			return err
+		}
+		if cfg.DeploymentState == nil {
+			return fmt.Errorf("No 'deployment_state' block found in %q.", cfgPath)
+		}
+		ds, err := loadDeploymentState(c.String("env"), "any app", cfg.DeploymentState)
+		if err != nil {
+			return err
+		}
+		if side == "from" {
+			c.App.Metadata["source_ds"] = ds
+		} else {
+			c.App.Metadata["target_ds"] = ds
+		}
+	}
+
+	return nil
+}
+
 func authenticateWithAWS(c *cli.Context) (*aws.User, error) {
 	a := aws.NewAWS(c.GlobalString("aws-profile"), "us-east-1")
 	log.Println("[INFO] Verifying AWS credentials")
@@ -467,6 +858,18 @@ func loadConfig(cmd cli.Command, env, awsAccId string) (*hcl.HclConfig, string,
 	return hcl.LoadConfigFromPath(env, awsAccId, cfgPath)
 }
 
+func loadTerraformExecutor(cfg *hcl.Terraform) error {
+	if cfg == nil {
+		return nil
+	}
+	e, err := terraform.NewExecutor(cfg.Executor, cfg.Path)
+	if err != nil {
+		return fmt.Errorf("Failed to load Terraform executor: %s", err)
+	}
+	terraform.SetExecutor(e)
+	return nil
+}
+
 func loadDeploymentState(env, appName string, cfg *hcl.DeploymentState) (*deploymentstate.DeploymentState, error) {
 	ds, err := deploymentstate.New(cfg)
 	if err != nil {
@@ -3,6 +3,8 @@ package commons
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -127,6 +129,51 @@ func GetVersionPathOrSlotPathForApp(appPath, slotSuffix, versionSuffix string) (
 	return versionPath, nil
 }
 
+// ChecksumDir returns SHA256 checksum of names and contents of all files
+// in a given directory (recursively), except hidden ones (e.g. .terraform)
+// and given paths
+func ChecksumDir(rootPath string, excludePaths []string) (string, error) {
+	excluded := make(map[string]bool, len(excludePaths))
+	for _, p := range excludePaths {
+		excluded[filepath.Clean(p)] = true
+	}
+
+	h := sha256.New()
+	err := filepath.Walk(rootPath, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if (p != rootPath && strings.HasPrefix(info.Name(), ".")) || excluded[filepath.Clean(p)] {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(rootPath, p)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(relPath), info.Size())
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 func doesFileOrDirExist(path string) (bool, error) {
 	if _, err := os.Stat(path); err != nil {
 		if os.IsNotExist(err) {
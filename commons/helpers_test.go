@@ -182,6 +182,56 @@ func TestDoesFileOrDirExist(t *testing.T) {
 
 }
 
+func TestChecksumDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rt-checksum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"main.tf":                 `resource "aws_instance" "web" {}`,
+		"modules/web/main.tf":     `variable "ami" {}`,
+		".terraform/modules/x.tf": "ignored",
+		"blue-planfile":           "ignored",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		err := ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	exclude := []string{filepath.Join(dir, "blue-planfile")}
+
+	checksum, err := ChecksumDir(dir, exclude)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hidden & excluded files don't change the checksum
+	ioutil.WriteFile(filepath.Join(dir, ".terraform/modules/x.tf"), []byte("changed"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "blue-planfile"), []byte("changed"), 0644)
+	sameChecksum, err := ChecksumDir(dir, exclude)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sameChecksum != checksum {
+		t.Fatalf("Expected checksum to stay %q, given: %q", checksum, sameChecksum)
+	}
+
+	// Configs in subdirectories (e.g. local modules) do
+	ioutil.WriteFile(filepath.Join(dir, "modules/web/main.tf"), []byte(`variable "ami" { default = "x" }`), 0644)
+	newChecksum, err := ChecksumDir(dir, exclude)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newChecksum == checksum {
+		t.Fatalf("Expected checksum to change after changing module, given: %q", newChecksum)
+	}
+}
+
 func TestReadAndDecodeHCLFromFile(t *testing.T) {
 	tplVars := _TestVars{
 		AwsAccountId: "123123123123",
@@ -2,6 +2,8 @@ package backends
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
 )
@@ -42,11 +44,99 @@ func (s *AppNotFound) Error() string {
 	return fmt.Sprintf("Application %q was not found.", s.AppName)
 }
 
+type LockHeld struct {
+	AppName string
+	Lock    *schema.LockData
+}
+
+func (l *LockHeld) Error() string {
+	holder := "unknown"
+	if l.Lock.Holder != nil {
+		holder = fmt.Sprintf("%s (%s)", l.Lock.Holder.AWSApiCaller, l.Lock.Holder.IPAddress)
+	}
+	command := fmt.Sprintf("%q", l.Lock.Command)
+	if l.Lock.Reason != "" {
+		command = fmt.Sprintf("%s (%s)", command, l.Lock.Reason)
+	}
+	return fmt.Sprintf("Application %q is locked by %s running %s since %s (lock expires %s).",
+		l.AppName, holder, command,
+		l.Lock.AcquiredAt.Format(time.RFC1123), l.Lock.ExpiresAt.Format(time.RFC1123))
+}
+
+type LockNotFound struct {
+	AppName     string
+	OriginalErr error
+}
+
+func (l *LockNotFound) Error() string {
+	return fmt.Sprintf("No lock found for application %q.", l.AppName)
+}
+
+type DeploymentNotFound struct {
+	SlotName     string
+	DeploymentId string
+	OriginalErr  error
+}
+
+func (d *DeploymentNotFound) Error() string {
+	return fmt.Sprintf("Deployment %q of slot %q was not found.", d.DeploymentId, d.SlotName)
+}
+
+type DeploymentChangesNotFound struct {
+	DeploymentId string
+	OriginalErr  error
+}
+
+func (c *DeploymentChangesNotFound) Error() string {
+	return fmt.Sprintf("No resource changes found for deployment %q.", c.DeploymentId)
+}
+
+type PlanNotFound struct {
+	PlanId      string
+	OriginalErr error
+}
+
+func (p *PlanNotFound) Error() string {
+	return fmt.Sprintf("Plan %q was not found.", p.PlanId)
+}
+
+// parseDeploymentId extracts deployment ID from a file/object name
+// of a given slot. Deployments of other slots sharing the prefix
+// (e.g. "blue-2" when listing "blue") are skipped as deployment IDs contain no dashes.
+func parseDeploymentId(key, prefix, suffix string) (string, bool) {
+	if !strings.HasPrefix(key, prefix) || !strings.HasSuffix(key, suffix) {
+		return "", false
+	}
+	deploymentId := strings.TrimSuffix(strings.TrimPrefix(key, prefix), suffix)
+	if deploymentId == "" || strings.Contains(deploymentId, "-") {
+		return "", false
+	}
+	return deploymentId, true
+}
+
 type Backend interface {
 	Configure(config map[string]interface{}) (interface{}, error)
 
 	SupportsWriteLock() bool
 
+	// AcquireLock takes the write lock for a given app unless
+	// it's already held by someone else (returns *LockHeld).
+	// Expired locks may be taken over.
+	AcquireLock(meta interface{}, appName string, lock *schema.LockData) error
+
+	// GetLock returns the lock currently held for a given app
+	// or *LockNotFound if there's none
+	GetLock(meta interface{}, appName string) (*schema.LockData, error)
+
+	// ReleaseLock releases the lock for a given app if lockId matches
+	// the held lock (returns *LockHeld otherwise)
+	ReleaseLock(meta interface{}, appName, lockId string) error
+
+	// RefreshLock saves a given lock (e.g. with later expiry) if it's still
+	// the held lock (returns *LockHeld if somebody else holds it
+	// or *LockNotFound if it was released in the meantime)
+	RefreshLock(meta interface{}, appName string, lock *schema.LockData) error
+
 	// IsReady can perform any kind of preliminar
 	// check (e.g. is TCP port open, are credentials valid,
 	// are permissions sufficient) to verify the backend
@@ -67,6 +157,7 @@ type Backend interface {
 	ListSlots(meta interface{}, appName string) ([]*schema.SlotData, error)
 
 	// DeleteSlot deletes all slot data available in the backend
+	// including all deployments of the slot
 	DeleteSlot(meta interface{}, appName, slotId string) error
 
 	// SaveSlot saves any given slot data into backend
@@ -83,5 +174,23 @@ type Backend interface {
 
 	// GetDeployment returns deployment data
 	// for a given slotId & deploymentId saved previously in the backend
+	// or *DeploymentNotFound if there's none
 	GetDeployment(meta interface{}, appName, slotId, deploymentId string) (*schema.DeploymentData, error)
+
+	// SaveDeploymentChanges saves resource changes of a given deployment
+	// separately from the deployment data
+	SaveDeploymentChanges(meta interface{}, appName, slotId, deploymentId string, data *schema.DeploymentChangesData) error
+
+	// GetDeploymentChanges returns resource changes of a given deployment
+	// or *DeploymentChangesNotFound if none were saved
+	GetDeploymentChanges(meta interface{}, appName, slotId, deploymentId string) (*schema.DeploymentChangesData, error)
+
+	// SavePlan saves a Terraform plan (incl. the planfile) of a given app
+	SavePlan(meta interface{}, appName, planId string, data *schema.PlanData) error
+
+	// GetPlan returns a plan saved previously or *PlanNotFound
+	GetPlan(meta interface{}, appName, planId string) (*schema.PlanData, error)
+
+	// DeletePlan deletes a given plan if it exists
+	DeletePlan(meta interface{}, appName, planId string) error
 }
@@ -0,0 +1,825 @@
+package backendstest
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/backends"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
+)
+
+// SetUpFunc returns a backend configured (meta) against empty storage
+// along with a function cleaning the storage up afterwards
+type SetUpFunc func(t *testing.T) (backends.Backend, interface{}, func())
+
+// TestBackendConformance verifies a given backend behaves
+// the way DeploymentState expects any backend to behave
+func TestBackendConformance(t *testing.T, setUp SetUpFunc) {
+	cases := []struct {
+		Name string
+		Func func(t *testing.T, b backends.Backend, meta interface{})
+	}{
+		{"IsReady", testIsReady},
+		{"ApplicationRoundTrip", testApplicationRoundTrip},
+		{"ApplicationNotFound", testApplicationNotFound},
+		{"ListApplications", testListApplications},
+		{"SlotRoundTrip", testSlotRoundTrip},
+		{"SlotNotFound", testSlotNotFound},
+		{"ListSlots", testListSlots},
+		{"DeleteSlot", testDeleteSlot},
+		{"DeploymentRoundTrip", testDeploymentRoundTrip},
+		{"DeploymentNotFound", testDeploymentNotFound},
+		{"DeploymentOrdering", testDeploymentOrdering},
+		{"DeploymentLimit", testDeploymentLimit},
+		{"DeploymentIdFormats", testDeploymentIdFormats},
+		{"DeploymentsOfSlotsSharingPrefix", testDeploymentsOfSlotsSharingPrefix},
+		{"DeploymentChangesRoundTrip", testDeploymentChangesRoundTrip},
+		{"PlanRoundTrip", testPlanRoundTrip},
+		{"Locking", testLocking},
+		{"LockExpiry", testLockExpiry},
+		{"LockRefresh", testLockRefresh},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			b, meta, tearDown := setUp(t)
+			defer tearDown()
+			c.Func(t, b, meta)
+		})
+	}
+}
+
+func testIsReady(t *testing.T, b backends.Backend, meta interface{}) {
+	isReady, err := b.IsReady(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isReady {
+		t.Fatal("Expected backend to be ready")
+	}
+}
+
+func testApplicationRoundTrip(t *testing.T, b backends.Backend, meta interface{}) {
+	timestamp := time.Date(2016, time.March, 30, 14, 4, 5, 0, time.UTC)
+	data := &schema.ApplicationData{
+		IsActive: true,
+		InfraOutputs: terraform.Outputs{
+			"colour":  "blue",
+			"subnets": []interface{}{"subnet-1", "subnet-2"},
+			"tags":    map[string]interface{}{"team": "ape"},
+		},
+		LastRtVersion:        "1.2.3",
+		LastTerraformVersion: "0.7.2",
+		LastDeploymentTime:   timestamp,
+		LastInfraChangeTime:  timestamp,
+		SlotCounters:         map[string]int64{"blue": 3},
+		InfraVariables:       map[string]string{"app_name": "brandnewapp", "environment": "test"},
+	}
+	err := b.SaveApplication(meta, "brandnewapp", data)
+	if err != nil {
+		t.Fatalf("Unexpected error when saving app: %s", err)
+	}
+
+	app, err := b.GetApplication(meta, "brandnewapp")
+	if err != nil {
+		t.Fatalf("Unexpected error when getting app: %s", err)
+	}
+	expected := *data
+	expected.Name = "brandnewapp"
+	if !reflect.DeepEqual(*app, expected) {
+		t.Fatalf("App data don't match.\nExpected: %#v\nGiven: %#v", expected, *app)
+	}
+
+	// Saving again overwrites
+	data.IsActive = false
+	err = b.SaveApplication(meta, "brandnewapp", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err = b.GetApplication(meta, "brandnewapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.IsActive {
+		t.Fatal("Expected app to be overwritten (inactive)")
+	}
+}
+
+func testApplicationNotFound(t *testing.T, b backends.Backend, meta interface{}) {
+	_, err := b.GetApplication(meta, "my-special-app")
+	if err == nil {
+		t.Fatal("Expected error when getting non-existent app")
+	}
+	if _, ok := err.(*backends.AppNotFound); !ok {
+		t.Fatalf("Expected AppNotFound error, given: %s", err)
+	}
+}
+
+func testListApplications(t *testing.T, b backends.Backend, meta interface{}) {
+	apps, err := b.ListApplications(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 0 {
+		t.Fatalf("Expected no apps in empty backend, given: %d", len(apps))
+	}
+
+	for i := 0; i < 5; i++ {
+		err := b.SaveApplication(meta, fmt.Sprintf("rt-test-%d", i), &schema.ApplicationData{
+			IsActive:     true,
+			InfraOutputs: terraform.Outputs{"order": fmt.Sprintf("%d", i)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Other records must not be mistaken for apps
+	err = b.SaveSlot(meta, "rt-test-0", "blue", &schema.SlotData{IsActive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apps, err = b.ListApplications(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 5 {
+		t.Fatalf("Expected exactly 5 apps, given: %d", len(apps))
+	}
+	names := make(map[string]string, 0)
+	for _, app := range apps {
+		names[app.Name], _ = app.InfraOutputs.GetString("order")
+	}
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("rt-test-%d", i)
+		if names[name] != fmt.Sprintf("%d", i) {
+			t.Fatalf("Expected app %q with order %d, given: %q", name, i, names)
+		}
+	}
+}
+
+func testSlotRoundTrip(t *testing.T, b backends.Backend, meta interface{}) {
+	timestamp := time.Date(2016, time.March, 30, 14, 4, 5, 0, time.UTC)
+	data := &schema.SlotData{
+		IsActive:                true,
+		LastDeploymentStartTime: timestamp,
+		LastDeployPilot: &schema.DeployPilot{
+			AWSApiCaller: "arn:aws:iam::123456789012:user/Bob",
+			IPAddress:    "8.8.8.8",
+		},
+		LastTerraformRun: &schema.TerraformRun{
+			FinishTime: timestamp,
+			Variables:  map[string]string{"app_version": "1.0"},
+			Outputs:    terraform.Outputs{"url": "http://example.com"},
+		},
+	}
+	err := b.SaveSlot(meta, "FindingUmar", "BLUE", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slot, err := b.GetSlot(meta, "FindingUmar", "BLUE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := *data
+	expected.SlotId = "BLUE"
+	if !reflect.DeepEqual(*slot, expected) {
+		t.Fatalf("Slot data don't match.\nExpected: %#v\nGiven: %#v", expected, *slot)
+	}
+}
+
+func testSlotNotFound(t *testing.T, b backends.Backend, meta interface{}) {
+	_, err := b.GetSlot(meta, "my-special-app", "newslot")
+	if err == nil {
+		t.Fatal("Expected error when getting non-existent slot")
+	}
+	if _, ok := err.(*backends.SlotNotFound); !ok {
+		t.Fatalf("Expected SlotNotFound error, given: %s", err)
+	}
+}
+
+func testDeploymentNotFound(t *testing.T, b backends.Backend, meta interface{}) {
+	_, err := b.GetDeployment(meta, "BloodyHell", "NEW", deploymentId(0))
+	if _, ok := err.(*backends.DeploymentNotFound); !ok {
+		t.Fatalf("Expected DeploymentNotFound error, given: %v", err)
+	}
+
+	err = b.SaveDeployment(meta, "BloodyHell", "NEW", deploymentId(0), &schema.DeploymentData{RTVersion: "1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.GetDeployment(meta, "BloodyHell", "NEW", deploymentId(1))
+	if _, ok := err.(*backends.DeploymentNotFound); !ok {
+		t.Fatalf("Expected DeploymentNotFound error for other deployment of existing slot, given: %v", err)
+	}
+}
+
+func testListSlots(t *testing.T, b backends.Backend, meta interface{}) {
+	slots, err := b.ListSlots(meta, "CookieMonster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 0 {
+		t.Fatalf("Expected no slots, given: %d", len(slots))
+	}
+
+	for i := 100; i < 115; i++ {
+		err := b.SaveSlot(meta, "CookieMonster", fmt.Sprintf("RANDOM_%d", i), &schema.SlotData{
+			IsActive: i%2 == 0,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Slots of other apps must not be listed
+	err = b.SaveSlot(meta, "CookieMonster2", "RANDOM_999", &schema.SlotData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Deployments must not be mistaken for slots
+	err = b.SaveDeployment(meta, "CookieMonster", "RANDOM_100", deploymentId(0), &schema.DeploymentData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slots, err = b.ListSlots(meta, "CookieMonster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 15 {
+		t.Fatalf("Expected exactly 15 slots, given: %d", len(slots))
+	}
+	for _, s := range slots {
+		var i int
+		_, err := fmt.Sscanf(s.SlotId, "RANDOM_%d", &i)
+		if err != nil {
+			t.Fatalf("Unexpected slot ID %q: %s", s.SlotId, err)
+		}
+		if s.IsActive != (i%2 == 0) {
+			t.Fatalf("Slot %q data don't match: %#v", s.SlotId, s)
+		}
+	}
+}
+
+func testDeleteSlot(t *testing.T, b backends.Backend, meta interface{}) {
+	for _, slotId := range []string{"BLUE", "GREEN"} {
+		err := b.SaveSlot(meta, "FindingUmar", slotId, &schema.SlotData{IsActive: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			err := b.SaveDeployment(meta, "FindingUmar", slotId, deploymentId(i), &schema.DeploymentData{
+				StartTime: deploymentStartTime(i),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = b.SaveDeploymentChanges(meta, "FindingUmar", slotId, deploymentId(i), &schema.DeploymentChangesData{
+				ResourceChanges: []*terraform.ResourceChange{{Address: "aws_sns_topic.s", Action: terraform.ActionCreate}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	err := b.DeleteSlot(meta, "FindingUmar", "BLUE")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = b.GetSlot(meta, "FindingUmar", "BLUE")
+	if _, ok := err.(*backends.SlotNotFound); !ok {
+		t.Fatalf("Expected SlotNotFound error for deleted slot, given: %v", err)
+	}
+	deployments, err := b.ListSortedDeploymentsForSlotId(meta, "FindingUmar", "BLUE", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deployments) != 0 {
+		t.Fatalf("Expected deployments of deleted slot to be gone, given: %d", len(deployments))
+	}
+	_, err = b.GetDeploymentChanges(meta, "FindingUmar", "BLUE", deploymentId(0))
+	if _, ok := err.(*backends.DeploymentChangesNotFound); !ok {
+		t.Fatalf("Expected changes of deleted slot to be gone, given: %v", err)
+	}
+
+	// Other slots must stay untouched
+	_, err = b.GetSlot(meta, "FindingUmar", "GREEN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployments, err = b.ListSortedDeploymentsForSlotId(meta, "FindingUmar", "GREEN", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deployments) != 3 {
+		t.Fatalf("Expected 3 deployments of GREEN slot, given: %d", len(deployments))
+	}
+	_, err = b.GetDeploymentChanges(meta, "FindingUmar", "GREEN", deploymentId(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testDeploymentRoundTrip(t *testing.T, b backends.Backend, meta interface{}) {
+	timestamp := time.Date(2016, time.March, 30, 14, 4, 5, 0, time.UTC)
+	data := &schema.DeploymentData{
+		RTVersion: "1.0",
+		StartTime: timestamp,
+		DeployPilot: &schema.DeployPilot{
+			AWSApiCaller: "arn:aws:iam::123456789012:user/Bob",
+			IPAddress:    "8.8.8.8",
+		},
+		Terraform: &schema.TerraformRun{
+			StartTime:  timestamp,
+			FinishTime: timestamp.Add(1 * time.Minute),
+			Variables:  map[string]string{"app_version": "1.0"},
+			Outputs:    terraform.Outputs{"url": "http://example.com"},
+		},
+	}
+	id := deploymentId(0)
+	err := b.SaveDeployment(meta, "BloodyHell", "NEW", id, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deployment, err := b.GetDeployment(meta, "BloodyHell", "NEW", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := *data
+	expected.DeploymentId = id
+	if !reflect.DeepEqual(*deployment, expected) {
+		t.Fatalf("Deployment data don't match.\nExpected: %#v\nGiven: %#v", expected, *deployment)
+	}
+}
+
+func testDeploymentChangesRoundTrip(t *testing.T, b backends.Backend, meta interface{}) {
+	id := deploymentId(0)
+	_, err := b.GetDeploymentChanges(meta, "BloodyHell", "NEW", id)
+	if _, ok := err.(*backends.DeploymentChangesNotFound); !ok {
+		t.Fatalf("Expected DeploymentChangesNotFound error, given: %v", err)
+	}
+
+	data := &schema.DeploymentChangesData{
+		ResourceChanges: []*terraform.ResourceChange{
+			{
+				Address: "aws_instance.web",
+				Type:    "aws_instance",
+				Action:  terraform.ActionReplace,
+				Before:  map[string]interface{}{"ami": "ami-1"},
+				After:   map[string]interface{}{"ami": "ami-2"},
+			},
+			{
+				Address: "aws_sns_topic.s",
+				Type:    "aws_sns_topic",
+				Action:  terraform.ActionDelete,
+				Before:  map[string]interface{}{"name": "umarsticks"},
+			},
+		},
+	}
+	err = b.SaveDeployment(meta, "BloodyHell", "NEW", id, &schema.DeploymentData{
+		StartTime: deploymentStartTime(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.SaveDeploymentChanges(meta, "BloodyHell", "NEW", id, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := b.GetDeploymentChanges(meta, "BloodyHell", "NEW", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := *data
+	expected.DeploymentId = id
+	if !reflect.DeepEqual(*changes, expected) {
+		t.Fatalf("Deployment changes don't match.\nExpected: %#v\nGiven: %#v", expected, *changes)
+	}
+
+	// Changes must not show up as deployments
+	deployments, err := b.ListSortedDeploymentsForSlotId(meta, "BloodyHell", "NEW", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deployments) != 1 {
+		t.Fatalf("Expected exactly 1 deployment, given: %d", len(deployments))
+	}
+}
+
+func testPlanRoundTrip(t *testing.T, b backends.Backend, meta interface{}) {
+	_, err := b.GetPlan(meta, "BloodyHell", "3f9a1c2b5e6d7a8b")
+	if _, ok := err.(*backends.PlanNotFound); !ok {
+		t.Fatalf("Expected PlanNotFound error, given: %v", err)
+	}
+
+	timestamp := time.Date(2016, time.March, 30, 14, 4, 5, 0, time.UTC)
+	data := &schema.PlanData{
+		SlotId:           "NEW",
+		CreatedBy:        &schema.DeployPilot{AWSApiCaller: "arn:aws:iam::123456789012:user/Bob"},
+		PlanStartTime:    timestamp,
+		PlanFinishTime:   timestamp.Add(time.Minute),
+		Variables:        map[string]string{"app_version": "NEW"},
+		RTVersion:        "0.1.0",
+		TerraformVersion: "0.12.29",
+		ConfigChecksum:   "0123456789abcdef",
+		LastDeploymentId: deploymentId(0),
+		Diff: &terraform.PlanResourceDiff{
+			ToCreate: 1,
+			Changes: []*terraform.ResourceChange{
+				{
+					Address: "aws_instance.web",
+					Type:    "aws_instance",
+					Action:  terraform.ActionCreate,
+					After:   map[string]interface{}{"ami": "ami-1"},
+				},
+			},
+		},
+		Planfile: []byte{0x50, 0x4b, 0x03, 0x04, 0x00, 0xff},
+	}
+	err = b.SavePlan(meta, "BloodyHell", "3f9a1c2b5e6d7a8b", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := b.GetPlan(meta, "BloodyHell", "3f9a1c2b5e6d7a8b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := *data
+	expected.PlanId = "3f9a1c2b5e6d7a8b"
+	if !reflect.DeepEqual(*plan, expected) {
+		t.Fatalf("Plan doesn't match.\nExpected: %#v\nGiven: %#v", expected, *plan)
+	}
+
+	// Plans must not show up as slots
+	slots, err := b.ListSlots(meta, "BloodyHell")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 0 {
+		t.Fatalf("Expected no slots, given: %d", len(slots))
+	}
+
+	err = b.DeletePlan(meta, "BloodyHell", "3f9a1c2b5e6d7a8b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.GetPlan(meta, "BloodyHell", "3f9a1c2b5e6d7a8b")
+	if _, ok := err.(*backends.PlanNotFound); !ok {
+		t.Fatalf("Expected PlanNotFound error after deletion, given: %v", err)
+	}
+
+	// Deleting a plan which doesn't exist is fine
+	err = b.DeletePlan(meta, "BloodyHell", "3f9a1c2b5e6d7a8b")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testDeploymentOrdering(t *testing.T, b backends.Backend, meta interface{}) {
+	// Saved out of order on purpose
+	for _, i := range []int{3, 0, 4, 1, 2} {
+		err := b.SaveDeployment(meta, "BloodyHell", "NEW", deploymentId(i), &schema.DeploymentData{
+			RTVersion: fmt.Sprintf("%d", i),
+			StartTime: deploymentStartTime(i),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deployments, err := b.ListSortedDeploymentsForSlotId(meta, "BloodyHell", "NEW", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	given := make([]string, 0)
+	for _, d := range deployments {
+		given = append(given, d.RTVersion)
+	}
+	expected := []string{"4", "3", "2", "1", "0"}
+	if !reflect.DeepEqual(given, expected) {
+		t.Fatalf("Expected deployments sorted from newest to oldest.\nExpected: %q\nGiven: %q",
+			expected, given)
+	}
+	for _, d := range deployments {
+		var i int
+		fmt.Sscanf(d.RTVersion, "%d", &i)
+		if d.DeploymentId != deploymentId(i) {
+			t.Fatalf("Expected deployment ID %q, given: %q", deploymentId(i), d.DeploymentId)
+		}
+	}
+}
+
+// Deployments with legacy IDs (seconds) and current IDs
+// (nanoseconds + random suffix) need to co-exist in the same slot
+func testDeploymentIdFormats(t *testing.T, b backends.Backend, meta interface{}) {
+	ids := []string{
+		deploymentId(0),
+		deploymentId(1),
+		nanoDeploymentId(2, "0a1b2c3d"),
+		nanoDeploymentId(3, "ffffffff"),
+	}
+	// Saved out of order on purpose
+	for _, i := range []int{2, 0, 3, 1} {
+		err := b.SaveDeployment(meta, "BloodyHell", "NEW", ids[i], &schema.DeploymentData{
+			RTVersion: fmt.Sprintf("%d", i),
+			StartTime: deploymentStartTime(i),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deployments, err := b.ListSortedDeploymentsForSlotId(meta, "BloodyHell", "NEW", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	given := make([]string, 0)
+	for _, d := range deployments {
+		given = append(given, d.DeploymentId)
+	}
+	expected := []string{ids[3], ids[2], ids[1], ids[0]}
+	if !reflect.DeepEqual(given, expected) {
+		t.Fatalf("Expected deployments sorted from newest to oldest.\nExpected: %q\nGiven: %q",
+			expected, given)
+	}
+
+	d, err := b.GetDeployment(meta, "BloodyHell", "NEW", ids[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.RTVersion != "2" {
+		t.Fatalf("Expected deployment %q, given: %q", "2", d.RTVersion)
+	}
+}
+
+func testDeploymentLimit(t *testing.T, b backends.Backend, meta interface{}) {
+	for i := 0; i < 5; i++ {
+		err := b.SaveDeployment(meta, "BloodyHell", "NEW", deploymentId(i), &schema.DeploymentData{
+			RTVersion: fmt.Sprintf("%d", i),
+			StartTime: deploymentStartTime(i),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deployments, err := b.ListSortedDeploymentsForSlotId(meta, "BloodyHell", "NEW", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deployments) != 2 {
+		t.Fatalf("Expected exactly 2 deployments, given: %d", len(deployments))
+	}
+	if deployments[0].RTVersion != "4" || deployments[1].RTVersion != "3" {
+		t.Fatalf("Expected 2 newest deployments, given: %q, %q",
+			deployments[0].RTVersion, deployments[1].RTVersion)
+	}
+
+	deployments, err = b.ListSortedDeploymentsForSlotId(meta, "BloodyHell", "EMPTY", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deployments) != 0 {
+		t.Fatalf("Expected no deployments for empty slot, given: %d", len(deployments))
+	}
+}
+
+func testDeploymentsOfSlotsSharingPrefix(t *testing.T, b backends.Backend, meta interface{}) {
+	for i, slotId := range []string{"blue", "blue-2", "blue2"} {
+		err := b.SaveSlot(meta, "Prefixed", slotId, &schema.SlotData{IsActive: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = b.SaveDeployment(meta, "Prefixed", slotId, deploymentId(i), &schema.DeploymentData{
+			RTVersion: slotId,
+			StartTime: deploymentStartTime(i),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deployments, err := b.ListSortedDeploymentsForSlotId(meta, "Prefixed", "blue", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deployments) != 1 || deployments[0].RTVersion != "blue" {
+		t.Fatalf("Expected only deployment of slot %q, given: %#v", "blue", deployments)
+	}
+
+	err = b.DeleteSlot(meta, "Prefixed", "blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, slotId := range []string{"blue-2", "blue2"} {
+		deployments, err := b.ListSortedDeploymentsForSlotId(meta, "Prefixed", slotId, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deployments) != 1 {
+			t.Fatalf("Expected deployment of %q to survive deletion of %q, given: %d",
+				slotId, "blue", len(deployments))
+		}
+	}
+}
+
+func testLocking(t *testing.T, b backends.Backend, meta interface{}) {
+	if !b.SupportsWriteLock() {
+		t.Skip("Backend doesn't support locking")
+	}
+
+	_, err := b.GetLock(meta, "LockedApp")
+	if _, ok := err.(*backends.LockNotFound); !ok {
+		t.Fatalf("Expected LockNotFound error, given: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	lock := &schema.LockData{
+		LockId: "first",
+		Holder: &schema.DeployPilot{
+			AWSApiCaller: "arn:aws:iam::123456789012:user/Bob",
+			IPAddress:    "8.8.8.8",
+		},
+		Command:    "deploy",
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(1 * time.Hour),
+	}
+	err = b.AcquireLock(meta, "LockedApp", lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	heldLock, err := b.GetLock(meta, "LockedApp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := *lock
+	expected.AppName = "LockedApp"
+	if !reflect.DeepEqual(*heldLock, expected) {
+		t.Fatalf("Lock data don't match.\nExpected: %#v\nGiven: %#v", expected, *heldLock)
+	}
+
+	// Other apps are not affected
+	err = b.AcquireLock(meta, "OtherApp", &schema.LockData{
+		LockId:     "other",
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(1 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Expected lock of other app to be acquired, given: %s", err)
+	}
+
+	secondLock := &schema.LockData{
+		LockId:     "second",
+		Command:    "apply-infra",
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(1 * time.Hour),
+	}
+	err = b.AcquireLock(meta, "LockedApp", secondLock)
+	lh, ok := err.(*backends.LockHeld)
+	if !ok {
+		t.Fatalf("Expected LockHeld error, given: %v", err)
+	}
+	if lh.Lock.LockId != "first" {
+		t.Fatalf("Expected lock to be held by %q, given: %q", "first", lh.Lock.LockId)
+	}
+
+	err = b.ReleaseLock(meta, "LockedApp", "second")
+	if _, ok := err.(*backends.LockHeld); !ok {
+		t.Fatalf("Expected LockHeld error when releasing someone else's lock, given: %v", err)
+	}
+
+	err = b.ReleaseLock(meta, "LockedApp", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.GetLock(meta, "LockedApp")
+	if _, ok := err.(*backends.LockNotFound); !ok {
+		t.Fatalf("Expected LockNotFound error after release, given: %v", err)
+	}
+
+	// Releasing released lock is no-op
+	err = b.ReleaseLock(meta, "LockedApp", "first")
+	if err != nil {
+		t.Fatalf("Expected releasing released lock to succeed, given: %s", err)
+	}
+
+	err = b.AcquireLock(meta, "LockedApp", secondLock)
+	if err != nil {
+		t.Fatalf("Expected lock to be acquired after release, given: %s", err)
+	}
+}
+
+func testLockExpiry(t *testing.T, b backends.Backend, meta interface{}) {
+	if !b.SupportsWriteLock() {
+		t.Skip("Backend doesn't support locking")
+	}
+
+	now := time.Now().UTC()
+	expiredLock := &schema.LockData{
+		LockId:     "stale",
+		Command:    "deploy",
+		AcquiredAt: now.Add(-3 * time.Hour),
+		ExpiresAt:  now.Add(-1 * time.Hour),
+	}
+	err := b.AcquireLock(meta, "CrashedApp", expiredLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lock := &schema.LockData{
+		LockId:     "fresh",
+		Command:    "deploy",
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(1 * time.Hour),
+	}
+	err = b.AcquireLock(meta, "CrashedApp", lock)
+	if err != nil {
+		t.Fatalf("Expected expired lock to be taken over, given: %s", err)
+	}
+	heldLock, err := b.GetLock(meta, "CrashedApp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heldLock.LockId != "fresh" {
+		t.Fatalf("Expected lock to be held by %q, given: %q", "fresh", heldLock.LockId)
+	}
+}
+
+func testLockRefresh(t *testing.T, b backends.Backend, meta interface{}) {
+	if !b.SupportsWriteLock() {
+		t.Skip("Backend doesn't support locking")
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	lock := &schema.LockData{
+		LockId:     "long-running",
+		Command:    "deploy",
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(1 * time.Hour),
+	}
+	err := b.RefreshLock(meta, "RefreshedApp", lock)
+	if _, ok := err.(*backends.LockNotFound); !ok {
+		t.Fatalf("Expected LockNotFound error when refreshing lock never acquired, given: %v", err)
+	}
+
+	err = b.AcquireLock(meta, "RefreshedApp", lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshedLock := *lock
+	refreshedLock.ExpiresAt = now.Add(2 * time.Hour)
+	err = b.RefreshLock(meta, "RefreshedApp", &refreshedLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heldLock, err := b.GetLock(meta, "RefreshedApp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !heldLock.ExpiresAt.Equal(refreshedLock.ExpiresAt) {
+		t.Fatalf("Expected lock to expire at %s, given: %s", refreshedLock.ExpiresAt, heldLock.ExpiresAt)
+	}
+
+	otherLock := &schema.LockData{
+		LockId:     "other",
+		Command:    "deploy",
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(1 * time.Hour),
+	}
+	err = b.RefreshLock(meta, "RefreshedApp", otherLock)
+	lh, ok := err.(*backends.LockHeld)
+	if !ok {
+		t.Fatalf("Expected LockHeld error when refreshing someone else's lock, given: %v", err)
+	}
+	if lh.Lock.LockId != "long-running" {
+		t.Fatalf("Expected lock to be held by %q, given: %q", "long-running", lh.Lock.LockId)
+	}
+}
+
+// deploymentId mimics IDs generated by DeploymentState,
+// i.e. higher i = newer deployment = lower ID
+func deploymentId(i int) string {
+	return fmt.Sprintf("%020d", math.MaxInt64-int(deploymentStartTime(i).Unix()))
+}
+
+// nanoDeploymentId mimics IDs generated by DeploymentState since
+// sub-second precision was introduced
+func nanoDeploymentId(i int, suffix string) string {
+	return fmt.Sprintf("%020d.%s", math.MaxInt64-deploymentStartTime(i).UnixNano(), suffix)
+}
+
+func deploymentStartTime(i int) time.Time {
+	return time.Date(2016, time.March, 30, 14, 4, 5, 0, time.UTC).Add(time.Duration(i) * time.Minute)
+}
@@ -0,0 +1,543 @@
+package backendstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// DynamoDBStandIn is an in-memory DynamoDB API server which understands
+// just enough of the API (and of the expression syntax) for the DynamoDB
+// deployment state backend to be tested without AWS or DynamoDB Local
+type DynamoDBStandIn struct {
+	server *httptest.Server
+
+	mu     sync.Mutex
+	tables map[string]*standInTable
+}
+
+type standInTable struct {
+	description *dynamodb.TableDescription
+	hashKey     string
+	rangeKey    string
+	// index name -> range key
+	indexes map[string]string
+	// hash key -> range key -> item
+	items map[string]map[string]map[string]*dynamodb.AttributeValue
+}
+
+func NewDynamoDBStandIn() *DynamoDBStandIn {
+	s := &DynamoDBStandIn{
+		tables: make(map[string]*standInTable, 0),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *DynamoDBStandIn) URL() string {
+	return s.server.URL
+}
+
+func (s *DynamoDBStandIn) Close() {
+	s.server.Close()
+}
+
+// BackendConfig returns config for the DynamoDB backend pointing to the stand-in
+func (s *DynamoDBStandIn) BackendConfig(table, prefix string) map[string]interface{} {
+	return map[string]interface{}{
+		"table":      table,
+		"prefix":     prefix,
+		"region":     "us-east-1",
+		"endpoint":   s.URL(),
+		"access_key": "stand-in",
+		"secret_key": "stand-in",
+	}
+}
+
+type standInError struct {
+	Code    string
+	Message string
+}
+
+func (s *DynamoDBStandIn) handle(w http.ResponseWriter, r *http.Request) {
+	target := r.Header.Get("X-Amz-Target")
+	operation := strings.TrimPrefix(target, "DynamoDB_20120810.")
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s.writeError(w, &standInError{"SerializationException", err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out interface{}
+	var sErr *standInError
+	switch operation {
+	case "CreateTable":
+		in := &dynamodb.CreateTableInput{}
+		if sErr = s.unmarshal(body, in); sErr == nil {
+			out, sErr = s.createTable(in)
+		}
+	case "DeleteTable":
+		in := &dynamodb.DeleteTableInput{}
+		if sErr = s.unmarshal(body, in); sErr == nil {
+			out, sErr = s.deleteTable(in)
+		}
+	case "DescribeTable":
+		in := &dynamodb.DescribeTableInput{}
+		if sErr = s.unmarshal(body, in); sErr == nil {
+			out, sErr = s.describeTable(in)
+		}
+	case "PutItem":
+		in := &dynamodb.PutItemInput{}
+		if sErr = s.unmarshal(body, in); sErr == nil {
+			out, sErr = s.putItem(in)
+		}
+	case "GetItem":
+		in := &dynamodb.GetItemInput{}
+		if sErr = s.unmarshal(body, in); sErr == nil {
+			out, sErr = s.getItem(in)
+		}
+	case "DeleteItem":
+		in := &dynamodb.DeleteItemInput{}
+		if sErr = s.unmarshal(body, in); sErr == nil {
+			out, sErr = s.deleteItem(in)
+		}
+	case "Query":
+		in := &dynamodb.QueryInput{}
+		if sErr = s.unmarshal(body, in); sErr == nil {
+			out, sErr = s.query(in)
+		}
+	case "Scan":
+		in := &dynamodb.ScanInput{}
+		if sErr = s.unmarshal(body, in); sErr == nil {
+			out, sErr = s.scan(in)
+		}
+	default:
+		sErr = &standInError{"UnknownOperationException", fmt.Sprintf("Operation %q not supported", target)}
+	}
+	if sErr != nil {
+		s.writeError(w, sErr)
+		return
+	}
+
+	b, err := jsonutil.BuildJSON(out)
+	if err != nil {
+		s.writeError(w, &standInError{"InternalServerError", err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.Write(b)
+}
+
+func (s *DynamoDBStandIn) unmarshal(body []byte, v interface{}) *standInError {
+	err := jsonutil.UnmarshalJSON(v, strings.NewReader(string(body)))
+	if err != nil {
+		return &standInError{"SerializationException", err.Error()}
+	}
+	return nil
+}
+
+func (s *DynamoDBStandIn) writeError(w http.ResponseWriter, e *standInError) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.WriteHeader(http.StatusBadRequest)
+	b, _ := json.Marshal(map[string]string{
+		"__type":  "com.amazonaws.dynamodb.v20120810#" + e.Code,
+		"message": e.Message,
+	})
+	w.Write(b)
+}
+
+func (s *DynamoDBStandIn) createTable(in *dynamodb.CreateTableInput) (interface{}, *standInError) {
+	name := aws.StringValue(in.TableName)
+	if _, ok := s.tables[name]; ok {
+		return nil, &standInError{"ResourceInUseException", fmt.Sprintf("Table %q already exists", name)}
+	}
+
+	t := &standInTable{
+		indexes: make(map[string]string, 0),
+		items:   make(map[string]map[string]map[string]*dynamodb.AttributeValue, 0),
+	}
+	for _, k := range in.KeySchema {
+		if aws.StringValue(k.KeyType) == dynamodb.KeyTypeHash {
+			t.hashKey = aws.StringValue(k.AttributeName)
+		} else {
+			t.rangeKey = aws.StringValue(k.AttributeName)
+		}
+	}
+	lsis := make([]*dynamodb.LocalSecondaryIndexDescription, 0)
+	for _, idx := range in.LocalSecondaryIndexes {
+		for _, k := range idx.KeySchema {
+			if aws.StringValue(k.KeyType) == dynamodb.KeyTypeRange {
+				t.indexes[aws.StringValue(idx.IndexName)] = aws.StringValue(k.AttributeName)
+			}
+		}
+		lsis = append(lsis, &dynamodb.LocalSecondaryIndexDescription{
+			IndexName:  idx.IndexName,
+			KeySchema:  idx.KeySchema,
+			Projection: idx.Projection,
+		})
+	}
+	t.description = &dynamodb.TableDescription{
+		TableName:             in.TableName,
+		TableStatus:           aws.String(dynamodb.TableStatusActive),
+		KeySchema:             in.KeySchema,
+		AttributeDefinitions:  in.AttributeDefinitions,
+		LocalSecondaryIndexes: lsis,
+	}
+	s.tables[name] = t
+
+	return &dynamodb.CreateTableOutput{TableDescription: t.description}, nil
+}
+
+func (s *DynamoDBStandIn) deleteTable(in *dynamodb.DeleteTableInput) (interface{}, *standInError) {
+	t, sErr := s.table(in.TableName)
+	if sErr != nil {
+		return nil, sErr
+	}
+	delete(s.tables, aws.StringValue(in.TableName))
+	return &dynamodb.DeleteTableOutput{TableDescription: t.description}, nil
+}
+
+func (s *DynamoDBStandIn) describeTable(in *dynamodb.DescribeTableInput) (interface{}, *standInError) {
+	t, sErr := s.table(in.TableName)
+	if sErr != nil {
+		return nil, sErr
+	}
+	return &dynamodb.DescribeTableOutput{Table: t.description}, nil
+}
+
+func (s *DynamoDBStandIn) putItem(in *dynamodb.PutItemInput) (interface{}, *standInError) {
+	t, sErr := s.table(in.TableName)
+	if sErr != nil {
+		return nil, sErr
+	}
+	hk, rk := t.key(in.Item)
+	existing := t.items[hk][rk]
+	if in.ConditionExpression != nil {
+		ok, sErr := evaluate(aws.StringValue(in.ConditionExpression), existing, in.ExpressionAttributeValues)
+		if sErr != nil {
+			return nil, sErr
+		}
+		if !ok {
+			return nil, &standInError{dynamodb.ErrCodeConditionalCheckFailedException,
+				"The conditional request failed"}
+		}
+	}
+
+	if _, ok := t.items[hk]; !ok {
+		t.items[hk] = make(map[string]map[string]*dynamodb.AttributeValue, 0)
+	}
+	t.items[hk][rk] = in.Item
+
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (s *DynamoDBStandIn) getItem(in *dynamodb.GetItemInput) (interface{}, *standInError) {
+	t, sErr := s.table(in.TableName)
+	if sErr != nil {
+		return nil, sErr
+	}
+	hk, rk := t.key(in.Key)
+	return &dynamodb.GetItemOutput{Item: t.items[hk][rk]}, nil
+}
+
+func (s *DynamoDBStandIn) deleteItem(in *dynamodb.DeleteItemInput) (interface{}, *standInError) {
+	t, sErr := s.table(in.TableName)
+	if sErr != nil {
+		return nil, sErr
+	}
+	hk, rk := t.key(in.Key)
+	existing := t.items[hk][rk]
+	if in.ConditionExpression != nil {
+		ok, sErr := evaluate(aws.StringValue(in.ConditionExpression), existing, in.ExpressionAttributeValues)
+		if sErr != nil {
+			return nil, sErr
+		}
+		if !ok {
+			return nil, &standInError{dynamodb.ErrCodeConditionalCheckFailedException,
+				"The conditional request failed"}
+		}
+	}
+	delete(t.items[hk], rk)
+
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (s *DynamoDBStandIn) query(in *dynamodb.QueryInput) (interface{}, *standInError) {
+	t, sErr := s.table(in.TableName)
+	if sErr != nil {
+		return nil, sErr
+	}
+	sortKey := t.rangeKey
+	if in.IndexName != nil {
+		var ok bool
+		sortKey, ok = t.indexes[aws.StringValue(in.IndexName)]
+		if !ok {
+			return nil, &standInError{"ValidationException",
+				fmt.Sprintf("Index %q not found", aws.StringValue(in.IndexName))}
+		}
+	}
+
+	items := make([]map[string]*dynamodb.AttributeValue, 0)
+	for _, partition := range t.items {
+		for _, item := range partition {
+			if _, ok := item[sortKey]; !ok {
+				// Sparse index
+				continue
+			}
+			ok, sErr := evaluate(aws.StringValue(in.KeyConditionExpression), item, in.ExpressionAttributeValues)
+			if sErr != nil {
+				return nil, sErr
+			}
+			if ok {
+				items = append(items, item)
+			}
+		}
+	}
+
+	forward := in.ScanIndexForward == nil || *in.ScanIndexForward
+	sort.Slice(items, func(i, j int) bool {
+		less := compare(items[i][sortKey], items[j][sortKey]) < 0
+		if !forward {
+			return !less
+		}
+		return less
+	})
+	if in.Limit != nil && int64(len(items)) > *in.Limit {
+		items = items[:*in.Limit]
+	}
+
+	return &dynamodb.QueryOutput{
+		Items: items,
+		Count: aws.Int64(int64(len(items))),
+	}, nil
+}
+
+func (s *DynamoDBStandIn) scan(in *dynamodb.ScanInput) (interface{}, *standInError) {
+	t, sErr := s.table(in.TableName)
+	if sErr != nil {
+		return nil, sErr
+	}
+
+	items := make([]map[string]*dynamodb.AttributeValue, 0)
+	for _, partition := range t.items {
+		for _, item := range partition {
+			if in.FilterExpression != nil {
+				ok, sErr := evaluate(aws.StringValue(in.FilterExpression), item, in.ExpressionAttributeValues)
+				if sErr != nil {
+					return nil, sErr
+				}
+				if !ok {
+					continue
+				}
+			}
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		hi, ri := t.key(items[i])
+		hj, rj := t.key(items[j])
+		if hi != hj {
+			return hi < hj
+		}
+		return ri < rj
+	})
+
+	return &dynamodb.ScanOutput{
+		Items: items,
+		Count: aws.Int64(int64(len(items))),
+	}, nil
+}
+
+func (s *DynamoDBStandIn) table(name *string) (*standInTable, *standInError) {
+	t, ok := s.tables[aws.StringValue(name)]
+	if !ok {
+		return nil, &standInError{dynamodb.ErrCodeResourceNotFoundException,
+			fmt.Sprintf("Requested resource not found: Table: %s not found", aws.StringValue(name))}
+	}
+	return t, nil
+}
+
+func (t *standInTable) key(item map[string]*dynamodb.AttributeValue) (string, string) {
+	return attributeString(item[t.hashKey]), attributeString(item[t.rangeKey])
+}
+
+var (
+	attrNotExistsRe = regexp.MustCompile(`^attribute_not_exists\((\w+)\)$`)
+	attrExistsRe    = regexp.MustCompile(`^attribute_exists\((\w+)\)$`)
+	beginsWithRe    = regexp.MustCompile(`^begins_with\((\w+),\s*(:\w+)\)$`)
+	comparisonRe    = regexp.MustCompile(`^(\w+)\s*(=|<>|<|>|<=|>=)\s*(:\w+)$`)
+)
+
+// evaluate supports conditions joined either by OR or by AND (no parentheses)
+// with attribute_exists, attribute_not_exists, begins_with and comparisons
+func evaluate(expr string, item map[string]*dynamodb.AttributeValue,
+	values map[string]*dynamodb.AttributeValue) (bool, *standInError) {
+	for _, orPart := range strings.Split(expr, " OR ") {
+		matches := true
+		for _, term := range strings.Split(orPart, " AND ") {
+			ok, sErr := evaluateTerm(strings.TrimSpace(term), item, values)
+			if sErr != nil {
+				return false, sErr
+			}
+			if !ok {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func evaluateTerm(term string, item map[string]*dynamodb.AttributeValue,
+	values map[string]*dynamodb.AttributeValue) (bool, *standInError) {
+	if m := attrNotExistsRe.FindStringSubmatch(term); m != nil {
+		_, ok := item[m[1]]
+		return !ok, nil
+	}
+	if m := attrExistsRe.FindStringSubmatch(term); m != nil {
+		_, ok := item[m[1]]
+		return ok, nil
+	}
+	if m := beginsWithRe.FindStringSubmatch(term); m != nil {
+		attr, ok := item[m[1]]
+		if !ok {
+			return false, nil
+		}
+		v, sErr := expressionValue(m[2], values)
+		if sErr != nil {
+			return false, sErr
+		}
+		return strings.HasPrefix(attributeString(attr), attributeString(v)), nil
+	}
+	if m := comparisonRe.FindStringSubmatch(term); m != nil {
+		attr, ok := item[m[1]]
+		if !ok {
+			return false, nil
+		}
+		v, sErr := expressionValue(m[3], values)
+		if sErr != nil {
+			return false, sErr
+		}
+		c := compare(attr, v)
+		switch m[2] {
+		case "=":
+			return c == 0, nil
+		case "<>":
+			return c != 0, nil
+		case "<":
+			return c < 0, nil
+		case ">":
+			return c > 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">=":
+			return c >= 0, nil
+		}
+	}
+
+	return false, &standInError{"ValidationException",
+		fmt.Sprintf("Unsupported expression: %q", term)}
+}
+
+func expressionValue(name string, values map[string]*dynamodb.AttributeValue) (*dynamodb.AttributeValue, *standInError) {
+	v, ok := values[name]
+	if !ok {
+		return nil, &standInError{"ValidationException",
+			fmt.Sprintf("Value %s not defined in ExpressionAttributeValues", name)}
+	}
+	return v, nil
+}
+
+func compare(a, b *dynamodb.AttributeValue) int {
+	if a != nil && b != nil && a.N != nil && b.N != nil {
+		an, _ := strconv.ParseFloat(*a.N, 64)
+		bn, _ := strconv.ParseFloat(*b.N, 64)
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(attributeString(a), attributeString(b))
+}
+
+func attributeString(v *dynamodb.AttributeValue) string {
+	if v == nil {
+		return ""
+	}
+	if v.S != nil {
+		return *v.S
+	}
+	if v.N != nil {
+		return *v.N
+	}
+	return ""
+}
+
+// CreateDynamoDBTable creates a table for the DynamoDB backend with a given config
+// (either in the stand-in or in DynamoDB Local)
+func CreateDynamoDBTable(config map[string]interface{}) error {
+	conn := dynamoDBConn(config)
+	_, err := conn.CreateTable(&dynamodb.CreateTableInput{
+		TableName: aws.String(config["table"].(string)),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String("pk"), AttributeType: aws.String("S")},
+			{AttributeName: aws.String("sk"), AttributeType: aws.String("S")},
+			{AttributeName: aws.String("start_sk"), AttributeType: aws.String("S")},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String("pk"), KeyType: aws.String(dynamodb.KeyTypeHash)},
+			{AttributeName: aws.String("sk"), KeyType: aws.String(dynamodb.KeyTypeRange)},
+		},
+		LocalSecondaryIndexes: []*dynamodb.LocalSecondaryIndex{
+			{
+				IndexName: aws.String("start_time"),
+				KeySchema: []*dynamodb.KeySchemaElement{
+					{AttributeName: aws.String("pk"), KeyType: aws.String(dynamodb.KeyTypeHash)},
+					{AttributeName: aws.String("start_sk"), KeyType: aws.String(dynamodb.KeyTypeRange)},
+				},
+				Projection: &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeAll)},
+			},
+		},
+		BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+	})
+	return err
+}
+
+func DeleteDynamoDBTable(config map[string]interface{}) error {
+	conn := dynamoDBConn(config)
+	_, err := conn.DeleteTable(&dynamodb.DeleteTableInput{
+		TableName: aws.String(config["table"].(string)),
+	})
+	return err
+}
+
+func dynamoDBConn(config map[string]interface{}) *dynamodb.DynamoDB {
+	return dynamodb.New(session.New(&aws.Config{
+		Region:   aws.String(config["region"].(string)),
+		Endpoint: aws.String(config["endpoint"].(string)),
+		Credentials: credentials.NewStaticCredentials(
+			config["access_key"].(string), config["secret_key"].(string), ""),
+	}))
+}
@@ -19,6 +19,22 @@ func (fb *FixtureBackend) SupportsWriteLock() bool {
 	return false
 }
 
+func (fb *FixtureBackend) AcquireLock(meta interface{}, appName string, lock *schema.LockData) error {
+	return errors.New("Locking is not supported")
+}
+
+func (fb *FixtureBackend) GetLock(meta interface{}, appName string) (*schema.LockData, error) {
+	return nil, errors.New("Locking is not supported")
+}
+
+func (fb *FixtureBackend) ReleaseLock(meta interface{}, appName, lockId string) error {
+	return errors.New("Locking is not supported")
+}
+
+func (fb *FixtureBackend) RefreshLock(meta interface{}, appName string, lock *schema.LockData) error {
+	return errors.New("Locking is not supported")
+}
+
 func (fb *FixtureBackend) IsReady(meta interface{}) (bool, error) {
 	return false, nil
 }
@@ -62,3 +78,23 @@ func (fb *FixtureBackend) SaveDeployment(meta interface{}, appName, slotId, depl
 func (fb *FixtureBackend) GetDeployment(meta interface{}, appName, slotId, deploymentId string) (*schema.DeploymentData, error) {
 	return nil, nil
 }
+
+func (fb *FixtureBackend) SaveDeploymentChanges(meta interface{}, appName, slotId, deploymentId string, data *schema.DeploymentChangesData) error {
+	return nil
+}
+
+func (fb *FixtureBackend) GetDeploymentChanges(meta interface{}, appName, slotId, deploymentId string) (*schema.DeploymentChangesData, error) {
+	return nil, nil
+}
+
+func (fb *FixtureBackend) SavePlan(meta interface{}, appName, planId string, data *schema.PlanData) error {
+	return nil
+}
+
+func (fb *FixtureBackend) GetPlan(meta interface{}, appName, planId string) (*schema.PlanData, error) {
+	return nil, nil
+}
+
+func (fb *FixtureBackend) DeletePlan(meta interface{}, appName, planId string) error {
+	return nil
+}
@@ -0,0 +1,12 @@
+package backends_test
+
+import (
+	"testing"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/backends"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/backends/backendstest"
+)
+
+func TestS3_conformance(t *testing.T) {
+	backendstest.TestBackendConformance(t, backends.SetUpAccS3)
+}
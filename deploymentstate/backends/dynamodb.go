@@ -0,0 +1,702 @@
+package backends
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	rtAWS "github.com/MeredithCorpOSS/ape-dev-rt/aws"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// All records live in a single table, partitioned by app:
+//
+//	pk                  sk                             start_sk
+//	<prefix>/<app>      APPLICATION
+//	<prefix>/<app>      LOCK
+//	<prefix>/<app>      SLOT#<slot-id>
+//	<prefix>/<app>      DEPLOYMENT#<slot-id>#<id>      DEPLOYMENT#<slot-id>#<start-time>#<id>
+//	<prefix>/<app>      CHANGES#<slot-id>#<id>
+//	<prefix>/<app>      PLAN#<plan-id>
+//
+// start_sk is the sort key of a local secondary index, so deployments
+// can be queried newest first regardless of the format of deployment IDs.
+const (
+	dynamodb_pk      = "%s/%s"
+	dynamodb_appSk   = "APPLICATION"
+	dynamodb_lockSk  = "LOCK"
+	dynamodb_slotSk  = "SLOT#%s"
+	dynamodb_slotsSk = "SLOT#"
+
+	dynamodb_deploymentSk          = "DEPLOYMENT#%s#%s"
+	dynamodb_deploymentStartSk     = "DEPLOYMENT#%s#%s#%s"
+	dynamodb_deploymentsPerSlotSk  = "DEPLOYMENT#%s#"
+	dynamodb_deploymentStartFormat = "2006-01-02T15:04:05.000000000Z"
+
+	dynamodb_changesSk        = "CHANGES#%s#%s"
+	dynamodb_changesPerSlotSk = "CHANGES#%s#"
+
+	dynamodb_planSk = "PLAN#%s"
+
+	DynamoDBStartTimeIndex = "start_time"
+
+	dynamodb_attrPk           = "pk"
+	dynamodb_attrSk           = "sk"
+	dynamodb_attrStartSk      = "start_sk"
+	dynamodb_attrData         = "data"
+	dynamodb_attrSlotId       = "slot_id"
+	dynamodb_attrDeploymentId = "deployment_id"
+	dynamodb_attrLockId       = "lock_id"
+	dynamodb_attrExpiresAt    = "expires_at"
+)
+
+type DynamoDB struct{}
+
+type DynamoDBConfig struct {
+	conn *dynamodb.DynamoDB
+
+	Table    string
+	Prefix   string
+	Region   string
+	Endpoint string
+}
+
+func (d *DynamoDB) Configure(config map[string]interface{}) (interface{}, error) {
+	cfg := DynamoDBConfig{}
+
+	if v, ok := config["table"]; ok {
+		cfg.Table = v.(string)
+	} else {
+		return nil, fmt.Errorf("Unable to find `table` in config")
+	}
+
+	if v, ok := config["prefix"]; ok {
+		cfg.Prefix = strings.TrimSuffix(v.(string), "/")
+	} else {
+		return nil, fmt.Errorf("Unable to find `prefix` in config")
+	}
+
+	if v, ok := config["region"]; ok {
+		cfg.Region = v.(string)
+	} else {
+		return nil, fmt.Errorf("Unable to find `region` in config")
+	}
+
+	awsCfg := &aws.Config{
+		Region: aws.String(cfg.Region),
+	}
+
+	// Custom endpoint allows using DynamoDB Local
+	if v, ok := config["endpoint"]; ok {
+		cfg.Endpoint = v.(string)
+		awsCfg.Endpoint = aws.String(cfg.Endpoint)
+	}
+
+	accessKey, hasAccessKey := config["access_key"]
+	secretKey, hasSecretKey := config["secret_key"]
+	if hasAccessKey && hasSecretKey {
+		awsCfg.Credentials = credentials.NewStaticCredentials(
+			accessKey.(string), secretKey.(string), "")
+	} else {
+		profile, ok := config["profile"]
+		if !ok {
+			profile = ""
+		}
+		awsCfg.Credentials = rtAWS.CredentialsProvider(profile.(string))
+	}
+
+	cfg.conn = dynamodb.New(session.New(awsCfg))
+
+	return &cfg, nil
+}
+
+// Locks are taken via conditional writes, so two concurrent
+// writers can never both succeed
+func (d *DynamoDB) SupportsWriteLock() bool {
+	return true
+}
+
+func (d *DynamoDB) AcquireLock(meta interface{}, appName string, lock *schema.LockData) error {
+	cfg := meta.(*DynamoDBConfig)
+
+	lockDataInBytes, err := lock.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	item := d.buildKey(cfg.Prefix, appName, dynamodb_lockSk)
+	item[dynamodb_attrData] = &dynamodb.AttributeValue{S: aws.String(string(lockDataInBytes))}
+	item[dynamodb_attrLockId] = &dynamodb.AttributeValue{S: aws.String(lock.LockId)}
+	item[dynamodb_attrExpiresAt] = d.timeToAttributeValue(lock.ExpiresAt)
+
+	input := dynamodb.PutItemInput{
+		TableName: aws.String(cfg.Table),
+		Item:      item,
+		ConditionExpression: aws.String("attribute_not_exists(pk) OR " +
+			"lock_id = :lock_id OR expires_at < :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":lock_id": {S: aws.String(lock.LockId)},
+			":now":     d.timeToAttributeValue(now),
+		},
+	}
+	log.Printf("[DEBUG] Acquiring lock in DynamoDB: %s", input)
+	_, err = cfg.conn.PutItem(&input)
+	if err != nil {
+		if isConditionalCheckFailed(err) {
+			existingLock, gErr := d.GetLock(meta, appName)
+			if gErr != nil {
+				return fmt.Errorf("Failed to get lock of %q after conflict: %s", appName, gErr)
+			}
+			return &LockHeld{AppName: appName, Lock: existingLock}
+		}
+		return fmt.Errorf("Failed to acquire lock of %q in DynamoDB: %s", appName, err)
+	}
+
+	log.Printf("[DEBUG] Acquired lock %q of %q", lock.LockId, appName)
+	return nil
+}
+
+func (d *DynamoDB) GetLock(meta interface{}, appName string) (*schema.LockData, error) {
+	data, err := d.getData(meta, appName, dynamodb_lockSk)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get lock of %q from DynamoDB: %s", appName, err)
+	}
+	if data == nil {
+		return nil, &LockNotFound{AppName: appName}
+	}
+
+	lock := &schema.LockData{}
+	err = lock.FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	lock.AppName = appName
+
+	return lock, nil
+}
+
+func (d *DynamoDB) ReleaseLock(meta interface{}, appName, lockId string) error {
+	cfg := meta.(*DynamoDBConfig)
+
+	input := dynamodb.DeleteItemInput{
+		TableName:           aws.String(cfg.Table),
+		Key:                 d.buildKey(cfg.Prefix, appName, dynamodb_lockSk),
+		ConditionExpression: aws.String("attribute_not_exists(pk) OR lock_id = :lock_id"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":lock_id": {S: aws.String(lockId)},
+		},
+	}
+	log.Printf("[DEBUG] Releasing lock in DynamoDB: %s", input)
+	_, err := cfg.conn.DeleteItem(&input)
+	if err != nil {
+		if isConditionalCheckFailed(err) {
+			lock, gErr := d.GetLock(meta, appName)
+			if gErr != nil {
+				if _, ok := gErr.(*LockNotFound); ok {
+					return nil
+				}
+				return gErr
+			}
+			return &LockHeld{AppName: appName, Lock: lock}
+		}
+		return err
+	}
+
+	log.Printf("[DEBUG] Released lock %q of %q", lockId, appName)
+	return nil
+}
+
+func (d *DynamoDB) RefreshLock(meta interface{}, appName string, lock *schema.LockData) error {
+	cfg := meta.(*DynamoDBConfig)
+
+	lockDataInBytes, err := lock.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	item := d.buildKey(cfg.Prefix, appName, dynamodb_lockSk)
+	item[dynamodb_attrData] = &dynamodb.AttributeValue{S: aws.String(string(lockDataInBytes))}
+	item[dynamodb_attrLockId] = &dynamodb.AttributeValue{S: aws.String(lock.LockId)}
+	item[dynamodb_attrExpiresAt] = d.timeToAttributeValue(lock.ExpiresAt)
+
+	input := dynamodb.PutItemInput{
+		TableName:           aws.String(cfg.Table),
+		Item:                item,
+		ConditionExpression: aws.String("lock_id = :lock_id"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":lock_id": {S: aws.String(lock.LockId)},
+		},
+	}
+	log.Printf("[DEBUG] Refreshing lock in DynamoDB: %s", input)
+	_, err = cfg.conn.PutItem(&input)
+	if err != nil {
+		if isConditionalCheckFailed(err) {
+			existingLock, gErr := d.GetLock(meta, appName)
+			if gErr != nil {
+				return gErr
+			}
+			return &LockHeld{AppName: appName, Lock: existingLock}
+		}
+		return fmt.Errorf("Failed to refresh lock of %q in DynamoDB: %s", appName, err)
+	}
+
+	log.Printf("[DEBUG] Refreshed lock %q of %q (expires %s)", lock.LockId, appName, lock.ExpiresAt)
+	return nil
+}
+
+func (d *DynamoDB) IsReady(meta interface{}) (bool, error) {
+	cfg := meta.(*DynamoDBConfig)
+
+	out, err := cfg.conn.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(cfg.Table),
+	})
+	if err != nil {
+		return false, fmt.Errorf("Failed describing DynamoDB table %q: %s", cfg.Table, err)
+	}
+
+	status := aws.StringValue(out.Table.TableStatus)
+	if status != dynamodb.TableStatusActive && status != dynamodb.TableStatusUpdating {
+		return false, fmt.Errorf("DynamoDB table %q is not active (%s)", cfg.Table, status)
+	}
+
+	hasIndex := false
+	for _, idx := range out.Table.LocalSecondaryIndexes {
+		if aws.StringValue(idx.IndexName) == DynamoDBStartTimeIndex {
+			hasIndex = true
+		}
+	}
+	if !hasIndex {
+		return false, fmt.Errorf("DynamoDB table %q is missing local secondary index %q",
+			cfg.Table, DynamoDBStartTimeIndex)
+	}
+
+	return true, nil
+}
+
+func (d *DynamoDB) GetApplication(meta interface{}, appName string) (*schema.ApplicationData, error) {
+	data, err := d.getData(meta, appName, dynamodb_appSk)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get application %q from DynamoDB: %s", appName, err)
+	}
+	if data == nil {
+		return nil, &AppNotFound{AppName: appName}
+	}
+
+	app := &schema.ApplicationData{}
+	err = app.FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	app.Name = appName
+
+	return app, nil
+}
+
+func (d *DynamoDB) SaveApplication(meta interface{}, name string, app *schema.ApplicationData) error {
+	cfg := meta.(*DynamoDBConfig)
+
+	appDataInBytes, err := app.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	item := d.buildKey(cfg.Prefix, name, dynamodb_appSk)
+	item[dynamodb_attrData] = &dynamodb.AttributeValue{S: aws.String(string(appDataInBytes))}
+
+	log.Printf("[DEBUG] Saving app data of %q into DynamoDB", name)
+	return d.putItem(cfg, item)
+}
+
+func (d *DynamoDB) ListApplications(meta interface{}) ([]*schema.ApplicationData, error) {
+	cfg := meta.(*DynamoDBConfig)
+	pkPrefix := fmt.Sprintf(dynamodb_pk, cfg.Prefix, "")
+
+	// Applications are spread across partitions, so the only way
+	// to list them is a scan. There shouldn't be too many.
+	input := dynamodb.ScanInput{
+		TableName:        aws.String(cfg.Table),
+		FilterExpression: aws.String("sk = :sk AND begins_with(pk, :prefix)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":sk":     {S: aws.String(dynamodb_appSk)},
+			":prefix": {S: aws.String(pkPrefix)},
+		},
+	}
+
+	var apps = make([]*schema.ApplicationData, 0)
+	var itemErr error
+	log.Printf("[DEBUG] Listing apps in DynamoDB: %s", input)
+	err := cfg.conn.ScanPages(&input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			app := &schema.ApplicationData{}
+			itemErr = app.FromJSON([]byte(aws.StringValue(item[dynamodb_attrData].S)))
+			if itemErr != nil {
+				return false
+			}
+			app.Name = strings.TrimPrefix(aws.StringValue(item[dynamodb_attrPk].S), pkPrefix)
+			apps = append(apps, app)
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return nil, err
+	}
+	if itemErr != nil {
+		return nil, itemErr
+	}
+
+	return apps, nil
+}
+
+func (d *DynamoDB) ListSlots(meta interface{}, appName string) ([]*schema.SlotData, error) {
+	cfg := meta.(*DynamoDBConfig)
+
+	input := dynamodb.QueryInput{
+		TableName:              aws.String(cfg.Table),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :prefix)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pk":     {S: aws.String(fmt.Sprintf(dynamodb_pk, cfg.Prefix, appName))},
+			":prefix": {S: aws.String(dynamodb_slotsSk)},
+		},
+	}
+
+	var slots = make([]*schema.SlotData, 0)
+	var itemErr error
+	log.Printf("[DEBUG] Listing slots in DynamoDB: %s", input)
+	err := cfg.conn.QueryPages(&input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			slot := &schema.SlotData{}
+			itemErr = slot.FromJSON([]byte(aws.StringValue(item[dynamodb_attrData].S)))
+			if itemErr != nil {
+				return false
+			}
+			slot.SlotId = aws.StringValue(item[dynamodb_attrSlotId].S)
+			slots = append(slots, slot)
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return nil, err
+	}
+	if itemErr != nil {
+		return nil, itemErr
+	}
+
+	return slots, nil
+}
+
+func (d *DynamoDB) SaveSlot(meta interface{}, appName, slotId string, slot *schema.SlotData) error {
+	cfg := meta.(*DynamoDBConfig)
+
+	slotDataInBytes, err := slot.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	item := d.buildKey(cfg.Prefix, appName, fmt.Sprintf(dynamodb_slotSk, slotId))
+	item[dynamodb_attrData] = &dynamodb.AttributeValue{S: aws.String(string(slotDataInBytes))}
+	item[dynamodb_attrSlotId] = &dynamodb.AttributeValue{S: aws.String(slotId)}
+
+	log.Printf("[DEBUG] Saving slot data of %q/%q into DynamoDB", appName, slotId)
+	return d.putItem(cfg, item)
+}
+
+func (d *DynamoDB) DeleteSlot(meta interface{}, appName, slotId string) error {
+	cfg := meta.(*DynamoDBConfig)
+
+	prefixes := []string{
+		fmt.Sprintf(dynamodb_deploymentsPerSlotSk, slotId),
+		fmt.Sprintf(dynamodb_changesPerSlotSk, slotId),
+	}
+	keys := make([]map[string]*dynamodb.AttributeValue, 0)
+	for _, prefix := range prefixes {
+		queryInput := dynamodb.QueryInput{
+			TableName:              aws.String(cfg.Table),
+			KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :prefix)"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":pk":     {S: aws.String(fmt.Sprintf(dynamodb_pk, cfg.Prefix, appName))},
+				":prefix": {S: aws.String(prefix)},
+			},
+			ProjectionExpression: aws.String("pk, sk"),
+		}
+		err := cfg.conn.QueryPages(&queryInput, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+			keys = append(keys, page.Items...)
+			return !lastPage
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to list deployments of slot %q: %s", slotId, err)
+		}
+	}
+	for _, key := range keys {
+		_, err := cfg.conn.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName: aws.String(cfg.Table),
+			Key:       key,
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to delete deployment of slot %q: %s", slotId, err)
+		}
+	}
+	log.Printf("[DEBUG] Deleted %d deployments of %q/%q from DynamoDB", len(keys), appName, slotId)
+
+	input := dynamodb.DeleteItemInput{
+		TableName: aws.String(cfg.Table),
+		Key:       d.buildKey(cfg.Prefix, appName, fmt.Sprintf(dynamodb_slotSk, slotId)),
+	}
+	log.Printf("[DEBUG] Deleting slot from DynamoDB: %s", input)
+	_, err := cfg.conn.DeleteItem(&input)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Deleted slot %q/%q from DynamoDB", appName, slotId)
+	return nil
+}
+
+func (d *DynamoDB) GetSlot(meta interface{}, appName, slotId string) (*schema.SlotData, error) {
+	data, err := d.getData(meta, appName, fmt.Sprintf(dynamodb_slotSk, slotId))
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, &SlotNotFound{SlotName: slotId}
+	}
+
+	slot := &schema.SlotData{}
+	err = slot.FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	slot.SlotId = slotId
+
+	return slot, nil
+}
+
+func (d *DynamoDB) ListSortedDeploymentsForSlotId(meta interface{}, appName, slotId string, limitPerSlot int) ([]*schema.DeploymentData, error) {
+	cfg := meta.(*DynamoDBConfig)
+
+	input := dynamodb.QueryInput{
+		TableName:              aws.String(cfg.Table),
+		IndexName:              aws.String(DynamoDBStartTimeIndex),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(start_sk, :prefix)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pk":     {S: aws.String(fmt.Sprintf(dynamodb_pk, cfg.Prefix, appName))},
+			":prefix": {S: aws.String(fmt.Sprintf(dynamodb_deploymentsPerSlotSk, slotId))},
+		},
+		// Newest first
+		ScanIndexForward: aws.Bool(false),
+	}
+	if limitPerSlot > 0 {
+		input.Limit = aws.Int64(int64(limitPerSlot))
+	}
+
+	var deployments = make([]*schema.DeploymentData, 0)
+	var itemErr error
+	log.Printf("[DEBUG] Listing deployments in DynamoDB: %s", input)
+	err := cfg.conn.QueryPages(&input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			deployment := &schema.DeploymentData{}
+			itemErr = deployment.FromJSON([]byte(aws.StringValue(item[dynamodb_attrData].S)))
+			if itemErr != nil {
+				return false
+			}
+			deployment.DeploymentId = aws.StringValue(item[dynamodb_attrDeploymentId].S)
+			deployments = append(deployments, deployment)
+
+			if len(deployments) == limitPerSlot {
+				return false
+			}
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return nil, err
+	}
+	if itemErr != nil {
+		return nil, itemErr
+	}
+
+	return deployments, nil
+}
+
+func (d *DynamoDB) SaveDeployment(meta interface{}, appName, slotId, deploymentId string, data *schema.DeploymentData) error {
+	cfg := meta.(*DynamoDBConfig)
+
+	deploymentDataInBytes, err := data.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	startSk := fmt.Sprintf(dynamodb_deploymentStartSk, slotId,
+		data.StartTime.UTC().Format(dynamodb_deploymentStartFormat), deploymentId)
+
+	item := d.buildKey(cfg.Prefix, appName, fmt.Sprintf(dynamodb_deploymentSk, slotId, deploymentId))
+	item[dynamodb_attrData] = &dynamodb.AttributeValue{S: aws.String(string(deploymentDataInBytes))}
+	item[dynamodb_attrSlotId] = &dynamodb.AttributeValue{S: aws.String(slotId)}
+	item[dynamodb_attrDeploymentId] = &dynamodb.AttributeValue{S: aws.String(deploymentId)}
+	item[dynamodb_attrStartSk] = &dynamodb.AttributeValue{S: aws.String(startSk)}
+
+	log.Printf("[DEBUG] Saving deployment data of %q/%q/%q into DynamoDB", appName, slotId, deploymentId)
+	return d.putItem(cfg, item)
+}
+
+func (d *DynamoDB) GetDeployment(meta interface{}, appName, slotId, deploymentId string) (*schema.DeploymentData, error) {
+	data, err := d.getData(meta, appName, fmt.Sprintf(dynamodb_deploymentSk, slotId, deploymentId))
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, &DeploymentNotFound{SlotName: slotId, DeploymentId: deploymentId}
+	}
+
+	deployment := &schema.DeploymentData{}
+	err = deployment.FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	deployment.DeploymentId = deploymentId
+
+	return deployment, nil
+}
+
+func (d *DynamoDB) SaveDeploymentChanges(meta interface{}, appName, slotId, deploymentId string,
+	data *schema.DeploymentChangesData) error {
+	cfg := meta.(*DynamoDBConfig)
+
+	changesInBytes, err := data.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	item := d.buildKey(cfg.Prefix, appName, fmt.Sprintf(dynamodb_changesSk, slotId, deploymentId))
+	item[dynamodb_attrData] = &dynamodb.AttributeValue{S: aws.String(string(changesInBytes))}
+	item[dynamodb_attrSlotId] = &dynamodb.AttributeValue{S: aws.String(slotId)}
+	item[dynamodb_attrDeploymentId] = &dynamodb.AttributeValue{S: aws.String(deploymentId)}
+
+	log.Printf("[DEBUG] Saving deployment changes of %q/%q/%q into DynamoDB", appName, slotId, deploymentId)
+	return d.putItem(cfg, item)
+}
+
+func (d *DynamoDB) GetDeploymentChanges(meta interface{}, appName, slotId, deploymentId string) (*schema.DeploymentChangesData, error) {
+	data, err := d.getData(meta, appName, fmt.Sprintf(dynamodb_changesSk, slotId, deploymentId))
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, &DeploymentChangesNotFound{DeploymentId: deploymentId}
+	}
+
+	changes := &schema.DeploymentChangesData{}
+	err = changes.FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	changes.DeploymentId = deploymentId
+
+	return changes, nil
+}
+
+// SavePlan saves the plan as a single item, so planfiles
+// are limited by the maximum item size of DynamoDB (400 KB)
+func (d *DynamoDB) SavePlan(meta interface{}, appName, planId string, data *schema.PlanData) error {
+	cfg := meta.(*DynamoDBConfig)
+
+	planInBytes, err := data.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	item := d.buildKey(cfg.Prefix, appName, fmt.Sprintf(dynamodb_planSk, planId))
+	item[dynamodb_attrData] = &dynamodb.AttributeValue{S: aws.String(string(planInBytes))}
+
+	log.Printf("[DEBUG] Saving plan %q of %q into DynamoDB", planId, appName)
+	return d.putItem(cfg, item)
+}
+
+func (d *DynamoDB) GetPlan(meta interface{}, appName, planId string) (*schema.PlanData, error) {
+	data, err := d.getData(meta, appName, fmt.Sprintf(dynamodb_planSk, planId))
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, &PlanNotFound{PlanId: planId}
+	}
+
+	plan := &schema.PlanData{}
+	err = plan.FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	plan.PlanId = planId
+
+	return plan, nil
+}
+
+func (d *DynamoDB) DeletePlan(meta interface{}, appName, planId string) error {
+	cfg := meta.(*DynamoDBConfig)
+
+	input := dynamodb.DeleteItemInput{
+		TableName: aws.String(cfg.Table),
+		Key:       d.buildKey(cfg.Prefix, appName, fmt.Sprintf(dynamodb_planSk, planId)),
+	}
+	log.Printf("[DEBUG] Deleting plan from DynamoDB: %s", input)
+	_, err := cfg.conn.DeleteItem(&input)
+	return err
+}
+
+// getData returns the JSON data of a given item or nil if the item doesn't exist
+func (d *DynamoDB) getData(meta interface{}, appName, sk string) ([]byte, error) {
+	cfg := meta.(*DynamoDBConfig)
+
+	input := dynamodb.GetItemInput{
+		TableName:      aws.String(cfg.Table),
+		Key:            d.buildKey(cfg.Prefix, appName, sk),
+		ConsistentRead: aws.Bool(true),
+	}
+	log.Printf("[DEBUG] Getting item from DynamoDB: %s", input)
+	out, err := cfg.conn.GetItem(&input)
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+	v, ok := out.Item[dynamodb_attrData]
+	if !ok || v.S == nil {
+		return nil, fmt.Errorf("Item %q/%q has no data", appName, sk)
+	}
+
+	return []byte(*v.S), nil
+}
+
+func (d *DynamoDB) putItem(cfg *DynamoDBConfig, item map[string]*dynamodb.AttributeValue) error {
+	input := dynamodb.PutItemInput{
+		TableName: aws.String(cfg.Table),
+		Item:      item,
+	}
+	_, err := cfg.conn.PutItem(&input)
+	return err
+}
+
+func (d *DynamoDB) buildKey(prefix, appName, sk string) map[string]*dynamodb.AttributeValue {
+	appName = strings.Trim(appName, "/")
+	return map[string]*dynamodb.AttributeValue{
+		dynamodb_attrPk: {S: aws.String(fmt.Sprintf(dynamodb_pk, prefix, appName))},
+		dynamodb_attrSk: {S: aws.String(sk)},
+	}
+}
+
+func (d *DynamoDB) timeToAttributeValue(t time.Time) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(t.Unix(), 10))}
+}
+
+func isConditionalCheckFailed(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
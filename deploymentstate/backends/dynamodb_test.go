@@ -0,0 +1,109 @@
+package backends_test
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/backends"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/backends/backendstest"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+)
+
+func TestDynamoDB_conformance(t *testing.T) {
+	backendstest.TestBackendConformance(t, func(t *testing.T) (backends.Backend, interface{}, func()) {
+		d, meta, tearDown := testDynamoDBSetup(t)
+		return d, meta, tearDown
+	})
+}
+
+func TestDynamoDB_isReady_missingTable(t *testing.T) {
+	d, meta, tearDown := testDynamoDBSetup(t)
+	defer tearDown()
+
+	missingTable := *meta.(*backends.DynamoDBConfig)
+	missingTable.Table = "non-existent-table"
+	_, err := d.IsReady(&missingTable)
+	if err == nil {
+		t.Fatal("Expected error for non-existent table")
+	}
+}
+
+func TestDynamoDB_deploymentsSortedByStartTime(t *testing.T) {
+	d, meta, tearDown := testDynamoDBSetup(t)
+	defer tearDown()
+
+	// IDs deliberately don't sort in the same order as start times
+	timestamp := time.Date(2016, time.March, 30, 14, 4, 5, 0, time.UTC)
+	deployments := map[string]time.Duration{
+		"c": 0,
+		"a": 1 * time.Minute,
+		"b": 2 * time.Minute,
+	}
+	for id, offset := range deployments {
+		err := d.SaveDeployment(meta, "BloodyHell", "NEW", id, &schema.DeploymentData{
+			RTVersion: id,
+			StartTime: timestamp.Add(offset),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := d.ListSortedDeploymentsForSlotId(meta, "BloodyHell", "NEW", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, d := range list {
+		ids = append(ids, d.DeploymentId)
+	}
+	expectedIds := []string{"b", "a"}
+	if !reflect.DeepEqual(ids, expectedIds) {
+		t.Fatalf("Deployments don't match.\nExpected: %q\nGiven: %q", expectedIds, ids)
+	}
+}
+
+// testDynamoDBSetup uses DynamoDB Local if RT_ACC_DYNAMODB_ENDPOINT is set
+// and the in-process stand-in otherwise
+func testDynamoDBSetup(t *testing.T) (*backends.DynamoDB, interface{}, func()) {
+	table := fmt.Sprintf("rt-test-%d", rand.New(rand.NewSource(time.Now().UnixNano())).Int())
+
+	var config map[string]interface{}
+	closeFunc := func() {}
+	if endpoint := os.Getenv("RT_ACC_DYNAMODB_ENDPOINT"); endpoint != "" {
+		config = map[string]interface{}{
+			"table":      table,
+			"prefix":     "123456789012",
+			"region":     "us-east-1",
+			"endpoint":   endpoint,
+			"access_key": "rt-test",
+			"secret_key": "rt-test",
+		}
+	} else {
+		standIn := backendstest.NewDynamoDBStandIn()
+		config = standIn.BackendConfig(table, "123456789012")
+		closeFunc = standIn.Close
+	}
+
+	err := backendstest.CreateDynamoDBTable(config)
+	if err != nil {
+		closeFunc()
+		t.Fatal(err)
+	}
+
+	d := &backends.DynamoDB{}
+	meta, err := d.Configure(config)
+	if err != nil {
+		closeFunc()
+		t.Fatal(err)
+	}
+
+	return d, meta, func() {
+		backendstest.DeleteDynamoDBTable(config)
+		closeFunc()
+	}
+}
@@ -0,0 +1,16 @@
+package backends
+
+import "testing"
+
+// SetUpAccS3 exposes S3 acceptance test setup to the conformance suite
+func SetUpAccS3(t *testing.T) (Backend, interface{}, func()) {
+	cfg, setUp, tearDown, err := testAccS3Setup()
+	if err != nil {
+		t.Skip(err)
+	}
+	err = setUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &S3{}, cfg, tearDown
+}
@@ -0,0 +1,669 @@
+package backends
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+	"github.com/mitchellh/go-homedir"
+)
+
+const (
+	local_appObjectKey = "APPLICATION.json"
+	local_lockKey      = "LOCK.json"
+
+	local_slotObjectPrefix = "SLOT-"
+	local_slotObjectSuffix = ".json"
+	local_slotKey          = "SLOT-%s%s"
+
+	local_deploymentPerSlotPrefix = "DEPLOYMENT-%s-"
+	local_deploymentKey           = "DEPLOYMENT-%s-%s%s"
+	local_deploymentKeySuffix     = ".json"
+
+	local_changesPerSlotPrefix = "CHANGES-%s-"
+	local_changesKey           = "CHANGES-%s-%s%s"
+
+	local_planKey = "PLAN-%s.json"
+
+	local_dirPerm  = 0755
+	local_filePerm = 0644
+)
+
+// Local stores deployment state in a directory tree on the local filesystem,
+// using the same layout as the S3 backend, i.e.
+//
+//	path/app/APPLICATION.json
+//	path/app/SLOT-<slot-id>.json
+//	path/app/DEPLOYMENT-<slot-id>-<deployment-id>.json
+//	path/app/CHANGES-<slot-id>-<deployment-id>.json
+//
+// This is mostly useful for sandbox environments, CI and tests.
+type Local struct{}
+
+type LocalConfig struct {
+	Path string
+}
+
+func (l *Local) Configure(config map[string]interface{}) (interface{}, error) {
+	cfg := LocalConfig{}
+
+	v, ok := config["path"]
+	if !ok {
+		return nil, fmt.Errorf("Unable to find `path` in config")
+	}
+	path, err := homedir.Expand(v.(string))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Path, err = filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+func (l *Local) SupportsWriteLock() bool {
+	return true
+}
+
+// Locks are created exclusively (O_EXCL) and expired locks are replaced
+// atomically by a single writer (see takeOverLock), so unlike S3
+// two concurrent writers can never both succeed.
+func (l *Local) AcquireLock(meta interface{}, appName string, lock *schema.LockData) error {
+	cfg := meta.(*LocalConfig)
+	path := l.buildLockPath(cfg.Path, appName)
+
+	existingLock, err := l.GetLock(meta, appName)
+	if err != nil {
+		if _, ok := err.(*LockNotFound); !ok {
+			return err
+		}
+	}
+	if existingLock != nil {
+		if existingLock.LockId == lock.LockId {
+			return nil
+		}
+		if !existingLock.IsExpired(time.Now().UTC()) {
+			return &LockHeld{AppName: appName, Lock: existingLock}
+		}
+		log.Printf("[WARN] Taking over expired lock of %q (expired %s)",
+			appName, existingLock.ExpiresAt)
+		return l.takeOverLock(meta, appName, existingLock, lock)
+	}
+
+	lockDataInBytes, err := lock.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), local_dirPerm)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, local_filePerm)
+	if err != nil {
+		if os.IsExist(err) {
+			// Somebody was faster
+			savedLock, gErr := l.GetLock(meta, appName)
+			if gErr != nil {
+				return fmt.Errorf("Failed verifying lock of %q: %s", appName, gErr)
+			}
+			return &LockHeld{AppName: appName, Lock: savedLock}
+		}
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(lockDataInBytes)
+	if err != nil {
+		return err
+	}
+	log.Printf("[DEBUG] Written lock to %q", path)
+
+	return nil
+}
+
+// takeOverLock replaces an expired lock. Only the writer which exclusively
+// creates a marker for the expired lock may replace it, after checking
+// the lock is still the expired one. The lock file is replaced via rename,
+// so it never disappears in between for writers creating it exclusively.
+func (l *Local) takeOverLock(meta interface{}, appName string, expiredLock, lock *schema.LockData) error {
+	cfg := meta.(*LocalConfig)
+	path := l.buildLockPath(cfg.Path, appName)
+
+	markerPath := filepath.Join(l.buildAppDir(cfg.Path, appName),
+		fmt.Sprintf(".takeover-%s", expiredLock.LockId))
+	marker, err := os.OpenFile(markerPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, local_filePerm)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("Expired lock of %q is being taken over by somebody else "+
+				"(remove %s if it's left over)", appName, markerPath)
+		}
+		return err
+	}
+	marker.Close()
+	defer os.Remove(markerPath)
+
+	currentLock, err := l.GetLock(meta, appName)
+	if err != nil {
+		if _, ok := err.(*LockNotFound); ok {
+			// Released in the meantime
+			return l.AcquireLock(meta, appName, lock)
+		}
+		return err
+	}
+	if currentLock.LockId != expiredLock.LockId {
+		// Somebody was faster
+		return &LockHeld{AppName: appName, Lock: currentLock}
+	}
+
+	lockDataInBytes, err := lock.ToJSON()
+	if err != nil {
+		return err
+	}
+	err = l.writeFile(path, lockDataInBytes)
+	if err != nil {
+		return err
+	}
+	log.Printf("[DEBUG] Replaced expired lock %q in %q", expiredLock.LockId, path)
+
+	return nil
+}
+
+func (l *Local) GetLock(meta interface{}, appName string) (*schema.LockData, error) {
+	cfg := meta.(*LocalConfig)
+	path := l.buildLockPath(cfg.Path, appName)
+
+	log.Printf("[DEBUG] Getting lock from %q", path)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &LockNotFound{AppName: appName, OriginalErr: err}
+		}
+		return nil, fmt.Errorf("Failed to get lock of %q: %s", appName, err)
+	}
+
+	lock := &schema.LockData{}
+	err = lock.FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	lock.AppName = appName
+
+	return lock, nil
+}
+
+func (l *Local) ReleaseLock(meta interface{}, appName, lockId string) error {
+	cfg := meta.(*LocalConfig)
+	path := l.buildLockPath(cfg.Path, appName)
+
+	lock, err := l.GetLock(meta, appName)
+	if err != nil {
+		if _, ok := err.(*LockNotFound); ok {
+			log.Printf("[DEBUG] Lock of %q already released", appName)
+			return nil
+		}
+		return err
+	}
+	if lock.LockId != lockId {
+		return &LockHeld{AppName: appName, Lock: lock}
+	}
+
+	log.Printf("[DEBUG] Deleting lock %q", path)
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	log.Printf("[DEBUG] Released lock %q of %q", lockId, appName)
+	return nil
+}
+
+// RefreshLock replaces the lock file via rename, like takeOverLock.
+// Only expired locks are taken over, so a lock refreshed before
+// it expires can't be replaced by somebody else in the meantime.
+func (l *Local) RefreshLock(meta interface{}, appName string, lock *schema.LockData) error {
+	cfg := meta.(*LocalConfig)
+	path := l.buildLockPath(cfg.Path, appName)
+
+	existingLock, err := l.GetLock(meta, appName)
+	if err != nil {
+		return err
+	}
+	if existingLock.LockId != lock.LockId {
+		return &LockHeld{AppName: appName, Lock: existingLock}
+	}
+
+	lockDataInBytes, err := lock.ToJSON()
+	if err != nil {
+		return err
+	}
+	err = l.writeFile(path, lockDataInBytes)
+	if err != nil {
+		return err
+	}
+	log.Printf("[DEBUG] Refreshed lock %q of %q (expires %s)", lock.LockId, appName, lock.ExpiresAt)
+
+	return nil
+}
+
+func (l *Local) IsReady(meta interface{}) (bool, error) {
+	cfg := meta.(*LocalConfig)
+
+	err := os.MkdirAll(cfg.Path, local_dirPerm)
+	if err != nil {
+		return false, fmt.Errorf("Failed creating %q: %s", cfg.Path, err)
+	}
+
+	// Verify we can actually write there
+	f, err := ioutil.TempFile(cfg.Path, ".rt-ready-")
+	if err != nil {
+		return false, fmt.Errorf("Failed writing into %q: %s", cfg.Path, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	return true, nil
+}
+
+func (l *Local) GetApplication(meta interface{}, appName string) (*schema.ApplicationData, error) {
+	cfg := meta.(*LocalConfig)
+	path := l.buildAppPath(cfg.Path, appName)
+
+	log.Printf("[DEBUG] Getting application %q from %q", appName, path)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &AppNotFound{AppName: appName, OriginalErr: err}
+		}
+		return nil, fmt.Errorf("Failed to get application %q: %s", appName, err)
+	}
+
+	app := &schema.ApplicationData{}
+	err = app.FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	app.Name = appName
+
+	return app, nil
+}
+
+func (l *Local) SaveApplication(meta interface{}, name string, app *schema.ApplicationData) error {
+	cfg := meta.(*LocalConfig)
+	path := l.buildAppPath(cfg.Path, name)
+
+	appDataInBytes, err := app.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Saving app data into %q", path)
+	return l.writeFile(path, appDataInBytes)
+}
+
+func (l *Local) ListApplications(meta interface{}) ([]*schema.ApplicationData, error) {
+	cfg := meta.(*LocalConfig)
+
+	files, err := ioutil.ReadDir(cfg.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*schema.ApplicationData{}, nil
+		}
+		return nil, err
+	}
+
+	var apps = make([]*schema.ApplicationData, 0)
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		app, err := l.GetApplication(meta, f.Name())
+		if err != nil {
+			if _, ok := err.(*AppNotFound); ok {
+				continue
+			}
+			return nil, err
+		}
+		apps = append(apps, app)
+	}
+
+	return apps, nil
+}
+
+func (l *Local) ListSlots(meta interface{}, appName string) ([]*schema.SlotData, error) {
+	cfg := meta.(*LocalConfig)
+
+	files, err := l.listFiles(cfg.Path, appName, local_slotObjectPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var slots = make([]*schema.SlotData, 0)
+	for _, name := range files {
+		slotId := strings.TrimPrefix(name, local_slotObjectPrefix)
+		slotId = strings.TrimSuffix(slotId, local_slotObjectSuffix)
+		slot, err := l.GetSlot(meta, appName, slotId)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %q: %s", name, err)
+		}
+		slots = append(slots, slot)
+	}
+
+	return slots, nil
+}
+
+func (l *Local) SaveSlot(meta interface{}, appName, slotId string, slot *schema.SlotData) error {
+	cfg := meta.(*LocalConfig)
+	path := l.buildSlotPath(cfg.Path, appName, slotId)
+
+	slotDataInBytes, err := slot.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Saving slot data into %q", path)
+	return l.writeFile(path, slotDataInBytes)
+}
+
+func (l *Local) DeleteSlot(meta interface{}, appName, slotId string) error {
+	cfg := meta.(*LocalConfig)
+	path := l.buildSlotPath(cfg.Path, appName, slotId)
+
+	prefixes := []string{
+		fmt.Sprintf(local_deploymentPerSlotPrefix, slotId),
+		fmt.Sprintf(local_changesPerSlotPrefix, slotId),
+	}
+	for _, prefix := range prefixes {
+		files, err := l.listFiles(cfg.Path, appName, prefix)
+		if err != nil {
+			return err
+		}
+		for _, name := range files {
+			if _, ok := parseDeploymentId(name, prefix, local_deploymentKeySuffix); !ok {
+				continue
+			}
+			log.Printf("[DEBUG] Deleting deployment %q", name)
+			err := os.Remove(filepath.Join(l.buildAppDir(cfg.Path, appName), name))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	log.Printf("[DEBUG] Deleting slot %q", path)
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	log.Printf("[DEBUG] Deleted slot %q", path)
+	return nil
+}
+
+func (l *Local) GetSlot(meta interface{}, appName, slotId string) (*schema.SlotData, error) {
+	cfg := meta.(*LocalConfig)
+	path := l.buildSlotPath(cfg.Path, appName, slotId)
+
+	log.Printf("[DEBUG] Getting slot from %q", path)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &SlotNotFound{SlotName: slotId, OriginalErr: err}
+		}
+		return nil, err
+	}
+
+	slot := &schema.SlotData{}
+	err = slot.FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	slot.SlotId = slotId
+
+	return slot, nil
+}
+
+func (l *Local) ListSortedDeploymentsForSlotId(meta interface{}, appName, slotId string, limitPerSlot int) ([]*schema.DeploymentData, error) {
+	cfg := meta.(*LocalConfig)
+	prefix := fmt.Sprintf(local_deploymentPerSlotPrefix, slotId)
+
+	// ReadDir returns files sorted by name, same as S3 listing
+	files, err := l.listFiles(cfg.Path, appName, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var deployments = make([]*schema.DeploymentData, 0)
+	for _, name := range files {
+		deploymentId, ok := parseDeploymentId(name, prefix, local_deploymentKeySuffix)
+		if !ok {
+			// Deployment of a different slot sharing the prefix
+			continue
+		}
+		deployment, err := l.GetDeployment(meta, appName, slotId, deploymentId)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %q: %s", name, err)
+		}
+		deployments = append(deployments, deployment)
+
+		if len(deployments) == limitPerSlot {
+			break
+		}
+	}
+
+	return deployments, nil
+}
+
+func (l *Local) SaveDeployment(meta interface{}, appName, slotId, deploymentId string, data *schema.DeploymentData) error {
+	cfg := meta.(*LocalConfig)
+	path := l.buildDeploymentPath(cfg.Path, appName, slotId, deploymentId)
+
+	deploymentDataInBytes, err := data.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Saving deployment data into %q", path)
+	return l.writeFile(path, deploymentDataInBytes)
+}
+
+func (l *Local) GetDeployment(meta interface{}, appName, slotId, deploymentId string) (*schema.DeploymentData, error) {
+	cfg := meta.(*LocalConfig)
+	path := l.buildDeploymentPath(cfg.Path, appName, slotId, deploymentId)
+
+	log.Printf("[DEBUG] Getting deployment from %q", path)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &DeploymentNotFound{SlotName: slotId, DeploymentId: deploymentId, OriginalErr: err}
+		}
+		return nil, err
+	}
+
+	deployment := &schema.DeploymentData{}
+	err = deployment.FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	deployment.DeploymentId = deploymentId
+
+	return deployment, nil
+}
+
+func (l *Local) SaveDeploymentChanges(meta interface{}, appName, slotId, deploymentId string,
+	data *schema.DeploymentChangesData) error {
+	cfg := meta.(*LocalConfig)
+	path := l.buildChangesPath(cfg.Path, appName, slotId, deploymentId)
+
+	changesInBytes, err := data.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Saving deployment changes into %q", path)
+	return l.writeFile(path, changesInBytes)
+}
+
+func (l *Local) GetDeploymentChanges(meta interface{}, appName, slotId, deploymentId string) (*schema.DeploymentChangesData, error) {
+	cfg := meta.(*LocalConfig)
+	path := l.buildChangesPath(cfg.Path, appName, slotId, deploymentId)
+
+	log.Printf("[DEBUG] Getting deployment changes from %q", path)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &DeploymentChangesNotFound{DeploymentId: deploymentId, OriginalErr: err}
+		}
+		return nil, err
+	}
+
+	changes := &schema.DeploymentChangesData{}
+	err = changes.FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	changes.DeploymentId = deploymentId
+
+	return changes, nil
+}
+
+func (l *Local) SavePlan(meta interface{}, appName, planId string, data *schema.PlanData) error {
+	cfg := meta.(*LocalConfig)
+	path := l.buildPlanPath(cfg.Path, appName, planId)
+
+	planInBytes, err := data.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Saving plan into %q", path)
+	return l.writeFile(path, planInBytes)
+}
+
+func (l *Local) GetPlan(meta interface{}, appName, planId string) (*schema.PlanData, error) {
+	cfg := meta.(*LocalConfig)
+	path := l.buildPlanPath(cfg.Path, appName, planId)
+
+	log.Printf("[DEBUG] Getting plan from %q", path)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &PlanNotFound{PlanId: planId, OriginalErr: err}
+		}
+		return nil, err
+	}
+
+	plan := &schema.PlanData{}
+	err = plan.FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	plan.PlanId = planId
+
+	return plan, nil
+}
+
+func (l *Local) DeletePlan(meta interface{}, appName, planId string) error {
+	cfg := meta.(*LocalConfig)
+	path := l.buildPlanPath(cfg.Path, appName, planId)
+
+	log.Printf("[DEBUG] Deleting plan %q", path)
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// writeFile writes data into a temporary file first
+// and then renames it, so readers never see partially written files
+func (l *Local) writeFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, local_dirPerm)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	err = os.Chmod(f.Name(), local_filePerm)
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// listFiles returns sorted names of files in the app directory with a given prefix
+func (l *Local) listFiles(rootPath, appName, prefix string) ([]string, error) {
+	files, err := ioutil.ReadDir(l.buildAppDir(rootPath, appName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), prefix) {
+			continue
+		}
+		names = append(names, f.Name())
+	}
+
+	return names, nil
+}
+
+func (l *Local) buildAppDir(rootPath, appName string) string {
+	appName = strings.Trim(appName, "/")
+	return filepath.Join(rootPath, appName)
+}
+
+func (l *Local) buildAppPath(rootPath, appName string) string {
+	return filepath.Join(l.buildAppDir(rootPath, appName), local_appObjectKey)
+}
+
+func (l *Local) buildLockPath(rootPath, appName string) string {
+	return filepath.Join(l.buildAppDir(rootPath, appName), local_lockKey)
+}
+
+func (l *Local) buildSlotPath(rootPath, appName, slotId string) string {
+	return filepath.Join(l.buildAppDir(rootPath, appName),
+		fmt.Sprintf(local_slotKey, slotId, local_slotObjectSuffix))
+}
+
+func (l *Local) buildDeploymentPath(rootPath, appName, slotId, deploymentId string) string {
+	return filepath.Join(l.buildAppDir(rootPath, appName),
+		fmt.Sprintf(local_deploymentKey, slotId, deploymentId, local_deploymentKeySuffix))
+}
+
+func (l *Local) buildChangesPath(rootPath, appName, slotId, deploymentId string) string {
+	return filepath.Join(l.buildAppDir(rootPath, appName),
+		fmt.Sprintf(local_changesKey, slotId, deploymentId, local_deploymentKeySuffix))
+}
+
+func (l *Local) buildPlanPath(rootPath, appName, planId string) string {
+	return filepath.Join(l.buildAppDir(rootPath, appName), fmt.Sprintf(local_planKey, planId))
+}
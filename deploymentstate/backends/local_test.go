@@ -0,0 +1,95 @@
+package backends_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/backends"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/backends/backendstest"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+)
+
+func TestLocal_conformance(t *testing.T) {
+	backendstest.TestBackendConformance(t, func(t *testing.T) (backends.Backend, interface{}, func()) {
+		dir, err := ioutil.TempDir("", "rt-local-backend")
+		if err != nil {
+			t.Fatal(err)
+		}
+		l := &backends.Local{}
+		meta, err := l.Configure(map[string]interface{}{"path": dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l, meta, func() {
+			os.RemoveAll(dir)
+		}
+	})
+}
+
+func TestLocal_concurrentTakeOver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rt-local-backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l := &backends.Local{}
+	meta, err := l.Configure(map[string]interface{}{"path": dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	for round := 0; round < 100; round++ {
+		expiredLock := &schema.LockData{
+			LockId:     fmt.Sprintf("stale-%d", round),
+			Command:    "deploy",
+			AcquiredAt: now.Add(-3 * time.Hour),
+			ExpiresAt:  now.Add(-1 * time.Hour),
+		}
+		err = l.AcquireLock(meta, "CrashedApp", expiredLock)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		acquired := 0
+		start := make(chan struct{})
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+				err := l.AcquireLock(meta, "CrashedApp", &schema.LockData{
+					LockId:     fmt.Sprintf("writer-%d-%d", round, i),
+					Command:    "deploy",
+					AcquiredAt: now,
+					ExpiresAt:  now.Add(1 * time.Hour),
+				})
+				if err == nil {
+					mu.Lock()
+					acquired++
+					mu.Unlock()
+				}
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+
+		if acquired != 1 {
+			t.Fatalf("Expected exactly one writer to take over the expired lock, %d did", acquired)
+		}
+		heldLock, err := l.GetLock(meta, "CrashedApp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = l.ReleaseLock(meta, "CrashedApp", heldLock.LockId)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"regexp"
 	"strings"
+	"time"
 
 	rtAWS "github.com/MeredithCorpOSS/ape-dev-rt/aws"
 	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
@@ -20,6 +21,7 @@ import (
 const (
 	s3_appPrefix    = "%s/"
 	s3_appObjectKey = "%s/%s/APPLICATION.json"
+	s3_lockKey      = "%s/%s/LOCK.json"
 
 	s3_slotObjectPrefix = "%s/%s/SLOT-"
 	s3_slotObjectSuffix = ".json"
@@ -30,6 +32,11 @@ const (
 	s3_deploymentKey           = "%s/%s/DEPLOYMENT-%s-%s%s"
 	s3_deploymentKeySuffix     = ".json"
 
+	s3_changesPerSlotPrefix = "%s/%s/CHANGES-%s-"
+	s3_changesKey           = "%s/%s/CHANGES-%s-%s%s"
+
+	s3_planKey = "%s/%s/PLAN-%s.json"
+
 	defaultContentType = "application/json"
 	defaultAcl         = "bucket-owner-read"
 )
@@ -93,7 +100,154 @@ func (s3 *S3) Configure(config map[string]interface{}) (interface{}, error) {
 // e.g. "Hey, backend %s doesn't support locking, it is your responsibility
 // to let your colleagues know you're deploying!"
 func (s3 *S3) SupportsWriteLock() bool {
-	return false
+	return true
+}
+
+// S3 doesn't offer any compare-and-swap for objects, so we check for
+// an existing lock first, write ours and then read it back to verify
+// nobody else has overwritten it in the meantime.
+// This narrows down the race window, but doesn't eliminate it completely.
+func (s3 *S3) AcquireLock(meta interface{}, appName string, lock *schema.LockData) error {
+	existingLock, err := s3.GetLock(meta, appName)
+	if err != nil {
+		if _, ok := err.(*LockNotFound); !ok {
+			return err
+		}
+	}
+	if existingLock != nil && existingLock.LockId != lock.LockId {
+		if !existingLock.IsExpired(time.Now().UTC()) {
+			return &LockHeld{AppName: appName, Lock: existingLock}
+		}
+		log.Printf("[WARN] Taking over expired lock of %q (expired %s)",
+			appName, existingLock.ExpiresAt)
+	}
+
+	err = s3.putLock(meta, appName, lock)
+	if err != nil {
+		return err
+	}
+
+	savedLock, err := s3.GetLock(meta, appName)
+	if err != nil {
+		return fmt.Errorf("Failed verifying lock of %q: %s", appName, err)
+	}
+	if savedLock.LockId != lock.LockId {
+		return &LockHeld{AppName: appName, Lock: savedLock}
+	}
+
+	return nil
+}
+
+func (s3 *S3) GetLock(meta interface{}, appName string) (*schema.LockData, error) {
+	cfg := meta.(*S3Config)
+	conn := cfg.s3conn
+	key := s3.buildLockKey(cfg.Prefix, appName)
+
+	input := awsS3.GetObjectInput{
+		Bucket: aws.String(cfg.Bucket),
+		Key:    aws.String(key),
+	}
+	log.Printf("[DEBUG] Getting lock from S3: %s", input)
+	out, err := conn.GetObject(&input)
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "NoSuchKey" {
+			return nil, &LockNotFound{AppName: appName, OriginalErr: err}
+		}
+		return nil, fmt.Errorf("Failed to get lock of %q from S3: %s", appName, err)
+	}
+
+	data, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &schema.LockData{}
+	err = lock.FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	lock.AppName = appName
+
+	return lock, nil
+}
+
+func (s3 *S3) ReleaseLock(meta interface{}, appName, lockId string) error {
+	cfg := meta.(*S3Config)
+	conn := cfg.s3conn
+	key := s3.buildLockKey(cfg.Prefix, appName)
+
+	lock, err := s3.GetLock(meta, appName)
+	if err != nil {
+		if _, ok := err.(*LockNotFound); ok {
+			log.Printf("[DEBUG] Lock of %q already released", appName)
+			return nil
+		}
+		return err
+	}
+	if lock.LockId != lockId {
+		return &LockHeld{AppName: appName, Lock: lock}
+	}
+
+	input := awsS3.DeleteObjectInput{
+		Bucket: aws.String(cfg.Bucket),
+		Key:    aws.String(key),
+	}
+	log.Printf("[DEBUG] Deleting lock from S3: %s", input)
+	_, err = conn.DeleteObject(&input)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Released lock %q of %q", lockId, appName)
+	return nil
+}
+
+// RefreshLock is subject to the same race as AcquireLock,
+// which is only likely if the lock already expired
+func (s3 *S3) RefreshLock(meta interface{}, appName string, lock *schema.LockData) error {
+	existingLock, err := s3.GetLock(meta, appName)
+	if err != nil {
+		return err
+	}
+	if existingLock.LockId != lock.LockId {
+		return &LockHeld{AppName: appName, Lock: existingLock}
+	}
+
+	err = s3.putLock(meta, appName, lock)
+	if err != nil {
+		return err
+	}
+	log.Printf("[DEBUG] Refreshed lock %q of %q (expires %s)", lock.LockId, appName, lock.ExpiresAt)
+
+	return nil
+}
+
+func (s3 *S3) putLock(meta interface{}, appName string, lock *schema.LockData) error {
+	cfg := meta.(*S3Config)
+	conn := cfg.s3conn
+	key := s3.buildLockKey(cfg.Prefix, appName)
+
+	lockDataInBytes, err := lock.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Saving lock into S3. Bucket: %q, Key: %q", cfg.Bucket, key)
+	input := awsS3.PutObjectInput{
+		Bucket:      aws.String(cfg.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(lockDataInBytes),
+		ContentType: aws.String(defaultContentType),
+		ACL:         aws.String(defaultAcl),
+	}
+	out, err := conn.PutObject(&input)
+	if err != nil {
+		return err
+	}
+	log.Printf("[DEBUG] Written lock to S3: %q (Etag: %s, VersionId: %#v)",
+		key, *out.ETag, out.VersionId)
+
+	return nil
 }
 
 func (s3 *S3) IsReady(meta interface{}) (bool, error) {
@@ -195,6 +349,7 @@ func (s3 *S3) ListApplications(meta interface{}) ([]*schema.ApplicationData, err
 
 	var apps = make([]*schema.ApplicationData, 0)
 	var pageNum = 0
+	var itemErr error
 	paginateFunc := func(page *awsS3.ListObjectsOutput, lastPage bool) bool {
 		objects := page.Contents
 		log.Printf("[DEBUG] Ranging over %d apps (page %d):\n%s\n\n\n", len(objects), pageNum, objects)
@@ -211,20 +366,20 @@ func (s3 *S3) ListApplications(meta interface{}) ([]*schema.ApplicationData, err
 			log.Printf("[DEBUG] Pulling S3 object: %s", input)
 			out, err := conn.GetObject(&input)
 			if err != nil {
-				log.Printf("[ERROR] Failed to download %q from S3: %s", *o.Key, err)
+				itemErr = fmt.Errorf("Failed to download %q from S3: %s", *o.Key, err)
 				return false
 			}
 
 			data, err := ioutil.ReadAll(out.Body)
 			if err != nil {
-				log.Printf("[ERROR] Failed to read bytes of %q: %s", *o.Key, err)
+				itemErr = fmt.Errorf("Failed to read bytes of %q: %s", *o.Key, err)
 				return false
 			}
 
 			app := &schema.ApplicationData{}
 			err = app.FromJSON(data)
 			if err != nil {
-				log.Printf("[ERROR] Failed to unmarshal %q: %s", *o.Key, err)
+				itemErr = fmt.Errorf("Failed to unmarshal %q: %s", *o.Key, err)
 				return false
 			}
 
@@ -244,6 +399,9 @@ func (s3 *S3) ListApplications(meta interface{}) ([]*schema.ApplicationData, err
 	if err != nil {
 		return nil, err
 	}
+	if itemErr != nil {
+		return nil, itemErr
+	}
 
 	return apps, nil
 }
@@ -255,6 +413,7 @@ func (s3 *S3) ListSlots(meta interface{}, appName string) ([]*schema.SlotData, e
 
 	var slots = make([]*schema.SlotData, 0)
 	var pageNum = 0
+	var itemErr error
 	paginateFunc := func(page *awsS3.ListObjectsOutput, lastPage bool) bool {
 		objects := page.Contents
 		log.Printf("[DEBUG] Ranging over %d slots (page %d)", len(objects), pageNum)
@@ -266,20 +425,20 @@ func (s3 *S3) ListSlots(meta interface{}, appName string) ([]*schema.SlotData, e
 			}
 			out, err := conn.GetObject(&input)
 			if err != nil {
-				log.Printf("[ERROR] Failed to download %q from S3: %s", *o.Key, err)
+				itemErr = fmt.Errorf("Failed to download %q from S3: %s", *o.Key, err)
 				return false
 			}
 
 			data, err := ioutil.ReadAll(out.Body)
 			if err != nil {
-				log.Printf("[ERROR] Failed to read bytes of %q: %s", *o.Key, err)
+				itemErr = fmt.Errorf("Failed to read bytes of %q: %s", *o.Key, err)
 				return false
 			}
 
 			slot := &schema.SlotData{}
 			err = slot.FromJSON(data)
 			if err != nil {
-				log.Printf("[ERROR] Failed to unmarshal %q: %s", *o.Key, err)
+				itemErr = fmt.Errorf("Failed to unmarshal %q: %s", *o.Key, err)
 				return false
 			}
 
@@ -301,6 +460,9 @@ func (s3 *S3) ListSlots(meta interface{}, appName string) ([]*schema.SlotData, e
 	if err != nil {
 		return nil, err
 	}
+	if itemErr != nil {
+		return nil, itemErr
+	}
 
 	return slots, nil
 }
@@ -338,12 +500,17 @@ func (s3 *S3) DeleteSlot(meta interface{}, appName, slotId string) error {
 	conn := cfg.s3conn
 	key := s3.buildSlotKey(cfg.Prefix, appName, slotId)
 
+	err := s3.deleteDeployments(cfg, appName, slotId)
+	if err != nil {
+		return fmt.Errorf("Failed to delete deployments of slot %q: %s", slotId, err)
+	}
+
 	input := awsS3.DeleteObjectInput{
 		Bucket: aws.String(cfg.Bucket),
 		Key:    aws.String(key),
 	}
 	log.Printf("[DEBUG] Deleting slot from S3: %s", input)
-	_, err := conn.DeleteObject(&input)
+	_, err = conn.DeleteObject(&input)
 	if err != nil {
 		return err
 	}
@@ -352,6 +519,60 @@ func (s3 *S3) DeleteSlot(meta interface{}, appName, slotId string) error {
 	return nil
 }
 
+// deleteDeployments deletes all deployments of a given slot along with their changes
+func (s3 *S3) deleteDeployments(cfg *S3Config, appName, slotId string) error {
+	conn := cfg.s3conn
+	prefixes := []string{
+		s3.buildDeploymentPerSlotKey(cfg.Prefix, appName, slotId),
+		s3.buildChangesPerSlotKey(cfg.Prefix, appName, slotId),
+	}
+
+	var keysForDeletion = make([]*awsS3.ObjectIdentifier, 0)
+	for _, prefix := range prefixes {
+		input := awsS3.ListObjectsInput{
+			Bucket: aws.String(cfg.Bucket),
+			Prefix: aws.String(prefix),
+		}
+		err := conn.ListObjectsPages(&input, func(page *awsS3.ListObjectsOutput, lastPage bool) bool {
+			for _, o := range page.Contents {
+				if _, ok := parseDeploymentId(*o.Key, prefix, s3_deploymentKeySuffix); ok {
+					keysForDeletion = append(keysForDeletion, &awsS3.ObjectIdentifier{Key: o.Key})
+				}
+			}
+			return !lastPage
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// DeleteObjects accepts up to 1000 keys per request
+	for len(keysForDeletion) > 0 {
+		n := len(keysForDeletion)
+		if n > 1000 {
+			n = 1000
+		}
+		delInput := awsS3.DeleteObjectsInput{
+			Bucket: aws.String(cfg.Bucket),
+			Delete: &awsS3.Delete{
+				Objects: keysForDeletion[:n],
+			},
+		}
+		log.Printf("[DEBUG] Deleting %d deployments of %q/%q from S3", n, appName, slotId)
+		out, err := conn.DeleteObjects(&delInput)
+		if err != nil {
+			return err
+		}
+		if len(out.Errors) > 0 {
+			return fmt.Errorf("Failed to delete %d deployments, first error: %s",
+				len(out.Errors), out.Errors[0])
+		}
+		keysForDeletion = keysForDeletion[n:]
+	}
+
+	return nil
+}
+
 func (s3 *S3) GetSlot(meta interface{}, appName, slotId string) (*schema.SlotData, error) {
 	cfg := meta.(*S3Config)
 	conn := cfg.s3conn
@@ -399,10 +620,16 @@ func (s3 *S3) ListSortedDeploymentsForSlotId(meta interface{}, appName, slotId s
 
 	var deployments = make([]*schema.DeploymentData, 0)
 	var pageNum = 0
+	var itemErr error
 	paginateFunc := func(page *awsS3.ListObjectsOutput, lastPage bool) bool {
 		objects := page.Contents
 		log.Printf("[DEBUG] Ranging over %d deployments (page %d)", len(objects), pageNum)
 		for _, o := range objects {
+			deploymentId, ok := parseDeploymentId(*o.Key, prefix, s3_deploymentKeySuffix)
+			if !ok {
+				// Deployment of a different slot sharing the prefix
+				continue
+			}
 			log.Printf("[DEBUG] Pulling deployment from S3: %q (%d) w/ Etag %q", *o.Key, *o.Size, *o.ETag)
 			input := awsS3.GetObjectInput{
 				Bucket: aws.String(cfg.Bucket),
@@ -410,24 +637,22 @@ func (s3 *S3) ListSortedDeploymentsForSlotId(meta interface{}, appName, slotId s
 			}
 			out, err := conn.GetObject(&input)
 			if err != nil {
-				log.Printf("[ERROR] Failed to download %q from S3: %s", *o.Key, err)
+				itemErr = fmt.Errorf("Failed to download %q from S3: %s", *o.Key, err)
 				return false
 			}
 
 			data, err := ioutil.ReadAll(out.Body)
 			if err != nil {
-				log.Printf("[ERROR] Failed to read bytes of %q: %s", *o.Key, err)
+				itemErr = fmt.Errorf("Failed to read bytes of %q: %s", *o.Key, err)
 				return false
 			}
 
 			deployment := &schema.DeploymentData{}
 			err = deployment.FromJSON(data)
 			if err != nil {
-				log.Printf("[ERROR] Failed to unmarshal %q: %s", *o.Key, err)
+				itemErr = fmt.Errorf("Failed to unmarshal %q: %s", *o.Key, err)
 				return false
 			}
-			deploymentId := strings.TrimPrefix(*o.Key, prefix)
-			deploymentId = strings.TrimSuffix(deploymentId, s3_deploymentKeySuffix)
 			deployment.DeploymentId = deploymentId
 			deployments = append(deployments, deployment)
 
@@ -445,6 +670,9 @@ func (s3 *S3) ListSortedDeploymentsForSlotId(meta interface{}, appName, slotId s
 	if err != nil {
 		return nil, err
 	}
+	if itemErr != nil {
+		return nil, itemErr
+	}
 
 	return deployments, nil
 }
@@ -489,6 +717,9 @@ func (s3 *S3) GetDeployment(meta interface{}, appName, slotId, deploymentId stri
 	log.Printf("[DEBUG] Getting deployment from S3: %s", input)
 	out, err := conn.GetObject(&input)
 	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "NoSuchKey" {
+			return nil, &DeploymentNotFound{SlotName: slotId, DeploymentId: deploymentId, OriginalErr: err}
+		}
 		return nil, err
 	}
 	log.Printf("[DEBUG] Received deployment from S3: %q (Etag: %s, VersionId: %#v)",
@@ -504,10 +735,148 @@ func (s3 *S3) GetDeployment(meta interface{}, appName, slotId, deploymentId stri
 	if err != nil {
 		return nil, err
 	}
+	deployment.DeploymentId = deploymentId
 
 	return deployment, nil
 }
 
+func (s3 *S3) SaveDeploymentChanges(meta interface{}, appName, slotId, deploymentId string,
+	data *schema.DeploymentChangesData) error {
+	cfg := meta.(*S3Config)
+	conn := cfg.s3conn
+	key := s3.buildChangesKey(cfg.Prefix, appName, slotId, deploymentId)
+
+	changesInBytes, err := data.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Saving deployment changes into S3. Bucket: %q, Key: %q", cfg.Bucket, key)
+	input := awsS3.PutObjectInput{
+		Bucket:      aws.String(cfg.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(changesInBytes),
+		ContentType: aws.String(defaultContentType),
+		ACL:         aws.String(defaultAcl),
+	}
+	out, err := conn.PutObject(&input)
+	if err != nil {
+		return err
+	}
+	log.Printf("[DEBUG] Written deployment changes to S3: %q (Etag: %s, VersionId: %#v)",
+		key, *out.ETag, out.VersionId)
+
+	return nil
+}
+
+func (s3 *S3) GetDeploymentChanges(meta interface{}, appName, slotId, deploymentId string) (*schema.DeploymentChangesData, error) {
+	cfg := meta.(*S3Config)
+	conn := cfg.s3conn
+	key := s3.buildChangesKey(cfg.Prefix, appName, slotId, deploymentId)
+
+	input := awsS3.GetObjectInput{
+		Bucket: aws.String(cfg.Bucket),
+		Key:    aws.String(key),
+	}
+	log.Printf("[DEBUG] Getting deployment changes from S3: %s", input)
+	out, err := conn.GetObject(&input)
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "NoSuchKey" {
+			return nil, &DeploymentChangesNotFound{DeploymentId: deploymentId, OriginalErr: err}
+		}
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := &schema.DeploymentChangesData{}
+	err = changes.FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	changes.DeploymentId = deploymentId
+
+	return changes, nil
+}
+
+func (s3 *S3) SavePlan(meta interface{}, appName, planId string, data *schema.PlanData) error {
+	cfg := meta.(*S3Config)
+	conn := cfg.s3conn
+	key := s3.buildPlanKey(cfg.Prefix, appName, planId)
+
+	planInBytes, err := data.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Saving plan into S3. Bucket: %q, Key: %q", cfg.Bucket, key)
+	input := awsS3.PutObjectInput{
+		Bucket:      aws.String(cfg.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(planInBytes),
+		ContentType: aws.String(defaultContentType),
+		ACL:         aws.String(defaultAcl),
+	}
+	out, err := conn.PutObject(&input)
+	if err != nil {
+		return err
+	}
+	log.Printf("[DEBUG] Written plan to S3: %q (Etag: %s, VersionId: %#v)",
+		key, *out.ETag, out.VersionId)
+
+	return nil
+}
+
+func (s3 *S3) GetPlan(meta interface{}, appName, planId string) (*schema.PlanData, error) {
+	cfg := meta.(*S3Config)
+	conn := cfg.s3conn
+	key := s3.buildPlanKey(cfg.Prefix, appName, planId)
+
+	input := awsS3.GetObjectInput{
+		Bucket: aws.String(cfg.Bucket),
+		Key:    aws.String(key),
+	}
+	log.Printf("[DEBUG] Getting plan from S3: %s", input)
+	out, err := conn.GetObject(&input)
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "NoSuchKey" {
+			return nil, &PlanNotFound{PlanId: planId, OriginalErr: err}
+		}
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &schema.PlanData{}
+	err = plan.FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	plan.PlanId = planId
+
+	return plan, nil
+}
+
+func (s3 *S3) DeletePlan(meta interface{}, appName, planId string) error {
+	cfg := meta.(*S3Config)
+	conn := cfg.s3conn
+	key := s3.buildPlanKey(cfg.Prefix, appName, planId)
+
+	input := awsS3.DeleteObjectInput{
+		Bucket: aws.String(cfg.Bucket),
+		Key:    aws.String(key),
+	}
+	log.Printf("[DEBUG] Deleting plan from S3: %s", input)
+	_, err := conn.DeleteObject(&input)
+	return err
+}
+
 func (s3 *S3) getAppKey(key, s3Prefix string) (string, bool) {
 	exp := fmt.Sprintf(s3_appObjectKey, strings.TrimSuffix(s3Prefix, "/"), "([^/]+)")
 	re := regexp.MustCompile(exp)
@@ -528,6 +897,11 @@ func (s3 *S3) buildAppKey(s3Prefix, appName string) string {
 	return fmt.Sprintf(s3_appObjectKey, s3Prefix, appName)
 }
 
+func (s3 *S3) buildLockKey(s3Prefix, appName string) string {
+	appName = strings.Trim(appName, "/")
+	return fmt.Sprintf(s3_lockKey, s3Prefix, appName)
+}
+
 func (s3 *S3) buildSlotPrefix(s3Prefix, appName string) string {
 	return fmt.Sprintf(s3_slotObjectPrefix, s3Prefix, appName)
 }
@@ -543,3 +917,16 @@ func (s3 *S3) buildDeploymentPerSlotKey(s3Prefix, appName, slotId string) string
 func (s3 *S3) buildDeploymentKey(s3Prefix, appName, slotId, deploymentId string) string {
 	return fmt.Sprintf(s3_deploymentKey, s3Prefix, appName, slotId, deploymentId, s3_deploymentKeySuffix)
 }
+
+func (s3 *S3) buildChangesPerSlotKey(s3Prefix, appName, slotId string) string {
+	return fmt.Sprintf(s3_changesPerSlotPrefix, s3Prefix, appName, slotId)
+}
+
+func (s3 *S3) buildChangesKey(s3Prefix, appName, slotId, deploymentId string) string {
+	return fmt.Sprintf(s3_changesKey, s3Prefix, appName, slotId, deploymentId, s3_deploymentKeySuffix)
+}
+
+func (s3 *S3) buildPlanKey(s3Prefix, appName, planId string) string {
+	appName = strings.Trim(appName, "/")
+	return fmt.Sprintf(s3_planKey, s3Prefix, appName, planId)
+}
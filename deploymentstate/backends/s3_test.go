@@ -6,11 +6,13 @@ import (
 	"math/rand"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	rtAWS "github.com/MeredithCorpOSS/ape-dev-rt/aws"
 	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -139,6 +141,7 @@ func TestSaveAndGetDeployment_single(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	insertedDeploymentData.DeploymentId = uniqueID
 	if !reflect.DeepEqual(*insertedDeploymentData, *receivedDeploymentData) {
 		t.Fatalf("Expected deployment data to match.\nInserted: %#v\nReceived: %#v",
 			*insertedDeploymentData, *receivedDeploymentData)
@@ -250,7 +253,7 @@ func TestSaveAndGetApplication(t *testing.T) {
 	data := &schema.ApplicationData{
 		UseCentralGitRepo:    false,
 		IsActive:             true,
-		InfraOutputs:         map[string]string{"colour": "blue"},
+		InfraOutputs:         terraform.Outputs{"colour": "blue"},
 		LastRtVersion:        "1.2.3",
 		LastTerraformVersion: "0.7.2",
 		LastDeploymentTime:   timestamp,
@@ -292,7 +295,7 @@ func TestListApplications(t *testing.T) {
 		err := s3.SaveApplication(s, fmt.Sprintf("rt-test-%d", i), &schema.ApplicationData{
 			UseCentralGitRepo:    false,
 			IsActive:             true,
-			InfraOutputs:         map[string]string{"order": fmt.Sprintf("%d", i)},
+			InfraOutputs:         terraform.Outputs{"order": fmt.Sprintf("%d", i)},
 			LastRtVersion:        "1.2.4",
 			LastTerraformVersion: "0.7.1",
 			LastDeploymentTime:   timestamp,
@@ -314,6 +317,42 @@ func TestListApplications(t *testing.T) {
 	}
 }
 
+func TestListDeployments_unreadable(t *testing.T) {
+	s, setUp, tearDown, err := testAccS3Setup()
+	if err != nil {
+		t.Skip(err)
+	}
+	err = setUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tearDown()
+
+	s3Backend := &S3{}
+	slotId := "RANDOMACCTEST"
+	err = s3Backend.SaveDeployment(s, "Bollocks", slotId, "1234567100", &schema.DeploymentData{
+		SchemaVersion: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := s3Backend.buildDeploymentKey(s.Prefix, "Bollocks", slotId, "1234567101")
+	_, err = s.s3conn.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+		Body:   strings.NewReader("{not json"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deployments, err := s3Backend.ListSortedDeploymentsForSlotId(s, "Bollocks", slotId, 0)
+	if err == nil {
+		t.Fatalf("Expected unreadable deployment to fail the listing, got %d deployments.", len(deployments))
+	}
+}
+
 func TestSaveAndListDeployments(t *testing.T) {
 	s, setUp, tearDown, err := testAccS3Setup()
 	if err != nil {
@@ -0,0 +1,157 @@
+package deploymentstate
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/backends"
+)
+
+// Problems found when comparing a backend against the authoritative one
+const (
+	RecordMissing   = "missing"
+	RecordDifferent = "different"
+	RecordExtra     = "extra"
+)
+
+// RecordDiff describes a single record (application, slot or deployment)
+// which isn't the same in a given backend as in the authoritative one
+type RecordDiff struct {
+	AppName string
+	Kind    string
+	Id      string
+	Backend string
+	Problem string
+}
+
+// BackendNames returns names of all configured backends in the order
+// they are configured (i.e. the first one is used for reads)
+func (ds *DeploymentState) BackendNames() []string {
+	names := make([]string, len(ds.backendList))
+	for i, b := range ds.backendList {
+		names[i] = b.Name
+	}
+	return names
+}
+
+// ListAllApplicationNames returns names of applications found in any of the backends
+func (ds *DeploymentState) ListAllApplicationNames() ([]string, error) {
+	seen := make(map[string]bool, 0)
+	for _, b := range ds.backendList {
+		apps, err := b.Backend.ListApplications(b.Meta)
+		if err != nil {
+			return nil, fmt.Errorf("Failed listing applications in backend %s: %s", b.Name, err)
+		}
+		for _, a := range apps {
+			seen[a.Name] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// CheckApplication compares all records of a given app in every backend
+// against the authoritative backend (first configured one if empty)
+func (ds *DeploymentState) CheckApplication(appName, authoritative string) ([]*RecordDiff, error) {
+	auth, others, err := ds.splitBackends(authoritative)
+	if err != nil {
+		return nil, err
+	}
+
+	authRecords, err := auth.applicationRecords(appName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %q from backend %s: %s", appName, auth.backendList[0].Name, err)
+	}
+
+	diffs := make([]*RecordDiff, 0)
+	for _, other := range others {
+		backendName := other.backendList[0].Name
+		records, err := other.applicationRecords(appName)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %q from backend %s: %s", appName, backendName, err)
+		}
+		checksums := make(map[string]string, len(records))
+		for _, r := range records {
+			checksums[r.key()] = r.checksum
+		}
+
+		for _, r := range authRecords {
+			checksum, ok := checksums[r.key()]
+			delete(checksums, r.key())
+			if ok && checksum == r.checksum {
+				continue
+			}
+			problem := RecordMissing
+			if ok {
+				problem = RecordDifferent
+			}
+			diffs = append(diffs, &RecordDiff{appName, r.kind, r.id, backendName, problem})
+		}
+		// Whatever is left only exists in the other backend
+		for _, r := range records {
+			if _, ok := checksums[r.key()]; ok {
+				diffs = append(diffs, &RecordDiff{appName, r.kind, r.id, backendName, RecordExtra})
+			}
+		}
+	}
+
+	return diffs, nil
+}
+
+// RepairApplication copies all records of a given app from the authoritative
+// backend (first configured one if empty) to all other backends.
+// Records which only exist in other backends are left untouched.
+func (ds *DeploymentState) RepairApplication(appName, authoritative string) (map[string]*ApplicationMigration, error) {
+	auth, others, err := ds.splitBackends(authoritative)
+	if err != nil {
+		return nil, err
+	}
+
+	repairs := make(map[string]*ApplicationMigration, len(others))
+	for _, other := range others {
+		backendName := other.backendList[0].Name
+		m, err := auth.MigrateApplication(appName, other, false)
+		if m != nil {
+			repairs[backendName] = m
+		}
+		if err != nil {
+			return repairs, fmt.Errorf("Failed to repair %q in backend %s: %s", appName, backendName, err)
+		}
+	}
+
+	return repairs, nil
+}
+
+// splitBackends returns the authoritative backend and all the others,
+// each wrapped as a single-backend DeploymentState
+func (ds *DeploymentState) splitBackends(authoritative string) (*DeploymentState, []*DeploymentState, error) {
+	if len(ds.backendList) < 1 {
+		return nil, nil, fmt.Errorf("No backend found: %v", ds.backendList)
+	}
+	if authoritative == "" {
+		authoritative = ds.backendList[0].Name
+	}
+
+	var auth *DeploymentState
+	others := make([]*DeploymentState, 0)
+	for _, b := range ds.backendList {
+		single := &DeploymentState{backendList: []*backends.BackendFactory{b}}
+		if b.Name == authoritative {
+			auth = single
+			continue
+		}
+		others = append(others, single)
+	}
+	if auth == nil {
+		return nil, nil, fmt.Errorf("Backend %q is not configured, available: %q",
+			authoritative, ds.BackendNames())
+	}
+
+	return auth, others, nil
+}
@@ -1,6 +1,8 @@
 package deploymentstate
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
@@ -15,13 +17,32 @@ import (
 )
 
 var supportedBackends = map[string]backends.Backend{
-	"s3": &backends.S3{},
+	"s3":       &backends.S3{},
+	"local":    &backends.Local{},
+	"dynamodb": &backends.DynamoDB{},
 }
 
+// DefaultLockTTL is how long a lock is considered valid
+// before it can be taken over by anyone else (e.g. after RT crashed)
+const DefaultLockTTL = 2 * time.Hour
+
+// LockRefreshInterval is how often locks of running commands are refreshed
+// (see RefreshLock), so that these only expire if RT stops running
+const LockRefreshInterval = DefaultLockTTL / 4
+
+// How many forced unlocks are kept in the audit trail of each app
+const maxForcedUnlocksKept = 20
+
+// How many traffic events are kept per slot
+const maxTrafficEventsKept = 50
+
 type DeploymentState struct {
 	// backendList persists configured backends
 	// ordereding matches ordering in HCL config
 	backendList []*backends.BackendFactory
+
+	// readPolicy decides which backend(s) READ operations use
+	readPolicy string
 }
 
 func New(config *hcl.DeploymentState) (*DeploymentState, error) {
@@ -33,6 +54,9 @@ func New(config *hcl.DeploymentState) (*DeploymentState, error) {
 	if err != nil {
 		return nil, err
 	}
+	if ds.readPolicy == "" {
+		ds.readPolicy = ReadPolicyPrimary
+	}
 
 	return &ds, nil
 }
@@ -51,7 +75,11 @@ func loadBackends(ds *DeploymentState, backendsCfg []map[string]interface{}) err
 
 			if v, ok := backendValuesSlice.([]map[string]interface{}); ok {
 				for _, backendValues := range v {
-					err := backend.Initialize(backendValues)
+					backendValues, err := loadReadPolicy(ds, backendValues)
+					if err != nil {
+						return err
+					}
+					err = backend.Initialize(backendValues)
 					if err != nil {
 						return fmt.Errorf("Error initializing backend: %q", err)
 					}
@@ -70,6 +98,31 @@ func loadBackends(ds *DeploymentState, backendsCfg []map[string]interface{}) err
 	return nil
 }
 
+// loadReadPolicy sets the read policy if defined in the backend config
+// and returns the config without it
+func loadReadPolicy(ds *DeploymentState, backendValues map[string]interface{}) (map[string]interface{}, error) {
+	v, ok := backendValues[readPolicyKey]
+	if !ok {
+		return backendValues, nil
+	}
+	policy, ok := v.(string)
+	if !ok || !isReadPolicySupported(policy) {
+		return nil, fmt.Errorf("Unsupported %s (%v), supported: %q", readPolicyKey, v, supportedReadPolicies)
+	}
+	if ds.readPolicy != "" && ds.readPolicy != policy {
+		return nil, fmt.Errorf("Conflicting %s defined (%s and %s)", readPolicyKey, ds.readPolicy, policy)
+	}
+	ds.readPolicy = policy
+
+	values := make(map[string]interface{}, len(backendValues)-1)
+	for k, v := range backendValues {
+		if k != readPolicyKey {
+			values[k] = v
+		}
+	}
+	return values, nil
+}
+
 func (ds *DeploymentState) loadBackend(name string) (*backends.BackendFactory, error) {
 	backend, ok := supportedBackends[name]
 	if !ok {
@@ -92,88 +145,97 @@ func (ds *DeploymentState) loadBackend(name string) (*backends.BackendFactory, e
 	return backendFactory, nil
 }
 
+// AreBackendsReady checks all backends are ready, unless the read policy
+// allows reading from a subset of backends (e.g. during an outage of one).
+// In that case only that many backends need to be ready.
 func (ds *DeploymentState) AreBackendsReady() (bool, error) {
+	needed := len(ds.backendList)
+	switch ds.readPolicy {
+	case ReadPolicyFallback:
+		needed = 1
+	case ReadPolicyQuorum:
+		needed = len(ds.backendList)/2 + 1
+	}
+
+	var _errors error
+	ready := 0
 	for _, b := range ds.backendList {
 		_, err := b.Backend.IsReady(b.Meta)
 		if err != nil {
-			return false, fmt.Errorf("There was an error getting backend %s ready: %q", b.Name, err)
+			err = fmt.Errorf("There was an error getting backend %s ready: %q", b.Name, err)
+			if needed == len(ds.backendList) {
+				return false, err
+			}
+			log.Printf("[WARN] %s", err)
+			_errors = multierror.Append(_errors, err)
+			continue
 		}
-
+		ready++
+	}
+	if ready < needed {
+		return false, _errors
 	}
 
 	return true, nil
 }
 
 // For READ operations we take the first backend as single point of truth
-// for simplicity (i.e. we don't deal with conflicts between backends)
+// for simplicity (i.e. we don't deal with conflicts between backends,
+// see CheckApplication & RepairApplication), unless the read policy
+// says otherwise (see read)
 
 func (ds *DeploymentState) ListSlots(appName string) ([]*schema.SlotData, error) {
-	if len(ds.backendList) < 1 {
-		return nil, fmt.Errorf("No backend found: %v", ds.backendList)
-	}
-	b := ds.backendList[0]
-
-	slotData, err := b.Backend.ListSlots(b.Meta, appName)
+	slotData, err := ds.read(func(b *backends.BackendFactory) (interface{}, error) {
+		return b.Backend.ListSlots(b.Meta, appName)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("Failed to list slots for %q: %s", appName, err)
 	}
 
-	return slotData, nil
+	return slotData.([]*schema.SlotData), nil
 }
 
 func (ds *DeploymentState) GetSlot(appName, slotId string) (*schema.SlotData, error) {
-	if len(ds.backendList) < 1 {
-		return nil, fmt.Errorf("No backend found: %v", ds.backendList)
-	}
-	b := ds.backendList[0]
-
-	slotData, err := b.Backend.GetSlot(b.Meta, appName, slotId)
+	slotData, err := ds.read(func(b *backends.BackendFactory) (interface{}, error) {
+		return b.Backend.GetSlot(b.Meta, appName, slotId)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get slot %s for %q: %s", slotId, appName, err)
 	}
 
-	return slotData, nil
+	return slotData.(*schema.SlotData), nil
 }
 
 func (ds *DeploymentState) ListLastDeployments(appName, slotId string, limit int) ([]*schema.DeploymentData, error) {
-	if len(ds.backendList) < 1 {
-		return nil, fmt.Errorf("No backend found: %v", ds.backendList)
-	}
-	b := ds.backendList[0]
-
-	deployments, err := b.Backend.ListSortedDeploymentsForSlotId(
-		b.Meta, appName, slotId, limit)
+	deployments, err := ds.read(func(b *backends.BackendFactory) (interface{}, error) {
+		return b.Backend.ListSortedDeploymentsForSlotId(
+			b.Meta, appName, slotId, limit)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("Failed to list last %d deployments of %q/%q: %s", limit, appName, slotId, err)
 	}
 
-	return deployments, nil
+	return deployments.([]*schema.DeploymentData), nil
 }
 
 func (ds *DeploymentState) ListApplications() ([]*schema.ApplicationData, error) {
-	if len(ds.backendList) < 1 {
-		return nil, fmt.Errorf("No backend found: %v", ds.backendList)
-	}
-	b := ds.backendList[0]
-
-	apps, err := b.Backend.ListApplications(b.Meta)
+	apps, err := ds.read(func(b *backends.BackendFactory) (interface{}, error) {
+		return b.Backend.ListApplications(b.Meta)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("Failed listing applications: %s", err)
 	}
-	return apps, err
+	return apps.([]*schema.ApplicationData), err
 }
 
 func (ds *DeploymentState) GetApplication(name string) (*schema.ApplicationData, error) {
-	if len(ds.backendList) < 1 {
-		return nil, fmt.Errorf("No backend found: %v", ds.backendList)
-	}
-	b := ds.backendList[0]
-
-	app, err := b.Backend.GetApplication(b.Meta, name)
+	app, err := ds.read(func(b *backends.BackendFactory) (interface{}, error) {
+		return b.Backend.GetApplication(b.Meta, name)
+	})
 	if err != nil {
 		return nil, err
 	}
-	return app, nil
+	return app.(*schema.ApplicationData), nil
 }
 
 func (ds *DeploymentState) SaveApplication(name string, data *schema.ApplicationData) error {
@@ -187,6 +249,28 @@ func (ds *DeploymentState) SaveApplication(name string, data *schema.Application
 	return nil
 }
 
+func (ds *DeploymentState) SaveSlot(appName, slotId string, data *schema.SlotData) error {
+	for _, b := range ds.backendList {
+		err := b.Backend.SaveSlot(b.Meta, appName, slotId, data)
+		if err != nil {
+			return fmt.Errorf("Failed to save slot data to backend %s: %q", b.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (ds *DeploymentState) SaveDeployment(appName, slotId, deploymentId string, data *schema.DeploymentData) error {
+	for _, b := range ds.backendList {
+		err := b.Backend.SaveDeployment(b.Meta, appName, slotId, deploymentId, data)
+		if err != nil {
+			return fmt.Errorf("Failed to save deployment data to backend %s: %q", b.Name, err)
+		}
+	}
+
+	return nil
+}
+
 func (ds *DeploymentState) SupportsWriteLock() (bool, error) {
 	if len(ds.backendList) < 1 {
 		return false, fmt.Errorf("No backend found: %v", ds.backendList)
@@ -196,39 +280,294 @@ func (ds *DeploymentState) SupportsWriteLock() (bool, error) {
 	return b.Backend.SupportsWriteLock(), nil
 }
 
-func (ds *DeploymentState) GetDeployment(appName, slotId, deploymentId string) (*schema.DeploymentData, error) {
-	if len(ds.backendList) < 1 {
-		return nil, fmt.Errorf("No backend found: %v", ds.backendList)
+// AcquireLock takes the write lock for a given app in every backend
+// which supports locking. Locks already taken are released
+// if any of the backends fails.
+func (ds *DeploymentState) AcquireLock(appName string, pilot *schema.DeployPilot, command, reason string,
+	ttl time.Duration) (*schema.LockData, error) {
+	lockId, err := generateLockId()
+	if err != nil {
+		return nil, err
 	}
-	b := ds.backendList[0]
 
-	deployment, err := b.Backend.GetDeployment(
-		b.Meta, appName, slotId, deploymentId)
+	now := time.Now().UTC()
+	lock := &schema.LockData{
+		AppName:    appName,
+		LockId:     lockId,
+		Holder:     pilot,
+		Command:    command,
+		Reason:     reason,
+		RTVersion:  rt.Version,
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+
+	locked := make([]*backends.BackendFactory, 0)
+	for _, b := range ds.backendList {
+		if !b.Backend.SupportsWriteLock() {
+			log.Printf("[DEBUG] Backend %s doesn't support locking, skipping", b.Name)
+			continue
+		}
+
+		err := b.Backend.AcquireLock(b.Meta, appName, lock)
+		if err != nil {
+			for _, lb := range locked {
+				rErr := lb.Backend.ReleaseLock(lb.Meta, appName, lockId)
+				if rErr != nil {
+					log.Printf("[ERROR] Failed to release lock of %q in backend %s: %s",
+						appName, lb.Name, rErr)
+				}
+			}
+			if _, ok := err.(*backends.LockHeld); ok {
+				return nil, err
+			}
+			return nil, fmt.Errorf("Failed to acquire lock of %q in backend %s: %s", appName, b.Name, err)
+		}
+		locked = append(locked, b)
+	}
+
+	if len(locked) == 0 {
+		return nil, nil
+	}
+
+	return lock, nil
+}
+
+// ReleaseLock releases a lock previously taken via AcquireLock
+func (ds *DeploymentState) ReleaseLock(appName string, lock *schema.LockData) error {
+	var _errors error
+	for _, b := range ds.backendList {
+		if !b.Backend.SupportsWriteLock() {
+			continue
+		}
+		err := b.Backend.ReleaseLock(b.Meta, appName, lock.LockId)
+		if err != nil {
+			if _, ok := err.(*backends.LockHeld); ok {
+				_errors = multierror.Append(_errors, fmt.Errorf(
+					"Lock of %q in backend %s was taken over while it was held "+
+						"(expired %s), deployment state may have been changed concurrently! %s",
+					appName, b.Name, lock.ExpiresAt, err))
+				continue
+			}
+			_errors = multierror.Append(_errors, fmt.Errorf(
+				"Failed to release lock of %q in backend %s: %s", appName, b.Name, err))
+		}
+	}
+	return _errors
+}
+
+// RefreshLock extends a lock previously taken via AcquireLock
+// to expire after ttl from now. It fails if the lock expired
+// and was taken over by somebody else in the meantime.
+func (ds *DeploymentState) RefreshLock(appName string, lock *schema.LockData, ttl time.Duration) error {
+	refreshedLock := *lock
+	refreshedLock.ExpiresAt = time.Now().UTC().Add(ttl)
+
+	var _errors error
+	for _, b := range ds.backendList {
+		if !b.Backend.SupportsWriteLock() {
+			continue
+		}
+		err := b.Backend.RefreshLock(b.Meta, appName, &refreshedLock)
+		if err != nil {
+			_errors = multierror.Append(_errors, fmt.Errorf(
+				"Failed to refresh lock of %q in backend %s: %s", appName, b.Name, err))
+		}
+	}
+	if _errors != nil {
+		return _errors
+	}
+
+	lock.ExpiresAt = refreshedLock.ExpiresAt
+	return nil
+}
+
+// GetLock returns the lock currently held for a given app
+// or nil if there's none or locking isn't supported
+func (ds *DeploymentState) GetLock(appName string) (*schema.LockData, error) {
+	lock, err := ds.read(func(b *backends.BackendFactory) (interface{}, error) {
+		if !b.Backend.SupportsWriteLock() {
+			return (*schema.LockData)(nil), nil
+		}
+		return b.Backend.GetLock(b.Meta, appName)
+	})
+	if err != nil {
+		if _, ok := err.(*backends.LockNotFound); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return lock.(*schema.LockData), nil
+}
+
+// ForceReleaseLock releases the lock of a given app regardless of who holds it
+// and records who broke it in the application data.
+// Returns the broken lock or nil if the app wasn't locked.
+func (ds *DeploymentState) ForceReleaseLock(appName string, pilot *schema.DeployPilot) (*schema.LockData, error) {
+	var brokenLock *schema.LockData
+	var _errors error
+	for _, b := range ds.backendList {
+		if !b.Backend.SupportsWriteLock() {
+			continue
+		}
+		lock, err := b.Backend.GetLock(b.Meta, appName)
+		if err != nil {
+			if _, ok := err.(*backends.LockNotFound); ok {
+				continue
+			}
+			_errors = multierror.Append(_errors, fmt.Errorf(
+				"Failed to get lock of %q from backend %s: %s", appName, b.Name, err))
+			continue
+		}
+		err = b.Backend.ReleaseLock(b.Meta, appName, lock.LockId)
+		if err != nil {
+			_errors = multierror.Append(_errors, fmt.Errorf(
+				"Failed to release lock of %q in backend %s: %s", appName, b.Name, err))
+			continue
+		}
+		log.Printf("[WARN] Lock %q of %q forcibly released in backend %s", lock.LockId, appName, b.Name)
+		if brokenLock == nil {
+			brokenLock = lock
+		}
+	}
+	if _errors != nil {
+		return brokenLock, _errors
+	}
+	if brokenLock == nil {
+		return nil, nil
+	}
+
+	appData, err := ds.GetApplication(appName)
+	if err != nil {
+		return brokenLock, fmt.Errorf("Lock released, but failed to record audit trail: %s", err)
+	}
+	appData.ForcedUnlocks = append(appData.ForcedUnlocks, &schema.ForcedUnlockData{
+		Lock:     brokenLock,
+		BrokenBy: pilot,
+		BrokenAt: time.Now().UTC(),
+	})
+	if len(appData.ForcedUnlocks) > maxForcedUnlocksKept {
+		appData.ForcedUnlocks = appData.ForcedUnlocks[len(appData.ForcedUnlocks)-maxForcedUnlocksKept:]
+	}
+	err = ds.SaveApplication(appName, appData)
+	if err != nil {
+		return brokenLock, fmt.Errorf("Lock released, but failed to record audit trail: %s", err)
+	}
+
+	return brokenLock, nil
+}
+
+// GetDeployment returns a given deployment
+// or *backends.DeploymentNotFound if there's none
+func (ds *DeploymentState) GetDeployment(appName, slotId, deploymentId string) (*schema.DeploymentData, error) {
+	deployment, err := ds.read(func(b *backends.BackendFactory) (interface{}, error) {
+		return b.Backend.GetDeployment(
+			b.Meta, appName, slotId, deploymentId)
+	})
 
 	if err != nil {
+		if _, ok := err.(*backends.DeploymentNotFound); ok {
+			return nil, err
+		}
 		return nil, fmt.Errorf("Failed getting deployment %s of %q for slot %s: %s",
 			deploymentId, appName, slotId, err)
 	}
 
-	return deployment, nil
+	return deployment.(*schema.DeploymentData), nil
+}
+
+// GetDeploymentChanges returns resource changes of a given deployment
+// or *backends.DeploymentChangesNotFound if none were recorded
+func (ds *DeploymentState) GetDeploymentChanges(appName, slotId, deploymentId string) (*schema.DeploymentChangesData, error) {
+	changes, err := ds.read(func(b *backends.BackendFactory) (interface{}, error) {
+		return b.Backend.GetDeploymentChanges(b.Meta, appName, slotId, deploymentId)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes.(*schema.DeploymentChangesData), nil
+}
+
+func (ds *DeploymentState) SaveDeploymentChanges(appName, slotId, deploymentId string, data *schema.DeploymentChangesData) error {
+	for _, b := range ds.backendList {
+		err := b.Backend.SaveDeploymentChanges(b.Meta, appName, slotId, deploymentId, data)
+		if err != nil {
+			return fmt.Errorf("Failed to save deployment changes to backend %s: %q", b.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// SavePlan saves a given plan (created by Terraform tfVersion)
+// under a newly generated plan ID
+func (ds *DeploymentState) SavePlan(appName, tfVersion string, data *schema.PlanData) (string, error) {
+	planId, err := generatePlanId()
+	if err != nil {
+		return "", err
+	}
+	data.PlanId = planId
+	data.RTVersion = rt.Version
+	data.TerraformVersion = tfVersion
+
+	for _, b := range ds.backendList {
+		err := b.Backend.SavePlan(b.Meta, appName, planId, data)
+		if err != nil {
+			return "", fmt.Errorf("Failed to save plan to backend %s: %q", b.Name, err)
+		}
+	}
+
+	return planId, nil
+}
+
+func (ds *DeploymentState) GetPlan(appName, planId string) (*schema.PlanData, error) {
+	plan, err := ds.read(func(b *backends.BackendFactory) (interface{}, error) {
+		return b.Backend.GetPlan(b.Meta, appName, planId)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return plan.(*schema.PlanData), nil
 }
 
-func (ds *DeploymentState) BeginDeployment(appName, slotId string, isDestroy bool, pilot *schema.DeployPilot, startTime time.Time,
-	vars map[string]string) (*schema.DeploymentData, error) {
-	deploymentId := generateUniqueDeploymentId()
+func (ds *DeploymentState) DeletePlan(appName, planId string) error {
+	var _errors error
+	for _, b := range ds.backendList {
+		err := b.Backend.DeletePlan(b.Meta, appName, planId)
+		if err != nil {
+			_errors = multierror.Append(_errors, err)
+		}
+	}
+	return _errors
+}
+
+// BeginDeployment records a deployment in progress, configChecksum
+// and rollbackOf are saved with it right away, empty if not known
+func (ds *DeploymentState) BeginDeployment(appName, slotId string, isDestroy bool, pilot *schema.DeployPilot,
+	tfVersion string, startTime time.Time, vars map[string]string,
+	configChecksum, rollbackOf string) (*schema.DeploymentData, error) {
+	deploymentId, err := generateUniqueDeploymentId(time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
 
 	tf := schema.TerraformRun{
 		IsDestroy:        isDestroy,
 		Variables:        vars,
-		TerraformVersion: rt.TerraformVersion,
+		TerraformVersion: tfVersion,
 	}
 
 	data := &schema.DeploymentData{
-		DeploymentId: deploymentId,
-		DeployPilot:  pilot,
-		Terraform:    &tf,
-		RTVersion:    rt.Version,
-		StartTime:    startTime,
+		DeploymentId:   deploymentId,
+		DeployPilot:    pilot,
+		Terraform:      &tf,
+		RTVersion:      rt.Version,
+		StartTime:      startTime,
+		Status:         schema.DeploymentInProgress,
+		ConfigChecksum: configChecksum,
+		RollbackOf:     rollbackOf,
 	}
 
 	for _, b := range ds.backendList {
@@ -245,6 +584,8 @@ func (ds *DeploymentState) BeginDeployment(appName, slotId string, isDestroy boo
 		}
 		slotData.LastDeployPilot = pilot
 		slotData.LastDeploymentStartTime = startTime
+		slotData.LastDeploymentId = deploymentId
+		slotData.LastDeploymentStatus = schema.DeploymentInProgress
 
 		err = b.Backend.SaveSlot(b.Meta, appName, slotId, slotData)
 		if err != nil {
@@ -273,7 +614,30 @@ func (ds *DeploymentState) FinishDeployment(appName, slotId, deploymentId string
 	data.Terraform.Warnings = tfRun.Warnings
 	data.Terraform.Stderr = tfRun.Stderr
 
+	data.Status = schema.DeploymentSucceeded
+	if tfRun.ExitCode != 0 {
+		data.Status = schema.DeploymentFailed
+	}
+	if tfRun.Interrupted {
+		data.Status = schema.DeploymentInterrupted
+	}
+
+	var changes *schema.DeploymentChangesData
+	if tfRun.ResourceChanges != nil {
+		changes = &schema.DeploymentChangesData{
+			DeploymentId:    deploymentId,
+			ResourceChanges: tfRun.ResourceChanges,
+		}
+	}
+
 	for _, b := range ds.backendList {
+		if changes != nil {
+			err := b.Backend.SaveDeploymentChanges(b.Meta, appName, slotId, deploymentId, changes)
+			if err != nil {
+				return fmt.Errorf("There was an error saving changes of the deployment with backend %s: %q", b.Name, err)
+			}
+		}
+
 		err := b.Backend.SaveDeployment(b.Meta, appName, slotId, deploymentId, data)
 		if err != nil {
 			return fmt.Errorf("There was an error finishing the deployment with backend %s: %q", b.Name, err)
@@ -291,6 +655,100 @@ func (ds *DeploymentState) FinishDeployment(appName, slotId, deploymentId string
 		slotData.LastTerraformRun.PlanFinishTime = data.Terraform.PlanFinishTime
 		slotData.LastDeployPilot = data.DeployPilot
 		slotData.LastTerraformRun = data.Terraform
+		slotData.LastDeploymentId = deploymentId
+		slotData.LastDeploymentStatus = data.Status
+		slotData.LastTerraformVersion = data.Terraform.TerraformVersion
+		err = b.Backend.SaveSlot(b.Meta, appName, slotId, slotData)
+		if err != nil {
+			return fmt.Errorf("Unable to save slot data for %s / %s: %s", appName, slotId, err)
+		}
+	}
+
+	return nil
+}
+
+// ListStaleDeployments returns deployments which are still in progress
+// and were started before a given time, i.e. most likely never finished
+// because RT crashed or was killed
+func (ds *DeploymentState) ListStaleDeployments(appName string, startedBefore time.Time) (map[string]*schema.DeploymentData, error) {
+	slots, err := ds.ListSlots(appName)
+	if err != nil {
+		return nil, err
+	}
+
+	stale := make(map[string]*schema.DeploymentData, 0)
+	for _, s := range slots {
+		if s.GetLastDeploymentStatus() != schema.DeploymentInProgress {
+			continue
+		}
+		if !s.LastDeploymentStartTime.Before(startedBefore) {
+			continue
+		}
+
+		var deployment *schema.DeploymentData
+		if s.LastDeploymentId != "" {
+			deployment, err = ds.GetDeployment(appName, s.SlotId, s.LastDeploymentId)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			// Slots deployed before the ID of last deployment was recorded
+			deployments, err := ds.ListLastDeployments(appName, s.SlotId, 1)
+			if err != nil {
+				return nil, err
+			}
+			if len(deployments) == 0 {
+				continue
+			}
+			deployment = deployments[0]
+		}
+		if deployment.GetStatus() != schema.DeploymentInProgress {
+			continue
+		}
+		stale[s.SlotId] = deployment
+	}
+
+	return stale, nil
+}
+
+// AbandonDeployment marks a deployment which never finished as abandoned,
+// so it's no longer treated as being in progress
+func (ds *DeploymentState) AbandonDeployment(appName, slotId, deploymentId string, pilot *schema.DeployPilot) error {
+	deployment, err := ds.GetDeployment(appName, slotId, deploymentId)
+	if err != nil {
+		return err
+	}
+	if status := deployment.GetStatus(); status != schema.DeploymentInProgress {
+		return fmt.Errorf("Deployment %s of %q/%q is %s, only deployments in progress can be abandoned",
+			deploymentId, appName, slotId, status)
+	}
+	deployment.Status = schema.DeploymentAbandoned
+	deployment.Abandoned = &schema.AbandonedData{
+		By: pilot,
+		At: time.Now().UTC(),
+	}
+
+	for _, b := range ds.backendList {
+		err := b.Backend.SaveDeployment(b.Meta, appName, slotId, deploymentId, deployment)
+		if err != nil {
+			return fmt.Errorf("Failed to save deployment data to backend %s: %q", b.Name, err)
+		}
+
+		slotData, err := b.Backend.GetSlot(b.Meta, appName, slotId)
+		if err != nil {
+			return fmt.Errorf("Unable to get slot data for %s / %s: %s", appName, slotId, err)
+		}
+		if slotData.LastDeploymentId != "" && slotData.LastDeploymentId != deploymentId {
+			// Slot was deployed since
+			continue
+		}
+		slotData.LastDeploymentId = deploymentId
+		slotData.LastDeploymentStatus = schema.DeploymentAbandoned
+		if slotData.LastTerraformRun == nil {
+			// First deployment of the slot never finished, so nothing
+			// ever made it active and cleanup-slots should be able to remove it
+			slotData.IsActive = false
+		}
 		err = b.Backend.SaveSlot(b.Meta, appName, slotId, slotData)
 		if err != nil {
 			return fmt.Errorf("Unable to save slot data for %s / %s: %s", appName, slotId, err)
@@ -300,6 +758,31 @@ func (ds *DeploymentState) FinishDeployment(appName, slotId, deploymentId string
 	return nil
 }
 
+// RecordTrafficShift appends a step of shift-traffic to the deployment record
+func (ds *DeploymentState) RecordTrafficShift(appName, slotId, deploymentId string, event *schema.TrafficShiftEvent) error {
+	deployment, err := ds.GetDeployment(appName, slotId, deploymentId)
+	if err != nil {
+		return err
+	}
+	deployment.TrafficShifts = append(deployment.TrafficShifts, event)
+
+	return ds.SaveDeployment(appName, slotId, deploymentId, deployment)
+}
+
+// RecordTrafficEvent appends a change of traffic to the slot record
+func (ds *DeploymentState) RecordTrafficEvent(appName, slotId string, event *schema.TrafficEvent) error {
+	slotData, err := ds.GetSlot(appName, slotId)
+	if err != nil {
+		return err
+	}
+	slotData.TrafficEvents = append(slotData.TrafficEvents, event)
+	if len(slotData.TrafficEvents) > maxTrafficEventsKept {
+		slotData.TrafficEvents = slotData.TrafficEvents[len(slotData.TrafficEvents)-maxTrafficEventsKept:]
+	}
+
+	return ds.SaveSlot(appName, slotId, slotData)
+}
+
 func (ds *DeploymentState) GetSlotCounter(prefix string, appData *schema.ApplicationData) (int64, bool, error) {
 	counter, ok := appData.SlotCounters[prefix]
 	if !ok {
@@ -349,15 +832,47 @@ func (ds *DeploymentState) DeleteSlotCounter(prefix string, appData *schema.Appl
 	return appData, nil
 }
 
+func generateLockId() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("Failed to generate lock ID: %s", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// generatePlanId returns a random ID, plans aren't listed
+// so there's no need to keep them sorted like deployments
+func generatePlanId() (string, error) {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("Failed to generate plan ID: %s", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
 // DIRTY HACK! 🐉
 // File-based backends (like S3) list objects in lexicographical order
 // and offer no easy ways to efficiently sort objects/files.
 // Reversed timestamps sorted lexicographically are sorted from newest to oldest.
 // This reduces complexity and data usage as we don't have to re-sort
 // the list of deployments nor paginate if we only need latest deployment
-func generateUniqueDeploymentId() string {
+//
+// Timestamps are in nanoseconds and followed by a random suffix, so that
+// deployments started at the same time (e.g. automated retries) don't collide,
+// e.g. 07459713834261430807.3f9a1c2b
+// IDs generated by older versions (reversed timestamps in seconds)
+// are numerically bigger, so they're always sorted after these.
+// IDs must not contain dashes (see parseDeploymentId).
+func generateUniqueDeploymentId(now time.Time) (string, error) {
 	// TODO: If we can avoid file-based backends, we can generate IDs any way we want
-	maxInt := math.MaxInt64
-	reversedTimestamp := maxInt - int(time.Now().UTC().Unix())
-	return fmt.Sprintf("%020d", reversedTimestamp)
+	// (DynamoDB backend sorts deployments by start time and doesn't rely on this)
+	suffix := make([]byte, 4)
+	_, err := rand.Read(suffix)
+	if err != nil {
+		return "", fmt.Errorf("Failed to generate deployment ID: %s", err)
+	}
+	reversedTimestamp := math.MaxInt64 - now.UnixNano()
+	return fmt.Sprintf("%020d.%s", reversedTimestamp, hex.EncodeToString(suffix)), nil
 }
@@ -2,10 +2,20 @@ package deploymentstate
 
 import (
 	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/backends"
 	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/backends/backendstest"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
 	"github.com/MeredithCorpOSS/ape-dev-rt/hcl"
+	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
 )
 
 func TestLoadBackends(t *testing.T) {
@@ -18,9 +28,9 @@ func TestLoadBackends(t *testing.T) {
 		ExpectedError error
 	}{
 		0: {"test-fixtures/no-deployment-state.hcl", emptyVars,
-			fmt.Errorf(`Failed to load config from "test-fixtures/no-deployment-state.hcl": Unrecognised config block ("random_thing_oink"), supported: ["deployment_state" "remote_state"]`)},
+			fmt.Errorf(`Failed to load config from "test-fixtures/no-deployment-state.hcl": Unrecognised config block ("random_thing_oink"), supported: ["deployment_state" "remote_state" "terraform"]`)},
 		1: {"test-fixtures/unexpected-resource.hcl", emptyVars,
-			fmt.Errorf(`Failed to load config from "test-fixtures/unexpected-resource.hcl": Unrecognised config block ("random_thing_oink"), supported: ["deployment_state" "remote_state"]`)},
+			fmt.Errorf(`Failed to load config from "test-fixtures/unexpected-resource.hcl": Unrecognised config block ("random_thing_oink"), supported: ["deployment_state" "remote_state" "terraform"]`)},
 		2: {"test-fixtures/empty-file.hcl", emptyVars,
 			fmt.Errorf("No configuration provided")},
 		3: {"test-fixtures/uninitializable-backend.hcl", emptyVars,
@@ -30,6 +40,9 @@ func TestLoadBackends(t *testing.T) {
 		5: {"test-fixtures/double-resource.hcl", emptyVars,
 			fmt.Errorf("Duplicate backend defined (fixture)")},
 		6: {"test-fixtures/valid.hcl", emptyVars, nil},
+		7: {"test-fixtures/unsupported-read-policy.hcl", emptyVars,
+			fmt.Errorf(`Unsupported read_policy (whatever), supported: ["primary" "fallback" "quorum"]`)},
+		8: {"test-fixtures/read-policy.hcl", emptyVars, nil},
 	}
 
 	for i, c := range cases {
@@ -56,3 +69,842 @@ func testLoadBackendsFixture(path string) error {
 	_, err = New(cfg.DeploymentState)
 	return err
 }
+
+func TestLoadReadPolicy(t *testing.T) {
+	supportedBackends["fixture"] = &backendstest.FixtureBackend{}
+
+	cfg, _, err := hcl.LoadConfigFromPath("", "", "test-fixtures/read-policy.hcl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := New(cfg.DeploymentState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.readPolicy != ReadPolicyFallback {
+		t.Fatalf("Expected read policy %q, given: %q", ReadPolicyFallback, ds.readPolicy)
+	}
+
+	cfg, _, err = hcl.LoadConfigFromPath("", "", "test-fixtures/valid.hcl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err = New(cfg.DeploymentState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.readPolicy != ReadPolicyPrimary {
+		t.Fatalf("Expected default read policy %q, given: %q", ReadPolicyPrimary, ds.readPolicy)
+	}
+
+	_, err = loadReadPolicy(ds, map[string]interface{}{"read_policy": "quorum"})
+	expectedErr := "Conflicting read_policy defined (primary and quorum)"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("Expected error: %q, given: %v", expectedErr, err)
+	}
+}
+
+func TestReadPolicies(t *testing.T) {
+	ds, tearDown := testMultiBackendDeploymentState(t)
+	defer tearDown()
+
+	err := ds.SaveApplication("read-app", &schema.ApplicationData{IsActive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds.readPolicy = ReadPolicyQuorum
+	app, err := ds.GetApplication("read-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !app.IsActive {
+		t.Fatal("Expected active app")
+	}
+	_, err = ds.GetApplication("missing-app")
+	if _, ok := err.(*backends.AppNotFound); !ok {
+		t.Fatalf("Expected AppNotFound error, given: %v", err)
+	}
+	_, err = ds.GetDeployment("read-app", "blue", "missing-deployment")
+	if _, ok := err.(*backends.DeploymentNotFound); !ok {
+		t.Fatalf("Expected DeploymentNotFound error, given: %v", err)
+	}
+
+	// Both backends need to agree on the result
+	local := &DeploymentState{backendList: ds.backendList[:1]}
+	err = local.SaveApplication("read-app", &schema.ApplicationData{IsActive: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ds.GetApplication("read-app")
+	if err == nil {
+		t.Fatal("Expected error when backends disagree")
+	}
+
+	// Break the primary backend
+	f, err := ioutil.TempFile("", "rt-broken-backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	err = ds.backendList[0].Initialize(map[string]interface{}{"path": f.Name()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds.readPolicy = ReadPolicyPrimary
+	_, err = ds.GetApplication("read-app")
+	if err == nil {
+		t.Fatal("Expected error when reading from broken primary backend")
+	}
+	ready, _ := ds.AreBackendsReady()
+	if ready {
+		t.Fatal("Expected backends not to be ready with broken primary")
+	}
+
+	ds.readPolicy = ReadPolicyFallback
+	ready, err = ds.AreBackendsReady()
+	if !ready {
+		t.Fatalf("Expected backends to be ready with fallback, given: %s", err)
+	}
+	app, err = ds.GetApplication("read-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !app.IsActive {
+		t.Fatal("Expected app from the second backend (active)")
+	}
+	slots, err := ds.ListSlots("read-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 0 {
+		t.Fatalf("Expected no slots, given: %d", len(slots))
+	}
+
+	ds.readPolicy = ReadPolicyQuorum
+	_, err = ds.GetApplication("read-app")
+	if err == nil {
+		t.Fatal("Expected error when quorum can't be reached")
+	}
+}
+
+func TestLocking(t *testing.T) {
+	ds, tearDown := testLocalDeploymentState(t)
+	defer tearDown()
+
+	err := ds.SaveApplication("locked-app", &schema.ApplicationData{IsActive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bob := &schema.DeployPilot{AWSApiCaller: "arn:aws:iam::123456789012:user/Bob"}
+	lock, err := ds.AcquireLock("locked-app", bob, "deploy", "", DefaultLockTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock == nil {
+		t.Fatal("Expected lock, received nil")
+	}
+
+	alice := &schema.DeployPilot{AWSApiCaller: "arn:aws:iam::123456789012:user/Alice"}
+	_, err = ds.AcquireLock("locked-app", alice, "deploy", "", DefaultLockTTL)
+	if _, ok := err.(*backends.LockHeld); !ok {
+		t.Fatalf("Expected LockHeld error, received: %v", err)
+	}
+
+	heldLock, err := ds.GetLock("locked-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heldLock.LockId != lock.LockId {
+		t.Fatalf("Expected lock %q to be held, given: %q", lock.LockId, heldLock.LockId)
+	}
+
+	brokenLock, err := ds.ForceReleaseLock("locked-app", alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if brokenLock.LockId != lock.LockId {
+		t.Fatalf("Expected lock %q to be broken, given: %q", lock.LockId, brokenLock.LockId)
+	}
+
+	heldLock, err = ds.GetLock("locked-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heldLock != nil {
+		t.Fatalf("Expected no lock after force-unlock, given: %#v", heldLock)
+	}
+
+	appData, err := ds.GetApplication("locked-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(appData.ForcedUnlocks) != 1 {
+		t.Fatalf("Expected 1 forced unlock recorded, given: %d", len(appData.ForcedUnlocks))
+	}
+	if appData.ForcedUnlocks[0].BrokenBy.AWSApiCaller != alice.AWSApiCaller {
+		t.Fatalf("Expected lock to be broken by %q, given: %q",
+			alice.AWSApiCaller, appData.ForcedUnlocks[0].BrokenBy.AWSApiCaller)
+	}
+
+	// Releasing someone else's lock must fail
+	lock, err = ds.AcquireLock("locked-app", alice, "deploy", "", DefaultLockTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ds.ReleaseLock("locked-app", &schema.LockData{LockId: "someone-else"})
+	if err == nil {
+		t.Fatal("Expected error when releasing someone else's lock")
+	}
+	err = ds.ReleaseLock("locked-app", lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeploymentState_refreshLock(t *testing.T) {
+	ds, tearDown := testLocalDeploymentState(t)
+	defer tearDown()
+
+	bob := &schema.DeployPilot{AWSApiCaller: "arn:aws:iam::123456789012:user/Bob"}
+	lock, err := ds.AcquireLock("long-app", bob, "shift-traffic", "", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ds.RefreshLock("long-app", lock, DefaultLockTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heldLock, err := ds.GetLock("long-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !heldLock.ExpiresAt.Equal(lock.ExpiresAt) || heldLock.ExpiresAt.Before(time.Now().Add(time.Hour)) {
+		t.Fatalf("Expected lock to be extended to %s, given: %s", lock.ExpiresAt, heldLock.ExpiresAt)
+	}
+
+	// Lock which expired & was taken over can neither be refreshed nor released
+	err = ds.RefreshLock("long-app", lock, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := &schema.DeployPilot{AWSApiCaller: "arn:aws:iam::123456789012:user/Alice"}
+	_, err = ds.AcquireLock("long-app", alice, "deploy", "", DefaultLockTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ds.RefreshLock("long-app", lock, DefaultLockTTL)
+	if err == nil {
+		t.Fatal("Expected error when refreshing lock which was taken over")
+	}
+	err = ds.ReleaseLock("long-app", lock)
+	if err == nil || !strings.Contains(err.Error(), "was taken over") {
+		t.Fatalf("Expected error about lock being taken over, given: %v", err)
+	}
+}
+
+func testLocalDeploymentState(t *testing.T) (*DeploymentState, func()) {
+	dir, err := ioutil.TempDir("", "rt-deployment-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds := &DeploymentState{}
+	b, err := ds.loadBackend("local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Initialize(map[string]interface{}{"path": dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ready, err := ds.AreBackendsReady()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ready {
+		t.Fatal("Expected local backend to be ready")
+	}
+
+	return ds, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestMigrateApplication(t *testing.T) {
+	source, tearDownSource := testLocalDeploymentState(t)
+	defer tearDownSource()
+	target, tearDownTarget := testLocalDeploymentState(t)
+	defer tearDownTarget()
+
+	startTime := time.Date(2016, time.March, 30, 14, 4, 5, 0, time.UTC)
+	err := source.SaveApplication("migrated-app", &schema.ApplicationData{
+		IsActive:     true,
+		SlotCounters: map[string]int64{"blue": 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, slotId := range []string{"blue", "blue-2"} {
+		err := source.SaveSlot("migrated-app", slotId, &schema.SlotData{
+			IsActive:                true,
+			LastDeploymentStartTime: startTime,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			deploymentId := fmt.Sprintf("%020d", 1000+i)
+			err := source.SaveDeployment("migrated-app", slotId, deploymentId, &schema.DeploymentData{
+				StartTime: startTime.Add(time.Duration(i) * time.Minute),
+				RTVersion: "0.1.0",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Dry run doesn't write anything
+	m, err := source.MigrateApplication("migrated-app", target, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Count(RecordCopied) != 9 {
+		t.Fatalf("Expected 9 records to be copied, given: %d", m.Count(RecordCopied))
+	}
+	_, err = target.GetApplication("migrated-app")
+	if _, ok := err.(*backends.AppNotFound); !ok {
+		t.Fatalf("Expected app not to be found in target after dry run, given: %v", err)
+	}
+
+	m, err = source.MigrateApplication("migrated-app", target, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Count(RecordCopied) != 9 {
+		t.Fatalf("Expected 9 records to be copied, given: %d", m.Count(RecordCopied))
+	}
+	if m.Records[len(m.Records)-1].Kind != "application" {
+		t.Fatalf("Expected application to be copied last, given: %#v", m.Records[len(m.Records)-1])
+	}
+	summary, err := source.VerifyMigration("migrated-app", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Slots != 2 || summary.Deployments != 6 {
+		t.Fatalf("Expected 2 slots & 6 deployments, given: %s", summary)
+	}
+
+	// Resuming skips what's already there and overwrites what differs
+	err = target.SaveSlot("migrated-app", "blue-2", &schema.SlotData{IsActive: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = source.VerifyMigration("migrated-app", target)
+	if err == nil {
+		t.Fatal("Expected verification to fail when slot differs")
+	}
+	m, err = source.MigrateApplication("migrated-app", target, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Count(RecordSkipped) != 8 || m.Count(RecordOverwritten) != 1 {
+		t.Fatalf("Expected 8 records skipped & 1 overwritten, given: %d & %d",
+			m.Count(RecordSkipped), m.Count(RecordOverwritten))
+	}
+	_, err = source.VerifyMigration("migrated-app", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Records only present in target are reported
+	err = target.SaveDeployment("migrated-app", "blue", fmt.Sprintf("%020d", 999), &schema.DeploymentData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = source.VerifyMigration("migrated-app", target)
+	if err == nil {
+		t.Fatal("Expected verification to fail with extra deployment in target")
+	}
+}
+
+func TestCheckAndRepairApplication(t *testing.T) {
+	ds, tearDown := testMultiBackendDeploymentState(t)
+	defer tearDown()
+
+	startTime := time.Date(2016, time.March, 30, 14, 4, 5, 0, time.UTC)
+	pilot := &schema.DeployPilot{AWSApiCaller: "arn:aws:iam::123456789012:user/Bob"}
+	err := ds.SaveApplication("checked-app", &schema.ApplicationData{IsActive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ds.BeginDeployment("checked-app", "blue", false, pilot, "0.12.29", startTime, map[string]string{}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err := ds.CheckApplication("checked-app", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Fatalf("Expected no differences, given: %d", len(diffs))
+	}
+
+	// Simulate a deployment which only made it to the first backend
+	local := &DeploymentState{backendList: ds.backendList[:1]}
+	err = local.SaveSlot("checked-app", "green", &schema.SlotData{IsActive: true, LastDeploymentStartTime: startTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = local.SaveApplication("checked-app", &schema.ApplicationData{IsActive: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err = ds.CheckApplication("checked-app", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedDiffs := []*RecordDiff{
+		{"checked-app", "slot", "green", "dynamodb", RecordMissing},
+		{"checked-app", "application", "checked-app", "dynamodb", RecordDifferent},
+	}
+	if !reflect.DeepEqual(diffs, expectedDiffs) {
+		t.Fatalf("Differences don't match.\nExpected: %#v\nGiven: %#v", expectedDiffs, diffs)
+	}
+
+	// From the point of view of the other backend the slot is extra
+	diffs, err = ds.CheckApplication("checked-app", "dynamodb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 || diffs[1].Problem != RecordExtra || diffs[1].Backend != "local" {
+		t.Fatalf("Expected extra slot in local backend, given: %#v", diffs)
+	}
+
+	_, err = ds.CheckApplication("checked-app", "s3")
+	if err == nil {
+		t.Fatal("Expected error for backend which isn't configured")
+	}
+
+	repairs, err := ds.RepairApplication("checked-app", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := repairs["dynamodb"]
+	if m.Count(RecordCopied) != 1 || m.Count(RecordOverwritten) != 1 {
+		t.Fatalf("Expected 1 record copied & 1 overwritten, given: %d & %d",
+			m.Count(RecordCopied), m.Count(RecordOverwritten))
+	}
+	diffs, err = ds.CheckApplication("checked-app", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Fatalf("Expected no differences after repair, given: %#v", diffs)
+	}
+}
+
+func testMultiBackendDeploymentState(t *testing.T) (*DeploymentState, func()) {
+	ds, tearDownLocal := testLocalDeploymentState(t)
+
+	standIn := backendstest.NewDynamoDBStandIn()
+	config := standIn.BackendConfig("rt-deployment-state", "test")
+	err := backendstest.CreateDynamoDBTable(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ds.loadBackend("dynamodb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Initialize(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ds, func() {
+		standIn.Close()
+		tearDownLocal()
+	}
+}
+
+func TestGenerateUniqueDeploymentId(t *testing.T) {
+	now := time.Date(2016, time.March, 30, 14, 4, 5, 123456789, time.UTC)
+	legacyId := fmt.Sprintf("%020d", math.MaxInt64-int(now.Add(-1*time.Hour).Unix()))
+
+	first, err := generateUniqueDeploymentId(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := generateUniqueDeploymentId(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatalf("Expected IDs generated at the same time to differ, given: %q", first)
+	}
+	later, err := generateUniqueDeploymentId(now.Add(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{legacyId, first, later}
+	sort.Strings(ids)
+	expectedIds := []string{later, first, legacyId}
+	if !reflect.DeepEqual(ids, expectedIds) {
+		t.Fatalf("Expected newest first.\nExpected: %q\nGiven: %q", expectedIds, ids)
+	}
+	for _, id := range ids {
+		if strings.Contains(id, "-") {
+			t.Fatalf("Deployment ID must not contain dashes: %q", id)
+		}
+	}
+}
+
+func TestBeginDeployment_sameSecond(t *testing.T) {
+	ds, tearDown := testLocalDeploymentState(t)
+	defer tearDown()
+
+	legacyTime := time.Date(2016, time.March, 30, 14, 4, 5, 0, time.UTC)
+	legacyId := fmt.Sprintf("%020d", math.MaxInt64-int(legacyTime.Unix()))
+	err := ds.SaveDeployment("retried-app", "blue", legacyId, &schema.DeploymentData{StartTime: legacyTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pilot := &schema.DeployPilot{AWSApiCaller: "arn:aws:iam::123456789012:user/Bob"}
+	startTime := time.Now().UTC()
+	var ids []string
+	for i := 0; i < 3; i++ {
+		d, err := ds.BeginDeployment("retried-app", "blue", false, pilot, "0.12.29", startTime, map[string]string{}, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, d.DeploymentId)
+	}
+
+	deployments, err := ds.ListLastDeployments("retried-app", "blue", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deployments) != 4 {
+		t.Fatalf("Expected 4 deployments, given: %d", len(deployments))
+	}
+	if deployments[3].DeploymentId != legacyId {
+		t.Fatalf("Expected legacy deployment to be last, given: %q", deployments[3].DeploymentId)
+	}
+	listedIds := []string{deployments[0].DeploymentId, deployments[1].DeploymentId, deployments[2].DeploymentId}
+	sort.Strings(ids)
+	sort.Strings(listedIds)
+	if !reflect.DeepEqual(listedIds, ids) {
+		t.Fatalf("Deployments don't match.\nExpected: %q\nGiven: %q", ids, listedIds)
+	}
+}
+
+func TestDeploymentStatus(t *testing.T) {
+	ds, tearDown := testLocalDeploymentState(t)
+	defer tearDown()
+
+	pilot := &schema.DeployPilot{AWSApiCaller: "arn:aws:iam::123456789012:user/Bob"}
+	startTime := time.Now().UTC().Add(-3 * time.Hour)
+
+	cases := []struct {
+		SlotId         string
+		TfRun          *schema.FinishedTerraformRun
+		ExpectedStatus string
+	}{
+		{"succeeded", &schema.FinishedTerraformRun{FinishTime: startTime}, schema.DeploymentSucceeded},
+		{"failed", &schema.FinishedTerraformRun{FinishTime: startTime, ExitCode: 1}, schema.DeploymentFailed},
+		{"interrupted", &schema.FinishedTerraformRun{FinishTime: startTime, ExitCode: 1, Interrupted: true},
+			schema.DeploymentInterrupted},
+		{"crashed", nil, schema.DeploymentInProgress},
+	}
+	for _, c := range cases {
+		d, err := ds.BeginDeployment("status-app", c.SlotId, false, pilot, "0.12.29", startTime, map[string]string{}, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Status != schema.DeploymentInProgress {
+			t.Fatalf("%s: Expected deployment in progress, given: %q", c.SlotId, d.Status)
+		}
+		if c.TfRun != nil {
+			err = ds.FinishDeployment("status-app", c.SlotId, d.DeploymentId, true, d, c.TfRun)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		slot, err := ds.GetSlot("status-app", c.SlotId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if slot.GetLastDeploymentStatus() != c.ExpectedStatus || slot.LastDeploymentId != d.DeploymentId {
+			t.Fatalf("%s: Expected slot with last deployment %s %q, given: %s %q", c.SlotId,
+				d.DeploymentId, c.ExpectedStatus, slot.LastDeploymentId, slot.GetLastDeploymentStatus())
+		}
+		deployment, err := ds.GetDeployment("status-app", c.SlotId, d.DeploymentId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deployment.GetStatus() != c.ExpectedStatus {
+			t.Fatalf("%s: Expected deployment status %q, given: %q", c.SlotId, c.ExpectedStatus, deployment.GetStatus())
+		}
+	}
+
+	// Recent deployments aren't stale yet
+	_, err := ds.BeginDeployment("status-app", "running", false, pilot, "0.12.29", time.Now().UTC(), map[string]string{}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stale, err := ds.ListStaleDeployments("status-app", time.Now().Add(-2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 || stale["crashed"] == nil {
+		t.Fatalf("Expected only crashed deployment to be stale, given: %#v", stale)
+	}
+
+	alice := &schema.DeployPilot{AWSApiCaller: "arn:aws:iam::123456789012:user/Alice"}
+	err = ds.AbandonDeployment("status-app", "crashed", stale["crashed"].DeploymentId, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment, err := ds.GetDeployment("status-app", "crashed", stale["crashed"].DeploymentId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployment.GetStatus() != schema.DeploymentAbandoned || deployment.Abandoned.By.AWSApiCaller != alice.AWSApiCaller {
+		t.Fatalf("Expected deployment abandoned by Alice, given: %q %#v", deployment.GetStatus(), deployment.Abandoned)
+	}
+	slot, err := ds.GetSlot("status-app", "crashed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slot.GetLastDeploymentStatus() != schema.DeploymentAbandoned {
+		t.Fatalf("Expected slot status %q, given: %q", schema.DeploymentAbandoned, slot.GetLastDeploymentStatus())
+	}
+	if slot.IsActive {
+		t.Fatal("Expected slot whose first deployment was abandoned to be inactive")
+	}
+
+	stale, err = ds.ListStaleDeployments("status-app", time.Now().Add(-2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 0 {
+		t.Fatalf("Expected no stale deployments after abandoning, given: %d", len(stale))
+	}
+
+	err = ds.AbandonDeployment("status-app", "crashed", deployment.DeploymentId, alice)
+	if err == nil {
+		t.Fatal("Expected error when abandoning deployment which isn't in progress")
+	}
+}
+
+func TestAbandonDeployment_keepsDeployedSlotActive(t *testing.T) {
+	ds, tearDown := testMultiBackendDeploymentState(t)
+	defer tearDown()
+
+	pilot := &schema.DeployPilot{AWSApiCaller: "arn:aws:iam::123456789012:user/Bob"}
+	startTime := time.Now().Add(-3 * time.Hour).UTC()
+
+	d, err := ds.BeginDeployment("abandon-app", "blue", false, pilot, "0.12.29", startTime, map[string]string{}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ds.FinishDeployment("abandon-app", "blue", d.DeploymentId, true, d,
+		&schema.FinishedTerraformRun{FinishTime: startTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = ds.BeginDeployment("abandon-app", "blue", false, pilot, "0.12.29", startTime, map[string]string{}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ds.AbandonDeployment("abandon-app", "blue", d.DeploymentId, pilot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slot, err := ds.GetSlot("abandon-app", "blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slot.IsActive {
+		t.Fatal("Expected previously deployed slot to stay active after abandoning a redeploy")
+	}
+}
+
+func TestBeginDeployment_inProgressRecord(t *testing.T) {
+	ds, tearDown := testMultiBackendDeploymentState(t)
+	defer tearDown()
+
+	pilot := &schema.DeployPilot{AWSApiCaller: "arn:aws:iam::123456789012:user/Bob"}
+	d, err := ds.BeginDeployment("rollback-app", "blue", false, pilot, "0.12.29", time.Now().UTC(),
+		map[string]string{}, "0123456789abcdef", "1234567100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing but the initial record is saved if RT dies during apply
+	deployment, err := ds.GetDeployment("rollback-app", "blue", d.DeploymentId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployment.ConfigChecksum != "0123456789abcdef" || deployment.RollbackOf != "1234567100" {
+		t.Fatalf("Expected checksum & rollback saved with deployment in progress, given: %q %q",
+			deployment.ConfigChecksum, deployment.RollbackOf)
+	}
+}
+
+func TestDeploymentChanges(t *testing.T) {
+	ds, tearDown := testMultiBackendDeploymentState(t)
+	defer tearDown()
+
+	pilot := &schema.DeployPilot{AWSApiCaller: "arn:aws:iam::123456789012:user/Bob"}
+	startTime := time.Now().UTC()
+
+	d, err := ds.BeginDeployment("changes-app", "blue", false, pilot, "0.12.29", startTime, map[string]string{}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Terraform.TerraformVersion != "0.12.29" {
+		t.Fatalf("Expected Terraform version to be recorded, given: %q", d.Terraform.TerraformVersion)
+	}
+	expectedChanges := []*terraform.ResourceChange{
+		{
+			Address: "aws_instance.web",
+			Type:    "aws_instance",
+			Action:  terraform.ActionUpdate,
+			Before:  map[string]interface{}{"instance_type": "t2.micro"},
+			After:   map[string]interface{}{"instance_type": "t2.small"},
+		},
+	}
+	err = ds.FinishDeployment("changes-app", "blue", d.DeploymentId, true, d, &schema.FinishedTerraformRun{
+		FinishTime:      startTime,
+		ResourceChanges: expectedChanges,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := ds.GetDeploymentChanges("changes-app", "blue", d.DeploymentId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changes.ResourceChanges, expectedChanges) {
+		t.Fatalf("Expected changes: %#v\nGiven: %#v", expectedChanges, changes.ResourceChanges)
+	}
+
+	// Changes are kept out of the slot
+	slot, err := ds.GetSlot("changes-app", "blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := slot.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "aws_instance.web") {
+		t.Fatalf("Expected no resource changes in slot, given: %s", b)
+	}
+
+	d, err = ds.BeginDeployment("changes-app", "blue", false, pilot, "0.12.29", startTime, map[string]string{}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ds.FinishDeployment("changes-app", "blue", d.DeploymentId, true, d, &schema.FinishedTerraformRun{
+		FinishTime: startTime,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ds.GetDeploymentChanges("changes-app", "blue", d.DeploymentId)
+	if _, ok := err.(*backends.DeploymentChangesNotFound); !ok {
+		t.Fatalf("Expected DeploymentChangesNotFound, given: %#v", err)
+	}
+}
+
+func TestRecordTrafficShift(t *testing.T) {
+	ds, tearDown := testLocalDeploymentState(t)
+	defer tearDown()
+
+	pilot := &schema.DeployPilot{AWSApiCaller: "arn:aws:iam::123456789012:user/Bob"}
+	d, err := ds.BeginDeployment("shift-app", "green", false, pilot, "0.12.29", time.Now().UTC(), map[string]string{}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := []*schema.TrafficShiftEvent{
+		{By: pilot, At: time.Now().UTC(), Percent: 10, Status: schema.TrafficShifted},
+		{By: pilot, At: time.Now().UTC(), Percent: 10, Status: schema.TrafficShiftReverted, Error: "unhealthy"},
+	}
+	for _, e := range events {
+		err = ds.RecordTrafficShift("shift-app", "green", d.DeploymentId, e)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deployment, err := ds.GetDeployment("shift-app", "green", d.DeploymentId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deployment.TrafficShifts) != 2 {
+		t.Fatalf("Expected 2 traffic shifts, given: %d", len(deployment.TrafficShifts))
+	}
+	if deployment.TrafficShifts[1].Status != schema.TrafficShiftReverted || deployment.TrafficShifts[1].Error != "unhealthy" {
+		t.Fatalf("Expected reverted shift last, given: %#v", deployment.TrafficShifts[1])
+	}
+}
+
+func TestRecordTrafficEvent(t *testing.T) {
+	ds, tearDown := testLocalDeploymentState(t)
+	defer tearDown()
+
+	pilot := &schema.DeployPilot{AWSApiCaller: "arn:aws:iam::123456789012:user/Bob", IPAddress: "10.0.0.1"}
+	_, err := ds.BeginDeployment("traffic-app", "v42", false, pilot, "0.12.29", time.Now().UTC(), map[string]string{}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < maxTrafficEventsKept+1; i++ {
+		direction := schema.TrafficEnabled
+		if i%2 == 1 {
+			direction = schema.TrafficDisabled
+		}
+		err = ds.RecordTrafficEvent("traffic-app", "v42", &schema.TrafficEvent{
+			By:        pilot,
+			At:        time.Now().UTC(),
+			Direction: direction,
+			Command:   "enable-traffic",
+			Balancers: []string{"ELB traffic-app"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	slot, err := ds.GetSlot("traffic-app", "v42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slot.TrafficEvents) != maxTrafficEventsKept {
+		t.Fatalf("Expected %d traffic events kept, given: %d", maxTrafficEventsKept, len(slot.TrafficEvents))
+	}
+	last := slot.TrafficEvents[len(slot.TrafficEvents)-1]
+	if last.Direction != schema.TrafficEnabled || last.By.IPAddress != "10.0.0.1" {
+		t.Fatalf("Expected last event enabling traffic, given: %#v", last)
+	}
+	if slot.LastDeploymentId == "" {
+		t.Fatal("Expected slot data to be kept along with traffic events")
+	}
+}
@@ -0,0 +1,272 @@
+package deploymentstate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/backends"
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/schema"
+)
+
+// Actions taken on records during migration
+const (
+	RecordCopied      = "copied"
+	RecordOverwritten = "overwritten"
+	RecordSkipped     = "skipped"
+)
+
+// MigratedRecord describes what happened to a single record
+// (application, slot or deployment) during migration
+type MigratedRecord struct {
+	Kind   string
+	Id     string
+	Action string
+}
+
+type ApplicationMigration struct {
+	AppName string
+	Records []*MigratedRecord
+}
+
+// Count returns number of records which the given action was taken on
+func (m *ApplicationMigration) Count(action string) int {
+	count := 0
+	for _, r := range m.Records {
+		if r.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// StateSummary allows comparing all records of an app between two deployment states
+type StateSummary struct {
+	AppName     string
+	Slots       int
+	Deployments int
+	Checksum    string
+}
+
+func (s *StateSummary) String() string {
+	return fmt.Sprintf("%d slots, %d deployments, checksum %s", s.Slots, s.Deployments, s.Checksum)
+}
+
+type stateRecord struct {
+	kind     string
+	id       string
+	checksum string
+
+	slotId     string
+	app        *schema.ApplicationData
+	slot       *schema.SlotData
+	deployment *schema.DeploymentData
+	changes    *schema.DeploymentChangesData
+}
+
+func (r *stateRecord) key() string {
+	return r.kind + "/" + r.id
+}
+
+func (r *stateRecord) saveTo(ds *DeploymentState, appName string) error {
+	switch r.kind {
+	case "application":
+		return ds.SaveApplication(appName, r.app)
+	case "slot":
+		return ds.SaveSlot(appName, r.slotId, r.slot)
+	case "deployment":
+		return ds.SaveDeployment(appName, r.slotId, r.deployment.DeploymentId, r.deployment)
+	case "changes":
+		return ds.SaveDeploymentChanges(appName, r.slotId, r.changes.DeploymentId, r.changes)
+	}
+	return fmt.Errorf("Unknown record kind: %q", r.kind)
+}
+
+// MigrateApplication copies the application with all its slots and deployments
+// into the target deployment state. Records already present in the target
+// with the same content are skipped, so an interrupted migration can be resumed.
+// Application data is saved last, so its presence in the target means
+// all slots & deployments were copied.
+func (ds *DeploymentState) MigrateApplication(appName string, target *DeploymentState, dryRun bool) (*ApplicationMigration, error) {
+	sourceRecords, err := ds.applicationRecords(appName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %q from source: %s", appName, err)
+	}
+	targetRecords, err := target.applicationRecords(appName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %q from target: %s", appName, err)
+	}
+	existing := make(map[string]string, len(targetRecords))
+	for _, r := range targetRecords {
+		existing[r.key()] = r.checksum
+	}
+
+	m := &ApplicationMigration{AppName: appName}
+	for _, r := range sourceRecords {
+		action := RecordCopied
+		if checksum, ok := existing[r.key()]; ok {
+			if checksum == r.checksum {
+				m.Records = append(m.Records, &MigratedRecord{r.kind, r.id, RecordSkipped})
+				continue
+			}
+			action = RecordOverwritten
+		}
+
+		if !dryRun {
+			err := r.saveTo(target, appName)
+			if err != nil {
+				return m, fmt.Errorf("Failed to save %s %q of %q: %s", r.kind, r.id, appName, err)
+			}
+		}
+		m.Records = append(m.Records, &MigratedRecord{r.kind, r.id, action})
+	}
+
+	return m, nil
+}
+
+// VerifyMigration compares counts and checksums of all records
+// of a given app between this and the target deployment state
+func (ds *DeploymentState) VerifyMigration(appName string, target *DeploymentState) (*StateSummary, error) {
+	source, err := ds.SummarizeApplication(appName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to summarize %q in source: %s", appName, err)
+	}
+	migrated, err := target.SummarizeApplication(appName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to summarize %q in target: %s", appName, err)
+	}
+
+	if *source != *migrated {
+		return source, fmt.Errorf("Verification of %q failed.\nSource: %s\nTarget: %s",
+			appName, source, migrated)
+	}
+
+	return source, nil
+}
+
+// SummarizeApplication counts slots & deployments of an app
+// and calculates a single checksum of all its records
+func (ds *DeploymentState) SummarizeApplication(appName string) (*StateSummary, error) {
+	records, err := ds.applicationRecords(appName)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &StateSummary{AppName: appName}
+	lines := make([]string, len(records))
+	for i, r := range records {
+		switch r.kind {
+		case "slot":
+			summary.Slots++
+		case "deployment":
+			summary.Deployments++
+		}
+		lines[i] = r.key() + " " + r.checksum + "\n"
+	}
+	sort.Strings(lines)
+
+	h := sha256.New()
+	for _, l := range lines {
+		h.Write([]byte(l))
+	}
+	summary.Checksum = hex.EncodeToString(h.Sum(nil))
+
+	return summary, nil
+}
+
+// applicationRecords reads all records of a given app,
+// deployments (preceded by their changes) first, application data last.
+// A missing app yields no records.
+func (ds *DeploymentState) applicationRecords(appName string) ([]*stateRecord, error) {
+	records := make([]*stateRecord, 0)
+
+	slots, err := ds.ListSlots(appName)
+	if err != nil {
+		return nil, err
+	}
+	for _, slot := range slots {
+		deployments, err := ds.ListLastDeployments(appName, slot.SlotId, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range deployments {
+			changes, err := ds.GetDeploymentChanges(appName, slot.SlotId, d.DeploymentId)
+			if err != nil {
+				if _, ok := err.(*backends.DeploymentChangesNotFound); !ok {
+					return nil, err
+				}
+			}
+			if changes != nil {
+				checksum, err := recordChecksum(changes)
+				if err != nil {
+					return nil, err
+				}
+				records = append(records, &stateRecord{
+					kind:     "changes",
+					id:       slot.SlotId + "/" + d.DeploymentId,
+					checksum: checksum,
+					slotId:   slot.SlotId,
+					changes:  changes,
+				})
+			}
+
+			checksum, err := recordChecksum(d)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, &stateRecord{
+				kind:       "deployment",
+				id:         slot.SlotId + "/" + d.DeploymentId,
+				checksum:   checksum,
+				slotId:     slot.SlotId,
+				deployment: d,
+			})
+		}
+
+		checksum, err := recordChecksum(slot)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, &stateRecord{
+			kind:     "slot",
+			id:       slot.SlotId,
+			checksum: checksum,
+			slotId:   slot.SlotId,
+			slot:     slot,
+		})
+	}
+
+	app, err := ds.GetApplication(appName)
+	if err != nil {
+		if _, ok := err.(*backends.AppNotFound); ok {
+			return records, nil
+		}
+		return nil, err
+	}
+	checksum, err := recordChecksum(app)
+	if err != nil {
+		return nil, err
+	}
+	records = append(records, &stateRecord{
+		kind:     "application",
+		id:       appName,
+		checksum: checksum,
+		app:      app,
+	})
+
+	return records, nil
+}
+
+type jsonRecord interface {
+	ToJSON() ([]byte, error)
+}
+
+func recordChecksum(r jsonRecord) (string, error) {
+	b, err := r.ToJSON()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
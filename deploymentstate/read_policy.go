@@ -0,0 +1,127 @@
+package deploymentstate
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/deploymentstate/backends"
+	"github.com/hashicorp/go-multierror"
+)
+
+// Read policies decide which backend(s) READ operations use
+const (
+	// Only the first configured backend is read from
+	ReadPolicyPrimary = "primary"
+	// Backends are tried in the configured order until one succeeds
+	ReadPolicyFallback = "fallback"
+	// All backends are read from and the majority has to agree
+	ReadPolicyQuorum = "quorum"
+)
+
+const readPolicyKey = "read_policy"
+
+var supportedReadPolicies = []string{ReadPolicyPrimary, ReadPolicyFallback, ReadPolicyQuorum}
+
+type readFunc func(b *backends.BackendFactory) (interface{}, error)
+
+type readResult struct {
+	value interface{}
+	err   error
+	votes []string
+}
+
+// read runs a given READ operation according to the configured read policy
+func (ds *DeploymentState) read(f readFunc) (interface{}, error) {
+	if len(ds.backendList) < 1 {
+		return nil, fmt.Errorf("No backend found: %v", ds.backendList)
+	}
+
+	switch ds.readPolicy {
+	case ReadPolicyFallback:
+		return ds.readWithFallback(f)
+	case ReadPolicyQuorum:
+		return ds.readWithQuorum(f)
+	}
+
+	return f(ds.backendList[0])
+}
+
+func (ds *DeploymentState) readWithFallback(f readFunc) (interface{}, error) {
+	var _errors error
+	for _, b := range ds.backendList {
+		v, err := f(b)
+		if err == nil || isNotFound(err) {
+			return v, err
+		}
+		log.Printf("[WARN] Reading from backend %s failed, trying next one: %s", b.Name, err)
+		_errors = multierror.Append(_errors, fmt.Errorf("%s: %s", b.Name, err))
+	}
+
+	return nil, _errors
+}
+
+func (ds *DeploymentState) readWithQuorum(f readFunc) (interface{}, error) {
+	needed := len(ds.backendList)/2 + 1
+
+	var _errors error
+	results := make([]*readResult, 0)
+	for _, b := range ds.backendList {
+		v, err := f(b)
+		if err != nil && !isNotFound(err) {
+			log.Printf("[WARN] Reading from backend %s failed: %s", b.Name, err)
+			_errors = multierror.Append(_errors, fmt.Errorf("%s: %s", b.Name, err))
+			continue
+		}
+
+		var result *readResult
+		for _, r := range results {
+			if r.matches(v, err) {
+				result = r
+				break
+			}
+		}
+		if result == nil {
+			result = &readResult{value: v, err: err}
+			results = append(results, result)
+		}
+		result.votes = append(result.votes, b.Name)
+
+		if len(result.votes) >= needed {
+			return result.value, result.err
+		}
+	}
+
+	if len(results) > 1 {
+		_errors = multierror.Append(_errors, fmt.Errorf("backends returned %d different results", len(results)))
+	}
+	return nil, fmt.Errorf("No quorum reached (%d of %d backends need to agree): %s",
+		needed, len(ds.backendList), _errors)
+}
+
+func (r *readResult) matches(v interface{}, err error) bool {
+	if err != nil || r.err != nil {
+		return err != nil && r.err != nil && err.Error() == r.err.Error()
+	}
+	return reflect.DeepEqual(r.value, v)
+}
+
+// isNotFound tells whether the error is a valid answer
+// (i.e. data doesn't exist) rather than backend failure
+func isNotFound(err error) bool {
+	switch err.(type) {
+	case *backends.AppNotFound, *backends.SlotNotFound, *backends.LockNotFound,
+		*backends.DeploymentNotFound, *backends.DeploymentChangesNotFound, *backends.PlanNotFound:
+		return true
+	}
+	return false
+}
+
+func isReadPolicySupported(policy string) bool {
+	for _, p := range supportedReadPolicies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
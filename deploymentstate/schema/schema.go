@@ -21,12 +21,18 @@ type ApplicationData struct {
 	UseCentralGitRepo bool `json:"use_central_git_repo"`
 
 	IsActive             bool              `json:"is_active"`
-	InfraOutputs         map[string]string `json:"infra_outputs"`
+	InfraOutputs         terraform.Outputs `json:"infra_outputs"`
 	LastRtVersion        string            `json:"last_rt_version"`
 	LastTerraformVersion string            `json:"last_terraform_version"`
 	LastDeploymentTime   time.Time         `json:"last_deployment_time,omitempty"`
 	LastInfraChangeTime  time.Time         `json:"last_infra_change_time"`
 	SlotCounters         map[string]int64  `json:"slot_counters,omitempty"`
+
+	// Variables the infra was last applied with (empty until the first apply-infra recording them)
+	InfraVariables map[string]string `json:"infra_variables,omitempty"`
+
+	// Audit trail of locks broken via force-unlock, newest last
+	ForcedUnlocks []*ForcedUnlockData `json:"forced_unlocks,omitempty"`
 }
 
 func (a *ApplicationData) ToJSON() ([]byte, error) {
@@ -49,6 +55,13 @@ func (a *ApplicationData) FromJSON(data []byte) error {
 			}
 			return a.FromJSON(migratedData)
 		}
+		if sv.Version == 1 {
+			migratedData, err := migrateApplication_v1_to_v2(data)
+			if err != nil {
+				return fmt.Errorf("Application schema migration from v1 to v2 failed: %s", err)
+			}
+			return a.FromJSON(migratedData)
+		}
 		return fmt.Errorf("No migrations available for application schema v%d", sv.Version)
 	}
 
@@ -71,6 +84,38 @@ type SlotData struct {
 	LastDeploymentStartTime time.Time     `json:"last_deployment_start_time"`
 	LastDeployPilot         *DeployPilot  `json:"last_deploy_pilot,omitempty"`
 	LastTerraformRun        *TerraformRun `json:"last_terraform_run"`
+
+	LastDeploymentId     string `json:"last_deployment_id,omitempty"`
+	LastDeploymentStatus string `json:"last_deployment_status,omitempty"`
+
+	// LastTerraformVersion is version of Terraform the slot's state was last written by
+	LastTerraformVersion string `json:"last_terraform_version,omitempty"`
+
+	// Balancers attached to/detached from the slot by traffic commands, newest last
+	TrafficEvents []*TrafficEvent `json:"traffic_events,omitempty"`
+}
+
+// GetLastDeploymentStatus returns status of the last deployment,
+// which is derived from the last Terraform run for slots
+// deployed before statuses were recorded
+func (s *SlotData) GetLastDeploymentStatus() string {
+	if s.LastDeploymentStatus != "" {
+		return s.LastDeploymentStatus
+	}
+	return statusOfTerraformRun(s.LastTerraformRun)
+}
+
+// GetLastTerraformVersion returns version of Terraform the slot was last
+// deployed with, which is derived from the last Terraform run for slots
+// deployed before versions were recorded
+func (s *SlotData) GetLastTerraformVersion() string {
+	if s.LastTerraformVersion != "" {
+		return s.LastTerraformVersion
+	}
+	if s.LastTerraformRun != nil {
+		return s.LastTerraformRun.TerraformVersion
+	}
+	return ""
 }
 
 func (s *SlotData) ToJSON() ([]byte, error) {
@@ -93,6 +138,13 @@ func (s *SlotData) FromJSON(data []byte) error {
 			}
 			return s.FromJSON(migratedData)
 		}
+		if sv.Version == 1 {
+			migratedData, err := migrateSlot_v1_to_v2(data)
+			if err != nil {
+				return fmt.Errorf("Slot schema migration from v1 to v2 failed: %s", err)
+			}
+			return s.FromJSON(migratedData)
+		}
 		return fmt.Errorf("No migrations available for slot schema v%d", sv.Version)
 	}
 
@@ -116,12 +168,32 @@ type DeploymentData struct {
 
 	RTVersion string `json:"rt_version"`
 
+	Status    string         `json:"status,omitempty"`
+	Abandoned *AbandonedData `json:"abandoned,omitempty"`
+
+	// ConfigChecksum is checksum of Terraform configs which were deployed
+	ConfigChecksum string `json:"config_checksum,omitempty"`
+	// RollbackOf is ID of the deployment this one rolled the slot back to
+	RollbackOf string `json:"rollback_of,omitempty"`
+
+	// Steps of shift-traffic to the deployed slot, oldest first
+	TrafficShifts []*TrafficShiftEvent `json:"traffic_shifts,omitempty"`
+
 	// TODO: Data+configuration of/from hooks
 	// See https://github.com/MeredithCorpOSS/ape-dev-rt/issues/138
 	// PreDeployHooks  []*Hook
 	// PostDeployHooks []*Hook
 }
 
+// GetStatus returns status of the deployment, which is derived
+// from the Terraform run for deployments recorded before statuses were
+func (d *DeploymentData) GetStatus() string {
+	if d.Status != "" {
+		return d.Status
+	}
+	return statusOfTerraformRun(d.Terraform)
+}
+
 func (d *DeploymentData) ToJSON() ([]byte, error) {
 	d.SchemaVersion = deploymentSchemaVersion
 	return json.Marshal(*d)
@@ -142,6 +214,13 @@ func (d *DeploymentData) FromJSON(data []byte) error {
 			}
 			return d.FromJSON(migratedData)
 		}
+		if sv.Version == 1 {
+			migratedData, err := migrateDeployment_v1_to_v2(data)
+			if err != nil {
+				return fmt.Errorf("Deployment schema migration from v1 to v2 failed: %s", err)
+			}
+			return d.FromJSON(migratedData)
+		}
 		return fmt.Errorf("No migrations available for deployment schema v%d", sv.Version)
 	}
 
@@ -154,6 +233,217 @@ func (d *DeploymentData) FromJSON(data []byte) error {
 	return json.Unmarshal(data, d)
 }
 
+// DeploymentChangesData holds resource-level changes of a single deployment.
+// It's stored separately from the deployment, so that deployment
+// and slot records (which embed the last Terraform run) stay small.
+type DeploymentChangesData struct {
+	SchemaVersion int    `json:"v"`
+	DeploymentId  string `json:"-"`
+
+	// Changes as planned before Terraform was run
+	ResourceChanges []*terraform.ResourceChange `json:"resource_changes"`
+}
+
+func (d *DeploymentChangesData) ToJSON() ([]byte, error) {
+	d.SchemaVersion = deploymentChangesSchemaVersion
+	return json.Marshal(*d)
+}
+
+func (d *DeploymentChangesData) FromJSON(data []byte) error {
+	sv := &_SchemaVersion{}
+	err := json.Unmarshal(data, sv)
+	if err != nil {
+		return err
+	}
+
+	if sv.Version < deploymentChangesSchemaVersion {
+		return fmt.Errorf("No migrations available for deployment changes schema v%d", sv.Version)
+	}
+
+	if sv.Version > deploymentChangesSchemaVersion {
+		return fmt.Errorf("Failed to process deployment changes (schema v%d). "+
+			"Please upgrade RT.", sv.Version)
+	}
+
+	return json.Unmarshal(data, d)
+}
+
+// Statuses of deployments
+const (
+	DeploymentInProgress  = "in_progress"
+	DeploymentSucceeded   = "succeeded"
+	DeploymentFailed      = "failed"
+	DeploymentInterrupted = "interrupted"
+	// Deployment which never finished (e.g. RT crashed) marked as such by hand
+	DeploymentAbandoned = "abandoned"
+)
+
+func statusOfTerraformRun(run *TerraformRun) string {
+	if run == nil || run.FinishTime.IsZero() {
+		return DeploymentInProgress
+	}
+	if run.ExitCode != 0 {
+		return DeploymentFailed
+	}
+	return DeploymentSucceeded
+}
+
+const (
+	TrafficShifted       = "shifted"
+	TrafficShiftAborted  = "aborted"
+	TrafficShiftReverted = "reverted"
+)
+
+// TrafficShiftEvent records a single step of shift-traffic
+type TrafficShiftEvent struct {
+	By      *DeployPilot `json:"by"`
+	At      time.Time    `json:"at"`
+	Percent int          `json:"percent"` // of traffic sent to the slot
+	Status  string       `json:"status"`
+	Error   string       `json:"error,omitempty"`
+}
+
+const (
+	TrafficEnabled  = "enabled"
+	TrafficDisabled = "disabled"
+	TrafficSplit    = "split"
+)
+
+// TrafficEvent records balancers being attached to (enabled)
+// or detached from (disabled) a slot, or traffic being left
+// split between slots by weights of target groups (split)
+type TrafficEvent struct {
+	By        *DeployPilot `json:"by"`
+	At        time.Time    `json:"at"`
+	Direction string       `json:"direction"`
+	Command   string       `json:"command"`
+	Balancers []string     `json:"balancers"`
+}
+
+// AbandonedData records who marked an unfinished deployment as abandoned
+type AbandonedData struct {
+	By *DeployPilot `json:"by"`
+	At time.Time    `json:"at"`
+}
+
+// LockData represents a write lock held over a single application
+// for the duration of an operation changing its deployment state
+type LockData struct {
+	SchemaVersion int `json:"v"`
+
+	AppName string `json:"-"`
+
+	LockId     string       `json:"lock_id"`
+	Holder     *DeployPilot `json:"holder,omitempty"`
+	Command    string       `json:"command"`
+	Reason     string       `json:"reason,omitempty"`
+	RTVersion  string       `json:"rt_version"`
+	AcquiredAt time.Time    `json:"acquired_at"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+}
+
+func (l *LockData) ToJSON() ([]byte, error) {
+	l.SchemaVersion = lockSchemaVersion
+	return json.Marshal(*l)
+}
+
+func (l *LockData) FromJSON(data []byte) error {
+	sv := &_SchemaVersion{}
+	err := json.Unmarshal(data, sv)
+	if err != nil {
+		return err
+	}
+
+	if sv.Version < lockSchemaVersion {
+		return fmt.Errorf("No migrations available for lock schema v%d", sv.Version)
+	}
+
+	if sv.Version > lockSchemaVersion {
+		return fmt.Errorf("Failed to process lock data (schema v%d). "+
+			"Please upgrade RT.", sv.Version)
+	}
+
+	return json.Unmarshal(data, l)
+}
+
+// IsExpired tells whether the lock outlived its TTL
+// and can be taken over by anyone else
+func (l *LockData) IsExpired(now time.Time) bool {
+	return !l.ExpiresAt.IsZero() && now.After(l.ExpiresAt)
+}
+
+// IsManual tells whether the lock was taken via the lock command
+// (e.g. for a maintenance window) rather than by a running operation
+func (l *LockData) IsManual() bool {
+	return l.Command == ManualLockCommand
+}
+
+// ManualLockCommand is recorded as the command of locks taken by hand
+const ManualLockCommand = "lock"
+
+// PlanData holds a Terraform plan saved by diff-deploy/diff-infra,
+// so that it can be reviewed and applied later exactly as planned
+type PlanData struct {
+	SchemaVersion int `json:"v"`
+
+	PlanId string `json:"-"`
+
+	// Empty for plans of application infrastructure
+	SlotId    string       `json:"slot_id,omitempty"`
+	CreatedBy *DeployPilot `json:"created_by,omitempty"`
+
+	PlanStartTime  time.Time `json:"plan_start_time"`
+	PlanFinishTime time.Time `json:"plan_finish_time"`
+
+	Variables        map[string]string `json:"variables"`
+	RTVersion        string            `json:"rt_version"`
+	TerraformVersion string            `json:"terraform_version"`
+
+	// Checksum of Terraform configs (after processing templates)
+	ConfigChecksum string `json:"config_checksum"`
+
+	// Last change of the slot/infrastructure at the time of planning,
+	// the plan is refused if any change happened since
+	LastDeploymentId    string    `json:"last_deployment_id,omitempty"`
+	LastInfraChangeTime time.Time `json:"last_infra_change_time,omitempty"`
+
+	Diff *terraform.PlanResourceDiff `json:"diff"`
+
+	// Planfile as written by `terraform plan -out`
+	Planfile []byte `json:"planfile"`
+}
+
+func (p *PlanData) ToJSON() ([]byte, error) {
+	p.SchemaVersion = planSchemaVersion
+	return json.Marshal(*p)
+}
+
+func (p *PlanData) FromJSON(data []byte) error {
+	sv := &_SchemaVersion{}
+	err := json.Unmarshal(data, sv)
+	if err != nil {
+		return err
+	}
+
+	if sv.Version < planSchemaVersion {
+		return fmt.Errorf("No migrations available for plan schema v%d", sv.Version)
+	}
+
+	if sv.Version > planSchemaVersion {
+		return fmt.Errorf("Failed to process plan data (schema v%d). "+
+			"Please upgrade RT.", sv.Version)
+	}
+
+	return json.Unmarshal(data, p)
+}
+
+// ForcedUnlockData records a lock which was broken by someone
+type ForcedUnlockData struct {
+	Lock     *LockData    `json:"lock"`
+	BrokenBy *DeployPilot `json:"broken_by"`
+	BrokenAt time.Time    `json:"broken_at"`
+}
+
 type DeployPilot struct {
 	AWSApiCaller string `json:"aws_api_caller"` // IAM/STS ARN
 	IPAddress    string `json:"ip_address"`
@@ -168,7 +458,7 @@ type TerraformRun struct {
 
 	ResourceDiff *terraform.ResourceDiff `json:"resource_diff,omitempty"`
 	Variables    map[string]string       `json:"variables"`
-	Outputs      map[string]string       `json:"outputs"`
+	Outputs      terraform.Outputs       `json:"outputs"`
 
 	TerraformVersion string `json:"terraform_version"`
 
@@ -184,9 +474,15 @@ type FinishedTerraformRun struct {
 	FinishTime     time.Time `json:"finish_time"`
 
 	ResourceDiff *terraform.ResourceDiff `json:"resource_diff,omitempty"`
-	Outputs      map[string]string       `json:"outputs"`
+	Outputs      terraform.Outputs       `json:"outputs"`
+
+	// Changes as planned before Terraform was run
+	ResourceChanges []*terraform.ResourceChange `json:"resource_changes,omitempty"`
 
 	ExitCode int      `json:"exit_code,omitempty"`
 	Warnings []string `json:"warnings,omitempty"`
 	Stderr   string   `json:"stderr,omitempty"`
+
+	// Whether Terraform was stopped by SIGINT/SIGTERM
+	Interrupted bool `json:"interrupted,omitempty"`
 }
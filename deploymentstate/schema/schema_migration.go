@@ -1,15 +1,23 @@
 package schema
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"log"
 	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/terraform"
 )
 
 const (
-	applicationSchemaVersion = 1
-	slotSchemaVersion        = 1
-	deploymentSchemaVersion  = 1
+	applicationSchemaVersion = 2
+	slotSchemaVersion        = 2
+	deploymentSchemaVersion  = 2
+	lockSchemaVersion        = 1
+
+	deploymentChangesSchemaVersion = 1
+	planSchemaVersion              = 1
 )
 
 type ApplicationData_v0 struct {
@@ -86,3 +94,60 @@ func migrateDeployment_v0_to_v1(sourceData []byte) ([]byte, error) {
 
 	return json.Marshal(&source)
 }
+
+// Outputs were recorded as strings in v1 (maps & lists were skipped)
+// and are typed in v2. Strings remain valid typed outputs,
+// only the placeholder of sensitive outputs is replaced.
+const sensitiveOutput_v1 = "<sensitive>"
+
+func migrateApplication_v1_to_v2(sourceData []byte) ([]byte, error) {
+	return migrateOutputs_v1_to_v2(sourceData, 2, "infra_outputs")
+}
+
+func migrateSlot_v1_to_v2(sourceData []byte) ([]byte, error) {
+	return migrateOutputs_v1_to_v2(sourceData, 2, "last_terraform_run", "outputs")
+}
+
+func migrateDeployment_v1_to_v2(sourceData []byte) ([]byte, error) {
+	return migrateOutputs_v1_to_v2(sourceData, 2, "terraform", "outputs")
+}
+
+// migrateOutputs_v1_to_v2 migrates outputs found under a given path
+// and keeps all other fields untouched
+func migrateOutputs_v1_to_v2(sourceData []byte, version int, path ...string) ([]byte, error) {
+	source := make(map[string]interface{}, 0)
+	dec := json.NewDecoder(bytes.NewReader(sourceData))
+	dec.UseNumber()
+	err := dec.Decode(&source)
+	if err != nil {
+		return nil, err
+	}
+
+	parent := source
+	for _, key := range path[:len(path)-1] {
+		v, ok := parent[key].(map[string]interface{})
+		if !ok {
+			parent = nil
+			break
+		}
+		parent = v
+	}
+	if parent != nil {
+		outputsKey := path[len(path)-1]
+		switch outputs := parent[outputsKey].(type) {
+		case nil:
+		case map[string]interface{}:
+			for name, value := range outputs {
+				if value == sensitiveOutput_v1 {
+					outputs[name] = terraform.SensitiveValue
+				}
+			}
+		default:
+			return nil, fmt.Errorf("Unexpected type of %q: %T", outputsKey, outputs)
+		}
+	}
+
+	source["v"] = version
+
+	return json.Marshal(&source)
+}
@@ -2,6 +2,7 @@ package schema
 
 import (
 	"testing"
+	"time"
 )
 
 func TestApplicationDataFromJSON(t *testing.T) {
@@ -30,3 +31,106 @@ func TestDeploymentDataFromJSON(t *testing.T) {
 		t.Fatal("Expected error on higher schema version, none received")
 	}
 }
+
+func TestLockDataFromJSON(t *testing.T) {
+	newVersion := []byte(`{"v":99999}`)
+	lock := &LockData{}
+	err := lock.FromJSON(newVersion)
+	if err == nil {
+		t.Fatal("Expected error on higher schema version, none received")
+	}
+}
+
+func TestLockDataIsExpired(t *testing.T) {
+	acquired, _ := time.Parse(time.RFC1123, "Wed, 30 Mar 2016 15:04:05 BST")
+	lock := &LockData{
+		AcquiredAt: acquired,
+		ExpiresAt:  acquired.Add(1 * time.Hour),
+	}
+	if lock.IsExpired(acquired.Add(59 * time.Minute)) {
+		t.Fatal("Expected lock to be valid before its expiry")
+	}
+	if !lock.IsExpired(acquired.Add(61 * time.Minute)) {
+		t.Fatal("Expected lock to be expired after its expiry")
+	}
+}
+
+func TestApplicationDataFromJSON_forcedUnlocks(t *testing.T) {
+	data := []byte(`{"v":1,"is_active":true,"forced_unlocks":[{"lock":{"v":1,"lock_id":"abc","command":"deploy"},` +
+		`"broken_by":{"aws_api_caller":"arn:aws:iam::123456789012:user/Bob","ip_address":"8.8.8.8"},` +
+		`"broken_at":"2016-03-30T15:04:05Z"}]}`)
+	app := &ApplicationData{}
+	err := app.FromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(app.ForcedUnlocks) != 1 {
+		t.Fatalf("Expected 1 forced unlock, given: %d", len(app.ForcedUnlocks))
+	}
+	fu := app.ForcedUnlocks[0]
+	if fu.Lock.LockId != "abc" || fu.BrokenBy.AWSApiCaller != "arn:aws:iam::123456789012:user/Bob" {
+		t.Fatalf("Unexpected forced unlock data: %#v", fu)
+	}
+}
+
+func TestLockDataIsManual(t *testing.T) {
+	if !(&LockData{Command: ManualLockCommand}).IsManual() {
+		t.Fatal("Expected lock taken via lock command to be manual")
+	}
+	if (&LockData{Command: "deploy"}).IsManual() {
+		t.Fatal("Expected lock taken via deploy not to be manual")
+	}
+}
+
+func TestDeploymentDataGetStatus(t *testing.T) {
+	finished := time.Date(2016, time.March, 30, 14, 4, 5, 0, time.UTC)
+	cases := []struct {
+		Data           string
+		ExpectedStatus string
+	}{
+		// Recorded before statuses were
+		0: {`{"v":1,"start_time":"2016-03-30T14:04:05Z"}`, DeploymentInProgress},
+		1: {`{"v":1,"terraform":{"finish_time":"0001-01-01T00:00:00Z"}}`, DeploymentInProgress},
+		2: {`{"v":1,"terraform":{"finish_time":"2016-03-30T14:04:05Z","exit_code":1}}`, DeploymentFailed},
+		3: {`{"v":1,"terraform":{"finish_time":"2016-03-30T14:04:05Z"}}`, DeploymentSucceeded},
+		// Explicit status wins
+		4: {`{"v":1,"terraform":{"finish_time":"2016-03-30T14:04:05Z","exit_code":1},"status":"interrupted"}`,
+			DeploymentInterrupted},
+	}
+
+	for i, c := range cases {
+		d := &DeploymentData{}
+		err := d.FromJSON([]byte(c.Data))
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if d.GetStatus() != c.ExpectedStatus {
+			t.Fatalf("%d: Expected status %q, given: %q", i, c.ExpectedStatus, d.GetStatus())
+		}
+	}
+
+	slot := &SlotData{LastTerraformRun: &TerraformRun{FinishTime: finished}}
+	if slot.GetLastDeploymentStatus() != DeploymentSucceeded {
+		t.Fatalf("Expected slot status %q, given: %q", DeploymentSucceeded, slot.GetLastDeploymentStatus())
+	}
+	slot.LastDeploymentStatus = DeploymentAbandoned
+	if slot.GetLastDeploymentStatus() != DeploymentAbandoned {
+		t.Fatalf("Expected slot status %q, given: %q", DeploymentAbandoned, slot.GetLastDeploymentStatus())
+	}
+}
+
+func TestSlotDataGetLastTerraformVersion(t *testing.T) {
+	slot := &SlotData{}
+	if slot.GetLastTerraformVersion() != "" {
+		t.Fatalf("Expected no version for a slot never deployed, given: %q", slot.GetLastTerraformVersion())
+	}
+	// Recorded before versions were
+	slot.LastTerraformRun = &TerraformRun{TerraformVersion: "0.12.29"}
+	if slot.GetLastTerraformVersion() != "0.12.29" {
+		t.Fatalf("Expected version of the last run, given: %q", slot.GetLastTerraformVersion())
+	}
+	slot.LastTerraformVersion = "0.13.5"
+	if slot.GetLastTerraformVersion() != "0.13.5" {
+		t.Fatalf("Expected recorded version, given: %q", slot.GetLastTerraformVersion())
+	}
+}
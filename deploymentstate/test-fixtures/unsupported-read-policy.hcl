@@ -0,0 +1,5 @@
+deployment_state "fixture" {
+  bucket = "ti-rt-deployment-state-{{.Environment}}"
+  key = "{{.AwsAccountId}}/hubot/nothing/"
+  read_policy = "whatever"
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"github.com/MeredithCorpOSS/ape-dev-rt/commons"
 	"github.com/MeredithCorpOSS/ape-dev-rt/git"
+	"github.com/MeredithCorpOSS/ape-dev-rt/hcl"
 	"github.com/MeredithCorpOSS/ape-dev-rt/validators"
 	"github.com/urfave/cli"
 )
@@ -30,6 +31,28 @@ type FlagDefinitions struct {
 	Variable          cli.StringSliceFlag
 	SlotPrefix        cli.StringFlag
 	PreviousSlot      cli.BoolFlag
+	LockTTL           commons.StringFlag
+	LockReason        cli.StringFlag
+	MigrateFrom       commons.StringFlag
+	MigrateTo         commons.StringFlag
+	DryRun            cli.BoolFlag
+	Authoritative     cli.StringFlag
+	StaleAfter        commons.StringFlag
+	Abandon           cli.BoolFlag
+	SavePlan          cli.BoolFlag
+	StoreValues       cli.BoolFlag
+	PlanID            cli.StringFlag
+	UpgradeTerraform  cli.BoolFlag
+	JSON              cli.BoolFlag
+	ReuseVars         cli.BoolFlag
+	RollbackTo        cli.StringFlag
+	HealthTimeout     commons.StringFlag
+	Wait              cli.BoolFlag
+	MinHealthy        cli.IntFlag
+	MinHealthyRatio   commons.Float64Flag
+	ShiftTo           cli.StringFlag
+	TrafficSteps      cli.StringFlag
+	TrafficInterval   commons.StringFlag
 }
 
 var flags = FlagDefinitions{
@@ -163,6 +186,143 @@ var flags = FlagDefinitions{
 		Validator: validators.IsBigDurationValid,
 	},
 
+	LockTTL: commons.StringFlag{
+		StringFlag: cli.StringFlag{
+			Name:  "ttl",
+			Usage: "How long to hold the lock (e.g. 4h, see github.com/ninibe/bigduration)",
+			Value: "2h",
+		},
+		Validator: validators.IsBigDurationValid,
+	},
+
+	LockReason: cli.StringFlag{
+		Name:  "reason",
+		Usage: "Why the app is being locked, shown to anyone else trying to operate on it",
+	},
+
+	MigrateFrom: commons.StringFlag{
+		StringFlag: cli.StringFlag{
+			Name:  "from",
+			Usage: "Path to the RT config (" + hcl.ConfigFilename + " or directory containing it) with the source deployment_state",
+		},
+		Validator: validators.StringIsValidPath,
+	},
+
+	MigrateTo: commons.StringFlag{
+		StringFlag: cli.StringFlag{
+			Name:  "to",
+			Usage: "Path to the RT config (" + hcl.ConfigFilename + " or directory containing it) with the target deployment_state",
+		},
+		Validator: validators.StringIsValidPath,
+	},
+
+	DryRun: cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Only show what would be done, without writing anything",
+	},
+
+	Authoritative: cli.StringFlag{
+		Name:  "authoritative",
+		Usage: "Name of the deployment state backend to treat as source of truth, defaults to the first one configured",
+	},
+
+	StaleAfter: commons.StringFlag{
+		StringFlag: cli.StringFlag{
+			Name:  "stale-after",
+			Usage: "How long after start a deployment still in progress is considered stale (e.g. 4h, see github.com/ninibe/bigduration)",
+			Value: "2h",
+		},
+		Validator: validators.IsBigDurationValid,
+	},
+
+	Abandon: cli.BoolFlag{
+		Name:  "abandon",
+		Usage: "Mark stale deployments as abandoned",
+	},
+
+	SavePlan: cli.BoolFlag{
+		Name:  "save-plan",
+		Usage: "Save the plan into deployment state, so that it can be applied later via -plan-id",
+	},
+
+	StoreValues: cli.BoolFlag{
+		Name: "store-values",
+		Usage: "Store before/after values of planned resource changes in deployment state " +
+			"(requires Terraform 0.14+ so that sensitive values can be redacted)",
+	},
+
+	PlanID: cli.StringFlag{
+		Name:  "plan-id",
+		Usage: "ID of a plan saved via -save-plan to apply instead of planning again",
+	},
+
+	ReuseVars: cli.BoolFlag{
+		Name:  "reuse-vars",
+		Usage: "Deploy with variables of the slot's last deployment, -var overrides them",
+	},
+
+	RollbackTo: cli.StringFlag{
+		Name:  "to",
+		Usage: "ID of the deployment to roll back to, defaults to the last successful one before the last deployment",
+	},
+
+	JSON: cli.BoolFlag{
+		Name:  "json",
+		Usage: "Print machine-readable JSON instead of human-readable output",
+	},
+
+	HealthTimeout: commons.StringFlag{
+		StringFlag: cli.StringFlag{
+			Name:  "timeout",
+			Usage: "How long to wait for instances to become healthy (e.g. 10m, see github.com/ninibe/bigduration)",
+			Value: "10m",
+		},
+		Validator: validators.IsBigDurationValid,
+	},
+
+	Wait: cli.BoolFlag{
+		Name:  "wait",
+		Usage: "Wait until instances of the slot are healthy behind all load-balancers",
+	},
+
+	MinHealthy: cli.IntFlag{
+		Name:  "min-healthy",
+		Usage: "Minimum number of healthy instances to wait for (all by default)",
+	},
+
+	MinHealthyRatio: commons.Float64Flag{
+		Float64Flag: cli.Float64Flag{
+			Name:  "min-healthy-ratio",
+			Usage: "Minimum ratio of healthy instances to wait for, between 0 and 1 (all by default)",
+		},
+		Validator: validators.Float64Percent,
+	},
+
+	ShiftTo: cli.StringFlag{
+		Name:  "to",
+		Usage: "Slot ID to shift traffic to",
+	},
+
+	TrafficSteps: cli.StringFlag{
+		Name:  "steps",
+		Usage: "Comma-separated percentages of traffic to shift in steps",
+		Value: "10,25,50,100",
+	},
+
+	TrafficInterval: commons.StringFlag{
+		StringFlag: cli.StringFlag{
+			Name:  "interval",
+			Usage: "How long to check health between steps (e.g. 5m, see github.com/ninibe/bigduration)",
+			Value: "5m",
+		},
+		Validator: validators.IsBigDurationValid,
+	},
+
+	UpgradeTerraform: cli.BoolFlag{
+		Name:  "upgrade-terraform",
+		Usage: "Upgrade state last applied with older Terraform without asking",
+	},
+
 	Namespace: commons.StringFlag{
 		StringFlag: cli.StringFlag{
 			Name:  "namespace",
@@ -174,7 +334,7 @@ var flags = FlagDefinitions{
 
 	OutputName: cli.StringFlag{
 		Name:  "name",
-		Usage: "Name of the output value",
+		Usage: "Name of the output value, optionally with a path into list/map values (e.g. subnet_ids.0, tags.Name)",
 	},
 
 	Target: cli.StringFlag{
@@ -10,6 +10,7 @@ import (
 type HclConfig struct {
 	DeploymentState *DeploymentState
 	RemoteState     *RemoteState
+	Terraform       *Terraform
 }
 
 type DeploymentState struct {
@@ -21,6 +22,15 @@ type RemoteState struct {
 	Config  map[string]string
 }
 
+// Terraform configures how RT runs Terraform
+type Terraform struct {
+	// Executor is either "embedded" (default) or "binary"
+	Executor string
+	// Path to the binary used by the "binary" executor,
+	// terraform found in PATH is used if empty
+	Path string
+}
+
 func (ds *DeploymentState) Iterator() []map[string]interface{} {
 	return ds.cfg
 }
@@ -29,6 +39,7 @@ func (ds *DeploymentState) Iterator() []map[string]interface{} {
 var supportedBlocks = map[string]int{
 	"deployment_state": math.MaxInt32,
 	"remote_state":     1,
+	"terraform":        1,
 }
 
 func parseBlock(hclConfig *HclConfig, blockKey string, cfgs []map[string]interface{}) error {
@@ -82,6 +93,27 @@ func parseBlock(hclConfig *HclConfig, blockKey string, cfgs []map[string]interfa
 		return nil
 	}
 
+	if blockKey == "terraform" {
+		tf := &Terraform{}
+		for k, v := range cfgs[0] {
+			s, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("Expected string for %q in %q, given: %#v", k, blockKey, v)
+			}
+			switch k {
+			case "executor":
+				tf.Executor = s
+			case "path":
+				tf.Path = s
+			default:
+				return fmt.Errorf("Unrecognised field %q in %q, supported: %q",
+					k, blockKey, []string{"executor", "path"})
+			}
+		}
+		hclConfig.Terraform = tf
+		return nil
+	}
+
 	return fmt.Errorf("Unable to parse block %q - no handler", blockKey)
 }
 
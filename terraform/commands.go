@@ -1,20 +1,26 @@
 package terraform
 
 import (
-	"bufio"
-	"bytes"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 
 	"github.com/MeredithCorpOSS/ape-dev-rt/rt"
-	"github.com/MeredithCorpOSS/ape-dev-rt/ui"
 )
 
 type Meta struct {
-	Color bool           // True if output should be colored
-	Ui    *ui.StreamedUi // Ui for output
+	Color bool // True if output should be colored
+
+	// Dir is the working directory of Terraform. The working directory
+	// of RT itself is never changed, so commands can run concurrently.
+	Dir string
+
+	Stdout io.Writer
+	Stderr io.Writer
 }
 
 type TfCommand struct {
@@ -22,32 +28,67 @@ type TfCommand struct {
 }
 
 func (c *TfCommand) Execute(args []string) int {
-	binary, err := CheckTerraform()
+	binary, _, err := CheckTerraform("", rt.TerraformVersion)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Correct version of terraform not available\n")
+		fmt.Fprintf(c.Meta.Stderr, "Correct version of terraform not available: %s\n", err)
 		return 1
 	}
 
-	cmd := exec.Command(binary, args...)
-	stdoutPipe, _ := cmd.StdoutPipe()
-	_, doneChan := c.Meta.Ui.AttachOutputReadCloser(stdoutPipe)
-	cmd.Stdout = c.Meta.Ui.OutputWriter
+	return runTerraform(binary, args, c.Meta)
+}
+
+// Terraform subprocesses which are currently running (see InterruptRunning)
+var running = struct {
+	sync.Mutex
+	cmds map[*exec.Cmd]bool
+}{cmds: make(map[*exec.Cmd]bool, 0)}
 
-	stderrPipe, _ := cmd.StderrPipe()
-	c.Meta.Ui.AttachErrorReadCloser(stderrPipe)
-	cmd.Stderr = c.Meta.Ui.ErrorWriter
+// runTerraform runs a given binary in meta.Dir and returns its exit code
+func runTerraform(binary string, args []string, meta Meta) int {
+	cmd := exec.Command(binary, args...)
+	cmd.Dir = meta.Dir
+	cmd.Stdout = meta.Stdout
+	cmd.Stderr = meta.Stderr
 
-	c.Meta.Ui.FlushBuffers()
-	cmd.Start()
+	err := cmd.Start()
+	if err != nil {
+		fmt.Fprintf(meta.Stderr, "Failed to run terraform: %s\n", err)
+		return 1
+	}
+	running.Lock()
+	running.cmds[cmd] = true
+	running.Unlock()
 
 	err = cmd.Wait()
+
+	running.Lock()
+	delete(running.cmds, cmd)
+	running.Unlock()
+
 	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode()
+		}
+		fmt.Fprintf(meta.Stderr, "Failed to run terraform: %s\n", err)
 		return 1
 	}
-	<-doneChan
 	return 0
 }
 
+// InterruptRunning asks all running Terraform subprocesses to stop gracefully,
+// same as if Ctrl+C was pressed in the terminal
+func InterruptRunning() {
+	running.Lock()
+	defer running.Unlock()
+	for cmd := range running.cmds {
+		log.Printf("[DEBUG] Interrupting Terraform (pid %d)", cmd.Process.Pid)
+		err := cmd.Process.Signal(os.Interrupt)
+		if err != nil {
+			log.Printf("[WARN] Unable to interrupt Terraform (pid %d): %s", cmd.Process.Pid, err)
+		}
+	}
+}
+
 type ApplyCommand struct {
 	TfCommand
 }
@@ -129,6 +170,15 @@ func (c *UntaintCommand) Run(args []string) int {
 	return c.Execute(args)
 }
 
+type ShowCommand struct {
+	TfCommand
+}
+
+func (c *ShowCommand) Run(args []string) int {
+	args = append([]string{"show"}, args...)
+	return c.Execute(args)
+}
+
 type ValidateCommand struct {
 	TfCommand
 }
@@ -151,35 +201,23 @@ func (c *TfCommand) Synopsis() string {
 	return "Builds or changes infrastructure"
 }
 
-func CheckTerraform() (string, error) {
-	binaryPathBytes, err := exec.Command("which", "terraform").Output() // output returns a byte slice
-	if err != nil {
-		fmt.Printf("Error with `which terraform`: %s\n", err.Error())
-		return "", err
+// CheckTerraform looks up Terraform binary (in PATH if no path is given)
+// and verifies its version satisfies a given constraint
+func CheckTerraform(binaryPath, constraint string) (string, string, error) {
+	if binaryPath == "" {
+		binaryPath = "terraform"
 	}
-	binaryPath := strings.Trim(string(binaryPathBytes[:]), "\n")
-	binaryVersion, err := exec.Command(binaryPath, "version").Output()
+	p, err := exec.LookPath(binaryPath)
 	if err != nil {
-		fmt.Printf("Error with `terraform version`: %s\n", err.Error())
-		return "", err
-	}
-	bytesReader := bytes.NewReader([]byte(binaryVersion))
-	bufReader := bufio.NewReader(bytesReader)
-	firstLine, isPrefix, err := bufReader.ReadLine()
-	if isPrefix {
-		fmt.Printf("Line too long")
-		return "", fmt.Errorf("Unable to read `terraform version` output")
+		return "", "", err
 	}
+	v, err := detectVersion(p)
 	if err != nil {
-		fmt.Printf("Error with `terraform version`: %s\n", err.Error())
-		return "", err
+		return "", "", err
 	}
-	versionStr := strings.Trim(string(firstLine[:]), "\n")
-	expectedVersionStr := "Terraform v" + rt.TerraformVersion
-	if expectedVersionStr != versionStr {
-		errorStr := fmt.Sprintf("unexpected version of terraform: %s (wanted %s)\n", versionStr, expectedVersionStr)
-		fmt.Printf(errorStr)
-		return "", fmt.Errorf(errorStr)
+	_, err = checkVersionConstraint(v, constraint)
+	if err != nil {
+		return "", "", err
 	}
-	return binaryPath, nil
+	return p, v, nil
 }
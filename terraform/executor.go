@@ -0,0 +1,193 @@
+package terraform
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/rt"
+	"github.com/hashicorp/go-version"
+	m_cli "github.com/mitchellh/cli"
+)
+
+const (
+	ExecutorEmbedded = "embedded"
+	ExecutorBinary   = "binary"
+)
+
+// Executor runs Terraform commands on behalf of Cmd
+type Executor interface {
+	// Run runs a Terraform command (e.g. "plan") in meta.Dir
+	// and returns its exit code
+	Run(cmdName string, args []string, meta Meta) (int, error)
+
+	// Version returns version of Terraform run by the executor
+	Version() (string, error)
+}
+
+// executor is set once on startup (see SetExecutor)
+// and only read afterwards, so it needs no locking
+var executor Executor = &EmbeddedExecutor{}
+
+// SetExecutor changes the executor used by all Terraform commands
+func SetExecutor(e Executor) {
+	executor = e
+}
+
+// NewExecutor returns executor of a given kind ("embedded" or "binary"),
+// binaryPath is only used by the binary executor
+func NewExecutor(kind, binaryPath string) (Executor, error) {
+	switch kind {
+	case "", ExecutorEmbedded:
+		return &EmbeddedExecutor{}, nil
+	case ExecutorBinary:
+		return NewBinaryExecutor(binaryPath)
+	}
+	return nil, fmt.Errorf("Unknown Terraform executor %q, supported: %q",
+		kind, []string{ExecutorEmbedded, ExecutorBinary})
+}
+
+// Version returns version of Terraform run by the current executor
+func Version() (string, error) {
+	return executor.Version()
+}
+
+// EmbeddedExecutor runs the terraform binary found in PATH through the
+// commands in this package, which require it to be exactly the version
+// RT was built for (rt.TerraformVersion)
+type EmbeddedExecutor struct{}
+
+func (e *EmbeddedExecutor) Run(cmdName string, args []string, meta Meta) (int, error) {
+	commands := map[string]m_cli.Command{
+		"apply": &ApplyCommand{
+			TfCommand{Meta: meta}},
+		"get": &GetCommand{
+			TfCommand{Meta: meta}},
+		"output": &OutputCommand{
+			TfCommand{Meta: meta}},
+		"plan": &PlanCommand{
+			TfCommand{Meta: meta}},
+		"init": &InitCommand{
+			TfCommand{Meta: meta}},
+		"state": &StateCommand{
+			TfCommand{Meta: meta}},
+		"destroy": &DestroyCommand{
+			TfCommand{Meta: meta}},
+		"taint": &TaintCommand{
+			TfCommand{Meta: meta}},
+		"untaint": &UntaintCommand{
+			TfCommand{Meta: meta}},
+		"show": &ShowCommand{
+			TfCommand{Meta: meta}},
+		"validate": &ValidateCommand{
+			TfCommand{Meta: meta}},
+	}
+
+	cmd, ok := commands[cmdName]
+	if !ok {
+		return 0, fmt.Errorf("Unknown Terraform command: %s", cmdName)
+	}
+
+	return cmd.Run(args), nil
+}
+
+func (e *EmbeddedExecutor) Version() (string, error) {
+	return rt.TerraformVersion, nil
+}
+
+// BinaryExecutor shells out to a configured Terraform binary
+// of any version
+type BinaryExecutor struct {
+	Path string
+
+	versionOnce sync.Once
+	version     string
+	versionErr  error
+}
+
+// NewBinaryExecutor returns executor running a given binary
+// or terraform found in PATH if no path is given
+func NewBinaryExecutor(binaryPath string) (*BinaryExecutor, error) {
+	if binaryPath == "" {
+		binaryPath = "terraform"
+	}
+	p, err := exec.LookPath(binaryPath)
+	if err != nil {
+		return nil, fmt.Errorf("Terraform binary not found: %s", err)
+	}
+	return &BinaryExecutor{Path: p}, nil
+}
+
+func (e *BinaryExecutor) Run(cmdName string, args []string, meta Meta) (int, error) {
+	args = append([]string{cmdName}, args...)
+	return runTerraform(e.Path, args, meta), nil
+}
+
+// Version detects version of the binary (once)
+func (e *BinaryExecutor) Version() (string, error) {
+	e.versionOnce.Do(func() {
+		e.version, e.versionErr = detectVersion(e.Path)
+	})
+	return e.version, e.versionErr
+}
+
+// detectVersion reads version from `terraform version -json` (0.13+)
+// or from the first line of `terraform version` (older versions)
+func detectVersion(binaryPath string) (string, error) {
+	out, err := exec.Command(binaryPath, "version", "-json").Output()
+	if err != nil {
+		out, err = exec.Command(binaryPath, "version").Output()
+		if err != nil {
+			return "", fmt.Errorf("Error with `%s version`: %s", binaryPath, err)
+		}
+	}
+	return parseVersionOutput(out)
+}
+
+func parseVersionOutput(out []byte) (string, error) {
+	trimmed := bytes.TrimSpace(out)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		var v struct {
+			TerraformVersion string `json:"terraform_version"`
+		}
+		err := json.Unmarshal(trimmed, &v)
+		if err != nil {
+			return "", fmt.Errorf("Unable to parse `terraform version -json` output: %s", err)
+		}
+		return v.TerraformVersion, nil
+	}
+
+	firstLine, _, err := bufio.NewReader(bytes.NewReader(trimmed)).ReadLine()
+	if err != nil {
+		return "", fmt.Errorf("Unable to read `terraform version` output: %s", err)
+	}
+	line := string(firstLine)
+	if !strings.HasPrefix(line, "Terraform v") {
+		return "", fmt.Errorf("Unexpected `terraform version` output: %q", line)
+	}
+	return strings.TrimPrefix(line, "Terraform v"), nil
+}
+
+// checkVersionConstraint verifies a given version satisfies constraint,
+// which can be an exact version ("0.12.29") or a range ("~> 0.13.0")
+func checkVersionConstraint(v, constraint string) (*version.Version, error) {
+	parsed, err := version.NewVersion(v)
+	if err != nil {
+		return nil, err
+	}
+	if constraint == "" {
+		return parsed, nil
+	}
+	c, err := version.NewConstraint(constraint)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid Terraform version constraint %q: %s", constraint, err)
+	}
+	if !c.Check(parsed) {
+		return nil, fmt.Errorf("Unexpected version of Terraform: %s (wanted %s)", v, constraint)
+	}
+	return parsed, nil
+}
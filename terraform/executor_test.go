@@ -0,0 +1,89 @@
+package terraform
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/rt"
+)
+
+func TestParseVersionOutput(t *testing.T) {
+	testCases := map[string]string{
+		"Terraform v0.12.29\n":                                             "0.12.29",
+		"Terraform v0.15.0\non linux_amd64\n":                              "0.15.0",
+		`{"terraform_version": "0.13.5", "terraform_revision": ""}` + "\n": "0.13.5",
+	}
+	for out, expected := range testCases {
+		v, err := parseVersionOutput([]byte(out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != expected {
+			t.Fatalf("Expected version %q from %q, given: %q", expected, out, v)
+		}
+	}
+
+	_, err := parseVersionOutput([]byte("Usage: terraform [-version] [-help]"))
+	if err == nil {
+		t.Fatal("Expected error for unexpected output")
+	}
+}
+
+func TestBinaryExecutor(t *testing.T) {
+	tearDown := testFakeTerraform(t)
+	defer tearDown()
+
+	e, err := NewExecutor(ExecutorBinary, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetExecutor(e)
+	defer SetExecutor(&EmbeddedExecutor{})
+
+	v, err := Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != rt.TerraformVersion {
+		t.Fatalf("Expected detected version %q, given: %q", rt.TerraformVersion, v)
+	}
+
+	for _, constraint := range []string{"", rt.TerraformVersion, ">= 0.12, < 0.13"} {
+		_, err = checkVersionConstraint(v, constraint)
+		if err != nil {
+			t.Fatalf("Expected %q to satisfy %q: %s", v, constraint, err)
+		}
+	}
+	_, err = checkVersionConstraint(v, "0.11.14")
+	if err == nil || !strings.Contains(err.Error(), "wanted 0.11.14") {
+		t.Fatalf("Expected version mismatch error, given: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "tf-cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out, err := Cmd("apply", []string{}, dir, ioutil.Discard, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.ExitCode != 3 {
+		t.Fatalf("Expected exit code 3, given: %#v", out)
+	}
+}
+
+func TestNewExecutor_invalid(t *testing.T) {
+	_, err := NewExecutor("docker", "")
+	if err == nil {
+		t.Fatal("Expected error for unknown executor")
+	}
+	_, err = NewExecutor(ExecutorBinary, path.Join(os.TempDir(), "non-existent-terraform"))
+	if err == nil {
+		t.Fatal("Expected error for non-existent binary")
+	}
+}
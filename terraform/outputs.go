@@ -0,0 +1,107 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Outputs maps names of Terraform outputs to their values,
+// which can be strings, numbers, bools, lists ([]interface{})
+// or maps (map[string]interface{}), as decoded from JSON
+type Outputs map[string]interface{}
+
+// outputJSON represents a single output in `terraform output -json`
+type outputJSON struct {
+	Sensitive bool        `json:"sensitive"`
+	Type      interface{} `json:"type"`
+	Value     interface{} `json:"value"`
+}
+
+// GetString returns value of a given output if it's a string
+func (o Outputs) GetString(name string) (string, bool) {
+	v, ok := o[name]
+	if !ok {
+		return "", false
+	}
+	s, ok := v.(string)
+	return s, ok
+}
+
+// Lookup returns value of an output or a value nested in it,
+// e.g. "subnet_ids.0" or "tags.Name"
+func (o Outputs) Lookup(path string) (interface{}, error) {
+	parts := strings.Split(path, ".")
+	value, ok := o[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("Output %q not found", parts[0])
+	}
+
+	for i, key := range parts[1:] {
+		parent := strings.Join(parts[:i+1], ".")
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value, ok = v[key]
+			if !ok {
+				return nil, fmt.Errorf("Key %q not found in %q", key, parent)
+			}
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil {
+				return nil, fmt.Errorf("%q is a list, expected numeric index, given: %q", parent, key)
+			}
+			if idx < 0 || idx >= len(v) {
+				return nil, fmt.Errorf("Index %d out of range of %q (%d elements)", idx, parent, len(v))
+			}
+			value = v[idx]
+		default:
+			return nil, fmt.Errorf("%q is neither a list nor a map", parent)
+		}
+	}
+
+	return value, nil
+}
+
+// FormatOutputValue returns strings as they are
+// and everything else as (indented) JSON
+func FormatOutputValue(value interface{}, indent string) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+
+	var b []byte
+	var err error
+	if indent == "" {
+		b, err = json.Marshal(value)
+	} else {
+		b, err = json.MarshalIndent(value, "", indent)
+	}
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(b)
+}
+
+func parseOutputsFromJSON(data []byte) (Outputs, error) {
+	raw := make(map[string]*outputJSON, 0)
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse outputs: %s", err)
+	}
+
+	outputs := make(Outputs, len(raw))
+	for name, o := range raw {
+		if o == nil {
+			continue
+		}
+		if o.Sensitive {
+			// Sensitive outputs don't end up in deployment state
+			outputs[name] = SensitiveValue
+			continue
+		}
+		outputs[name] = o.Value
+	}
+
+	return outputs, nil
+}
@@ -0,0 +1,184 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+)
+
+// Actions of a single resource change
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionReplace = "replace"
+)
+
+// SensitiveValue replaces values marked as sensitive in the plan
+const SensitiveValue = "(sensitive)"
+
+// planJSON represents the relevant subset of `terraform show -json <planfile>`
+// See https://www.terraform.io/docs/internals/json-format.html
+type planJSON struct {
+	FormatVersion   string                `json:"format_version"`
+	ResourceChanges []*resourceChangeJSON `json:"resource_changes"`
+}
+
+type resourceChangeJSON struct {
+	Address string      `json:"address"`
+	Mode    string      `json:"mode"`
+	Type    string      `json:"type"`
+	Change  *changeJSON `json:"change"`
+}
+
+type changeJSON struct {
+	Actions         []string    `json:"actions"`
+	Before          interface{} `json:"before"`
+	After           interface{} `json:"after"`
+	BeforeSensitive interface{} `json:"before_sensitive"`
+	AfterSensitive  interface{} `json:"after_sensitive"`
+}
+
+// hasSensitivity tells whether the change marks its sensitive values,
+// which older Terraform (<0.14) leaves out of the plan
+func (c *changeJSON) hasSensitivity() bool {
+	return c.BeforeSensitive != nil || c.AfterSensitive != nil
+}
+
+// ShowPlan reads the saved planfile and returns planned resource changes.
+// Before/after values are only returned withValues and only if the plan marks
+// sensitive values (Terraform 0.14+), so that these can be redacted.
+func ShowPlan(rootPath, planFilePath string, withValues bool) (*PlanResourceDiff, error) {
+	args := []string{
+		"-json",
+		planFilePath,
+	}
+	out, err := Cmd("show", args, rootPath, ioutil.Discard, ioutil.Discard)
+	if err != nil {
+		return nil, err
+	}
+	if out.ExitCode != 0 {
+		return nil, fmt.Errorf("Error(s) occured when reading plan (exit code %d). Stderr:\n%s",
+			out.ExitCode, out.Stderr)
+	}
+
+	return parseDiffFromPlanJSON([]byte(out.Stdout), withValues)
+}
+
+func parseDiffFromPlanJSON(data []byte, withValues bool) (*PlanResourceDiff, error) {
+	var plan planJSON
+	err := json.Unmarshal(data, &plan)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse plan: %s", err)
+	}
+	if plan.FormatVersion == "" {
+		return nil, fmt.Errorf("Unable to parse plan: format_version not found")
+	}
+
+	diff := &PlanResourceDiff{
+		Changes: make([]*ResourceChange, 0),
+	}
+	for _, rc := range plan.ResourceChanges {
+		if rc.Mode == "data" || rc.Change == nil {
+			continue
+		}
+		action, err := actionFromPlanActions(rc.Change.Actions)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", rc.Address, err)
+		}
+
+		switch action {
+		case "":
+			continue
+		case ActionCreate:
+			diff.ToCreate++
+		case ActionUpdate:
+			diff.ToChange++
+		case ActionDelete:
+			diff.ToRemove++
+		case ActionReplace:
+			diff.ToCreate++
+			diff.ToRemove++
+		}
+
+		change := &ResourceChange{
+			Address: rc.Address,
+			Type:    rc.Type,
+			Action:  action,
+		}
+		if withValues {
+			if rc.Change.hasSensitivity() {
+				change.Before = redactSensitive(rc.Change.Before, rc.Change.BeforeSensitive)
+				change.After = redactSensitive(rc.Change.After, rc.Change.AfterSensitive)
+			} else {
+				log.Printf("[WARN] Plan doesn't mark sensitive values of %s (Terraform <0.14?), "+
+					"leaving out its values", rc.Address)
+			}
+		}
+		diff.Changes = append(diff.Changes, change)
+	}
+	sort.Slice(diff.Changes, func(i, j int) bool {
+		return diff.Changes[i].Address < diff.Changes[j].Address
+	})
+
+	return diff, nil
+}
+
+// actionFromPlanActions turns list of actions from the plan into a single action
+// Empty action is returned for resources which aren't changing
+func actionFromPlanActions(actions []string) (string, error) {
+	switch len(actions) {
+	case 1:
+		switch actions[0] {
+		case "no-op", "read":
+			return "", nil
+		case ActionCreate, ActionUpdate, ActionDelete:
+			return actions[0], nil
+		}
+	case 2:
+		// create-before-destroy or destroy-before-create
+		if (actions[0] == ActionCreate && actions[1] == ActionDelete) ||
+			(actions[0] == ActionDelete && actions[1] == ActionCreate) {
+			return ActionReplace, nil
+		}
+	}
+	return "", fmt.Errorf("Unknown actions: %q", actions)
+}
+
+// redactSensitive replaces values marked as sensitive
+// (Terraform 0.14+ only) so these don't end up in deployment state
+func redactSensitive(value, sensitive interface{}) interface{} {
+	switch s := sensitive.(type) {
+	case bool:
+		if s {
+			return SensitiveValue
+		}
+	case map[string]interface{}:
+		v, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		redacted := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			redacted[key] = redactSensitive(val, s[key])
+		}
+		return redacted
+	case []interface{}:
+		v, ok := value.([]interface{})
+		if !ok {
+			return value
+		}
+		redacted := make([]interface{}, len(v))
+		for i, val := range v {
+			if i < len(s) {
+				redacted[i] = redactSensitive(val, s[i])
+			} else {
+				redacted[i] = val
+			}
+		}
+		return redacted
+	}
+	return value
+}
@@ -1,6 +1,7 @@
 package terraform
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,20 +12,17 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
-
-	"github.com/MeredithCorpOSS/ape-dev-rt/ui"
-	m_cli "github.com/mitchellh/cli"
 )
 
 const AppName = "app"
 
 func FreshPlan(input *FreshPlanInput) (*PlanOutput, error) {
-	_, err := ReenableRemoteState(input.RemoteState, input.RootPath)
+	_, err := reenableRemoteState(input.RemoteState, input.RootPath, input.StdoutWriter, input.StderrWriter)
 	if err != nil {
 		return nil, err
 	}
 
-	err = Get(input.RootPath)
+	err = get(input.RootPath, input.StdoutWriter, input.StderrWriter)
 	if err != nil {
 		return nil, err
 	}
@@ -39,6 +37,7 @@ func FreshPlan(input *FreshPlanInput) (*PlanOutput, error) {
 		StderrWriter: input.StderrWriter,
 		StdoutWriter: input.StdoutWriter,
 		XLegacy:      input.XLegacy,
+		WithValues:   input.WithValues,
 	})
 }
 
@@ -65,9 +64,12 @@ func Plan(input *PlanInput) (*PlanOutput, error) {
 		return nil, err
 	}
 
-	diff, err := parseDiffFromPlanOutput(out.Stdout)
-	if err != nil {
-		return nil, err
+	diff := &PlanResourceDiff{}
+	if out.ExitCode == 0 {
+		diff, err = ShowPlan(input.RootPath, input.PlanFilePath, input.WithValues)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &PlanOutput{
@@ -126,7 +128,13 @@ func Apply(input *ApplyInput) (*ApplyOutput, error) {
 		return nil, err
 	}
 
-	outputs := parseOutputsFromApplyOutput(out.Stdout)
+	outputs := make(Outputs, 0)
+	if out.ExitCode == 0 {
+		outputs, err = Output(input.RootPath)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return &ApplyOutput{
 		ExitCode: out.ExitCode,
@@ -269,6 +277,10 @@ func GenerateBackendConfig(remoteState *RemoteState, rootPath string) (string, e
 }
 
 func ReenableRemoteState(remoteState *RemoteState, rootPath string) (string, error) {
+	return reenableRemoteState(remoteState, rootPath, os.Stdout, os.Stderr)
+}
+
+func reenableRemoteState(remoteState *RemoteState, rootPath string, stdoutW, stderrW io.Writer) (string, error) {
 	os.RemoveAll(path.Join(rootPath, ".terraform"))
 
 	_, err := GenerateBackendConfig(remoteState, rootPath)
@@ -278,7 +290,7 @@ func ReenableRemoteState(remoteState *RemoteState, rootPath string) (string, err
 
 	var output string
 
-	out, err := Cmd("init", nil, rootPath, os.Stdout, os.Stderr)
+	out, err := Cmd("init", nil, rootPath, stdoutW, stderrW)
 	if err != nil {
 		return "", err
 	}
@@ -293,7 +305,11 @@ func ReenableRemoteState(remoteState *RemoteState, rootPath string) (string, err
 }
 
 func Get(rootPath string) error {
-	out, err := Cmd("get", []string{"-update"}, rootPath, os.Stdout, os.Stderr)
+	return get(rootPath, os.Stdout, os.Stderr)
+}
+
+func get(rootPath string, stdoutW, stderrW io.Writer) error {
+	out, err := Cmd("get", []string{"-update"}, rootPath, stdoutW, stderrW)
 	if err != nil {
 		return err
 	}
@@ -304,7 +320,7 @@ func Get(rootPath string) error {
 	return nil
 }
 
-func FreshOutput(remoteState *RemoteState, rootPath string) (map[string]string, error) {
+func FreshOutput(remoteState *RemoteState, rootPath string) (Outputs, error) {
 	_, err := ReenableRemoteState(remoteState, rootPath)
 	if err != nil {
 		return nil, err
@@ -313,47 +329,35 @@ func FreshOutput(remoteState *RemoteState, rootPath string) (map[string]string,
 	return Output(rootPath)
 }
 
-func Output(rootPath string) (map[string]string, error) {
+func Output(rootPath string) (Outputs, error) {
 	args := []string{
-		"-no-color",
-		// TODO: Terraform v0.7+
-		// "-json",
+		"-json",
 	}
 
-	out, err := Cmd("output", args, rootPath, os.Stdout, os.Stderr)
+	out, err := Cmd("output", args, rootPath, ioutil.Discard, os.Stderr)
 	if err != nil {
 		return nil, err
 	}
 
 	if out.ExitCode != 0 {
-		if out.Stdout == "The module root could not be found. There is nothing to output.\n" {
-			return nil, nil
+		if strings.HasPrefix(out.Stdout, "The module root could not be found. There is nothing to output.") {
+			return Outputs{}, nil
 		}
 		if strings.HasPrefix(out.Stdout, "The state file has no outputs defined.") {
-			return nil, nil
+			return Outputs{}, nil
 		}
 
 		return nil, fmt.Errorf("Error(s) occured with output (exit code %d). Stderr:\n%s",
 			out.ExitCode, out.Stderr)
 	}
 
-	var outputs = make(map[string]string, 0)
-	// TODO: Parse JSON output instead (Terraform v0.7)
-	lines := strings.Split(out.Stdout, "\n")
-	for _, l := range lines {
-		items := strings.Split(l, " = ")
-		if len(items) == 2 {
-			key, value := items[0], items[1]
-			outputs[key] = value
-		}
-	}
-
-	return outputs, nil
-
+	return parseOutputsFromJSON([]byte(out.Stdout))
 }
 
-func Validate(rootpath string) (*CmdOutput, error) {
-	out, err := Cmd("validate", []string{}, rootpath, os.Stdout, os.Stderr)
+// Validate validates configs in rootpath, streaming Terraform's output
+// into given writers (stdout/stderr of RT if nil)
+func Validate(rootpath string, stdoutW, stderrW io.Writer) (*CmdOutput, error) {
+	out, err := Cmd("validate", []string{}, rootpath, stdoutW, stderrW)
 	if err != nil {
 		return nil, err
 	}
@@ -366,103 +370,53 @@ func Validate(rootpath string) (*CmdOutput, error) {
 
 }
 
+// Cmd runs a given Terraform command in basePath through the current
+// executor (see SetExecutor), streaming its output into given writers
+// while also capturing it.
+// It's safe to run multiple commands concurrently (in different paths).
 func Cmd(cmdName string, args []string, basePath string, stdoutW, stderrW io.Writer) (*CmdOutput, error) {
-	workDir, err := os.Getwd()
+	fi, err := os.Stat(basePath)
 	if err != nil {
 		return nil, err
 	}
-	os.Chdir(basePath)
-	defer os.Chdir(workDir)
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%q is not a directory", basePath)
+	}
 
-	streamedUi := new(ui.StreamedUi)
-	streamedUi.OutputWriter = stdoutW
-	streamedUi.ErrorWriter = stderrW
+	if stdoutW == nil {
+		stdoutW = os.Stdout
+	}
+	if stderrW == nil {
+		stderrW = os.Stderr
+	}
 
+	// Buffers are only written by the subprocess' output
+	// and read after it finished, so these need no locking
+	var stdoutBuf, stderrBuf bytes.Buffer
 	meta := Meta{
-		Ui:    streamedUi,
-		Color: true,
-	}
-
-	commands := map[string]m_cli.Command{
-		"apply": &ApplyCommand{
-			TfCommand{Meta: meta}},
-		"get": &GetCommand{
-			TfCommand{Meta: meta}},
-		"output": &OutputCommand{
-			TfCommand{Meta: meta}},
-		"plan": &PlanCommand{
-			TfCommand{Meta: meta}},
-		"init": &InitCommand{
-			TfCommand{Meta: meta}},
-		"state": &StateCommand{
-			TfCommand{Meta: meta}},
-		"destroy": &DestroyCommand{
-			TfCommand{Meta: meta}},
-		"taint": &TaintCommand{
-			TfCommand{Meta: meta}},
-		"untaint": &UntaintCommand{
-			TfCommand{Meta: meta}},
-		"validate": &ValidateCommand{
-			TfCommand{Meta: meta}},
-	}
-
-	cmd, ok := commands[cmdName]
-	if !ok {
-		return nil, fmt.Errorf("Unknown Terraform command: %s", cmdName)
+		Color:  true,
+		Dir:    basePath,
+		Stdout: io.MultiWriter(stdoutW, &stdoutBuf),
+		Stderr: io.MultiWriter(stderrW, &stderrBuf),
 	}
 
 	log.Printf("[DEBUG] Executing: terraform %s %q in path %s", cmdName, args, basePath)
-	exitCode := cmd.Run(args)
-	bufferedStdout := streamedUi.OutputBuffer.String()
-	bufferedStderr := streamedUi.ErrorBuffer.String()
-	streamedUi.FlushBuffers()
-	streamedUi.OutputBuffer.Reset()
-	streamedUi.ErrorBuffer.Reset()
+	exitCode, err := executor.Run(cmdName, args, meta)
+	if err != nil {
+		return nil, err
+	}
+	stdout := stdoutBuf.String()
 
-	warns := parseOutWarnings(bufferedStdout)
+	warns := parseOutWarnings(stdout)
 
 	return &CmdOutput{
-		Stdout:   bufferedStdout,
-		Stderr:   bufferedStderr,
+		Stdout:   stdout,
+		Stderr:   stderrBuf.String(),
 		ExitCode: exitCode,
 		Warnings: warns,
 	}, nil
 }
 
-func parseDiffFromPlanOutput(output string) (planDiff *PlanResourceDiff, err error) {
-	sumsRegexp := regexp.MustCompile(
-		"Plan:[^ ]{0,6} " + // Coloring
-			"([0-9]+) to add, ([0-9]+) to change, ([0-9]+) to destroy.")
-	matches := sumsRegexp.FindStringSubmatch(output)
-
-	if matches == nil {
-		return &PlanResourceDiff{
-			ToCreate: 0,
-			ToChange: 0,
-			ToRemove: 0,
-		}, nil
-	}
-
-	toCreate, err := strconv.ParseInt(matches[1], 0, 0)
-	if err != nil {
-		return
-	}
-	toChange, err := strconv.ParseInt(matches[2], 0, 0)
-	if err != nil {
-		return
-	}
-	toRemove, err := strconv.ParseInt(matches[3], 0, 0)
-	if err != nil {
-		return
-	}
-
-	return &PlanResourceDiff{
-		ToCreate: int(toCreate),
-		ToChange: int(toChange),
-		ToRemove: int(toRemove),
-	}, nil
-}
-
 func parseDiffFromApplyOutput(output string) (*ResourceDiff, error) {
 	re := regexp.MustCompile("(?:Apply|Destroy) complete! Resources: " +
 		"(([0-9]+) added, )?(([0-9]+) changed, )?([0-9]+) destroyed.")
@@ -514,37 +468,6 @@ func parseOutWarnings(input string) []string {
 	return warnings
 }
 
-func parseOutputsFromApplyOutput(input string) map[string]string {
-	outputs := make(map[string]string, 0)
-	re := regexp.MustCompile("(?s)Outputs:\n\n(.+)\\[0m\n")
-	matches := re.FindStringSubmatch(input)
-	if len(matches) == 2 {
-		lines := strings.Split(matches[1], "\n")
-		for _, l := range lines {
-			m := strings.Split(l, " = ")
-			if len(m) != 2 {
-				// Skip anything that's not parseable (map, list)
-				continue
-			}
-			trimmedKey := strings.TrimSpace(m[0])
-			if m[0] != trimmedKey {
-				// Skip elements of a map (those are indented)
-				continue
-			}
-			v := strings.TrimSpace(m[1])
-			if v == "{" || v == "[" {
-				// Skip anything that looks like a map or list
-				log.Printf("[WARN] Parser is skipping %q because it looks like a list or map", m[0])
-				continue
-			}
-
-			key, value := trimmedKey, v
-			outputs[key] = value
-		}
-	}
-	return outputs
-}
-
 func GetRemoteStateForApp(rs *RemoteState, namespace, appName string) (*RemoteState, error) {
 	if rs.Backend == "s3" {
 		rs.Config["key"] = fmt.Sprintf("%s/%s/terraform.tfstate", namespace, appName)
@@ -6,8 +6,14 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/MeredithCorpOSS/ape-dev-rt/rt"
 )
 
 func TestPlan(t *testing.T) {
@@ -68,6 +74,14 @@ Path: %s
 			ToRemove: 0,
 		},
 	}
+
+	// Values of planned resources depend on the AWS provider version
+	changes := out.Diff.Changes
+	if len(changes) != 1 || changes[0].Address != "aws_sns_topic.s" || changes[0].Action != ActionCreate {
+		t.Fatalf("Unexpected planned changes: %#v", changes)
+	}
+	out.Diff.Changes = nil
+
 	if !reflect.DeepEqual(*out, *expectedOut) {
 		t.Fatalf("Plan output doesn't match.\nGiven:    %#v\nExpected: %#v\n",
 			*out, *expectedOut)
@@ -142,7 +156,7 @@ yololo = yada[0m
 			Removed: 0,
 		},
 		ExitCode: 0,
-		Outputs: map[string]string{
+		Outputs: Outputs{
 			"yololo": "yada",
 		},
 		Warnings: []string{},
@@ -190,6 +204,14 @@ output "alpha" {
 output "static" {
   value = "yololo"
 }
+output "list" {
+  value = ["one-${var.one}", "two-${var.two}"]
+}
+output "map" {
+  value = {
+    one = var.one
+  }
+}
 `
 	tmpDir, _ := createTempTerraformEnv(cfg, t)
 	defer os.RemoveAll(tmpDir)
@@ -211,9 +233,11 @@ output "static" {
 	if err != nil {
 		t.Fatal(err)
 	}
-	expectedOutputs := map[string]string{
+	expectedOutputs := Outputs{
 		"alpha":  "one-aaa,two-bbb",
 		"static": "yololo",
+		"list":   []interface{}{"one-aaa", "two-bbb"},
+		"map":    map[string]interface{}{"one": "aaa"},
 	}
 	if !reflect.DeepEqual(outputs, expectedOutputs) {
 		t.Fatalf("Unexpected outputs.\nGiven:    %#v\nExpected: %#v\n", outputs, expectedOutputs)
@@ -254,135 +278,367 @@ func TestGet(t *testing.T) {
 	// TODO
 }
 
-func createTempTerraformEnv(content string, t *testing.T) (string, string) {
-	profileName := os.Getenv("RT_ACC_AWS_PROFILE")
-	if profileName == "" {
-		t.Skip("Please set AWS profile name (RT_ACC_AWS_PROFILE)")
-	}
+func TestCmd_concurrent(t *testing.T) {
+	tearDown := testFakeTerraform(t)
+	defer tearDown()
 
-	tmpDir := path.Join(os.TempDir(), "tf-test")
-	err := os.Mkdir(tmpDir, 0755)
+	workDir, err := os.Getwd()
 	if err != nil {
 		t.Fatal(err)
 	}
-	f, err := os.Create(path.Join(tmpDir, "test.tf"))
-	if err != nil {
-		t.Fatalf("Failed creating temp file: %s", err)
+
+	dirs := make([]string, 10)
+	for i := range dirs {
+		dir, err := ioutil.TempDir("", "tf-cmd")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		dirs[i], err = filepath.EvalSymlinks(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
 	}
-	_, err = f.WriteString(content)
+
+	outputs := make([]*CmdOutput, len(dirs))
+	errs := make([]error, len(dirs))
+	var wg sync.WaitGroup
+	for i, dir := range dirs {
+		wg.Add(1)
+		go func(i int, dir string) {
+			defer wg.Done()
+			outputs[i], errs[i] = Cmd("state", []string{"list"}, dir, ioutil.Discard, ioutil.Discard)
+		}(i, dir)
+	}
+	wg.Wait()
+
+	for i, dir := range dirs {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if strings.TrimSpace(outputs[i].Stdout) != dir || outputs[i].ExitCode != 0 {
+			t.Fatalf("Expected terraform to run in %q, given: %#v", dir, outputs[i])
+		}
+	}
+
+	cwd, err := os.Getwd()
 	if err != nil {
-		t.Fatalf("Failed saving temp config: %s", err)
+		t.Fatal(err)
+	}
+	if cwd != workDir {
+		t.Fatalf("Expected working directory to stay %q, given: %q", workDir, cwd)
 	}
-	return tmpDir, profileName
 }
 
-func TestParseSumsFromPlanOutput_add(t *testing.T) {
-	testOutput := `yada yada yada o834u984 (*£@&*£@)*
+func TestCmd_exitCode(t *testing.T) {
+	tearDown := testFakeTerraform(t)
+	defer tearDown()
 
-    Plan: 1 to add, 0 to change, 0 to destroy.
-`
+	dir, err := ioutil.TempDir("", "tf-cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
 
-	expectedDiff := &PlanResourceDiff{
-		ToCreate: 1,
-		ToChange: 0,
-		ToRemove: 0,
+	out, err := Cmd("apply", []string{}, dir, ioutil.Discard, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.ExitCode != 3 || out.Stderr != "apply failed\n" {
+		t.Fatalf("Expected exit code 3 & stderr, given: %#v", out)
 	}
 
-	actualDiff, err := parseDiffFromPlanOutput(testOutput)
+	// Output goes to stdout/stderr of RT when no writers are given
+	out, err = Cmd("apply", []string{}, dir, nil, nil)
 	if err != nil {
-		t.Fatalf("Unexpected error: %q", err.Error())
+		t.Fatal(err)
 	}
-	if !reflect.DeepEqual(expectedDiff, actualDiff) {
-		t.Fatalf("Sums don't match. Expected: %#v\nGiven: %#v",
-			expectedDiff, actualDiff)
+	if out.ExitCode != 3 || out.Stderr != "apply failed\n" {
+		t.Fatalf("Expected exit code 3 & stderr, given: %#v", out)
 	}
-}
 
-func TestParseSumsFromPlanOutput_change(t *testing.T) {
-	testOutput := `yada yada yada o834u984 (*£@&*£@)*
+	_, err = Cmd("apply", []string{}, path.Join(dir, "non-existent"), ioutil.Discard, ioutil.Discard)
+	if err == nil {
+		t.Fatal("Expected error for non-existent path")
+	}
+}
 
-    Plan: 0 to add, 45 to change, 0 to destroy.
-`
+func TestInterruptRunning(t *testing.T) {
+	tearDown := testFakeTerraform(t)
+	defer tearDown()
 
-	expectedDiff := &PlanResourceDiff{
-		ToCreate: 0,
-		ToChange: 45,
-		ToRemove: 0,
+	dir, err := ioutil.TempDir("", "tf-cmd")
+	if err != nil {
+		t.Fatal(err)
 	}
+	defer os.RemoveAll(dir)
+
+	type result struct {
+		out *CmdOutput
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		out, err := Cmd("destroy", []string{}, dir, ioutil.Discard, ioutil.Discard)
+		done <- result{out, err}
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		running.Lock()
+		n := len(running.cmds)
+		running.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for terraform to start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Give the script a moment to set up its trap
+	time.Sleep(200 * time.Millisecond)
+	InterruptRunning()
 
-	actualDiff, err := parseDiffFromPlanOutput(testOutput)
-	if err != nil {
-		t.Fatalf("Unexpected error: %q", err.Error())
+	select {
+	case r := <-done:
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		if r.out.ExitCode != 130 || r.out.Stderr != "destroy interrupted\n" {
+			t.Fatalf("Expected terraform to be interrupted, given: %#v", r.out)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for terraform to stop")
 	}
-	if !reflect.DeepEqual(expectedDiff, actualDiff) {
-		t.Fatalf("Sums don't match. Expected: %#v\nGiven: %#v",
-			expectedDiff, actualDiff)
+
+	running.Lock()
+	defer running.Unlock()
+	if len(running.cmds) != 0 {
+		t.Fatalf("Expected no running commands, given %d", len(running.cmds))
 	}
 }
 
-func TestParseSumsFromPlanOutput_destroy(t *testing.T) {
-	testOutput := `yada yada yada o834u984 (*£@&*£@)*
+// testFakeTerraform puts a fake terraform binary in PATH
+// which prints its working directory (or fails on apply,
+// or runs destroy until interrupted)
+func testFakeTerraform(t *testing.T) func() {
+	binDir, err := ioutil.TempDir("", "tf-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := fmt.Sprintf(`#!/bin/sh
+case "$1" in
+  version) echo "Terraform v%s" ;;
+  apply) echo "apply failed" >&2; exit 3 ;;
+  destroy) trap 'echo "destroy interrupted" >&2; exit 130' INT
+    while true; do sleep 0.1; done ;;
+  *) pwd -P ;;
+esac
+`, rt.TerraformVersion)
+	err = ioutil.WriteFile(path.Join(binDir, "terraform"), []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-    Plan: 0 to add, 0 to change, 8 to destroy.
-`
+	origPath := os.Getenv("PATH")
+	os.Setenv("PATH", binDir+string(os.PathListSeparator)+origPath)
+	return func() {
+		os.Setenv("PATH", origPath)
+		os.RemoveAll(binDir)
+	}
+}
 
-	expectedDiff := &PlanResourceDiff{
-		ToCreate: 0,
-		ToChange: 0,
-		ToRemove: 8,
+func createTempTerraformEnv(content string, t *testing.T) (string, string) {
+	profileName := os.Getenv("RT_ACC_AWS_PROFILE")
+	if profileName == "" {
+		t.Skip("Please set AWS profile name (RT_ACC_AWS_PROFILE)")
 	}
 
-	actualDiff, err := parseDiffFromPlanOutput(testOutput)
+	tmpDir := path.Join(os.TempDir(), "tf-test")
+	err := os.Mkdir(tmpDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path.Join(tmpDir, "test.tf"))
 	if err != nil {
-		t.Fatalf("Unexpected error: %q", err.Error())
+		t.Fatalf("Failed creating temp file: %s", err)
 	}
-	if !reflect.DeepEqual(expectedDiff, actualDiff) {
-		t.Fatalf("Sums don't match. Expected: %#v\nGiven: %#v",
-			expectedDiff, actualDiff)
+	_, err = f.WriteString(content)
+	if err != nil {
+		t.Fatalf("Failed saving temp config: %s", err)
 	}
+	return tmpDir, profileName
 }
 
-func TestParseSumsFromPlanOutput_combined(t *testing.T) {
-	testOutput := `yada yada yada o834u984 (*£@&*£@)*
-
-    Plan: 11 to add, 23 to change, 9 to destroy.
-`
+func TestParseDiffFromPlanJSON(t *testing.T) {
+	planJSON := `{
+  "format_version": "0.1",
+  "terraform_version": "0.12.29",
+  "resource_changes": [
+    {
+      "address": "aws_sns_topic.s",
+      "mode": "managed",
+      "type": "aws_sns_topic",
+      "name": "s",
+      "change": {"actions": ["create"], "before": null, "after": {"name": "tf-test-umarsticks"}}
+    },
+    {
+      "address": "aws_iam_user.u",
+      "mode": "managed",
+      "type": "aws_iam_user",
+      "name": "u",
+      "change": {"actions": ["update"], "before": {"path": "/"}, "after": {"path": "/rt/"}}
+    },
+    {
+      "address": "aws_instance.web",
+      "mode": "managed",
+      "type": "aws_instance",
+      "name": "web",
+      "change": {
+        "actions": ["create", "delete"],
+        "before": {"ami": "ami-1"},
+        "after": {"ami": "ami-2"},
+        "before_sensitive": {},
+        "after_sensitive": {}
+      }
+    },
+    {
+      "address": "aws_s3_bucket.old",
+      "mode": "managed",
+      "type": "aws_s3_bucket",
+      "name": "old",
+      "change": {
+        "actions": ["delete"],
+        "before": {"bucket": "old"},
+        "after": null,
+        "before_sensitive": {},
+        "after_sensitive": false
+      }
+    },
+    {
+      "address": "aws_ssm_parameter.secret",
+      "mode": "managed",
+      "type": "aws_ssm_parameter",
+      "name": "secret",
+      "change": {
+        "actions": ["update"],
+        "before": {"name": "secret", "value": "old"},
+        "after": {"name": "secret", "value": "new"},
+        "before_sensitive": {"value": true},
+        "after_sensitive": {"value": true}
+      }
+    },
+    {
+      "address": "aws_vpc.main",
+      "mode": "managed",
+      "type": "aws_vpc",
+      "name": "main",
+      "change": {"actions": ["no-op"], "before": {"id": "vpc-1"}, "after": {"id": "vpc-1"}}
+    },
+    {
+      "address": "data.aws_ami.latest",
+      "mode": "data",
+      "type": "aws_ami",
+      "name": "latest",
+      "change": {"actions": ["read"], "before": null, "after": {}}
+    }
+  ]
+}`
 
+	// Values are left out by default
+	diff, err := parseDiffFromPlanJSON([]byte(planJSON), false)
+	if err != nil {
+		t.Fatal(err)
+	}
 	expectedDiff := &PlanResourceDiff{
-		ToCreate: 11,
-		ToChange: 23,
-		ToRemove: 9,
+		ToCreate: 2,
+		ToChange: 2,
+		ToRemove: 2,
+		Changes: []*ResourceChange{
+			{Address: "aws_iam_user.u", Type: "aws_iam_user", Action: ActionUpdate},
+			{Address: "aws_instance.web", Type: "aws_instance", Action: ActionReplace},
+			{Address: "aws_s3_bucket.old", Type: "aws_s3_bucket", Action: ActionDelete},
+			{Address: "aws_sns_topic.s", Type: "aws_sns_topic", Action: ActionCreate},
+			{Address: "aws_ssm_parameter.secret", Type: "aws_ssm_parameter", Action: ActionUpdate},
+		},
+	}
+	if !reflect.DeepEqual(diff, expectedDiff) {
+		t.Fatalf("Unexpected diff.\nGiven:    %#v\nExpected: %#v\n", diff, expectedDiff)
 	}
 
-	actualDiff, err := parseDiffFromPlanOutput(testOutput)
+	// Values are kept only for changes which mark sensitive values (Terraform 0.14+)
+	diff, err = parseDiffFromPlanJSON([]byte(planJSON), true)
 	if err != nil {
-		t.Fatalf("Unexpected error: %q", err.Error())
+		t.Fatal(err)
 	}
-	if !reflect.DeepEqual(expectedDiff, actualDiff) {
-		t.Fatalf("Sums don't match. Expected: %#v\nGiven: %#v",
-			expectedDiff, actualDiff)
+	expectedDiff = &PlanResourceDiff{
+		ToCreate: 2,
+		ToChange: 2,
+		ToRemove: 2,
+		Changes: []*ResourceChange{
+			{
+				Address: "aws_iam_user.u",
+				Type:    "aws_iam_user",
+				Action:  ActionUpdate,
+			},
+			{
+				Address: "aws_instance.web",
+				Type:    "aws_instance",
+				Action:  ActionReplace,
+				Before:  map[string]interface{}{"ami": "ami-1"},
+				After:   map[string]interface{}{"ami": "ami-2"},
+			},
+			{
+				Address: "aws_s3_bucket.old",
+				Type:    "aws_s3_bucket",
+				Action:  ActionDelete,
+				Before:  map[string]interface{}{"bucket": "old"},
+			},
+			{
+				Address: "aws_sns_topic.s",
+				Type:    "aws_sns_topic",
+				Action:  ActionCreate,
+			},
+			{
+				Address: "aws_ssm_parameter.secret",
+				Type:    "aws_ssm_parameter",
+				Action:  ActionUpdate,
+				Before:  map[string]interface{}{"name": "secret", "value": SensitiveValue},
+				After:   map[string]interface{}{"name": "secret", "value": SensitiveValue},
+			},
+		},
+	}
+	if !reflect.DeepEqual(diff, expectedDiff) {
+		t.Fatalf("Unexpected diff with values.\nGiven:    %#v\nExpected: %#v\n", diff, expectedDiff)
 	}
 }
 
-func TestParseSumsFromPlanOutput_noChanges(t *testing.T) {
-	testOutput := `No changes. Infrastructure is up-to-date. This means that Terraform
-could not detect any differences between your configuration and
-the real physical resources that exist. As a result, Terraform
-doesn't need to do anything.
-`
-
-	actualDiff, err := parseDiffFromPlanOutput(testOutput)
+func TestParseDiffFromPlanJSON_noChanges(t *testing.T) {
+	diff, err := parseDiffFromPlanJSON([]byte(`{"format_version": "0.1", "terraform_version": "0.12.29"}`), true)
 	if err != nil {
-		t.Fatalf("Unexpected error: %q", err.Error())
+		t.Fatal(err)
 	}
-	if actualDiff.ToChange != 0 {
-		t.Fatalf("Unexpected ToChange: %d, expected zero", actualDiff.ToChange)
+	if diff.ToCreate+diff.ToChange+diff.ToRemove != 0 || len(diff.Changes) != 0 {
+		t.Fatalf("Expected no changes, given: %#v", diff)
 	}
-	if actualDiff.ToCreate != 0 {
-		t.Fatalf("Unexpected ToCreate: %d, expected zero", actualDiff.ToCreate)
+}
+
+func TestParseDiffFromPlanJSON_invalid(t *testing.T) {
+	cases := []string{
+		// Not JSON
+		"\x1b[0m\x1b[1mPlan:\x1b[0m 1 to add, 0 to change, 0 to destroy.\x1b[0m",
+		// Not a plan
+		`{"values": {}}`,
+		// Unknown action
+		`{"format_version": "0.1", "resource_changes": [
+			{"address": "a.b", "mode": "managed", "change": {"actions": ["teleport"]}}]}`,
 	}
-	if actualDiff.ToRemove != 0 {
-		t.Fatalf("Unexpected ToRemove: %d, expected zero", actualDiff.ToRemove)
+	for i, c := range cases {
+		_, err := parseDiffFromPlanJSON([]byte(c), true)
+		if err == nil {
+			t.Fatalf("%d: Expected error for invalid plan", i)
+		}
 	}
 }
 
@@ -421,63 +677,78 @@ fix these before continuing.
 	}
 }
 
-func TestParseOutputsFromApplyOutput(t *testing.T) {
-	cases := []struct {
-		Input           string
-		ExpectedOutputs map[string]string
-	}{
-		0: {
-			Input: `
-State path: terraform.tfstate[0m
-[0m[1m[32m
-Outputs:
-
-id = vpc-6cc7f308
-yada = yololo[0m
-`,
-			ExpectedOutputs: map[string]string{
-				"id":   "vpc-6cc7f308",
-				"yada": "yololo",
-			},
-		},
-		1: {
-			Input: `State path: terraform.tfstate[0m
-[0m[1m[32m
-Outputs:
+func TestParseOutputsFromJSON(t *testing.T) {
+	input := `{
+  "app": {"sensitive": false, "type": "string", "value": "umarsticks"},
+  "port": {"sensitive": false, "type": "number", "value": 8080},
+  "subnet_ids": {"sensitive": false, "type": ["list", "string"], "value": ["subnet-1", "subnet-2"]},
+  "tags": {"sensitive": false, "type": ["map", "string"], "value": {"Team": "ape"}},
+  "password": {"sensitive": true, "type": "string", "value": "secret"}
+}`
+	outputs, err := parseOutputsFromJSON([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedOutputs := Outputs{
+		"app":        "umarsticks",
+		"port":       float64(8080),
+		"subnet_ids": []interface{}{"subnet-1", "subnet-2"},
+		"tags":       map[string]interface{}{"Team": "ape"},
+		"password":   SensitiveValue,
+	}
+	if !reflect.DeepEqual(outputs, expectedOutputs) {
+		t.Fatalf("Unexpected outputs.\nGiven:    %#v\nExpected: %#v\n", outputs, expectedOutputs)
+	}
 
-yololo = yada[0m
-`,
-			ExpectedOutputs: map[string]string{
-				"yololo": "yada",
-			},
-		},
-		2: {
-			Input: `Outputs:
-
-mylist = [
-    us-east-1a,
-    us-east-1c,
-    us-east-1d,
-    us-east-1e
-]
-mymap = {
-  one = 111
-  two = 222
-}
-mystring = sdfasdfasdf[0m
-`,
-			ExpectedOutputs: map[string]string{
-				"mystring": "sdfasdfasdf",
-			},
-		},
+	_, err = parseOutputsFromJSON([]byte("app = umarsticks"))
+	if err == nil {
+		t.Fatal("Expected error for non-JSON outputs")
 	}
+}
 
-	for i, c := range cases {
-		outputs := parseOutputsFromApplyOutput(c.Input)
-		if !reflect.DeepEqual(outputs, c.ExpectedOutputs) {
-			t.Fatalf("Case %d: Unexpected outputs parsed out.\nExpected: %#v\nGiven:    %#v\n",
-				i, c.ExpectedOutputs, outputs)
+func TestOutputsLookup(t *testing.T) {
+	outputs := Outputs{
+		"app":        "umarsticks",
+		"subnet_ids": []interface{}{"subnet-1", "subnet-2"},
+		"tags":       map[string]interface{}{"Team": "ape", "Owners": []interface{}{"bob"}},
+	}
+	cases := []struct {
+		Path          string
+		ExpectedValue interface{}
+		ExpectError   bool
+	}{
+		{"app", "umarsticks", false},
+		{"subnet_ids", []interface{}{"subnet-1", "subnet-2"}, false},
+		{"subnet_ids.1", "subnet-2", false},
+		{"tags.Team", "ape", false},
+		{"tags.Owners.0", "bob", false},
+		{"missing", nil, true},
+		{"app.name", nil, true},
+		{"subnet_ids.2", nil, true},
+		{"subnet_ids.first", nil, true},
+		{"tags.Missing", nil, true},
+	}
+	for _, c := range cases {
+		value, err := outputs.Lookup(c.Path)
+		if c.ExpectError {
+			if err == nil {
+				t.Fatalf("%s: Expected error, given: %#v", c.Path, value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", c.Path, err)
 		}
+		if !reflect.DeepEqual(value, c.ExpectedValue) {
+			t.Fatalf("%s: Expected %#v, given: %#v", c.Path, c.ExpectedValue, value)
+		}
+	}
+
+	if s, ok := outputs.GetString("subnet_ids"); ok {
+		t.Fatalf("Expected list not to be returned as string, given: %q", s)
+	}
+	if FormatOutputValue(outputs["subnet_ids"], "") != `["subnet-1","subnet-2"]` {
+		t.Fatalf("Unexpected formatted list: %s", FormatOutputValue(outputs["subnet_ids"], ""))
 	}
 }
 
@@ -553,7 +824,7 @@ func TestGenerateBackendConfig(t *testing.T) {
 
 func TestCheckTerraform(t *testing.T) {
 	expected := "terraform"
-	tfBinaryPath, err := CheckTerraform()
+	tfBinaryPath, _, err := CheckTerraform("", rt.TerraformVersion)
 	if err != nil {
 		t.Fatal(err)
 	}
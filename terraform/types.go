@@ -27,6 +27,10 @@ type FreshPlanInput struct {
 	Target       string
 	Destroy      bool
 	XLegacy      bool
+
+	// WithValues keeps before/after values of resource changes
+	// (see ShowPlan), these are left out by default
+	WithValues bool
 }
 
 type PlanInput struct {
@@ -39,6 +43,10 @@ type PlanInput struct {
 	Target       string
 	Destroy      bool
 	XLegacy      bool
+
+	// WithValues keeps before/after values of resource changes
+	// (see ShowPlan), these are left out by default
+	WithValues bool
 }
 
 type PlanOutput struct {
@@ -50,9 +58,19 @@ type PlanOutput struct {
 }
 
 type PlanResourceDiff struct {
-	ToCreate int
-	ToRemove int
-	ToChange int
+	ToCreate int               `json:"to_create"`
+	ToRemove int               `json:"to_remove"`
+	ToChange int               `json:"to_change"`
+	Changes  []*ResourceChange `json:"changes"`
+}
+
+// ResourceChange describes planned change of a single resource
+type ResourceChange struct {
+	Address string      `json:"address"`
+	Type    string      `json:"type"`
+	Action  string      `json:"action"`
+	Before  interface{} `json:"before,omitempty"`
+	After   interface{} `json:"after,omitempty"`
 }
 
 type FreshApplyInput struct {
@@ -82,7 +100,7 @@ type ApplyOutput struct {
 	Stdout   string
 	Stderr   string
 	Warnings []string
-	Outputs  map[string]string
+	Outputs  Outputs
 	Diff     *ResourceDiff
 }
 